@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"encoding/gob"
 	"encoding/json"
+	"fmt"
 	"github.com/azd1997/ego/utils"
 	"github.com/pkg/errors"
 	"io/ioutil"
@@ -34,8 +35,8 @@ func NewAccount(roleNo uint8) (*Account, error) {
 }
 
 // LoadOrCreateAccount 从指定路径加载账户，加载不到就新建
-func LoadOrCreateAccount(accountFile string) (acc *Account, err error) {
-	acc = &Account{}
+// storeType为StoreKeystore时，新建的账户以keystore保存，已有的明文账户文件迁移为keystore，口令由passphrase获取
+func LoadOrCreateAccount(accountFile string, storeType int, passphrase PassphraseFunc) (acc *Account, err error) {
 	// 1.1. 加载selfAccount文件，取账户文件
 	// 1.1.1 检查是否存在账户文件
 	exists, err := utils.FileExists(accountFile)
@@ -43,50 +44,89 @@ func LoadOrCreateAccount(accountFile string) (acc *Account, err error) {
 		return nil, err
 	}
 
-	jsonSuffix := strings.HasSuffix(accountFile, ".json")
-
-	// 若不存在，则需要创建一个账户并保存到这个文件
-	if !exists {
-		log.Printf("默认路径下找不到指定账户文件: %s", accountFile)
-		log.Println("准备创建新账户......")
-		acc, err = NewAccount(0)
-		//fmt.Println("78910")
-		if err != nil {
+	// 若存在，则从这个文件读取account
+	if exists {
+		log.Println("指定路径下发现账户文件， 准备加载......")
+		if acc, err = LoadAccount(accountFile, storeType, passphrase); err != nil {
 			return nil, err
 		}
+		log.Printf("账户加载成功， 账户ID: %s", acc.UserId())
+		return acc, nil
+	}
 
-		if jsonSuffix {
-			err = acc.SaveFileWithJsonEncode(accountFile)
-		} else {
-			err = acc.SaveFileWithGobEncode(accountFile)
-		}
+	// 若不存在，则需要创建一个账户并保存到这个文件
+	log.Printf("默认路径下找不到指定账户文件: %s", accountFile)
+	log.Println("准备创建新账户......")
+	if acc, err = NewAccount(0); err != nil {
+		return nil, err
+	}
+	if err = acc.SaveFile(accountFile, storeType, passphrase); err != nil {
+		return nil, err
+	}
+	log.Printf("新账户创建成功并保存至默认路径， 账户ID: %s", acc.UserId())
+
+	return acc, nil
+}
+
+// LoadAccount 从账户文件加载账户。keystore文件使用口令解密，明文文件按后缀以json或gob解码
+// storeType为StoreKeystore而文件为明文时，将其迁移为keystore（原文件被替换）
+func LoadAccount(accountFile string, storeType int, passphrase PassphraseFunc) (*Account, error) {
+	data, err := ioutil.ReadFile(accountFile)
+	if err != nil {
+		return nil, errors.Wrap(err, "LoadAccount")
+	}
 
-		//fmt.Println("123456")
+	acc := &Account{}
+	if IsKeystore(data) {
+		pass, err := passphrase(false)
 		if err != nil {
 			return nil, err
 		}
-		log.Printf("新账户创建成功并保存至默认路径， 账户ID: %s", acc.UserId())
+		if err = acc.LoadFileWithKeystore(accountFile, pass); err != nil {
+			return nil, err
+		}
+		return acc, nil
+	}
+
+	if strings.HasSuffix(accountFile, ".json") {
+		err = acc.LoadFileWithJsonDecode(accountFile)
 	} else {
-		// 若存在，则从这个文件读取account
-		log.Println("指定路径下发现账户文件， 准备加载......")
+		err = acc.LoadFileWithGobDecode(accountFile) // 只要不是json后缀，都以gob编码
+	}
+	if err != nil {
+		return nil, err
+	}
 
-		jsonSuffix := strings.HasSuffix(accountFile, ".json")
-		if jsonSuffix {
-			err = acc.LoadFileWithJsonDecode(accountFile)
-		} else {
-			err = acc.LoadFileWithGobDecode(accountFile)	// 只要不是json后缀，都以gob编码
+	if storeType == StoreKeystore {
+		log.Printf("账户文件 %s 为明文存储，迁移为加密存储，请设置口令", accountFile)
+		if err = acc.SaveFile(accountFile, StoreKeystore, passphrase); err != nil {
+			return nil, errors.Wrap(err, "migrate account file")
 		}
+		log.Printf("账户文件已迁移为加密存储: %s", accountFile)
+	}
+	return acc, nil
+}
 
+// SaveFile 按存储形式保存到文件。明文按后缀以json或gob编码；keystore的口令由passphrase获取（需确认）
+func (a *Account) SaveFile(file string, storeType int, passphrase PassphraseFunc) error {
+	switch storeType {
+	case StorePlain:
+		if strings.HasSuffix(file, ".json") {
+			return a.SaveFileWithJsonEncode(file)
+		}
+		return a.SaveFileWithGobEncode(file)
+	case StoreKeystore:
+		pass, err := passphrase(true)
 		if err != nil {
-			return nil, err
+			return err
 		}
-		log.Printf("账户加载成功， 账户ID: %s", acc.UserId())
+		return a.SaveFileWithKeystore(file, pass)
+	default:
+		return fmt.Errorf("unknown account store type %d", storeType)
 	}
-
-	return acc, nil
 }
 
-// TODO: 待解决的问题：多个账户文件在同一个目录下怎么去选取。目前的做法是只读取指定文件名的账户文件。但如果要考虑多个账户呢？
+// 多个账户文件放在同一个目录下时，使用钱包目录（见Wallet）按账户名或ID选取
 
 
 ///////////////////////////////////////////////////////////////////////////////////
@@ -13,4 +13,9 @@ var (
 	ErrNotRoleA = errors.New("not A type of role")
 	ErrNotRoleB = errors.New("not B type of role")
 	ErrUnmatchedRole = errors.New("unmatched role")
+
+	// 口令相关
+	ErrWrongPassphrase = errors.New("wrong passphrase or corrupted keystore")
+	ErrEmptyPassphrase = errors.New("empty passphrase")
+	ErrPassphraseMismatch = errors.New("passphrases do not match")
 )
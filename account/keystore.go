@@ -0,0 +1,230 @@
+package account
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/pkg/errors"
+	"golang.org/x/crypto/scrypt"
+
+	"github.com/azd1997/ecoin/common/crypto"
+	"github.com/azd1997/ecoin/common/encoding"
+	"github.com/azd1997/ecoin/common/utils"
+)
+
+// 加密的账户文件（keystore）
+// 私钥使用AES-256-GCM加密，密钥由口令经scrypt派生。账户ID以明文记录，并作为GCM的附加数据参与认证，
+// 这样不需要口令也能识别账户文件，且ID被篡改时解密失败。
+// keystore统一以json编码，与文件后缀无关；加载时根据内容区分keystore与旧的明文账户文件
+
+const (
+	keystoreVersion = 1
+	keystoreCipher  = "aes-256-gcm"
+	keystoreKDF     = "scrypt"
+
+	// StandardScryptN StandardScryptP 默认的scrypt参数，在普通机器上派生一次约需1秒
+	StandardScryptN = 1 << 18
+	StandardScryptP = 1
+
+	scryptR       = 8
+	scryptKeyLen  = 32
+	scryptSaltLen = 32
+)
+
+// 保存keystore文件时使用的scrypt参数
+var fileScryptN, fileScryptP = StandardScryptN, StandardScryptP
+
+// 账户文件的存储形式
+const (
+	StorePlain    = 0 // 明文（json或gob，按后缀区分）
+	StoreKeystore = 1 // 以口令加密的keystore
+)
+
+type keystore struct {
+	Version int            `json:"version"`
+	ID      string         `json:"id"` // hex(UserId)，其中包含角色编号
+	Crypto  keystoreCrypto `json:"crypto"`
+}
+
+type keystoreCrypto struct {
+	Cipher     string       `json:"cipher"`
+	CipherText string       `json:"ciphertext"` // hex
+	Nonce      string       `json:"nonce"`      // hex
+	KDF        string       `json:"kdf"`
+	KDFParams  scryptParams `json:"kdfparams"`
+}
+
+type scryptParams struct {
+	N      int    `json:"n"`
+	R      int    `json:"r"`
+	P      int    `json:"p"`
+	KeyLen int    `json:"keylen"`
+	Salt   string `json:"salt"` // hex
+}
+
+// EncryptKey 使用口令加密账户，得到keystore编码。scryptN、scryptP一般取StandardScryptN、StandardScryptP
+func (a *Account) EncryptKey(passphrase string, scryptN, scryptP int) ([]byte, error) {
+	salt := make([]byte, scryptSaltLen)
+	if _, err := io.ReadFull(rand.Reader, salt); err != nil {
+		return nil, errors.Wrap(err, "Account_EncryptKey")
+	}
+	derived, err := scrypt.Key([]byte(passphrase), salt, scryptN, scryptR, scryptP, scryptKeyLen)
+	if err != nil {
+		return nil, errors.Wrap(err, "Account_EncryptKey")
+	}
+	gcm, err := newGCM(derived)
+	if err != nil {
+		return nil, errors.Wrap(err, "Account_EncryptKey")
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return nil, errors.Wrap(err, "Account_EncryptKey")
+	}
+
+	id := a.UserId()
+	ks := &keystore{
+		Version: keystoreVersion,
+		ID:      id.ToHex(),
+		Crypto: keystoreCrypto{
+			Cipher:     keystoreCipher,
+			CipherText: encoding.ToHex(gcm.Seal(nil, nonce, a.PrivateKey.Serialize(), []byte(id))),
+			Nonce:      encoding.ToHex(nonce),
+			KDF:        keystoreKDF,
+			KDFParams: scryptParams{
+				N:      scryptN,
+				R:      scryptR,
+				P:      scryptP,
+				KeyLen: scryptKeyLen,
+				Salt:   encoding.ToHex(salt),
+			},
+		},
+	}
+	return encoding.JsonMarshalIndent(ks)
+}
+
+// DecryptKey 使用口令解密keystore编码得到账户。口令错误时返回ErrWrongPassphrase
+func DecryptKey(data []byte, passphrase string) (*Account, error) {
+	ks := &keystore{}
+	if err := json.Unmarshal(data, ks); err != nil {
+		return nil, errors.Wrap(err, "DecryptKey")
+	}
+	if ks.Version != keystoreVersion || ks.Crypto.Cipher != keystoreCipher || ks.Crypto.KDF != keystoreKDF {
+		return nil, fmt.Errorf("DecryptKey: unsupported keystore version %d (%s, %s)",
+			ks.Version, ks.Crypto.Cipher, ks.Crypto.KDF)
+	}
+
+	idB, err := encoding.FromHex(ks.ID)
+	if err != nil {
+		return nil, errors.Wrap(err, "DecryptKey")
+	}
+	kp := ks.Crypto.KDFParams
+	salt, err := encoding.FromHex(kp.Salt)
+	if err != nil {
+		return nil, errors.Wrap(err, "DecryptKey")
+	}
+	nonce, err := encoding.FromHex(ks.Crypto.Nonce)
+	if err != nil {
+		return nil, errors.Wrap(err, "DecryptKey")
+	}
+	cipherText, err := encoding.FromHex(ks.Crypto.CipherText)
+	if err != nil {
+		return nil, errors.Wrap(err, "DecryptKey")
+	}
+
+	derived, err := scrypt.Key([]byte(passphrase), salt, kp.N, kp.R, kp.P, kp.KeyLen)
+	if err != nil {
+		return nil, errors.Wrap(err, "DecryptKey")
+	}
+	gcm, err := newGCM(derived)
+	if err != nil {
+		return nil, errors.Wrap(err, "DecryptKey")
+	}
+	if len(nonce) != gcm.NonceSize() {
+		return nil, errors.New("DecryptKey: invalid nonce")
+	}
+	privKeyB, err := gcm.Open(nil, nonce, cipherText, idB)
+	if err != nil {
+		return nil, ErrWrongPassphrase
+	}
+
+	id := crypto.ID(idB)
+	acc := (&account{RoleNo: id.RoleNo(), PrivKeyB: privKeyB}).toAccount()
+	if acc == nil || acc.UserId() != id {
+		return nil, errors.New("DecryptKey: keystore mismatches its id")
+	}
+	return acc, nil
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// IsKeystore data是否为keystore编码
+func IsKeystore(data []byte) bool {
+	ks := &keystore{}
+	return json.Unmarshal(data, ks) == nil && ks.Crypto.KDF != "" && ks.Crypto.CipherText != ""
+}
+
+// SaveFileWithKeystore 使用口令加密后保存到文件
+// 先写临时文件再替换，避免覆盖旧文件时中途失败导致账户丢失
+func (a *Account) SaveFileWithKeystore(file string, passphrase string) error {
+	data, err := a.EncryptKey(passphrase, fileScryptN, fileScryptP)
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(file, data)
+}
+
+// LoadFileWithKeystore 从keystore文件中使用口令解密读取
+func (a *Account) LoadFileWithKeystore(file string, passphrase string) error {
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		return errors.Wrap(err, "Account_LoadFile")
+	}
+	acc, err := DecryptKey(data, passphrase)
+	if err != nil {
+		return err
+	}
+	a.PrivateKey = acc.PrivateKey
+	a.RoleNo = acc.RoleNo
+	return nil
+}
+
+func writeFileAtomic(file string, data []byte) error {
+	if err := utils.EnsureDirOfFileExists(file); err != nil {
+		return err
+	}
+	tmp, err := ioutil.TempFile(filepath.Dir(file), filepath.Base(file)+".tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	// 私钥文件只允许本用户读写
+	if err := os.Chmod(tmp.Name(), 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), file)
+}
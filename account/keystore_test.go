@@ -0,0 +1,112 @@
+package account
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// 测试使用较小的scrypt参数
+const (
+	testScryptN = 1 << 12
+	testScryptP = 1
+)
+
+func TestKeystore(t *testing.T) {
+	acc, err := NewAccount(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := acc.EncryptKey("secret", testScryptN, testScryptP)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !IsKeystore(data) {
+		t.Fatal("encrypted key should be a keystore")
+	}
+	acc1, err := DecryptKey(data, "secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if acc1.UserId() != acc.UserId() || acc1.RoleNo != acc.RoleNo {
+		t.Fatalf("decrypted account %s mismatches %s", acc1.UserId(), acc.UserId())
+	}
+	if _, err := DecryptKey(data, "wrong"); err != ErrWrongPassphrase {
+		t.Fatalf("expect ErrWrongPassphrase, but %v", err)
+	}
+
+	// 篡改账户ID导致解密失败
+	other, _ := NewAccount(1)
+	otherData, _ := other.EncryptKey("secret", testScryptN, testScryptP)
+	ks, other1 := &keystore{}, &keystore{}
+	decodeJSON(t, data, ks)
+	decodeJSON(t, otherData, other1)
+	ks.ID = other1.ID
+	if _, err := DecryptKey(encodeJSON(t, ks), "secret"); err == nil {
+		t.Fatal("keystore with tampered id should fail")
+	}
+}
+
+func TestMigrateToKeystore(t *testing.T) {
+	dir, err := ioutil.TempDir("", "keystore")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	fileScryptN, fileScryptP = testScryptN, testScryptP
+	defer func() { fileScryptN, fileScryptP = StandardScryptN, StandardScryptP }()
+
+	passphrase := func(confirm bool) (string, error) { return "secret", nil }
+	for _, name := range []string{"plain.json", "plain.gob"} {
+		file := filepath.Join(dir, name)
+		acc, _ := NewAccount(2)
+		if err := acc.SaveFile(file, StorePlain, passphrase); err != nil {
+			t.Fatal(err)
+		}
+
+		// 明文存储时原样加载，文件不变
+		loaded, err := LoadAccount(file, StorePlain, passphrase)
+		if err != nil || loaded.UserId() != acc.UserId() {
+			t.Fatalf("%s: load plain account failed: %v", name, err)
+		}
+		if data, _ := ioutil.ReadFile(file); IsKeystore(data) {
+			t.Fatalf("%s: plain account should not be migrated", name)
+		}
+
+		// 加密存储时迁移为keystore，之后以口令加载
+		if loaded, err = LoadAccount(file, StoreKeystore, passphrase); err != nil || loaded.UserId() != acc.UserId() {
+			t.Fatalf("%s: migrate account failed: %v", name, err)
+		}
+		data, _ := ioutil.ReadFile(file)
+		if !IsKeystore(data) {
+			t.Fatalf("%s: account should be migrated to keystore", name)
+		}
+		if info, _ := os.Stat(file); info.Mode().Perm() != 0600 {
+			t.Fatalf("%s: keystore mode %v, expect 0600", name, info.Mode().Perm())
+		}
+		if loaded, err = LoadAccount(file, StorePlain, passphrase); err != nil || loaded.UserId() != acc.UserId() {
+			t.Fatalf("%s: load keystore failed: %v", name, err)
+		}
+		wrong := func(confirm bool) (string, error) { return "wrong", nil }
+		if _, err = LoadAccount(file, StoreKeystore, wrong); err != ErrWrongPassphrase {
+			t.Fatalf("%s: expect ErrWrongPassphrase, but %v", name, err)
+		}
+	}
+}
+
+func decodeJSON(t *testing.T, data []byte, v interface{}) {
+	if err := json.Unmarshal(data, v); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func encodeJSON(t *testing.T, v interface{}) []byte {
+	data, err := json.Marshal(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
@@ -0,0 +1,62 @@
+package account
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+
+	"golang.org/x/crypto/ssh/terminal"
+)
+
+// PassphraseEnv 设置了该环境变量时，直接以其值作为账户口令，不再提示输入（用于以服务方式运行的节点）
+const PassphraseEnv = "ECOIN_PASSPHRASE"
+
+// PassphraseFunc 获取账户口令。confirm为true时（新建或迁移账户文件）需要二次确认
+type PassphraseFunc func(confirm bool) (string, error)
+
+// PromptPassphrase 从环境变量PassphraseEnv读取口令；未设置时从终端读取（不回显），非终端时从标准输入读取一行
+func PromptPassphrase(confirm bool) (string, error) {
+	if pass, ok := os.LookupEnv(PassphraseEnv); ok {
+		return pass, nil
+	}
+
+	pass, err := readPassphrase("Passphrase: ")
+	if err != nil {
+		return "", err
+	}
+	if pass == "" {
+		return "", ErrEmptyPassphrase
+	}
+	if confirm {
+		again, err := readPassphrase("Repeat passphrase: ")
+		if err != nil {
+			return "", err
+		}
+		if again != pass {
+			return "", ErrPassphraseMismatch
+		}
+	}
+	return pass, nil
+}
+
+var stdinReader = bufio.NewReader(os.Stdin)
+
+func readPassphrase(prompt string) (string, error) {
+	fd := int(os.Stdin.Fd())
+	if terminal.IsTerminal(fd) {
+		fmt.Fprint(os.Stderr, prompt)
+		pass, err := terminal.ReadPassword(fd)
+		fmt.Fprintln(os.Stderr)
+		if err != nil {
+			return "", fmt.Errorf("read passphrase failed: %v", err)
+		}
+		return string(pass), nil
+	}
+
+	line, err := stdinReader.ReadString('\n')
+	if err != nil && line == "" {
+		return "", fmt.Errorf("read passphrase failed: %v", err)
+	}
+	return strings.TrimRight(line, "\r\n"), nil
+}
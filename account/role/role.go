@@ -1,6 +1,10 @@
 package role
 
-import "github.com/azd1997/ecoin/common"
+import (
+	"math"
+
+	"github.com/azd1997/ecoin/common"
+)
 
 
 // 实际使用的Role需在区块链各个版本的客户端软件配置文件中指定。这里只定义基本的格式
@@ -49,5 +53,107 @@ func (r *Role) GenesisReward() common.Coin {
 	return r.GenesisRewardField
 }
 
+// MaxReward 出块奖励的上限。奖励由每个验证者独立计算并检查，因此全部使用整数运算，
+// 保证不同平台的节点得到相同的结果；中间结果超出范围时取上限（饱和）
+const MaxReward = math.MaxUint32
+
+// Reward 高度为height的区块的出块奖励
+// 创世区块（高度为1）奖励GenesisReward；其余区块奖励CoinbaseReward，
+// 开启ks/es时再加上增长多项式 f(height) = Σ ks[i] * height^es[i]，结果在[0, MaxReward]之间。
+// 负指数项按整数除法计算，即 ks[i] / height^(-es[i])，向0取整
+func (r *Role) Reward(height uint64) common.Coin {
+	if height <= 1 {
+		return r.GenesisRewardField
+	}
+
+	reward := int64(MaxReward)
+	if uint64(r.CoinbaseRewardField) < MaxReward {
+		reward = int64(r.CoinbaseRewardField)
+	}
+	if r.EnableKsEsField {
+		for i := 0; i < len(r.KsField) && i < len(r.EsField); i++ {
+			reward = clampReward(reward + term(r.KsField[i], height, r.EsField[i]))
+		}
+	}
+	if reward <= 0 {
+		return 0
+	}
+	return common.Coin(reward)
+}
+
+// 增长多项式的一项 k * x^e，绝对值不超过MaxReward
+func term(k int, x uint64, e int) int64 {
+	if k == 0 {
+		return 0
+	}
+	sign, abs := int64(1), uint64(k)
+	if k < 0 {
+		sign, abs = -1, uint64(-int64(k))
+	}
+
+	var mag uint64
+	if e >= 0 {
+		p := powCapped(x, e)
+		if p != 0 && abs > MaxReward/p {
+			mag = MaxReward
+		} else {
+			mag = abs * p
+		}
+	} else {
+		mag = abs / powCapped(x, -e)
+	}
+	if mag > MaxReward {
+		mag = MaxReward
+	}
+	return sign * int64(mag)
+}
+
+// x^e（e >= 0），超过MaxReward时取MaxReward
+func powCapped(x uint64, e int) uint64 {
+	result := uint64(1)
+	for i := 0; i < e; i++ {
+		if x != 0 && result > MaxReward/x {
+			return MaxReward
+		}
+		result *= x
+	}
+	return result
+}
+
+func clampReward(v int64) int64 {
+	if v > MaxReward {
+		return MaxReward
+	}
+	if v < -MaxReward {
+		return -MaxReward
+	}
+	return v
+}
+
+// 各角色的默认配置。A类角色参与出块，有出块奖励；B类角色不能出块，出块奖励只能是0
+var roles = map[No]*Role{
+	HOSPITAL:   {NoField: HOSPITAL, AliasField: "hospital", CoinbaseRewardField: 100, GenesisRewardField: 10000},
+	RESEARCHER: {NoField: RESEARCHER, AliasField: "researcher", CoinbaseRewardField: 100, GenesisRewardField: 10000},
+	PATIENT:    {NoField: PATIENT, AliasField: "patient"},
+	DOCTOR:     {NoField: DOCTOR, AliasField: "doctor"},
+}
+
+// Get 获取角色配置。未知角色返回nil
+func Get(no No) *Role {
+	return roles[no]
+}
+
+// Set 用配置文件中的角色配置覆盖默认配置。只应在节点启动前调用
+// 注意：同一网络中所有节点的角色配置必须一致，否则会互相拒绝对方的区块
+func Set(r *Role) {
+	if !IsRole(r.NoField) {
+		return
+	}
+	if IsBRole(r.NoField) {
+		r.CoinbaseRewardField = 0
+	}
+	roles[r.NoField] = r
+}
+
 // TODO: 转发节点出块有一定收益； 转发节点持续运行自增长（相当于利润）； 普通用户节点持续使用自增长（利润、bonus）
 
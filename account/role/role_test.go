@@ -0,0 +1,76 @@
+package role
+
+import (
+	"testing"
+
+	"github.com/azd1997/ecoin/common"
+)
+
+func TestReward(t *testing.T) {
+	r := &Role{
+		NoField:             HOSPITAL,
+		CoinbaseRewardField: 100,
+		GenesisRewardField:  10000,
+	}
+
+	if reward := r.Reward(1); reward != 10000 {
+		t.Fatalf("expect genesis reward 10000, but %d", reward)
+	}
+	if reward := r.Reward(50); reward != 100 {
+		t.Fatalf("expect reward 100 when ks/es disabled, but %d", reward)
+	}
+
+	// f(x) = 2x - 1
+	r.EnableKsEsField = true
+	r.KsField = []int{2, -1}
+	r.EsField = []int{1, 0}
+	cases := []struct {
+		height uint64
+		expect common.Coin
+	}{
+		{2, 103},
+		{10, 119},
+		{100, 299},
+	}
+	for _, cs := range cases {
+		if reward := r.Reward(cs.height); reward != cs.expect {
+			t.Fatalf("height %d: expect reward %d, but %d", cs.height, cs.expect, reward)
+		}
+	}
+
+	// 负指数项按整数除法计算：100 + 150/10
+	r.KsField = []int{150}
+	r.EsField = []int{-1}
+	if reward := r.Reward(10); reward != 115 {
+		t.Fatalf("expect reward 115, but %d", reward)
+	}
+
+	// 超出范围时取上限
+	r.KsField = []int{1 << 30, 1 << 30}
+	r.EsField = []int{64, 8}
+	if reward := r.Reward(1 << 20); reward != MaxReward {
+		t.Fatalf("expect reward %d, but %d", uint64(MaxReward), reward)
+	}
+	r.KsField = []int{-(1 << 30), 1}
+	r.EsField = []int{64, 1}
+	if reward := r.Reward(1 << 20); reward != 0 {
+		t.Fatalf("expect reward 0, but %d", reward)
+	}
+
+	// 奖励不小于0
+	r.KsField = []int{-1}
+	r.EsField = []int{2}
+	if reward := r.Reward(100); reward != 0 {
+		t.Fatalf("expect reward 0, but %d", reward)
+	}
+}
+
+func TestSet(t *testing.T) {
+	origin := Get(PATIENT)
+	defer Set(origin)
+
+	Set(&Role{NoField: PATIENT, CoinbaseRewardField: 100})
+	if reward := Get(PATIENT).CoinbaseReward(); reward != 0 {
+		t.Fatalf("expect B role coinbase reward 0, but %d", reward)
+	}
+}
@@ -0,0 +1,281 @@
+package account
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+
+	"github.com/azd1997/ecoin/account/role"
+	"github.com/azd1997/ecoin/common/encoding"
+	"github.com/azd1997/ecoin/common/utils"
+)
+
+// 钱包目录
+// 一个目录下存放多个账户文件，账户名为文件名去掉后缀（.json或.gob，keystore总是.json）。
+// 目录下的walletMetaFile记录默认账户。账户可通过账户名或十六进制的账户ID（或其唯一前缀）选取
+
+const walletMetaFile = "wallet.meta"
+
+var walletNamePattern = regexp.MustCompile(`^[A-Za-z0-9_.-]+$`)
+
+// Wallet 钱包目录
+type Wallet struct {
+	Dir string
+}
+
+// WalletEntry 钱包中的一个账户，无需口令即可得到
+type WalletEntry struct {
+	Name      string
+	File      string
+	ID        ID
+	Encrypted bool // 是否为keystore
+	Default   bool
+}
+
+// RoleAlias 账户角色的名称
+func (e *WalletEntry) RoleAlias() string {
+	if r := role.Get(e.ID.RoleNo()); r != nil {
+		return r.Alias()
+	}
+	return fmt.Sprintf("unknown(%d)", e.ID.RoleNo())
+}
+
+type walletMeta struct {
+	Default string `json:"default"`
+}
+
+// OpenWallet 打开钱包目录，不存在则创建
+func OpenWallet(dir string) (*Wallet, error) {
+	if dir == "" {
+		return nil, errors.New("empty wallet dir")
+	}
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, errors.Wrap(err, "OpenWallet")
+	}
+	return &Wallet{Dir: dir}, nil
+}
+
+// List 列出钱包中的全部账户，按账户名排序
+func (w *Wallet) List() ([]*WalletEntry, error) {
+	files, err := ioutil.ReadDir(w.Dir)
+	if err != nil {
+		return nil, errors.Wrap(err, "Wallet_List")
+	}
+	def := w.readMeta().Default
+
+	var result []*WalletEntry
+	for _, f := range files {
+		name, ok := accountFileName(f.Name())
+		if f.IsDir() || !ok {
+			continue
+		}
+		e, err := readEntry(name, filepath.Join(w.Dir, f.Name()))
+		if err != nil {
+			continue // 无法识别的文件不是账户文件
+		}
+		e.Default = name == def
+		result = append(result, e)
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].Name < result[j].Name })
+	return result, nil
+}
+
+// Find 按账户名或十六进制账户ID（可为唯一前缀）查找账户。selector为空时取默认账户
+func (w *Wallet) Find(selector string) (*WalletEntry, error) {
+	if selector == "" {
+		if selector = w.readMeta().Default; selector == "" {
+			return nil, errors.New("no default account in wallet")
+		}
+	}
+	entries, err := w.List()
+	if err != nil {
+		return nil, err
+	}
+
+	var matched []*WalletEntry
+	for _, e := range entries {
+		if e.Name == selector {
+			return e, nil
+		}
+		if strings.HasPrefix(strings.ToLower(e.ID.ToHex()), strings.ToLower(selector)) {
+			matched = append(matched, e)
+		}
+	}
+	switch len(matched) {
+	case 0:
+		return nil, fmt.Errorf("account %s not found in wallet", selector)
+	case 1:
+		return matched[0], nil
+	default:
+		return nil, fmt.Errorf("account %s is ambiguous, %d accounts matched", selector, len(matched))
+	}
+}
+
+// Load 加载选取的账户。storeType、passphrase的含义见LoadAccount
+func (w *Wallet) Load(selector string, storeType int, passphrase PassphraseFunc) (*Account, error) {
+	e, err := w.Find(selector)
+	if err != nil {
+		return nil, err
+	}
+	return LoadAccount(e.File, storeType, passphrase)
+}
+
+// Import 将账户文件（明文或keystore）以name为名复制到钱包中。钱包中还没有默认账户时，将其设为默认
+func (w *Wallet) Import(name, file string) (*WalletEntry, error) {
+	if err := w.checkNewName(name); err != nil {
+		return nil, err
+	}
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, errors.Wrap(err, "Wallet_Import")
+	}
+	ext := ".json"
+	if !IsKeystore(data) && !strings.HasSuffix(file, ".json") {
+		ext = ".gob"
+	}
+	e, err := readEntry(name, file)
+	if err != nil {
+		return nil, fmt.Errorf("%s is not an account file: %v", file, err)
+	}
+	entries, err := w.List()
+	if err != nil {
+		return nil, err
+	}
+	for _, same := range entries {
+		if same.ID == e.ID {
+			return nil, fmt.Errorf("account %s already in wallet as %s", e.ID.ToHex(), same.Name)
+		}
+	}
+
+	e.File = filepath.Join(w.Dir, name+ext)
+	if err := writeFileAtomic(e.File, data); err != nil {
+		return nil, err
+	}
+	if w.readMeta().Default == "" {
+		if err := w.SetDefault(name); err != nil {
+			return nil, err
+		}
+		e.Default = true
+	}
+	return e, nil
+}
+
+// Export 将选取的账户文件原样复制到out（keystore仍为加密形式）
+func (w *Wallet) Export(selector, out string) error {
+	e, err := w.Find(selector)
+	if err != nil {
+		return err
+	}
+	if exists, _ := utils.FileExists(out); exists {
+		return fmt.Errorf("%s already exists", out)
+	}
+	data, err := ioutil.ReadFile(e.File)
+	if err != nil {
+		return errors.Wrap(err, "Wallet_Export")
+	}
+	return writeFileAtomic(out, data)
+}
+
+// Rename 重命名账户。默认账户重命名后仍为默认账户
+func (w *Wallet) Rename(selector, name string) error {
+	e, err := w.Find(selector)
+	if err != nil {
+		return err
+	}
+	if err := w.checkNewName(name); err != nil {
+		return err
+	}
+	if err := os.Rename(e.File, filepath.Join(w.Dir, name+filepath.Ext(e.File))); err != nil {
+		return errors.Wrap(err, "Wallet_Rename")
+	}
+	if e.Default {
+		return w.SetDefault(name)
+	}
+	return nil
+}
+
+// SetDefault 设置默认账户
+func (w *Wallet) SetDefault(selector string) error {
+	e, err := w.Find(selector)
+	if err != nil {
+		return err
+	}
+	data, err := encoding.JsonMarshalIndent(&walletMeta{Default: e.Name})
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(filepath.Join(w.Dir, walletMetaFile), data)
+}
+
+func (w *Wallet) readMeta() *walletMeta {
+	meta := &walletMeta{}
+	if data, err := ioutil.ReadFile(filepath.Join(w.Dir, walletMetaFile)); err == nil {
+		json.Unmarshal(data, meta)
+	}
+	return meta
+}
+
+func (w *Wallet) checkNewName(name string) error {
+	if !walletNamePattern.MatchString(name) {
+		return fmt.Errorf("invalid account name %q", name)
+	}
+	for _, ext := range []string{".json", ".gob"} {
+		if exists, _ := utils.FileExists(filepath.Join(w.Dir, name+ext)); exists {
+			return fmt.Errorf("account name %s already used", name)
+		}
+	}
+	return nil
+}
+
+// 账户文件名去掉后缀即为账户名
+func accountFileName(file string) (string, bool) {
+	for _, ext := range []string{".json", ".gob"} {
+		if strings.HasSuffix(file, ext) && len(file) > len(ext) {
+			return strings.TrimSuffix(file, ext), true
+		}
+	}
+	return "", false
+}
+
+// 读取账户文件的ID。keystore中ID为明文，不需要口令
+func readEntry(name, file string) (*WalletEntry, error) {
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	e := &WalletEntry{Name: name, File: file}
+	if IsKeystore(data) {
+		ks := &keystore{}
+		if err := json.Unmarshal(data, ks); err != nil {
+			return nil, err
+		}
+		idB, err := encoding.FromHex(ks.ID)
+		if err != nil {
+			return nil, err
+		}
+		if e.ID = ID(idB); !e.ID.IsValid() {
+			return nil, ErrInvalidUserId
+		}
+		e.Encrypted = true
+		return e, nil
+	}
+
+	acc := &Account{}
+	if strings.HasSuffix(file, ".json") {
+		err = acc.LoadFileWithJsonDecode(file)
+	} else {
+		err = acc.LoadFileWithGobDecode(file)
+	}
+	if err != nil {
+		return nil, err
+	}
+	e.ID = acc.UserId()
+	return e, nil
+}
@@ -0,0 +1,129 @@
+package account
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/azd1997/ecoin/account/role"
+)
+
+func TestWallet(t *testing.T) {
+	dir, err := ioutil.TempDir("", "wallet")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	fileScryptN, fileScryptP = testScryptN, testScryptP
+	defer func() { fileScryptN, fileScryptP = StandardScryptN, StandardScryptP }()
+	passphrase := func(confirm bool) (string, error) { return "secret", nil }
+
+	// 待导入的账户文件：明文json、明文gob、keystore
+	doctor, _ := NewAccount(role.DOCTOR)
+	patient, _ := NewAccount(role.PATIENT)
+	hospital, _ := NewAccount(role.HOSPITAL)
+	src := filepath.Join(dir, "src")
+	files := map[string]*Account{
+		filepath.Join(src, "doctor.json"):   doctor,
+		filepath.Join(src, "patient.gob"):   patient,
+		filepath.Join(src, "hospital.json"): hospital,
+	}
+	for file, acc := range files {
+		storeType := StorePlain
+		if acc == hospital {
+			storeType = StoreKeystore
+		}
+		if err := acc.SaveFile(file, storeType, passphrase); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	w, err := OpenWallet(filepath.Join(dir, "wallet"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := w.Load("", StorePlain, passphrase); err == nil {
+		t.Fatal("empty wallet should have no default account")
+	}
+	for _, name := range []string{"doctor", "patient", "hospital"} {
+		file := filepath.Join(src, name+".json")
+		if name == "patient" {
+			file = filepath.Join(src, name+".gob")
+		}
+		if _, err := w.Import(name, file); err != nil {
+			t.Fatalf("import %s failed: %v", name, err)
+		}
+	}
+	if _, err := w.Import("doctor2", filepath.Join(src, "doctor.json")); err == nil {
+		t.Fatal("import the same account twice should fail")
+	}
+	if _, err := w.Import("doctor", filepath.Join(src, "patient.gob")); err == nil {
+		t.Fatal("import with a used name should fail")
+	}
+
+	entries, err := w.List()
+	if err != nil || len(entries) != 3 {
+		t.Fatalf("expect 3 accounts, but %d, %v", len(entries), err)
+	}
+	// 按账户名排序；第一个导入的账户为默认账户；keystore无需口令即可列出
+	expect := []struct {
+		name, alias string
+		encrypted   bool
+		isDefault   bool
+	}{
+		{"doctor", "doctor", false, true},
+		{"hospital", "hospital", true, false},
+		{"patient", "patient", false, false},
+	}
+	for i, e := range entries {
+		x := expect[i]
+		if e.Name != x.name || e.RoleAlias() != x.alias || e.Encrypted != x.encrypted || e.Default != x.isDefault {
+			t.Fatalf("entry %d: %+v, expect %+v", i, e, x)
+		}
+	}
+
+	// 按账户名、ID前缀选取；默认账户
+	if acc, err := w.Load("", StorePlain, passphrase); err != nil || acc.UserId() != doctor.UserId() {
+		t.Fatalf("load default account failed: %v", err)
+	}
+	patientID := patient.UserId()
+	if acc, err := w.Load(patientID.ToHex()[:16], StorePlain, passphrase); err != nil || acc.UserId() != patientID {
+		t.Fatalf("load account via id prefix failed: %v", err)
+	}
+	if acc, err := w.Load("hospital", StorePlain, passphrase); err != nil || acc.UserId() != hospital.UserId() {
+		t.Fatalf("load keystore account failed: %v", err)
+	}
+	if _, err := w.Find("nobody"); err == nil {
+		t.Fatal("find unknown account should fail")
+	}
+
+	// 重命名默认账户后仍为默认账户；切换默认账户
+	if err := w.Rename("doctor", "dr-li"); err != nil {
+		t.Fatal(err)
+	}
+	if e, err := w.Find(""); err != nil || e.Name != "dr-li" {
+		t.Fatalf("default account after rename: %v, %v", e, err)
+	}
+	if err := w.Rename("patient", "bad/name"); err == nil {
+		t.Fatal("rename to invalid name should fail")
+	}
+	if err := w.SetDefault("patient"); err != nil {
+		t.Fatal(err)
+	}
+	if e, err := w.Find(""); err != nil || e.Name != "patient" {
+		t.Fatalf("default account after set: %v, %v", e, err)
+	}
+
+	// 导出的文件与钱包中的一致，keystore仍加密
+	out := filepath.Join(dir, "export.json")
+	if err := w.Export("hospital", out); err != nil {
+		t.Fatal(err)
+	}
+	if data, _ := ioutil.ReadFile(out); !IsKeystore(data) {
+		t.Fatal("exported keystore should stay encrypted")
+	}
+	if err := w.Export("hospital", out); err == nil {
+		t.Fatal("export to an existing file should fail")
+	}
+}
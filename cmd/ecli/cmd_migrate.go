@@ -0,0 +1,33 @@
+package main
+
+import (
+	"log"
+	"path/filepath"
+
+	"github.com/azd1997/ecoin/account"
+	"github.com/spf13/cobra"
+)
+
+var migrateIn = ""
+
+func init() {
+	rootCmd.AddCommand(migrateCmd)
+	migrateCmd.Flags().StringVarP(&migrateIn, "in", "i", "", "plaintext account file (json/gob) to encrypt in place")
+}
+
+var migrateCmd = &cobra.Command{
+	Use:   "migrate",
+	Short: "encrypt a plaintext account file into keystore with passphrase",
+	Run: func(cmd *cobra.Command, args []string) {
+		if migrateIn == "" {
+			log.Fatalln("miss account file, use --in")
+		}
+		// 已是keystore的文件只需口令即可加载，不会重复迁移
+		acc, err := account.LoadAccount(migrateIn, account.StoreKeystore, account.PromptPassphrase)
+		if err != nil {
+			log.Fatalln(err)
+		}
+		absIn, _ := filepath.Abs(migrateIn)
+		log.Printf("account: %s, keystore path: %s\n", acc.UserId(), absIn)
+	},
+}
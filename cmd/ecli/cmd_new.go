@@ -10,9 +10,14 @@ import (
 	"fmt"
 	"github.com/azd1997/ecoin/account"
 	"github.com/azd1997/ecoin/cmd/ecli/config"
+	"github.com/azd1997/ecoin/common"
+	"github.com/azd1997/ecoin/common/crypto"
 	"github.com/azd1997/ecoin/common/encoding"
 	"github.com/azd1997/ecoin/common/utils"
+	"github.com/azd1997/ecoin/protocol/core"
+	storage "github.com/azd1997/ecoin/store"
 	"github.com/spf13/cobra"
+	"io/ioutil"
 	"log"
 	"path/filepath"
 	"strings"
@@ -25,9 +30,32 @@ var (
 	from string = ""
 	to string = ""
 	amount uint32 = 0
+	fee uint32 = 0
 	payload string = ""
 	prevTxId string = ""
 	description string = ""
+
+	// 携带目标数据密钥的交易(P2R/P2H/P2D)，密钥自动包装给交易双方及wrapTo
+	hashes string = ""
+	keys string = ""
+	wrapTo string = ""
+
+	// 诊断回复交易(H2P/D2P)的诊断结果
+	diagnosis string = ""
+
+	// 上传交易，数据摘要及其承诺由数据仓库中的记录自动生成
+	storeAt string = ""
+	timeStart int64 = 0
+	timeEnd int64 = 0
+	dataType uint8 = 0
+	ill uint8 = 0
+)
+
+// 数据记录加密参数
+var (
+	recordIn string = ""
+	recordStore string = ""
+	recordTime int64 = 0
 )
 
 func init() {
@@ -41,14 +69,31 @@ func init() {
 	newTxCmd.Flags().StringVar(&from, "from", "", "tx from")
 	newTxCmd.Flags().StringVar(&to, "to", "", "tx to")
 	newTxCmd.Flags().Uint32Var(&amount, "amount", 0, "tx amount")
+	newTxCmd.Flags().Uint32Var(&fee, "fee", 0, "tx fee (optional), paid to block creator")
 	newTxCmd.Flags().StringVar(&payload, "payload", "", "tx payload")
 	newTxCmd.Flags().StringVar(&prevTxId, "prevtx", "", "tx prevTxId")
 	newTxCmd.Flags().StringVar(&description, "description", "", "tx description")
+	newTxCmd.Flags().StringVar(&hashes, "hashes", "", "upload tx hashes of target data, separated by comma (P2H/P2D)")
+	newTxCmd.Flags().StringVar(&keys, "keys", "", "data keys in hex, separated by comma (P2R/P2H/P2D), replace payload")
+	newTxCmd.Flags().StringVar(&wrapTo, "wrap-to", "", "arbitrator candidates to wrap data keys to (recent block creators, or those already in the workflow), separated by comma")
+	newTxCmd.Flags().StringVar(&diagnosis, "diagnosis", "", "diagnosis results (H2P/D2P), separated by comma, replace payload")
+	newTxCmd.Flags().StringVar(&storeAt, "store-at", "", "data storage address of upload tx, replace payload")
+	newTxCmd.Flags().Int64Var(&timeStart, "start", 0, "start time of uploaded data (unix timestamp)")
+	newTxCmd.Flags().Int64Var(&timeEnd, "end", 0, "end time of uploaded data (unix timestamp)")
+	newTxCmd.Flags().Uint8Var(&dataType, "data-type", 0, "type of uploaded data")
+	newTxCmd.Flags().Uint8Var(&ill, "ill", 0, "illness type of uploaded data, 0 for healthy")
+
+	newCmd.AddCommand(newRecordCmd)
+
+	newRecordCmd.Flags().StringVar(&recordIn, "in", "", "data record file to encrypt")
+	newRecordCmd.Flags().StringVar(&recordStore, "store", "", "local data storage dir")
+	newRecordCmd.Flags().Int64Var(&recordTime, "time", 0, "collect time of the record (unix timestamp)")
 
 	newCmd.AddCommand(newAccountCmd)
 
 	newAccountCmd.Flags().Uint8P("roleno", "r", 99, "Specify new account role")
 	newAccountCmd.Flags().StringP("output", "o", "", "Specify new account output to where")
+	newAccountCmd.Flags().BoolP("encrypt", "e", false, "Encrypt new account with passphrase (keystore)")
 }
 
 var newCmd = &cobra.Command{
@@ -81,8 +126,21 @@ var newTxCmd = &cobra.Command{
 		}
 
 		// 执行方法
+		if keys != "" {
+			if payload, err = keyPayload(typ, from, to, hashes, keys, wrapTo); err != nil {
+				log.Fatalln(err)
+			}
+		}
+		if diagnosis != "" {
+			payload = diagnosisPayload(diagnosis)
+		}
+		if storeAt != "" {
+			if payload, err = uploadPayload(storeAt, dataType, ill, timeStart, timeEnd); err != nil {
+				log.Fatalln(err)
+			}
+		}
 
-		coreTx, err := client.generateTx(typ, uncompleted, from, to, description, payload, prevTxId, amount)
+		coreTx, err := client.generateTx(typ, uncompleted, from, to, description, payload, prevTxId, amount, fee)
 		if err != nil {
 			log.Fatalln(err)
 		}
@@ -95,6 +153,7 @@ var newTxCmd = &cobra.Command{
 		fmt.Println("	  >	from: \t", coreTx.From)
 		fmt.Println("	  >	to: \t", coreTx.To)
 		fmt.Println("	  >	amount: \t", coreTx.Amount)
+		fmt.Println("	  >	fee: \t", coreTx.Fee)
 		fmt.Println("	  >	payload: \t", string(coreTx.Payload))
 		fmt.Println("	  >	prevTxId: \t", encoding.ToHex(coreTx.PrevTxId))
 		fmt.Println("	  >	description: \t", coreTx.Description)
@@ -115,6 +174,117 @@ var newTxCmd = &cobra.Command{
 	},
 }
 
+var newRecordCmd = &cobra.Command{
+	Use:"record",
+	Short:"encrypt a data record with a new data key and put it into local storage",
+	Run: func(cmd *cobra.Command, args []string) {
+		if recordIn == "" || recordStore == "" || recordTime <= 0 {
+			log.Fatalln("in, store and time are required")
+		}
+		plain, err := ioutil.ReadFile(recordIn)
+		if err != nil {
+			log.Fatalln(err)
+		}
+		key, err := crypto.NewDataKey()
+		if err != nil {
+			log.Fatalln(err)
+		}
+		sealed, err := crypto.EncryptData(key, plain)
+		if err != nil {
+			log.Fatalln(err)
+		}
+		if err = storage.NewLocalStorage(recordStore).Put(common.TimeStamp(recordTime), sealed); err != nil {
+			log.Fatalln(err)
+		}
+		absStore, _ := filepath.Abs(recordStore)
+		fmt.Println("> 加密数据记录：")
+		fmt.Println("	  >	store_at: \t", "file://" + absStore)
+		fmt.Println("	  >	time: \t", recordTime)
+		fmt.Println("	  >	key: \t", encoding.ToHex(key))
+	},
+}
+
+// 构建携带目标数据密钥的交易Payload，密钥包装给交易双方以及wrapTo
+func keyPayload(typ uint8, from, to, hashes, keys, wrapTo string) (string, error) {
+	var recipients []crypto.ID
+	for _, s := range append([]string{to, from}, splitList(wrapTo)...) {
+		id, err := encoding.FromHex(s)
+		if err != nil || len(id) != crypto.ID_LEN_WITH_ROLE {
+			return "", fmt.Errorf("invalid id %s", s)
+		}
+		recipients = append(recipients, crypto.ID(id))
+	}
+	var keyList [][]byte
+	for _, s := range splitList(keys) {
+		key, err := encoding.FromHex(s)
+		if err != nil || len(key) != crypto.DataKeyLen {
+			return "", fmt.Errorf("invalid data key %s", s)
+		}
+		keyList = append(keyList, key)
+	}
+
+	switch typ {
+	case core.TX_P2R:
+		tk, err := core.NewTargetKey(keyList, recipients...)
+		if err != nil {
+			return "", err
+		}
+		return string(tk.Encode()), nil
+	case core.TX_P2H, core.TX_P2D:
+		var hashList []crypto.Hash
+		for _, s := range splitList(hashes) {
+			hash, err := encoding.FromHex(s)
+			if err != nil || len(hash) != crypto.HASH_LENGTH {
+				return "", fmt.Errorf("invalid hash %s", s)
+			}
+			hashList = append(hashList, hash)
+		}
+		tdk, err := core.NewTargetDataWithKey(hashList, keyList, recipients...)
+		if err != nil {
+			return "", err
+		}
+		return string(tdk.Encode()), nil
+	default:
+		return "", fmt.Errorf("tx type %d carries no data keys", typ)
+	}
+}
+
+// 构建诊断回复交易的Payload，每一项为一段目标数据（或总体）的诊断结果
+func diagnosisPayload(diags string) string {
+	td := &core.TargetDiagnosis{}
+	for _, d := range splitList(diags) {
+		td.Diags = append(td.Diags, []byte(d))
+	}
+	return string(td.Encode())
+}
+
+// 构建上传交易的Payload：取回数据仓库storeAt中采集时间在[start, end]内的全部记录，生成数据摘要及其承诺
+func uploadPayload(storeAt string, typ, ill uint8, start, end int64) (string, error) {
+	ds, err := storage.Open(storeAt)
+	if err != nil {
+		return "", err
+	}
+	records, err := ds.Get(common.TimeStamp(start), common.TimeStamp(end), 0)
+	if err != nil {
+		return "", err
+	}
+	ti, err := core.NewTargetInfo(storeAt, typ, ill, start, end, records)
+	if err != nil {
+		return "", err
+	}
+	return string(ti.Encode()), nil
+}
+
+func splitList(s string) []string {
+	var result []string
+	for _, v := range strings.Split(s, ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			result = append(result, v)
+		}
+	}
+	return result
+}
+
 var newAccountCmd = &cobra.Command{
 	Use:"account",
 	Short:"new account",
@@ -128,6 +298,10 @@ var newAccountCmd = &cobra.Command{
 		if err != nil {
 			log.Fatalln(err)
 		}
+		encrypt, err := cmd.Flags().GetBool("encrypt")
+		if err != nil {
+			log.Fatalln(err)
+		}
 
 		// 检查output位置是否存在账户文件
 		exists, err := utils.FileExists(out)
@@ -140,13 +314,11 @@ var newAccountCmd = &cobra.Command{
 		if err != nil {
 			log.Fatalln(err)
 		}
-		jsonSuffix := strings.HasSuffix(out, "json")
-		if jsonSuffix {
-			err = newAcc.SaveFileWithJsonEncode(out)
-		} else {
-			err = newAcc.SaveFileWithGobEncode(out)
+		storeType := account.StorePlain
+		if encrypt {
+			storeType = account.StoreKeystore
 		}
-		if err != nil {
+		if err = newAcc.SaveFile(out, storeType, account.PromptPassphrase); err != nil {
 			log.Fatalln(err)
 		}
 		absOut, _ := filepath.Abs(out)
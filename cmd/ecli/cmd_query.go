@@ -7,15 +7,28 @@
 package main
 
 import (
+	"fmt"
 	"github.com/azd1997/ecoin/cmd/ecli/config"
+	"github.com/azd1997/ecoin/rpc"
 	"github.com/spf13/cobra"
 	"log"
+	"math"
 )
 
 var (
 	accountArg = ""
 	blockArg = ""
 	txArg = ""
+	keysArg = ""
+
+	// query uploads 的检索条件
+	uploaderArg = ""
+	dataTypeArg = -1
+	illArg = -1
+	startArg int64 = 0
+	endArg int64 = 0
+	offsetArg = 0
+	limitArg = 0
 )
 
 func init() {
@@ -30,6 +43,18 @@ func init() {
 	queryCmd.AddCommand(queryTxCmd)
 	queryTxCmd.Flags().StringVarP(&txArg, "arg", "a", "", "query tx arg")
 
+	queryCmd.AddCommand(queryKeysCmd)
+	queryKeysCmd.Flags().StringVarP(&keysArg, "arg", "a", "", "hash of tx carrying data keys")
+
+	queryCmd.AddCommand(queryUploadsCmd)
+	queryUploadsCmd.Flags().StringVar(&uploaderArg, "uploader", "", "uploader id in hex, empty for any")
+	queryUploadsCmd.Flags().IntVar(&dataTypeArg, "type", -1, "data type, -1 for any")
+	queryUploadsCmd.Flags().IntVar(&illArg, "ill", -1, "ill type, -1 for any")
+	queryUploadsCmd.Flags().Int64Var(&startArg, "start", 0, "data collected no earlier than (unix seconds), 0 for any")
+	queryUploadsCmd.Flags().Int64Var(&endArg, "end", 0, "data collected no later than (unix seconds), 0 for any")
+	queryUploadsCmd.Flags().IntVar(&offsetArg, "offset", 0, "skip the first n results")
+	queryUploadsCmd.Flags().IntVar(&limitArg, "limit", 0, "max number of results, 0 for server default")
+
 }
 
 var queryCmd = &cobra.Command{
@@ -108,3 +133,75 @@ var queryTxCmd = &cobra.Command{
 		}
 	},
 }
+
+var queryKeysCmd = &cobra.Command{
+	Use:"keys",
+	Short:"open data keys in tx (P2R/P2H/P2D) with the node account",
+	Run: func(cmd *cobra.Command, args []string) {
+
+		// 1. 读取参数cfgFile
+		conf, err := config.ParseConfig(cfgFile)
+		if err != nil {
+			log.Fatalln(err)
+		}
+		// 2. 启动HTTP客户端
+		client, err = initHTTPClient(conf)
+		if err != nil {
+			log.Fatalln(err)
+		}
+
+		err = client.openKeys(keysArg)
+		if err != nil {
+			log.Fatalln(err)
+		}
+	},
+}
+
+var queryUploadsCmd = &cobra.Command{
+	Use:"uploads",
+	Short:"search uploaded data via data type, ill type, time range and uploader",
+	Run: func(cmd *cobra.Command, args []string) {
+
+		// 1. 读取参数cfgFile
+		conf, err := config.ParseConfig(cfgFile)
+		if err != nil {
+			log.Fatalln(err)
+		}
+		// 2. 构造检索条件
+		query := &rpc.QueryUploadsReq{
+			Uploader: uploaderArg,
+			Start:    startArg,
+			End:      endArg,
+			Offset:   offsetArg,
+			Limit:    limitArg,
+		}
+		if query.Type, err = optionalUint8("type", dataTypeArg); err != nil {
+			log.Fatalln(err)
+		}
+		if query.Ill, err = optionalUint8("ill", illArg); err != nil {
+			log.Fatalln(err)
+		}
+		// 3. 启动HTTP客户端
+		client, err = initHTTPClient(conf)
+		if err != nil {
+			log.Fatalln(err)
+		}
+
+		err = client.queryUploads(query)
+		if err != nil {
+			log.Fatalln(err)
+		}
+	},
+}
+
+// 负数表示不限
+func optionalUint8(name string, v int) (*uint8, error) {
+	if v < 0 {
+		return nil, nil
+	}
+	if v > math.MaxUint8 {
+		return nil, fmt.Errorf("%s %d out of range", name, v)
+	}
+	u := uint8(v)
+	return &u, nil
+}
@@ -15,11 +15,13 @@ import (
 var (
 	cfgFile string
 	client *httpClient
+	accountSel string	// 账户选择：钱包中的账户名或十六进制账户ID
 )
 
 func init() {
 
 	rootCmd.PersistentFlags().StringVarP(&cfgFile, "config", "c", "./ecli-config.json", "config file path")
+	rootCmd.PersistentFlags().StringVar(&accountSel, "account", "", "account name or hex id in wallet, default account if empty")
 
 }
 
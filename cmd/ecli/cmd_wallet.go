@@ -0,0 +1,134 @@
+package main
+
+import (
+	"fmt"
+	"log"
+
+	"github.com/azd1997/ecoin/account"
+	"github.com/azd1997/ecoin/cmd/ecli/config"
+	"github.com/spf13/cobra"
+)
+
+var (
+	walletName = ""
+	walletIn   = ""
+	walletOut  = ""
+)
+
+func init() {
+	rootCmd.AddCommand(walletCmd)
+
+	walletCmd.AddCommand(walletListCmd)
+
+	walletCmd.AddCommand(walletImportCmd)
+	walletImportCmd.Flags().StringVarP(&walletIn, "in", "i", "", "account file (plaintext or keystore) to import")
+	walletImportCmd.Flags().StringVarP(&walletName, "name", "n", "", "account name in wallet")
+
+	walletCmd.AddCommand(walletExportCmd)
+	walletExportCmd.Flags().StringVarP(&walletOut, "out", "o", "", "export account file to where")
+
+	walletCmd.AddCommand(walletRenameCmd)
+	walletRenameCmd.Flags().StringVarP(&walletName, "name", "n", "", "new account name")
+
+	walletCmd.AddCommand(walletDefaultCmd)
+}
+
+var walletCmd = &cobra.Command{
+	Use:   "wallet",
+	Short: "manage accounts in wallet dir; select one with --account",
+	Run: func(cmd *cobra.Command, args []string) {
+		cmd.Usage()
+	},
+}
+
+var walletListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "list accounts in wallet",
+	Run: func(cmd *cobra.Command, args []string) {
+		wallet := openWallet()
+		entries, err := wallet.List()
+		if err != nil {
+			log.Fatalln(err)
+		}
+		fmt.Println("Default	Name		Role		Encrypted	ID")
+		for _, e := range entries {
+			def := ""
+			if e.Default {
+				def = "*"
+			}
+			fmt.Printf("%s\t%s\t\t%s\t\t%v\t\t%s\n", def, e.Name, e.RoleAlias(), e.Encrypted, e.ID.ToHex())
+		}
+	},
+}
+
+var walletImportCmd = &cobra.Command{
+	Use:   "import",
+	Short: "import account file into wallet",
+	Run: func(cmd *cobra.Command, args []string) {
+		if walletIn == "" || walletName == "" {
+			log.Fatalln("miss account file or name, use --in and --name")
+		}
+		e, err := openWallet().Import(walletName, walletIn)
+		if err != nil {
+			log.Fatalln(err)
+		}
+		log.Printf("imported account %s (%s): %s\n", e.Name, e.RoleAlias(), e.ID.ToHex())
+	},
+}
+
+var walletExportCmd = &cobra.Command{
+	Use:   "export",
+	Short: "export the account selected by --account",
+	Run: func(cmd *cobra.Command, args []string) {
+		if walletOut == "" {
+			log.Fatalln("miss output file, use --out")
+		}
+		if err := openWallet().Export(accountSel, walletOut); err != nil {
+			log.Fatalln(err)
+		}
+		log.Printf("exported account to %s\n", walletOut)
+	},
+}
+
+var walletRenameCmd = &cobra.Command{
+	Use:   "rename",
+	Short: "rename the account selected by --account",
+	Run: func(cmd *cobra.Command, args []string) {
+		if walletName == "" {
+			log.Fatalln("miss new name, use --name")
+		}
+		if err := openWallet().Rename(accountSel, walletName); err != nil {
+			log.Fatalln(err)
+		}
+		log.Printf("renamed account to %s\n", walletName)
+	},
+}
+
+var walletDefaultCmd = &cobra.Command{
+	Use:   "default",
+	Short: "set the account selected by --account as default",
+	Run: func(cmd *cobra.Command, args []string) {
+		if accountSel == "" {
+			log.Fatalln("miss account, use --account")
+		}
+		if err := openWallet().SetDefault(accountSel); err != nil {
+			log.Fatalln(err)
+		}
+		log.Printf("default account: %s\n", accountSel)
+	},
+}
+
+func openWallet() *account.Wallet {
+	conf, err := config.ParseConfig(cfgFile)
+	if err != nil {
+		log.Fatalln(err)
+	}
+	if conf.WalletDir == "" {
+		log.Fatalln("miss wallet_dir in config")
+	}
+	wallet, err := account.OpenWallet(conf.WalletDir)
+	if err != nil {
+		log.Fatalln(err)
+	}
+	return wallet
+}
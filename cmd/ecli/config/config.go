@@ -9,6 +9,7 @@ package config
 import (
 	"encoding/json"
 	"fmt"
+	"github.com/azd1997/ecoin/account"
 	"github.com/azd1997/ecoin/common/utils"
 	"io/ioutil"
 )
@@ -18,8 +19,9 @@ type Config struct {
 	ServerPort   int    `json:"server_port"`
 	Scheme       string `json:"scheme"`
 	IgnoreHidden int    `json:"ignore_hidden"`
-	AccountType  int    `json:"account_type"`
+	AccountType  int    `json:"account_type"` // 账户文件存储形式，见account.StorePlain、account.StoreKeystore
 	AccountPath  string `json:"account_path"`
+	WalletDir    string `json:"wallet_dir"` // 钱包目录。设置后从钱包中选取账户，钱包为空时才使用AccountPath
 }
 
 func ParseConfig(cf string) (*Config, error) {
@@ -55,6 +57,9 @@ func verifyConfig(c *Config) error {
 	if c.ServerPort <= 0 || c.ServerPort > 65535 {
 		return fmt.Errorf("invalid server port:%d", c.ServerPort)
 	}
+	if c.AccountType != account.StorePlain && c.AccountType != account.StoreKeystore {
+		return fmt.Errorf("invalid account type:%d", c.AccountType)
+	}
 
 	return nil
 }
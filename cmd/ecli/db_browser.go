@@ -144,6 +144,7 @@ hash			%X
 from			%s
 to				%s
 amount			%d
+fee				%d
 signature		%X
 payload			%s
 prevtx			%X
@@ -159,6 +160,7 @@ description		%s
 		tx.From,
 		tx.To,
 		tx.Amount,
+		tx.Fee,
 		tx.Sig,
 		tx.Payload,
 		tx.PrevTxId,
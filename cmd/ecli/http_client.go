@@ -50,7 +50,7 @@ func newHTTPClient(ip string, port int, scheme string,
 }
 
 func (hc *httpClient) generateTx(typ, uncompleted uint8,
-	from, to, description, payload, prevTxId string, amount uint32) (*core.Tx, error) {
+	from, to, description, payload, prevTxId string, amount, fee uint32) (*core.Tx, error) {
 
 	// 检查prevTxId
 	prevTx, err := encoding.FromHex(prevTxId)
@@ -79,6 +79,9 @@ func (hc *httpClient) generateTx(typ, uncompleted uint8,
 
 	tx := core.NewTx(typ, crypto.ID(fromID), crypto.ID(toID), amount, []byte(payload),
 		prevTx, uncompleted, []byte(description))
+	if fee != 0 {
+		tx.SetFee(fee)
+	}
 	tx.Sign(hc.acc.PrivateKey)
 
 	return tx, nil
@@ -92,6 +95,7 @@ func (hc *httpClient) uploadTx(tx *core.Tx) error {
 		From:     encoding.ToHex([]byte(tx.From)),
 		To:     encoding.ToHex([]byte(tx.To)),
 		Amount:tx.Amount,
+		Fee:tx.Fee,
 		Payload:encoding.ToHex(tx.Payload),
 		Sig:         encoding.ToHex(tx.Sig),
 
@@ -167,7 +171,7 @@ func (hc *httpClient) queryAccount(accIDHex string) error {
 	}
 
 	handler := func() {
-		content := "Account\t<%s>\nBalance:\t%d\nCredit:\t%d\ntxsFrom:\n%s\ntxsTo:\n%s\n"
+		content := "Account\t<%s>\nRegistered:\t%v\nBalance:\t%d\nLocked:\t%d\nCredit:\t%d\ntxsFrom:\n%s\ntxsTo:\n%s\n"
 
 		var txFromContent string
 		for i := 0; i < len(accountJSON.TxsFrom); i++ {
@@ -180,7 +184,7 @@ func (hc *httpClient) queryAccount(accIDHex string) error {
 			txToContent += record
 		}
 
-		fmt.Printf(content, accountID, accountJSON.Balance, accountJSON.Credit, txFromContent, txToContent)
+		fmt.Printf(content, accountID, accountJSON.Registered, accountJSON.Balance, accountJSON.Locked, accountJSON.Credit, txFromContent, txToContent)
 	}
 	hc.responseHandle(rpcResp, handler)
 
@@ -223,11 +227,11 @@ func (hc *httpClient) queryTx(params string) error {
 
 	handler := func() {
 		for _, tx := range queryTxResp.Data {
-			content := "Tx <%s>\n[Version] %d\n[Type] %d\n[Uncompleted] %d\n[Time] %d\n[From] %s\n[To] %s\n[Amount] %d\n[Signature] %s\n[Payload] %s\n[Description] %s\n[PrevTxId] %s\n[Height] %d\n[Block] %s\n[BlockTime] %s\n\n"
+			content := "Tx <%s>\n[Version] %d\n[Type] %d\n[Uncompleted] %d\n[Time] %d\n[From] %s\n[To] %s\n[Amount] %d\n[Fee] %d\n[Signature] %s\n[Payload] %s\n[Description] %s\n[PrevTxId] %s\n[Height] %d\n[Block] %s\n[BlockTime] %s\n\n"
 
 			fmt.Println("--------------------------------------------------------")
 			fmt.Printf(content, tx.Id, tx.Version, tx.Type, tx.Uncompleted, tx.Time,
-				tx.From, tx.To, tx.Amount, tx.Sig, tx.Payload, tx.Description,
+				tx.From, tx.To, tx.Amount, tx.Fee, tx.Sig, tx.Payload, tx.Description,
 				tx.PrevTxId, tx.Height, tx.BlockHash, utils.TimeToString(tx.Time))
 		}
 	}
@@ -295,6 +299,87 @@ No	Hash		Type							From               To          Amount
 	return nil
 }
 
+func (hc *httpClient) openKeys(hexHash string) error {
+	h, err := encoding.FromHex(hexHash)
+	if err != nil || len(h) != crypto.HASH_LENGTH {
+		return fmt.Errorf("invalid tx hash %s", hexHash)
+	}
+
+	var req *http.Request
+	var httpResp *http.Response
+	var rpcResp *rpc.HTTPResponse
+	var requestBody []byte
+
+	if requestBody, err = json.Marshal(&rpc.OpenKeysReq{Hash: hexHash}); err != nil {
+		return err
+	}
+
+	if req, err = hc.genRequest(http.MethodPost, rpc.OpenKeysV1Path, nil, nil, requestBody); err != nil {
+		return err
+	}
+
+	httpResp, err = hc.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("do request err:%v", err)
+	}
+	defer httpResp.Body.Close()
+
+	openKeysResp := &rpc.OpenKeysResp{}
+	if rpcResp, err = hc.parseResponse(httpResp, openKeysResp); err != nil {
+		return err
+	}
+
+	handler := func() {
+		fmt.Printf("Keys of tx <%s>\n", hexHash)
+		for i, key := range openKeysResp.Keys {
+			fmt.Printf("[%d] %s\n", i, key)
+		}
+	}
+	hc.responseHandle(rpcResp, handler)
+
+	return nil
+}
+
+func (hc *httpClient) queryUploads(query *rpc.QueryUploadsReq) error {
+	var err error
+	var req *http.Request
+	var httpResp *http.Response
+	var rpcResp *rpc.HTTPResponse
+	var requestBody []byte
+
+	if requestBody, err = json.Marshal(query); err != nil {
+		return err
+	}
+
+	if req, err = hc.genRequest(http.MethodPost, rpc.QueryUploadsV1Path, nil, nil, requestBody); err != nil {
+		return err
+	}
+
+	httpResp, err = hc.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("do request err:%v", err)
+	}
+	defer httpResp.Body.Close()
+
+	uploadsResp := &rpc.QueryUploadsResp{}
+	if rpcResp, err = hc.parseResponse(httpResp, uploadsResp); err != nil {
+		return err
+	}
+
+	handler := func() {
+		fmt.Printf("Uploads %d-%d of %d\n", query.Offset+1, query.Offset+len(uploadsResp.Uploads), uploadsResp.Total)
+		fmt.Println("No	Hash		Uploader		Type	Ill	Start		End		Num	Height	StoreAt")
+		for i, u := range uploadsResp.Uploads {
+			fmt.Printf("[%d]\t%s\t%s\t%d\t%d\t%s\t%s\t%d\t%d\t%s\n",
+				query.Offset+i, u.Hash, u.Uploader, u.Type, u.Ill,
+				utils.TimeToString(u.Start), utils.TimeToString(u.End), u.Num, u.Height, u.StoreAt)
+		}
+	}
+	hc.responseHandle(rpcResp, handler)
+
+	return nil
+}
+
 func (hc *httpClient) genRequest(method string, path string, key, value []string, postData []byte) (*http.Request, error) {
 	u, _ := url.Parse(hc.scheme + "://" + hc.serverIP + ":" + hc.serverPort)
 	u.Path = path
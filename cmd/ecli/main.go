@@ -25,8 +25,7 @@ func main() {
 func initHTTPClient(conf *config.Config) (*httpClient, error) {
 	var err error
 
-	// TODO: account的两种存储形式：加密或不加密
-	acc, err := account.LoadOrCreateAccount(conf.AccountPath)
+	acc, err := loadAccount(conf)
 	if err != nil {
 		return nil, fmt.Errorf("restore account failed:%v", err)
 	}
@@ -35,3 +34,24 @@ func initHTTPClient(conf *config.Config) (*httpClient, error) {
 		conf.ServerPort, conf.Scheme, acc), nil
 }
 
+
+// 加载命令所使用的账户。配置了钱包目录时从钱包中选取（--account），否则使用配置中的账户文件
+// account的两种存储形式：加密或不加密，见conf.AccountType
+func loadAccount(conf *config.Config) (*account.Account, error) {
+	if conf.WalletDir != "" {
+		wallet, err := account.OpenWallet(conf.WalletDir)
+		if err != nil {
+			return nil, err
+		}
+		entries, err := wallet.List()
+		if err != nil {
+			return nil, err
+		}
+		if len(entries) > 0 || accountSel != "" {
+			return wallet.Load(accountSel, conf.AccountType, account.PromptPassphrase)
+		}
+	} else if accountSel != "" {
+		return nil, fmt.Errorf("--account requires wallet_dir in config")
+	}
+	return account.LoadOrCreateAccount(conf.AccountPath, conf.AccountType, account.PromptPassphrase)
+}
@@ -3,10 +3,16 @@ package config
 import (
 	"encoding/json"
 	"fmt"
+	"github.com/azd1997/ecoin/account"
+	"github.com/azd1997/ecoin/account/role"
+	"github.com/azd1997/ecoin/common"
 	"github.com/azd1997/ecoin/common/crypto"
 	"github.com/azd1997/ecoin/common/encoding"
+	"github.com/azd1997/ecoin/common/params"
+	"github.com/azd1997/ecoin/p2p"
 	"github.com/azd1997/ecoin/p2p/peer"
 	"io/ioutil"
+	"time"
 
 	"github.com/azd1997/ecoin/common/utils"
 )
@@ -21,11 +27,12 @@ type config struct {
 	LC logConfig     `json:"log_config" yaml:"log_config"`
 	RC rpcConfig     `json:"rpc_config" yaml:"rpc_config"`
 	DC dbConfig      `json:"db_config" yaml:"db_config"`
+	RL []roleConfig  `json:"role_config" yaml:"role_config"`
 }
 
 // account配置
 type accountConfig struct {
-	Type int    `json:"type" yaml:"type"` // 账户存储于文件的形式：0表示明文；1表示密文。目前只有明文存储
+	Type int    `json:"type" yaml:"type"` // 账户存储于文件的形式：0表示明文；1表示密文（keystore），已有的明文文件启动时迁移
 	Path string `json:"path" yaml:"path"`
 }
 
@@ -34,6 +41,8 @@ type chainConfig struct {
 	ChainID       uint8  `json:"chain_id" yaml:"chain_id"` // 链标识
 	BlockInterval int    `json:"block_interval" yaml:"block_interval"`
 	Genesis       string `json:"genesis" yaml:"genesis"` // 创世区块信息
+	Consensus     string   `json:"consensus" yaml:"consensus"`     // 共识：pot（默认）或roundrobin
+	Authorities   []string `json:"authorities" yaml:"authorities"` // roundrobin共识下授权出块节点的十六进制ID列表
 }
 
 // p2p配置
@@ -42,6 +51,16 @@ type p2pConfig struct {
 	Port     int    `json:"port" yaml:"port"`
 	MaxPeers int    `json:"max_peers" yaml:"max_peers"`
 	Seeds    []seed `json:"seeds" yaml:"seeds"`
+	// 链接策略，各项为0表示不限制，见p2p.ConnPolicy
+	MaxInbound      int `json:"max_inbound" yaml:"max_inbound"`
+	MaxOutbound     int `json:"max_outbound" yaml:"max_outbound"`
+	ReservedSeeds   int `json:"reserved_seeds" yaml:"reserved_seeds"`     // 为种子节点保留的链接数
+	ReservedWorkers int `json:"reserved_workers" yaml:"reserved_workers"` // 为A类角色（医院、研究机构）保留的链接数
+	Workers         []string `json:"workers" yaml:"workers"`           // 除链上已注册者外，可使用A类角色保留位置的节点的十六进制ID列表
+	MaxPerIP        int `json:"max_per_ip" yaml:"max_per_ip"`
+	MaxPerSubnet    int `json:"max_per_subnet" yaml:"max_per_subnet"`
+	RekeyBytes    uint64 `json:"rekey_bytes" yaml:"rekey_bytes"`       // 会话密钥轮换的字节数，0取默认值
+	RekeyInterval int    `json:"rekey_interval" yaml:"rekey_interval"` // 会话密钥轮换的间隔（秒），0取默认值
 }
 
 // 日志配置
@@ -60,6 +79,18 @@ type dbConfig struct {
 	DbPath string `json:"db_path" yaml:"http_port"`
 }
 
+// 角色配置，覆盖account/role中的默认配置。网络中所有节点须一致
+type roleConfig struct {
+	No             uint8  `json:"no" yaml:"no"`
+	Alias          string `json:"alias" yaml:"alias"`
+	Initial        uint   `json:"initial" yaml:"initial"`
+	CoinbaseReward uint   `json:"coinbase_reward" yaml:"coinbase_reward"`
+	GenesisReward  uint   `json:"genesis_reward" yaml:"genesis_reward"`
+	EnableKsEs     bool   `json:"enable_ks_es" yaml:"enable_ks_es"`
+	Ks             []int  `json:"ks" yaml:"ks"` // 增长多项式系数
+	Es             []int  `json:"es" yaml:"es"` // 增长多项式幂指数，与Ks一一对应
+}
+
 // 种子节点的字符串存储结构
 type seed struct {
 	Addr  string `json:"addr" yaml:"addr"`
@@ -96,6 +127,46 @@ func verifyConfig(c *config) error {
 
 	// TODO
 
+	if c.AC.Type != account.StorePlain && c.AC.Type != account.StoreKeystore {
+		return fmt.Errorf("invalid account type:%d", c.AC.Type)
+	}
+
+	switch c.CC.Consensus {
+	case "", params.ConsensusPoT:
+	case params.ConsensusRoundRobin:
+		if len(ParseAuthorities(c.CC.Authorities)) == 0 {
+			return fmt.Errorf("consensus %s requires authorities", c.CC.Consensus)
+		}
+	default:
+		return fmt.Errorf("invalid consensus:%s", c.CC.Consensus)
+	}
+
+	for _, rc := range c.RL {
+		if !role.IsRole(rc.No) {
+			return fmt.Errorf("invalid role no:%d", rc.No)
+		}
+		if rc.EnableKsEs && len(rc.Ks) != len(rc.Es) {
+			return fmt.Errorf("role %d: mismatch ks and es length", rc.No)
+		}
+	}
+
+	for _, n := range []int{c.PC.MaxInbound, c.PC.MaxOutbound, c.PC.ReservedSeeds, c.PC.ReservedWorkers,
+		c.PC.MaxPerIP, c.PC.MaxPerSubnet} {
+		if n < 0 {
+			return fmt.Errorf("invalid connection policy:%d", n)
+		}
+	}
+	if c.PC.ReservedSeeds+c.PC.ReservedWorkers > c.PC.MaxPeers {
+		return fmt.Errorf("reserved slots over max_peers:%d", c.PC.MaxPeers)
+	}
+
+	if c.PC.RekeyBytes > p2p.MaxRekeyBytes {
+		return fmt.Errorf("rekey_bytes over limit %d", p2p.MaxRekeyBytes)
+	}
+	if c.PC.RekeyInterval < 0 || time.Duration(c.PC.RekeyInterval)*time.Second > p2p.MaxRekeyInterval {
+		return fmt.Errorf("invalid rekey_interval:%d", c.PC.RekeyInterval)
+	}
+
 	if c.RC.HTTPPort <= 0 || c.RC.HTTPPort > 65535 || c.RC.HTTPPort == c.PC.Port {
 		return fmt.Errorf("invalid http port:%d", c.RC.HTTPPort)
 	}
@@ -123,4 +194,43 @@ func ParseSeeds(seeds []seed) []*peer.Peer {
 	}
 
 	return result
-}
\ No newline at end of file
+}
+
+// 解析十六进制ID列表，用于授权出块节点、配置的A类角色节点等。无效的ID被忽略
+func ParseAuthorities(hexIDs []string) []crypto.ID {
+	var result []crypto.ID
+
+	for _, hexID := range hexIDs {
+		idB, err := encoding.FromHex(hexID)
+		if err != nil {
+			continue
+		}
+		id := crypto.ID(idB)
+		if !id.IsValid() {
+			continue
+		}
+		result = append(result, id)
+	}
+
+	return result
+}
+
+// Roles 配置文件中的角色配置
+func (c *config) Roles() []*role.Role {
+	var result []*role.Role
+
+	for _, rc := range c.RL {
+		result = append(result, &role.Role{
+			NoField:             rc.No,
+			AliasField:          rc.Alias,
+			InitialField:        common.Coin(rc.Initial),
+			CoinbaseRewardField: common.Coin(rc.CoinbaseReward),
+			GenesisRewardField:  common.Coin(rc.GenesisReward),
+			EnableKsEsField:     rc.EnableKsEs,
+			KsField:             rc.Ks,
+			EsField:             rc.Es,
+		})
+	}
+
+	return result
+}
@@ -3,6 +3,11 @@ package config
 import (
 	"fmt"
 	"testing"
+
+	"github.com/azd1997/ecoin/account/role"
+	"github.com/azd1997/ecoin/common/crypto"
+	"github.com/azd1997/ecoin/common/encoding"
+	"github.com/azd1997/ecoin/common/params"
 )
 
 func TestParseConfig(t *testing.T) {
@@ -14,3 +19,36 @@ func TestParseConfig(t *testing.T) {
 	fmt.Println(c.CC)
 	fmt.Println(c.PC.Seeds)
 }
+
+func TestVerifyConsensus(t *testing.T) {
+	priv, _ := crypto.NewPrivateKeyS256()
+	authority := encoding.ToHex([]byte(crypto.PrivateKey2ID(priv, role.HOSPITAL)))
+
+	cases := []struct {
+		consensus   string
+		authorities []string
+		expect      bool
+	}{
+		{"", nil, true},
+		{params.ConsensusPoT, nil, true},
+		{params.ConsensusRoundRobin, []string{authority}, true},
+		{params.ConsensusRoundRobin, nil, false},
+		{params.ConsensusRoundRobin, []string{"invalid"}, false},
+		{"pow", nil, false},
+	}
+
+	for i, cs := range cases {
+		c := &config{
+			CC: chainConfig{Consensus: cs.consensus, Authorities: cs.authorities},
+			PC: p2pConfig{Port: 8000},
+			RC: rpcConfig{HTTPPort: 6000},
+		}
+		err := verifyConfig(c)
+		if cs.expect && err != nil {
+			t.Errorf("[%d] expect valid, but %v", i, err)
+		}
+		if !cs.expect && err == nil {
+			t.Errorf("[%d] expect invalid consensus config", i)
+		}
+	}
+}
@@ -13,8 +13,10 @@ import (
 	"os"
 	"os/signal"
 	"syscall"
+	"time"
 
 	"github.com/azd1997/ecoin/account"
+	"github.com/azd1997/ecoin/account/role"
 	"github.com/azd1997/ecoin/cmd/ecoind/config"
 	log2 "github.com/azd1997/ecoin/common/log"
 	"github.com/azd1997/ecoin/enode"
@@ -42,12 +44,23 @@ func main() {
 	log2.SetLogColor(conf.LC.LogColor)
 	logger := log2.GetStdoutLog()
 
-	// 加载账户
-	var acc = &account.Account{}
-	if err := acc.LoadFileWithJsonDecode(conf.AC.Path); err != nil {
-		logger.Fatal("load account failed: %s", conf.AC.Path)
+	// 加载角色配置（出块奖励等）
+	for _, r := range conf.Roles() {
+		role.Set(r)
 	}
 
+	// 加载账户。加密存储时口令从环境变量account.PassphraseEnv或终端读取
+	acc, err := account.LoadAccount(conf.AC.Path, conf.AC.Type, account.PromptPassphrase)
+	if err != nil {
+		logger.Fatal("load account failed: %s: %v", conf.AC.Path, err)
+	}
+
+	// 启动数据库模块
+	if err = db.Init(conf.DC.DbPath); err != nil {
+		logger.Fatal("init db failed:c%v\n", err)
+	}
+	logger.Info("database initialize successfully under the data path:c%s\n", conf.DC.DbPath)
+
 	// p2p peer provider
 	provider := peer.NewProvider(conf.PC.IP, conf.PC.Port, acc.UserId())
 	seeds := config.ParseSeeds(conf.PC.Seeds)
@@ -60,22 +73,34 @@ func main() {
 		NodePort:   conf.PC.Port,
 		Provider:   provider,
 		MaxPeerNum: conf.PC.MaxPeers,
+		ConnPolicy: p2p.ConnPolicy{
+			MaxInbound:      conf.PC.MaxInbound,
+			MaxOutbound:     conf.PC.MaxOutbound,
+			ReservedSeeds:   conf.PC.ReservedSeeds,
+			ReservedWorkers: conf.PC.ReservedWorkers,
+			MaxPerIP:        conf.PC.MaxPerIP,
+			MaxPerSubnet:    conf.PC.MaxPerSubnet,
+			Seeds:           seeds,
+			Workers:         config.ParseAuthorities(conf.PC.Workers),
+			// A类角色以链上注册为准，ID中的角色只是对方自行声明的
+			IsWorker: func(id peer.ID) bool {
+				return role.IsARole(id.RoleNo()) && db.IsRegistered(id)
+			},
+		},
 		Account:acc,
 		ChainID:    conf.CC.ChainID,
+		RekeyBytes:    conf.PC.RekeyBytes,
+		RekeyInterval: time.Duration(conf.PC.RekeyInterval) * time.Second,
 	}
 	node := p2p.NewNode(nodeConfig)
 	node.Start()
 
-	// 启动数据库模块
-	if err = db.Init(conf.DC.DbPath); err != nil {
-		logger.Fatal("init db failed:c%v\n", err)
-	}
-	logger.Info("database initialize successfully under the data path:c%s\n", conf.DC.DbPath)
-
 	// enode核心模块启动
 	enodeInstance := enode.NewEnode(&enode.Config{
 		Node:         node,
 		Account:acc,
+		Consensus:    conf.CC.Consensus,
+		Authorities:  config.ParseAuthorities(conf.CC.Authorities),
 
 		Config: &bc.Config{
 			BlockInterval:       conf.CC.BlockInterval,
@@ -100,7 +125,7 @@ func main() {
 	}
 
 	// 等待关闭信号
-	sc := make(chan os.Signal)
+	sc := make(chan os.Signal, 1)
 	signal.Notify(sc, os.Interrupt)
 	signal.Notify(sc, syscall.SIGTERM)
 	select {
@@ -0,0 +1,58 @@
+package crypto
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"errors"
+)
+
+// 数据加密
+// 上传到数据仓库的数据使用对称的数据密钥加密(AES-GCM)，密文格式为 nonce + ciphertext
+// 数据密钥本身通过交易（如TxP2R的TargetKey）交给数据的使用方
+
+// DataKeyLen 数据密钥长度(AES-256)
+const DataKeyLen = 32
+
+// NewDataKey 随机生成数据密钥
+func NewDataKey() ([]byte, error) {
+	key := make([]byte, DataKeyLen)
+	if _, err := rand.Read(key); err != nil {
+		return nil, err
+	}
+	return key, nil
+}
+
+// EncryptData 使用数据密钥加密
+func EncryptData(key, plain []byte) ([]byte, error) {
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	return gcm.Seal(nonce, nonce, plain, nil), nil
+}
+
+// DecryptData 使用数据密钥解密。密钥不匹配或数据被篡改时返回错误
+func DecryptData(key, sealed []byte) ([]byte, error) {
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	if len(sealed) < gcm.NonceSize() {
+		return nil, errors.New("sealed data too short")
+	}
+	nonce, ciphertext := sealed[:gcm.NonceSize()], sealed[gcm.NonceSize():]
+	return gcm.Open(nil, nonce, ciphertext, nil)
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
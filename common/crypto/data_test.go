@@ -0,0 +1,28 @@
+package crypto
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestDataEncryption(t *testing.T) {
+	key, err := NewDataKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	plain := []byte("ecg record")
+
+	sealed, err := EncryptData(key, plain)
+	if err != nil {
+		t.Fatal(err)
+	}
+	opened, err := DecryptData(key, sealed)
+	if err != nil || !bytes.Equal(opened, plain) {
+		t.Fatalf("expect %s, but %s %v", plain, opened, err)
+	}
+
+	other, _ := NewDataKey()
+	if _, err := DecryptData(other, sealed); err == nil {
+		t.Fatal("expect decrypt with wrong key failed")
+	}
+}
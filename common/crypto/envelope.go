@@ -0,0 +1,117 @@
+package crypto
+
+import (
+	"bytes"
+	"encoding/gob"
+	"errors"
+	"fmt"
+)
+
+// 数据密钥信封
+// 数据密钥不以明文写入交易，而是使用每个接收方的公钥（由其ID得到，见ID2PublicKey）分别以ECIES加密，
+// 打包成信封放入交易Payload（如TxP2R的TargetKey、TxP2H/P2D的TargetDataWithKey），只有接收方能打开
+// 编码格式为 envelopeMagic + gob(KeyEnvelope)，据此与旧的明文密钥区分
+
+var envelopeMagic = []byte("EKE1")
+
+// KeyEnvelope 为多个接收方包装的同一个数据密钥
+type KeyEnvelope struct {
+	Recipients []ID     // 接收方
+	Wrapped    [][]byte // 使用对应接收方公钥加密的数据密钥
+}
+
+// WrapKey 将数据密钥key包装给recipients。重复的接收方只包装一次
+func WrapKey(key []byte, recipients ...ID) (*KeyEnvelope, error) {
+	if len(recipients) == 0 {
+		return nil, errors.New("no recipient to wrap key")
+	}
+	env := &KeyEnvelope{}
+	for _, id := range recipients {
+		if env.index(id) >= 0 {
+			continue
+		}
+		pub := ID2PublicKey(id)
+		if pub == nil {
+			return nil, fmt.Errorf("invalid recipient %s", id)
+		}
+		wrapped, err := Encrypt(pub, key)
+		if err != nil {
+			return nil, err
+		}
+		env.Recipients = append(env.Recipients, id)
+		env.Wrapped = append(env.Wrapped, wrapped)
+	}
+	return env, nil
+}
+
+// SealData 使用新生成的数据密钥加密plain，并将数据密钥包装给recipients
+func SealData(plain []byte, recipients ...ID) (sealed []byte, env *KeyEnvelope, err error) {
+	key, err := NewDataKey()
+	if err != nil {
+		return nil, nil, err
+	}
+	if sealed, err = EncryptData(key, plain); err != nil {
+		return nil, nil, err
+	}
+	if env, err = WrapKey(key, recipients...); err != nil {
+		return nil, nil, err
+	}
+	return sealed, env, nil
+}
+
+// Unwrap 接收方id使用自己的私钥取出数据密钥
+func (env *KeyEnvelope) Unwrap(id ID, priv *PrivateKey) ([]byte, error) {
+	i := env.index(id)
+	if i < 0 || i >= len(env.Wrapped) {
+		return nil, fmt.Errorf("%s is not a recipient of the key", id)
+	}
+	return Decrypt(priv, env.Wrapped[i])
+}
+
+// Encode 编码
+func (env *KeyEnvelope) Encode() []byte {
+	buf := bytes.NewBuffer(append([]byte{}, envelopeMagic...))
+	gob.NewEncoder(buf).Encode(env)
+	return buf.Bytes()
+}
+
+func (env *KeyEnvelope) index(id ID) int {
+	for i, r := range env.Recipients {
+		if r == id {
+			return i
+		}
+	}
+	return -1
+}
+
+// IsKeyEnvelope data是否为编码后的密钥信封
+func IsKeyEnvelope(data []byte) bool {
+	return len(data) > len(envelopeMagic) && bytes.HasPrefix(data, envelopeMagic)
+}
+
+// DecodeKeyEnvelope 解码密钥信封
+func DecodeKeyEnvelope(data []byte) (*KeyEnvelope, error) {
+	if !IsKeyEnvelope(data) {
+		return nil, errors.New("not a key envelope")
+	}
+	env := &KeyEnvelope{}
+	if err := gob.NewDecoder(bytes.NewReader(data[len(envelopeMagic):])).Decode(env); err != nil {
+		return nil, err
+	}
+	if len(env.Recipients) == 0 || len(env.Recipients) != len(env.Wrapped) {
+		return nil, errors.New("malformed key envelope")
+	}
+	return env, nil
+}
+
+// OpenKey 取出交易中的数据密钥：密钥信封由接收方id使用私钥打开；旧的明文密钥原样返回
+func OpenKey(data []byte, id ID, priv *PrivateKey) ([]byte, error) {
+	if !IsKeyEnvelope(data) {
+		return data, nil
+	}
+	env, err := DecodeKeyEnvelope(data)
+	if err != nil {
+		return nil, err
+	}
+	return env.Unwrap(id, priv)
+}
@@ -0,0 +1,59 @@
+package crypto
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestKeyEnvelope(t *testing.T) {
+	newID := func() (ID, *PrivateKey) {
+		priv, _ := NewPrivateKeyS256()
+		return PrivateKey2ID(priv, 1), priv
+	}
+	patient, patientPriv := newID()
+	researcher, researcherPriv := newID()
+	other, otherPriv := newID()
+
+	plain := []byte("ecg record")
+	sealed, env, err := SealData(plain, researcher, patient, researcher)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(env.Recipients) != 2 {
+		t.Fatalf("expect 2 recipients, but %d", len(env.Recipients))
+	}
+
+	data := env.Encode()
+	if !IsKeyEnvelope(data) {
+		t.Fatal("expect encoded key envelope")
+	}
+	for id, priv := range map[ID]*PrivateKey{patient: patientPriv, researcher: researcherPriv} {
+		key, err := OpenKey(data, id, priv)
+		if err != nil {
+			t.Fatalf("recipient %s open key failed: %v", id, err)
+		}
+		if opened, err := DecryptData(key, sealed); err != nil || !bytes.Equal(opened, plain) {
+			t.Fatalf("expect %s, but %s %v", plain, opened, err)
+		}
+	}
+	if _, err := OpenKey(data, other, otherPriv); err == nil {
+		t.Fatal("expect non-recipient open key failed")
+	}
+	// 冒充接收方也无法解开
+	if _, err := OpenKey(data, researcher, otherPriv); err == nil {
+		t.Fatal("expect open key with wrong private key failed")
+	}
+
+	// 旧的明文密钥原样返回
+	raw, _ := NewDataKey()
+	if key, err := OpenKey(raw, other, otherPriv); err != nil || !bytes.Equal(key, raw) {
+		t.Fatalf("expect raw key returned, but %x %v", key, err)
+	}
+
+	if _, err := WrapKey(raw); err == nil {
+		t.Fatal("expect wrap key without recipient failed")
+	}
+	if _, err := DecodeKeyEnvelope(append([]byte{}, envelopeMagic[0], 0)); err == nil {
+		t.Fatal("expect decode malformed envelope failed")
+	}
+}
@@ -6,4 +6,7 @@ package params
 const (
 	// BlockSize is 1MB
 	BlockSize = 1024 * 1024
+
+	// MaxTxsPerBlock 单个区块最多打包的交易数（不含coinbase）
+	MaxTxsPerBlock = 512
 )
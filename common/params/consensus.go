@@ -1,4 +1,12 @@
 package params
 
+// 可选的共识
+const (
+	// ConsensusPoT 交易量证明
+	ConsensusPoT = "pot"
+	// ConsensusRoundRobin 授权节点轮流出块，作为对比的基准共识
+	ConsensusRoundRobin = "roundrobin"
+)
+
 // 默认的Consensus
-var Consensus = 1
+var Consensus = ConsensusPoT
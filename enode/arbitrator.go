@@ -0,0 +1,232 @@
+package enode
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"math/bits"
+
+	"github.com/azd1997/ecoin/account"
+	"github.com/azd1997/ecoin/common"
+	"github.com/azd1997/ecoin/common/crypto"
+	"github.com/azd1997/ecoin/enode/bc"
+	"github.com/azd1997/ecoin/protocol/core"
+	"github.com/azd1997/ecoin/protocol/handshake"
+	storage "github.com/azd1997/ecoin/store"
+	"github.com/azd1997/ego/epattern"
+)
+
+// arbitrator 仲裁器，只对worker节点生效
+// 监听新加入区块链的区块，发现R-P交易流程三轮未完成陷入纠纷，且本节点被选为该流程的仲裁者时，
+// 从数据仓库取回目标数据，检验P提供的密钥能否解开，据此构建并提交仲裁交易
+type arbitrator struct {
+	acc    *account.Account
+	id     crypto.ID
+	chain  *bc.Chain
+	txPool *txPool
+
+	// 根据哈希获取交易，默认为chain.GetTx
+	getTx func(hash crypto.Hash) *core.Tx
+	// 根据TargetInfo.StoreAt打开数据仓库，默认为storage.Open
+	openStorage func(storeAt string) (storage.DataStorage, error)
+
+	blocks chan []*core.Block // 新加入区块链的区块
+
+	lm *epattern.LoopMode
+}
+
+func newArbitrator(acc *account.Account, c *bc.Chain, p *txPool) *arbitrator {
+	return &arbitrator{
+		acc:         acc,
+		id:          acc.UserId(),
+		chain:       c,
+		txPool:      p,
+		getTx:       c.GetTx,
+		openStorage: storage.Open,
+		blocks:      make(chan []*core.Block, 16),
+		lm:          epattern.NewLoop(1),
+	}
+}
+
+func (a *arbitrator) start() {
+	go a.loop()
+	a.lm.StartWorking()
+}
+
+func (a *arbitrator) stop() {
+	a.lm.Stop()
+}
+
+func (a *arbitrator) loop() {
+	a.lm.Add()
+	defer a.lm.Done()
+
+	for {
+		select {
+		case <-a.lm.D:
+			return
+		case blocks := <-a.blocks:
+			for _, b := range blocks {
+				a.checkBlock(b)
+			}
+		}
+	}
+}
+
+// 检查区块中是否有使R-P流程陷入纠纷的交易
+func (a *arbitrator) checkBlock(b *core.Block) {
+	for _, tx := range b.Txs {
+		if tx.Type != core.TX_R2P || tx.Uncompleted == 0 {
+			continue
+		}
+		w, err := a.chain.GetWorkflow(tx.Id)
+		if err != nil || w.State != bc.WorkflowDisputed || w.Txs[0].Type != core.TX_R2P {
+			continue
+		}
+		arbitratorID, err := a.chain.GetArbitrator(w)
+		if err != nil || arbitratorID != a.id {
+			continue
+		}
+
+		arb, err := a.arbitrate(w)
+		if err != nil {
+			logger.Warn("arbitrate workflow %X failed: %v\n", w.Origin, err)
+			continue
+		}
+		if err := a.txPool.addTx([]*core.Tx{arb}, false); err != nil {
+			logger.Warn("add arbitrate tx of workflow %X failed: %v\n", w.Origin, err)
+			continue
+		}
+		logger.Info("arbitrate workflow %X: %s\n", w.Origin, arb.Payload)
+	}
+}
+
+// 仲裁陷入纠纷的R-P流程w，构建签名后的仲裁交易
+// 逐段检验P最近一次回复中的密钥能否解开R所请求的目标数据：
+// 有任意一段解不开（或取不到数据），判定P作恶；否则判定R作恶
+// 密钥以密钥信封给出时，P须将其同时包装给仲裁候选者（见Enode.SendTargetKeys），否则仲裁者无法检验，同样判定P作恶
+func (a *arbitrator) arbitrate(w *bc.Workflow) (*core.Tx, error) {
+	td := &core.TargetData{}
+	if err := td.Decode(bytes.NewReader(w.Txs[0].Payload)); err != nil {
+		return nil, err
+	}
+	keys := latestKeys(w)
+
+	ta := &core.TargetArbitrate{Arbs: make([]bool, len(td.Hashes))}
+	for i, hash := range td.Hashes {
+		// 密钥与目标数据从前向后依次对应，密钥数少于数据段数时，最后一个密钥对应剩余所有数据段
+		if len(keys) > 0 {
+			key, err := crypto.OpenKey(keys[minInt(i, len(keys)-1)], a.id, a.acc.PrivateKey)
+			ta.Arbs[i] = err == nil && a.checkTarget(hash, key)
+		}
+		if !ta.Arbs[i] {
+			ta.Bad = true
+		}
+	}
+
+	tx := core.NewTx(core.TX_ARBITRATE, a.id, "", 0, ta.Encode(), w.Last().Id, 0, nil)
+	if err := tx.Sign(a.acc.PrivateKey); err != nil {
+		return nil, err
+	}
+	return tx, nil
+}
+
+// 检验key能否解开哈希为hash的上传交易所指向的目标数据
+func (a *arbitrator) checkTarget(hash crypto.Hash, key []byte) bool {
+	upload := a.getTx(hash)
+	if upload == nil || upload.Type != core.TX_UPLOAD {
+		return false
+	}
+	ti := &core.TargetInfo{}
+	if err := ti.Decode(bytes.NewReader(upload.Payload)); err != nil {
+		return false
+	}
+	ds, err := a.openStorage(ti.StoreAt)
+	if err != nil {
+		return false
+	}
+	records, err := ds.Get(common.TimeStamp(ti.TimeStart), common.TimeStamp(ti.TimeEnd), uint(ti.Num))
+	if err != nil || len(records) == 0 {
+		return false
+	}
+	// 取回的数据须与上传交易中的承诺一致
+	if !ti.CheckSegments(records) {
+		return false
+	}
+	for _, record := range records {
+		if _, err := crypto.DecryptData(key, record); err != nil {
+			return false
+		}
+	}
+	return true
+}
+
+// 检查上传交易时抽样挑战的数据记录条数
+const uploadSamples = 3
+
+// 检查上传交易时数据仓库单个响应的最大长度
+// 最大的响应为一条抽样记录及其默克尔证明：记录须能在一条消息中发给买方，不超过MaxMsgSize；
+// 证明为num条记录的默克尔树高度个哈希。 均按JSON中的base64编码计算
+func uploadResponseLimit(num uint) int64 {
+	const jsonOverhead = 64
+	record := base64.StdEncoding.EncodedLen(int(handshake.DefaultMaxMsgSize))
+	proof := (bits.Len(num) + 1) * (base64.StdEncoding.EncodedLen(sha256.Size) + 3)
+	return int64(record + proof + jsonOverhead)
+}
+
+// 检查上传交易所声称的数据：数据仓库可用，且在所声称的时间区间内至少有所声称的点数；
+// 再随机抽取若干条记录，检验其默克尔证明与上传交易中的承诺一致
+// remote表示交易来自其他节点，此时不允许访问本机文件系统上的数据仓库（file://）及非公网地址，且限制响应长度
+func checkUpload(tx *core.Tx, remote bool) error {
+	ti := &core.TargetInfo{}
+	if err := ti.Decode(bytes.NewReader(tx.Payload)); err != nil {
+		return err
+	}
+	start, end := common.TimeStamp(ti.TimeStart), common.TimeStamp(ti.TimeEnd)
+	var td *storage.TargetData
+	var err error
+	if remote {
+		var ds storage.DataStorage
+		if ds, err = storage.OpenRemote(ti.StoreAt, uploadResponseLimit(uint(ti.Num))); err != nil {
+			return fmt.Errorf("upload %X from remote: %v", tx.Id, err)
+		}
+		td = &storage.TargetData{StartTime: start, EndTime: end, NumsOfRecords: uint(ti.Num), Storage: ds}
+	} else if td, err = storage.NewTargetData(ti.StoreAt, start, end, uint(ti.Num)); err != nil {
+		return err
+	}
+	if err := td.IsOk(); err != nil {
+		return err
+	}
+	for _, i := range ti.SampleIndexes(uploadSamples) {
+		record, proof, err := storage.Sample(td.Storage, start, end, uint(ti.Num), uint(i))
+		if err != nil {
+			return err
+		}
+		if !ti.CheckSegment(i, record, proof) {
+			return fmt.Errorf("sample %d of upload %X mismatches commitment", i, tx.Id)
+		}
+	}
+	return nil
+}
+
+// 流程中P最近一次回复所提供的密钥
+func latestKeys(w *bc.Workflow) [][]byte {
+	for i := len(w.Txs) - 1; i >= 0; i-- {
+		if w.Txs[i].Type != core.TX_P2R {
+			continue
+		}
+		tk := &core.TargetKey{}
+		if err := tk.Decode(bytes.NewReader(w.Txs[i].Payload)); err == nil {
+			return tk.Keys
+		}
+	}
+	return nil
+}
+
+func minInt(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
@@ -0,0 +1,148 @@
+package enode
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/azd1997/ecoin/account"
+	"github.com/azd1997/ecoin/account/role"
+	"github.com/azd1997/ecoin/common"
+	"github.com/azd1997/ecoin/common/crypto"
+	"github.com/azd1997/ecoin/common/encoding"
+	"github.com/azd1997/ecoin/enode/bc"
+	"github.com/azd1997/ecoin/protocol/core"
+	storage "github.com/azd1997/ecoin/store"
+)
+
+// 内存中的数据仓库
+type memStorage struct {
+	records [][]byte
+}
+
+func (s *memStorage) Get(startTime, endTime common.TimeStamp, numsOfRecords uint) ([][]byte, error) {
+	return s.records, nil
+}
+
+func (s *memStorage) Query(startTime, endTime common.TimeStamp, numsOfRecords uint) (bool, error) {
+	return len(s.records) > 0, nil
+}
+
+func (s *memStorage) IsOk() bool {
+	return true
+}
+
+func TestArbitrate(t *testing.T) {
+	worker, _ := account.NewAccount(role.HOSPITAL)
+	patient, _ := account.NewAccount(role.PATIENT)
+	researcher, _ := account.NewAccount(role.RESEARCHER)
+
+	key, _ := crypto.NewDataKey()
+	sealed, _ := crypto.EncryptData(key, []byte("ecg"))
+	stores := map[string]*memStorage{"mqtt://store": {records: [][]byte{sealed}}}
+
+	ti, _ := core.NewTargetInfo("mqtt://store", 0, 0, 1, 2, [][]byte{sealed})
+	upload := core.NewTx(core.TX_UPLOAD, patient.UserId(), "", 0, ti.Encode(), nil, 0, nil)
+	txs := map[string]*core.Tx{encoding.ToHex(upload.Id): upload}
+
+	a := &arbitrator{
+		acc: worker,
+		id:  worker.UserId(),
+		getTx: func(hash crypto.Hash) *core.Tx {
+			return txs[encoding.ToHex(hash)]
+		},
+		openStorage: func(storeAt string) (storage.DataStorage, error) {
+			return stores[storeAt], nil
+		},
+	}
+
+	// R请求目标数据，P回复密钥，R认为未完成
+	workflow := func(keys ...[]byte) *bc.Workflow {
+		td := &core.TargetData{Hashes: []crypto.Hash{upload.Id}}
+		r2p := core.NewTx(core.TX_R2P, researcher.UserId(), patient.UserId(), 10, td.Encode(), nil, 0, nil)
+		tk := &core.TargetKey{Keys: keys}
+		p2r := core.NewTx(core.TX_P2R, patient.UserId(), researcher.UserId(), 0, tk.Encode(), r2p.Id, 0, nil)
+		last := core.NewTx(core.TX_R2P, researcher.UserId(), patient.UserId(), 0, nil, p2r.Id, 1, nil)
+		return &bc.Workflow{Origin: r2p.Id, Txs: []*core.Tx{r2p, p2r, last}, State: bc.WorkflowDisputed}
+	}
+
+	// 密钥信封：包装给仲裁者时可以检验，只包装给请求方时无法检验
+	wrap := func(recipients ...crypto.ID) []byte {
+		env, _ := crypto.WrapKey(key, recipients...)
+		return env.Encode()
+	}
+
+	cases := []struct {
+		name string
+		keys [][]byte
+		bad  bool
+	}{
+		{"valid key", [][]byte{key}, false},
+		{"wrapped to arbitrator", [][]byte{wrap(researcher.UserId(), worker.UserId())}, false},
+		{"wrapped to requester only", [][]byte{wrap(researcher.UserId())}, true},
+		{"wrong key", [][]byte{make([]byte, crypto.DataKeyLen)}, true},
+		{"no key", nil, true},
+	}
+	for _, c := range cases {
+		w := workflow(c.keys...)
+		tx, err := a.arbitrate(w)
+		if err != nil {
+			t.Fatalf("%s: %v", c.name, err)
+		}
+		if err := tx.Verify(); err != nil {
+			t.Fatalf("%s: invalid arbitrate tx: %v", c.name, err)
+		}
+		if !bytes.Equal(tx.PrevTxId, w.Last().Id) || tx.From != worker.UserId() {
+			t.Fatalf("%s: arbitrate tx should follow the last tx of workflow", c.name)
+		}
+		ta := &core.TargetArbitrate{}
+		if err := ta.Decode(bytes.NewReader(tx.Payload)); err != nil {
+			t.Fatalf("%s: %v", c.name, err)
+		}
+		if ta.Bad != c.bad || len(ta.Arbs) != 1 || ta.Arbs[0] == c.bad {
+			t.Fatalf("%s: unexpected arbitration %s", c.name, ta)
+		}
+	}
+}
+
+func TestCheckUpload(t *testing.T) {
+	dir, err := ioutil.TempDir("", "upload")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	ls := storage.NewLocalStorage(dir)
+	var segments [][]byte
+	for i := 1; i <= 5; i++ {
+		segment := []byte(fmt.Sprintf("ecg_%d", i))
+		ls.Put(common.TimeStamp(i), segment)
+		segments = append(segments, segment)
+	}
+
+	patient, _ := account.NewAccount(role.PATIENT)
+	hospital, _ := account.NewAccount(role.HOSPITAL)
+	upload := func(segments [][]byte) *core.Tx {
+		ti, _ := core.NewTargetInfo("file://"+dir, 0, 0, 1, 5, segments)
+		return core.NewTx(core.TX_UPLOAD, patient.UserId(), hospital.UserId(), 0, ti.Encode(), nil, 0, nil)
+	}
+
+	if err := checkUpload(upload(segments), false); err != nil {
+		t.Fatalf("expect upload accepted: %v", err)
+	}
+	// 承诺与数据仓库中的数据不一致，抽样挑战失败
+	forged := [][]byte{[]byte("a"), []byte("b"), []byte("c"), []byte("d"), []byte("e")}
+	if err := checkUpload(upload(forged), false); err == nil {
+		t.Fatal("expect upload with forged commitment refused")
+	}
+	// 数据仓库中的数据不足所声称的点数
+	if err := checkUpload(upload(append(segments, []byte("ecg_6"))), false); err == nil {
+		t.Fatal("expect upload with missing records refused")
+	}
+	// 来自其他节点的上传交易不能指向本机文件系统
+	if err := checkUpload(upload(segments), true); err == nil {
+		t.Fatal("expect remote upload with local storage refused")
+	}
+}
@@ -0,0 +1,249 @@
+package bc
+
+import (
+	"bytes"
+	"fmt"
+
+	"github.com/azd1997/ecoin/common/crypto"
+	"github.com/azd1997/ecoin/protocol/core"
+	"github.com/azd1997/ecoin/store/db"
+)
+
+// 仲裁者选取
+// 流程陷入纠纷（见WorkflowDisputed）后，由一名worker仲裁。仲裁者须能打开流程中的数据密钥，
+// 因此候选仲裁者为流程中全部密钥信封的共同接收方（排除交易双方及被封禁者）。
+// 包装密钥时，新加入的候选者须为最近keyRecipientWindow个区块的构建者，且与流程中此前的密钥信封至少有一个共同的候选者（见checkKeyRecipients）。
+// 流程中没有密钥信封（旧的明文密钥）时，候选仲裁者为使流程陷入纠纷的交易所在区块及其之前共arbitratorWindow个区块的构建者。
+// 从候选者中选取 hash(流程初始交易哈希 + 候选者ID) 最小者。所有节点根据链上数据可以得到相同的结果
+
+// 候选仲裁者所取的区块数
+const arbitratorWindow = 16
+
+// 密钥信封的候选仲裁者须为其所在区块之前多少个区块的构建者。
+// 发送方按发送时最新的arbitratorWindow个区块包装，这里留出交易上链的延迟
+const keyRecipientWindow = 2 * arbitratorWindow
+
+// 从候选者中为初始交易为origin的流程选取仲裁者，exclude中的账户不参与选取
+func selectArbitrator(origin crypto.Hash, candidates []crypto.ID, exclude ...crypto.ID) crypto.ID {
+	var result crypto.ID
+	var min []byte
+	for _, id := range candidates {
+		if containsID(exclude, id) {
+			continue
+		}
+		score := crypto.HashD(append(append([]byte{}, origin...), id...))
+		if min == nil || bytes.Compare(score, min) < 0 {
+			result, min = id, score
+		}
+	}
+	return result
+}
+
+func containsID(ids []crypto.ID, id crypto.ID) bool {
+	for _, v := range ids {
+		if v == id {
+			return true
+		}
+	}
+	return false
+}
+
+// 获取陷入纠纷的流程w的仲裁者
+func (b *branch) getArbitrator(w *Workflow) (crypto.ID, error) {
+	if w.State != WorkflowDisputed {
+		return "", fmt.Errorf("workflow %X is %s, not disputed", w.Origin, w.State)
+	}
+
+	candidates, sealed := w.KeyRecipients()
+	if !sealed {
+		var err error
+		if candidates, err = b.recentCreators(w.Last().Id, arbitratorWindow); err != nil {
+			return "", err
+		}
+	}
+	// 交易双方以及已被封禁的worker不参与选取
+	exclude := []crypto.ID{w.Requester, w.Responder}
+	for _, id := range candidates {
+		if b.isBanned(id) {
+			exclude = append(exclude, id)
+		}
+	}
+	arbitrator := selectArbitrator(w.Origin, candidates, exclude...)
+	if arbitrator == "" {
+		return "", fmt.Errorf("no arbitrator candidate for workflow %X", w.Origin)
+	}
+	return arbitrator, nil
+}
+
+// 检查仲裁交易：仲裁者须为选定的仲裁者，仲裁结果须与目标数据一一对应
+// w为仲裁交易所要结束的流程（仲裁之前的状态）
+func (b *branch) checkArbitrate(tx *core.Tx, w *Workflow) error {
+	arbitrator, err := b.getArbitrator(w)
+	if err != nil {
+		return ErrInvalidWorkflow{tx.Id, err.Error()}
+	}
+	if tx.From != arbitrator {
+		return ErrInvalidWorkflow{tx.Id, "arbitrator should be " + arbitrator.ToHex()}
+	}
+
+	if w.kind() == core.TX_R2P {
+		td, ta := &core.TargetData{}, &core.TargetArbitrate{}
+		if err := td.Decode(bytes.NewReader(w.Txs[0].Payload)); err != nil {
+			return ErrInvalidWorkflow{tx.Id, err.Error()}
+		}
+		if err := ta.Decode(bytes.NewReader(tx.Payload)); err != nil {
+			return ErrInvalidWorkflow{tx.Id, err.Error()}
+		}
+		if len(ta.Arbs) != len(td.Hashes) {
+			return ErrInvalidWorkflow{tx.Id, fmt.Sprintf("%d arbitration results for %d targets",
+				len(ta.Arbs), len(td.Hashes))}
+		}
+	}
+	return nil
+}
+
+// 检查包装数据密钥的交易tx。prior为tx之前的流程，tx为初始交易时为nil
+// 交易双方以外的接收方即候选仲裁者：流程中已有的候选者可以继续使用，新加入的须为该分支上最近keyRecipientWindow个区块的构建者；
+// 并且与流程中此前的密钥信封至少有一个共同的候选者，保证流程陷入纠纷时选出的仲裁者能打开全部密钥
+func (b *branch) checkKeyRecipients(tx *core.Tx, prior *Workflow) error {
+	ids, sealed := txKeyRecipients(tx)
+	if !sealed {
+		return nil
+	}
+
+	var known []crypto.ID
+	priorSealed := false
+	if prior != nil {
+		known, priorSealed = prior.KeyRecipients()
+	}
+	var creators []crypto.ID
+	for _, id := range ids {
+		if id == tx.From || id == tx.To || containsID(known, id) {
+			continue
+		}
+		if creators == nil {
+			creators = b.headCreators(keyRecipientWindow, false)
+		}
+		if !containsID(creators, id) {
+			return ErrInvalidWorkflow{tx.Id, fmt.Sprintf("key recipient %s is not a recent block creator", id.ToHex())}
+		}
+	}
+
+	if priorSealed {
+		ids = intersectIDs(known, ids)
+	}
+	for _, id := range ids {
+		if id != tx.From && id != tx.To {
+			return nil
+		}
+	}
+	return ErrInvalidWorkflow{tx.Id, "data keys are not wrapped to any arbitrator candidate"}
+}
+
+// 交易tx中密钥信封的共同接收方。tx不包含密钥或使用旧的明文密钥时返回false
+func txKeyRecipients(tx *core.Tx) ([]crypto.ID, bool) {
+	switch tx.Type {
+	case core.TX_P2R:
+		tk := &core.TargetKey{}
+		if err := tk.Decode(bytes.NewReader(tx.Payload)); err != nil {
+			return nil, false
+		}
+		return tk.Recipients()
+	case core.TX_P2H, core.TX_P2D:
+		if len(tx.Payload) == 0 {
+			return nil, false
+		}
+		tdk := &core.TargetDataWithKey{}
+		if err := tdk.Decode(bytes.NewReader(tx.Payload)); err != nil {
+			return nil, false
+		}
+		return tdk.Recipients()
+	}
+	return nil, false
+}
+
+func intersectIDs(a, b []crypto.ID) []crypto.ID {
+	var result []crypto.ID
+	for _, id := range a {
+		if containsID(b, id) {
+			result = append(result, id)
+		}
+	}
+	return result
+}
+
+// 从包含交易txHash的区块开始向前，共n个区块的构建者（去重）
+// 交易须已在该分支上（包括已存储的部分）
+func (b *branch) recentCreators(txHash crypto.Hash, n int) ([]crypto.ID, error) {
+	var result []crypto.ID
+	add := func(id crypto.ID) {
+		if !containsID(result, id) {
+			result = append(result, id)
+		}
+	}
+
+	// 先在缓存中查找交易所在区块
+	var height uint64
+	found := false
+	for iter := b.head; iter != nil && !found; iter = iter.prev {
+		for _, tx := range iter.Txs {
+			if bytes.Equal(tx.Id, txHash) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			continue
+		}
+		for ; iter != nil && n > 0; iter = iter.prev {
+			add(iter.CreateBy)
+			height = iter.height
+			n--
+		}
+		break
+	}
+
+	// 缓存中没有，或者缓存中的区块不足n个，继续在数据库中查找
+	if !found {
+		_, h, err := db.GetTxViaHash(txHash)
+		if err != nil {
+			return nil, fmt.Errorf("block of tx %X not found: %v", txHash, err)
+		}
+		height = h + 1
+	}
+	for ; n > 0 && height > 1; n-- {
+		height--
+		header, _, err := db.GetHeaderViaHeight(height)
+		if err != nil {
+			return nil, err
+		}
+		add(header.CreateBy)
+	}
+	return result, nil
+}
+
+// 分支上最新n个区块的构建者（去重），skipBanned为true时排除已被封禁者
+func (b *branch) headCreators(n int, skipBanned bool) []crypto.ID {
+	var result []crypto.ID
+	add := func(id crypto.ID) {
+		if !containsID(result, id) && !(skipBanned && b.isBanned(id)) {
+			result = append(result, id)
+		}
+	}
+
+	height := b.height() + 1
+	for iter := b.head; iter != nil && n > 0; iter = iter.prev {
+		add(iter.CreateBy)
+		height = iter.height
+		n--
+	}
+	for ; n > 0 && height > 1; n-- {
+		height--
+		header, _, err := db.GetHeaderViaHeight(height)
+		if err != nil {
+			break
+		}
+		add(header.CreateBy)
+	}
+	return result
+}
@@ -0,0 +1,88 @@
+package bc
+
+import (
+	"testing"
+
+	"github.com/azd1997/ecoin/account/role"
+	"github.com/azd1997/ecoin/common/crypto"
+	"github.com/azd1997/ecoin/protocol/core"
+)
+
+func TestSelectArbitrator(t *testing.T) {
+	candidates := []crypto.ID{genID(role.HOSPITAL), genID(role.HOSPITAL), genID(role.RESEARCHER)}
+	origin := crypto.HashD([]byte("origin"))
+
+	// 与候选者顺序无关
+	first := selectArbitrator(origin, candidates)
+	reversed := []crypto.ID{candidates[2], candidates[1], candidates[0]}
+	if got := selectArbitrator(origin, reversed); got != first {
+		t.Fatalf("expect %s, but %s", first.ToHex(), got.ToHex())
+	}
+
+	// 被排除的账户不参与选取
+	if got := selectArbitrator(origin, candidates, first); got == first || got == "" {
+		t.Fatalf("expect another arbitrator, but %q", got)
+	}
+	if got := selectArbitrator(origin, candidates, candidates...); got != "" {
+		t.Fatalf("expect no arbitrator, but %s", got.ToHex())
+	}
+}
+
+func TestCheckKeyRecipients(t *testing.T) {
+	patient, researcher := genID(role.PATIENT), genID(role.RESEARCHER)
+	first, second, stranger := genID(role.HOSPITAL), genID(role.HOSPITAL), genID(role.HOSPITAL)
+	key := make([]byte, crypto.DataKeyLen)
+
+	// 最近的区块由first、second构建
+	parent := newBlock(core.NewBlock(core.NewBlockHeaderV1(crypto.HashD([]byte("base")), first, nil), nil), 1, true)
+	b := newBranch(parent)
+	b.add(newBlock(core.NewBlock(core.NewBlockHeaderV1(parent.Hash, second, nil), nil), 2, false))
+
+	req := core.NewTx(core.TX_R2P, researcher, patient, 0, nil, nil, 0, nil)
+	reply := func(prev *core.Tx, recipients ...crypto.ID) *core.Tx {
+		tk, err := core.NewTargetKey([][]byte{key}, append([]crypto.ID{patient, researcher}, recipients...)...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return core.NewTx(core.TX_P2R, patient, researcher, 0, tk.Encode(), prev.Id, 0, nil)
+	}
+	w, err := newWorkflow(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := b.checkKeyRecipients(reply(req, first, second), w); err != nil {
+		t.Fatalf("expect keys wrapped to recent creators valid, but %v", err)
+	}
+	if err := b.checkKeyRecipients(reply(req), w); err == nil {
+		t.Fatal("expect keys wrapped to no arbitrator candidate invalid")
+	}
+	if err := b.checkKeyRecipients(reply(req, first, stranger), w); err == nil {
+		t.Fatal("expect keys wrapped to non creator invalid")
+	}
+
+	// 流程中已有的候选者可以继续使用，但须与此前的密钥信封有共同的候选者
+	p2r := reply(req, first)
+	if err := w.apply(p2r); err != nil {
+		t.Fatal(err)
+	}
+	if ids, sealed := w.KeyRecipients(); !sealed || !containsID(ids, first) || containsID(ids, second) {
+		t.Fatalf("unexpected key recipients %v", ids)
+	}
+	again := core.NewTx(core.TX_R2P, researcher, patient, 0, nil, p2r.Id, 1, nil)
+	if err := w.apply(again); err != nil {
+		t.Fatal(err)
+	}
+	if err := b.checkKeyRecipients(reply(again, second), w); err == nil {
+		t.Fatal("expect keys without common arbitrator candidate invalid")
+	}
+	if err := b.checkKeyRecipients(reply(again, first), w); err != nil {
+		t.Fatalf("expect keys wrapped to known candidate valid, but %v", err)
+	}
+
+	// 旧的明文密钥不限制仲裁者
+	plain := core.NewTx(core.TX_P2R, patient, researcher, 0, (&core.TargetKey{Keys: [][]byte{key}}).Encode(), req.Id, 0, nil)
+	if _, sealed := txKeyRecipients(plain); sealed {
+		t.Fatal("expect plaintext keys not sealed")
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"sync"
 
+	"github.com/azd1997/ecoin/common/crypto"
 	"github.com/azd1997/ecoin/common/encoding"
 	"github.com/azd1997/ecoin/protocol/core"
 )
@@ -68,6 +69,16 @@ func (b *block) isPrevOf(cb *core.Block) bool {
 	return ok
 }
 
+// 是否已有由creator构建的子区块
+func (b *block) hasNextBy(creator crypto.ID) bool {
+	found := false
+	b.nexts.Range(func(k, v interface{}) bool {
+		found = v.(*block).CreateBy == creator
+		return !found
+	})
+	return found
+}
+
 // 子区块的数量
 func (b *block) nextsNum() int {
 	result := 0
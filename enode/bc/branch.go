@@ -31,25 +31,34 @@ type branch struct {
 
 	// 交易缓存
 	txCache sync.Map // <hex(tx.Id), *core.Tx>
+	// 后续交易缓存，用于沿交易流程向后查找
+	nextCache sync.Map // <hex(tx.PrevTxId), *core.Tx>
 	// 区块缓存
 	blockCache sync.Map // <hex(block.Hash), *block>
+
+	// 账户状态覆盖层，记录该分支上未存储区块带来的账户状态变动
+	state *accountState
 }
 
 // 新建分支
 func newBranch(begin *block) *branch {
 	result := &branch{
-		head: begin,
-		tail: begin,
+		head:  begin,
+		tail:  begin,
+		state: newAccountState(),
 	}
 
+	var unstored []*block
 	iter := begin
 	for {
 		bKey := encoding.ToHex(iter.Hash)
 		result.blockCache.Store(bKey, iter)
 
 		for _, tx := range iter.Txs {
-			txKey := encoding.ToHex(tx.Id)
-			result.txCache.Store(txKey, tx)
+			result.cacheTx(tx)
+		}
+		if !iter.isStored() {
+			unstored = append(unstored, iter)
 		}
 
 		iter = iter.prev
@@ -62,6 +71,11 @@ func newBranch(begin *block) *branch {
 		}
 	}
 
+	// 账户状态须按区块先后顺序计入覆盖层
+	for i := len(unstored) - 1; i >= 0; i-- {
+		result.state.applyBlock(unstored[i].Block)
+	}
+
 	return result
 }
 
@@ -97,13 +111,20 @@ func (b *branch) add(newBlock *block) error {
 	b.blockCache.Store(nbKey, newBlock)
 
 	for _, tx := range newBlock.Txs {
-		key := encoding.ToHex(tx.Id)
-		b.txCache.Store(key, tx)
+		b.cacheTx(tx)
+	}
+	if !newBlock.isStored() {
+		b.state.applyBlock(newBlock.Block)
 	}
 
 	return nil
 }
 
+// 分支上的某个区块被写入数据库之后，将其账户状态变动从覆盖层移到数据库（即从覆盖层扣除）
+func (b *branch) rebase(stored *block) {
+	b.state.revertBlock(stored.Block)
+}
+
 // 分支的哈希标识，取的是分支末端的区块哈希
 func (b *branch) hash() crypto.Hash {
 	return b.head.Hash
@@ -126,6 +147,23 @@ func (b *branch) getBlock(hash crypto.Hash) *block {
 	return nil
 }
 
+// 缓存交易，有来源交易的同时记录到后续交易缓存
+func (b *branch) cacheTx(tx *core.Tx) {
+	b.txCache.Store(encoding.ToHex(tx.Id), tx)
+	if tx.HasPrevTx() {
+		b.nextCache.Store(encoding.ToHex(tx.PrevTxId), tx)
+	}
+}
+
+// 分支上（内存中）的区块记录的未出块胜者总数。各分支共享分叉点之前的区块，因此差值即分叉后的差异
+func (b *branch) missedNum() int {
+	n := 0
+	for iter := b.head; iter != nil; iter = iter.prev {
+		n += missedNum(iter.Block)
+	}
+	return n
+}
+
 // 在该分支搜索交易
 func (b *branch) getTx(hash crypto.Hash) *core.Tx {
 	eKey := encoding.ToHex(hash)
@@ -138,7 +176,8 @@ func (b *branch) getTx(hash crypto.Hash) *core.Tx {
 }
 
 // 根据该分支，以及已经存储（固化）的过往区块链，校验新来的区块是否合法
-func (b *branch) verifyBlock(cb *core.Block) error {
+// checker为共识相关的区块检查，为nil时不做共识检查
+func (b *branch) verifyBlock(cb *core.Block, checker ConsensusChecker) error {
 	// 检查区块结构的有效性
 	if err := cb.Verify(); err != nil {
 		return fmt.Errorf("block struct verify failed:%v", err)
@@ -146,12 +185,12 @@ func (b *branch) verifyBlock(cb *core.Block) error {
 
 	// 根据区块链上下文（该分支及已固化的区块链）检查区块
 
-	// 1. time
-	t := time.Unix(cb.Time, 0)
-	if t.Sub(time.Now()) > 3*time.Second {
+	// 1. time （区块时间为ns级别）
+	t := time.Unix(0, cb.Time)
+	if t.Sub(time.Now()) > MaxFutureBlockTime {
 		return fmt.Errorf("invalid future time")
 	}
-	if t.Before(time.Unix(b.head.time(), 0)) {
+	if t.Before(time.Unix(0, b.head.time())) {
 		return fmt.Errorf("invalid past time")
 	}
 
@@ -162,18 +201,31 @@ func (b *branch) verifyBlock(cb *core.Block) error {
 		return fmt.Errorf("mismatch last hash")
 	}
 
-	// 4. pot
+	// 4. consensus
+	barred := recentMissed(b.head, MissedRounds)
+	if checker != nil {
+		if err := checker.CheckBlock(cb, b.height()+1, barred); err != nil {
+			return err
+		}
+	}
+
+	// 5. coinbase
+	if err := b.verifyCoinbase(cb, b.height()+1, barred); err != nil {
+		return err
+	}
 
-	// 5. tx
+	// 6. tx
 	if cb.IsEmptyMerkleRoot() {
 		return nil
 	}
 
 	var leafs merkle.MerkleLeafs
+	ctx := newTxContext()
 	for _, tx := range cb.Txs {
-		if err := b.verifyTx(tx); err != nil {
+		if err := b.verifyTxWithContext(tx, ctx); err != nil {
 			return err
 		}
+		ctx.add(tx)
 		leafs = append(leafs, tx.Id)
 	}
 
@@ -185,9 +237,85 @@ func (b *branch) verifyBlock(cb *core.Block) error {
 	return nil
 }
 
+// 检查区块中的coinbase交易：至多一个，必须位于区块交易列表首位，奖励发给区块构建者，
+// 且奖励数额符合出块奖励规则（见CoinbaseReward）
+// barred为近期已被记录的未出块胜者，本轮本就不能胜出
+func (b *branch) verifyCoinbase(cb *core.Block, height uint64, barred []crypto.ID) error {
+	for i, tx := range cb.Txs {
+		if tx.Type != core.TX_COINBASE {
+			continue
+		}
+		if i != 0 {
+			return fmt.Errorf("coinbase tx %X must be the first tx of block", tx.Id)
+		}
+		if tx.To != cb.CreateBy {
+			return fmt.Errorf("coinbase tx %X is not rewarded to block creator", tx.Id)
+		}
+		if reward := CoinbaseReward(cb.CreateBy, height); tx.Amount != reward {
+			return fmt.Errorf("coinbase tx %X rewards %d, but expect %d at height %d",
+				tx.Id, tx.Amount, reward, height)
+		}
+		if err := verifyMissed(cb, tx, b.head.time(), barred); err != nil {
+			return err
+		}
+		// 已收到被记录者在同一父区块上构建的区块，说明其并未错过出块，只是接替区块的出块者看到得晚
+		for _, p := range tx.Missed() {
+			if b.head.hasNextBy(p.From) {
+				return fmt.Errorf("coinbase tx %X records missed winner %s, but its block on the same base has been seen",
+					tx.Id, p.From.ToHex())
+			}
+		}
+	}
+	return nil
+}
+
+// 检查coinbase交易tx记录的未出块胜者。被记录者会被扣除信誉分并在之后若干轮中不能胜出，
+// 因此出块者只能记录确实排在自己之前的胜者：
+//	1. 被记录的胜者出块的时限都已过（见missedTimeout），且区块时间不超前于本地时间。
+//		区块时间由出块者自行填写，只能据此排除明显的提前出块；
+//		被记录者的区块是否已经出现，由verifyCoinbase检查，最长链选择也优先不记录未出块胜者的分支
+//	2. 每个证明都是基于同一父区块竞争的其他worker的证明，且不在barred中（本轮本就不能胜出）
+//	3. 证明按排名（与proofPool.WinnerProof相同的core.PoTProof.GreaterThan）从高到低依次排列，
+//		且都严格高于出块者自身的证明，即出块者恰好是这些胜者依次未出块后的接替者
+// 至于是否遗漏了排在出块者之前的证明，由共识检查（见CheckPoT）负责
+func verifyMissed(cb *core.Block, tx *core.Tx, prevTime int64, barred []crypto.ID) error {
+	missed := tx.Missed()
+	if len(missed) == 0 {
+		return nil
+	}
+	if cb.Time-prevTime < int64(missedTimeout(len(missed))) {
+		return fmt.Errorf("coinbase tx %X records missed winners before timeout", tx.Id)
+	}
+	if time.Unix(0, cb.Time).Sub(time.Now()) > MaxFutureBlockTime {
+		return fmt.Errorf("coinbase tx %X records missed winners with future block time", tx.Id)
+	}
+	own := blockPoTProof(cb)
+	for i, p := range missed {
+		if !bytes.Equal(p.Base, cb.PrevHash) || p.From == cb.CreateBy || containsID(barred, p.From) {
+			return fmt.Errorf("coinbase tx %X records invalid missed winner %s", tx.Id, p.From.ToHex())
+		}
+		if !p.GreaterThan(own) {
+			return fmt.Errorf("coinbase tx %X records missed winner %s not ranked above block creator",
+				tx.Id, p.From.ToHex())
+		}
+		if i > 0 && !missed[i-1].GreaterThan(p) {
+			return fmt.Errorf("coinbase tx %X records missed winners out of rank order", tx.Id)
+		}
+	}
+	return nil
+}
+
 // 根据该分支和已固化的区块链去检查交易的有效性
-// TODO
+// coinbase交易只能随区块一起校验
 func (b *branch) verifyTx(tx *core.Tx) error {
+	if tx.Type == core.TX_COINBASE {
+		return fmt.Errorf("coinbase tx %X is only allowed in block", tx.Id)
+	}
+	return b.verifyTxWithContext(tx, newTxContext())
+}
+
+// 根据该分支、已固化的区块链以及区块内上下文ctx检查交易的有效性
+func (b *branch) verifyTxWithContext(tx *core.Tx, ctx *txContext) error {
 	// 检查交易结构的有效性
 	if err := tx.Verify(); err != nil {
 		return fmt.Errorf("tx struct verify failed:%v", err)
@@ -195,22 +323,169 @@ func (b *branch) verifyTx(tx *core.Tx) error {
 
 	// 根据该分支和已固化的区块链深度检查该交易
 
+	// 1. 重复交易
+	// 区块内上下文
+	if _, ok := ctx.txs[encoding.ToHex(tx.Id)]; ok {
+		return ErrTxAlreadyExist{tx.Id}
+	}
 	// 该分支的交易缓存
 	if v := b.getTx(tx.Id); v != nil {
 		return ErrTxAlreadyExist{tx.Id}
 	}
-
 	// 数据库（已固化区块链）检查
 	if db.HasTx(tx.Id) {
 		return ErrTxAlreadyExist{tx.Id}
 	}
 
+	// 2. 交易双方角色
+	if err := checkTxRoles(tx); err != nil {
+		return err
+	}
+
+	// 3. 来源交易
+	var prev *core.Tx
+	if tx.HasPrevTx() {
+		if prev = b.findTx(tx.PrevTxId, ctx); prev == nil {
+			return ErrInvalidPrevTx{tx.Id, fmt.Sprintf("prev tx %X not found", tx.PrevTxId)}
+		}
+	}
+	if err := checkPrevTxType(tx, prev); err != nil {
+		return err
+	}
+
+	// 4. 两方交易流程
+	if isWorkflowTx(tx) {
+		if err := b.verifyWorkflow(tx, prev, ctx); err != nil {
+			return err
+		}
+	}
+
+	// 5. 账户注册
+	if err := b.verifyRegistration(tx, prev, ctx); err != nil {
+		return err
+	}
+
+	// 6. 信誉分
+	if err := b.verifyCredit(tx); err != nil {
+		return err
+	}
+
+	// 7. 发起方余额（转账数额与交易费）
+	cost := txCost(tx)
+	if isEmptyID(tx.From) || cost == 0 {
+		return nil
+	}
+	balance, err := b.getBalance(tx.From)
+	if err != nil {
+		return err
+	}
+	balance += ctx.deltas[tx.From]
+	if balance < cost {
+		return ErrInsufficientBalance{tx.From.ToHex(), balance, cost}
+	}
+
 	return nil
 }
 
-// TODO
-func (b *branch) potCheck() bool {
-	return true
+// 检查tx是否为其所在交易流程的合法下一步。prev为tx的来源交易
+func (b *branch) verifyWorkflow(tx *core.Tx, prev *core.Tx, ctx *txContext) error {
+	if prev == nil {
+		if _, err := newWorkflow(tx); err != nil {
+			return err
+		}
+		return b.checkKeyRecipients(tx, nil)
+	}
+
+	// 流程中的每一笔交易只能有一个后续交易
+	if next := b.findNextTx(prev.Id, ctx); next != nil {
+		return ErrInvalidWorkflow{tx.Id, fmt.Sprintf("prev tx %X already has next tx %X", prev.Id, next.Id)}
+	}
+
+	w, err := buildWorkflow(prev, func(hash crypto.Hash) *core.Tx {
+		return b.findTx(hash, ctx)
+	})
+	if err != nil {
+		return err
+	}
+	// 仲裁交易只能由选定的仲裁者发起
+	if tx.Type == core.TX_ARBITRATE && w.State == WorkflowDisputed {
+		if err := b.checkArbitrate(tx, w); err != nil {
+			return err
+		}
+	}
+	if err := b.checkKeyRecipients(tx, w); err != nil {
+		return err
+	}
+	return w.apply(tx)
+}
+
+// 获取tx所在的交易流程（包括tx之后已上链的交易）
+func (b *branch) getWorkflow(tx *core.Tx) (*Workflow, error) {
+	ctx := newTxContext()
+	w, err := buildWorkflow(tx, func(hash crypto.Hash) *core.Tx {
+		return b.findTx(hash, ctx)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	for next := b.findNextTx(tx.Id, ctx); next != nil; next = b.findNextTx(next.Id, ctx) {
+		if err := w.apply(next); err != nil {
+			return nil, err
+		}
+	}
+	return w, nil
+}
+
+// 在区块内上下文、该分支以及数据库中查找以hash为来源交易的后续交易
+func (b *branch) findNextTx(hash crypto.Hash, ctx *txContext) *core.Tx {
+	key := encoding.ToHex(hash)
+	if tx, ok := ctx.next[key]; ok {
+		return tx
+	}
+	if v, ok := b.nextCache.Load(key); ok {
+		return v.(*core.Tx)
+	}
+	if next, err := db.GetNextTxHash(hash); err == nil {
+		if tx, _, err := db.GetTxViaHash(next); err == nil {
+			return tx
+		}
+	}
+	return nil
+}
+
+// 在区块内上下文、该分支以及数据库中查找交易
+func (b *branch) findTx(hash crypto.Hash, ctx *txContext) *core.Tx {
+	if tx, ok := ctx.txs[encoding.ToHex(hash)]; ok {
+		return tx
+	}
+	if tx := b.getTx(hash); tx != nil {
+		return tx
+	}
+	if tx, _, err := db.GetTxViaHash(hash); err == nil {
+		return tx
+	}
+	return nil
+}
+
+// 查询账户在该分支上的余额：已固化的余额加上该分支覆盖层中的变动
+func (b *branch) getBalance(id crypto.ID) (int64, error) {
+	dbBalance, err := db.GetBalanceViaID(id)
+	if err != nil {
+		return 0, err
+	}
+
+	return int64(dbBalance) + b.state.balance(id), nil
+}
+
+// 查询账户在该分支上冻结在托管池中的款项
+func (b *branch) getLocked(id crypto.ID) (int64, error) {
+	dbLocked, err := db.GetLockedViaID(id)
+	if err != nil {
+		return 0, err
+	}
+
+	return int64(dbLocked) + b.state.lockedBalance(id), nil
 }
 
 // 从缓存移除某区块及其所包含交易
@@ -221,6 +496,9 @@ func (b *branch) removeFromCache(rmBlock *block) {
 	for _, tx := range rmBlock.Block.Txs {
 		txKey := encoding.ToHex(tx.Id)
 		b.txCache.Delete(txKey)
+		if tx.HasPrevTx() {
+			b.nextCache.Delete(encoding.ToHex(tx.PrevTxId))
+		}
 	}
 }
 
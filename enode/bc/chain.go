@@ -31,8 +31,8 @@ const (
 )
 
 var (
-	// BlockInterval 期望的区块产生间隔
-	BlockInterval           time.Duration
+	// BlockInterval 期望的区块产生间隔。可由Config.BlockInterval（单位s）覆盖
+	BlockInterval           = 10 * time.Second
 )
 
 
@@ -56,6 +56,10 @@ type Chain struct {
 	branchLock    sync.RWMutex
 	// 待处理区块通道，有缓冲(16)
 	pendingBlocks chan []*core.Block
+	// 共识相关的区块检查
+	checker ConsensusChecker
+	// 新区块通知。区块加入分支后将其推送出去（例如交易池据此移除已打包的交易）
+	blocksNotify []chan<- []*core.Block
 	lm            *epattern.LoopMode
 }
 
@@ -77,6 +81,10 @@ type Config struct {
 
 // Init 从数据库初始化Chain。只允许调用一次
 func (c *Chain) Init(conf *Config) error {
+	if conf.BlockInterval > 0 {
+		BlockInterval = time.Duration(conf.BlockInterval) * time.Second
+	}
+
 	if !db.HasGenesis() {
 		logger.Info("chain starts with empty database")
 		if err := c.initGenesis(conf.Genesis); err != nil {
@@ -98,6 +106,66 @@ func (c *Chain) Stop() {
 	c.lm.Stop()
 }
 
+// SetConsensusChecker 设置共识相关的区块检查，需在Start之前调用
+// 未设置时不对区块做共识检查
+func (c *Chain) SetConsensusChecker(checker ConsensusChecker) {
+	c.checker = checker
+}
+
+// AddBlocksNotify 添加新区块通知通道。须在开始接收区块之前调用
+func (c *Chain) AddBlocksNotify(ch chan<- []*core.Block) {
+	c.blocksNotify = append(c.blocksNotify, ch)
+}
+
+// VerifyConsensus 检查区块是否满足共识规则（例如是否由该轮的出块者构建）
+// 本地找不到其父区块时无法判断，不做检查
+func (c *Chain) VerifyConsensus(cb *core.Block) error {
+	if c.checker == nil {
+		return nil
+	}
+	prevHeight, err := c.GetHeightViaHash(cb.PrevHash)
+	if err != nil {
+		return nil
+	}
+	return c.checker.CheckBlock(cb, prevHeight+1, c.RecentMissed(cb.PrevHash))
+}
+
+// RecentMissed 从区块base开始向前共MissedRounds个区块中记录的未出块胜者，
+// 它们不能在以base为父区块的这一轮竞争中胜出
+func (c *Chain) RecentMissed(base crypto.Hash) []crypto.ID {
+	c.branchLock.RLock()
+	defer c.branchLock.RUnlock()
+
+	for _, bc := range c.branches {
+		if b := bc.getBlock(base); b != nil {
+			return recentMissed(b, MissedRounds)
+		}
+	}
+	_, height, err := db.GetHeaderViaHash(base)
+	if err != nil {
+		return nil
+	}
+	return storedMissed(nil, height+1, MissedRounds)
+}
+
+// GetHeightViaHash 查询区块高度。先查缓存中的各个分支，再查数据库
+func (c *Chain) GetHeightViaHash(hash crypto.Hash) (uint64, error) {
+	c.branchLock.RLock()
+	for _, bc := range c.branches {
+		if b := bc.getBlock(hash); b != nil {
+			c.branchLock.RUnlock()
+			return b.height, nil
+		}
+	}
+	c.branchLock.RUnlock()
+
+	_, height, err := db.GetHeaderViaHash(hash)
+	if err != nil {
+		return 0, ErrHashNotFound{hash}
+	}
+	return height, nil
+}
+
 // AddBlocks 添加若干个区块
 func (c *Chain) AddBlocks(blocks []*core.Block, local bool) {
 	if local {	// local表示是本地区块（自己构建的），直接添加就好
@@ -254,6 +322,149 @@ func (c *Chain) VerifyTx(tx *core.Tx) error {
 	return nil
 }
 
+// GetWorkflow 在最长分支（最长链）上查询交易txId所在的两方交易流程
+func (c *Chain) GetWorkflow(txId crypto.Hash) (*Workflow, error) {
+	c.branchLock.RLock()
+	defer c.branchLock.RUnlock()
+
+	tx := c.longestBranch.findTx(txId, newTxContext())
+	if tx == nil {
+		return nil, fmt.Errorf("tx %X not found", txId)
+	}
+	if !isWorkflowTx(tx) {
+		return nil, fmt.Errorf("tx %X is a %s tx, not in any workflow", txId, core.TxTypes[tx.Type])
+	}
+	return c.longestBranch.getWorkflow(tx)
+}
+
+// GetArbitrator 在最长分支（最长链）上获取陷入纠纷的流程w的仲裁者
+func (c *Chain) GetArbitrator(w *Workflow) (crypto.ID, error) {
+	c.branchLock.RLock()
+	defer c.branchLock.RUnlock()
+
+	return c.longestBranch.getArbitrator(w)
+}
+
+// ArbitratorCandidates 包装数据密钥时应包装给的候选仲裁者（不含交易双方）。
+// prev为待发送交易的来源交易，其所在流程已有候选仲裁者时沿用，保证流程陷入纠纷时选出的仲裁者能打开全部密钥；
+// 否则取最长分支（最长链）上最新arbitratorWindow个区块的构建者（已被封禁者除外）
+func (c *Chain) ArbitratorCandidates(prev crypto.Hash) ([]crypto.ID, error) {
+	c.branchLock.RLock()
+	defer c.branchLock.RUnlock()
+
+	var result []crypto.ID
+	if prev != nil {
+		tx := c.longestBranch.findTx(prev, newTxContext())
+		if tx == nil {
+			return nil, fmt.Errorf("tx %X not found", prev)
+		}
+		w, err := c.longestBranch.getWorkflow(tx)
+		if err != nil {
+			return nil, err
+		}
+		if ids, sealed := w.KeyRecipients(); sealed {
+			for _, id := range ids {
+				if id != w.Requester && id != w.Responder {
+					result = append(result, id)
+				}
+			}
+			return result, nil
+		}
+	}
+	return c.longestBranch.headCreators(arbitratorWindow, true), nil
+}
+
+// GetTx 在最长分支（最长链）上查找交易，找不到返回nil
+func (c *Chain) GetTx(hash crypto.Hash) *core.Tx {
+	c.branchLock.RLock()
+	defer c.branchLock.RUnlock()
+
+	return c.longestBranch.findTx(hash, newTxContext())
+}
+
+// FilterTxs 在最长分支上按顺序校验一批交易（后面的交易可以依赖前面的交易），返回其中有效的交易
+// 用于出块前挑选交易，保证同一发起方的多笔交易合起来也不会透支
+func (c *Chain) FilterTxs(txs []*core.Tx) []*core.Tx {
+	c.branchLock.RLock()
+	defer c.branchLock.RUnlock()
+
+	var result []*core.Tx
+	ctx := newTxContext()
+	for _, tx := range txs {
+		if tx.Type == core.TX_COINBASE {
+			continue
+		}
+		if err := c.longestBranch.verifyTxWithContext(tx, ctx); err != nil {
+			logger.Debug("filter out tx %X: %v\n", tx.Id, err)
+			continue
+		}
+		ctx.add(tx)
+		result = append(result, tx)
+	}
+	return result
+}
+
+// GetBalance 查询账户在最长分支（最长链）上的余额
+func (c *Chain) GetBalance(id crypto.ID) (uint64, error) {
+	return c.GetBalanceOnBranch(id, nil)
+}
+
+// GetBalanceOnBranch 查询账户在指定分支上的余额。branchHash为分支末端区块哈希，为空则表示最长分支
+func (c *Chain) GetBalanceOnBranch(id crypto.ID, branchHash crypto.Hash) (uint64, error) {
+	c.branchLock.RLock()
+	defer c.branchLock.RUnlock()
+
+	bc := c.longestBranch
+	if len(branchHash) != 0 {
+		if bc = c.getBranch(branchHash); bc == nil {
+			return 0, ErrHashNotFound{branchHash}
+		}
+	}
+
+	balance, err := bc.getBalance(id)
+	if err != nil {
+		return 0, err
+	}
+	if balance < 0 {	// 正常情况下不会出现，出现说明数据库与缓存不一致
+		logger.Warn("negative balance %d of %s\n", balance, id.ToHex())
+		return 0, nil
+	}
+	return uint64(balance), nil
+}
+
+// GetCredit 查询账户在最长分支（最长链）上的信誉分
+func (c *Chain) GetCredit(id crypto.ID) (int64, error) {
+	c.branchLock.RLock()
+	defer c.branchLock.RUnlock()
+
+	return c.longestBranch.getCredit(id)
+}
+
+// IsRegistered 查询账户在最长分支（最长链）上是否已完成注册
+func (c *Chain) IsRegistered(id crypto.ID) bool {
+	c.branchLock.RLock()
+	defer c.branchLock.RUnlock()
+
+	return c.longestBranch.isRegistered(id, newTxContext())
+}
+
+// GetLocked 查询账户在最长分支（最长链）上冻结在托管池中的款项
+// 冻结款项已从余额中扣除，即GetBalance返回的是可用余额
+func (c *Chain) GetLocked(id crypto.ID) (uint64, error) {
+	c.branchLock.RLock()
+	defer c.branchLock.RUnlock()
+
+	locked, err := c.longestBranch.getLocked(id)
+	if err != nil {
+		return 0, err
+	}
+	if locked < 0 {	// 正常情况下不会出现，出现说明数据库与缓存不一致
+		logger.Warn("negative locked balance %d of %s\n", locked, id.ToHex())
+		return 0, nil
+	}
+	return uint64(locked), nil
+}
+
 // GetUnstoredBlocks 返回所有未存储的区块及其高度，并按高度降序排序
 func (c *Chain) GetUnstoredBlocks() ([]*core.Block, []uint64) {
 	c.branchLock.RLock()
@@ -411,6 +622,10 @@ func (c *Chain) maintain() {
 					logger.Fatal("store block failed:%v\n", err)
 				}
 				removingBlock.stored = true
+				// 区块的账户状态变动已写入数据库，各分支的覆盖层需要随之变基
+				for _, bc := range c.branches {
+					bc.rebase(removingBlock)
+				}
 				logger.Debug("store block (height %d)\n", iter.height)
 			}
 
@@ -471,19 +686,30 @@ func (c *Chain) addBlocks(blocks []*core.Block, local bool) {
 	}
 
 	// 将blocks添加到分支bc上
+	var added []*core.Block
 	for _, cb := range blocks {
-		if err := bc.verifyBlock(cb); err != nil {
+		if err := bc.verifyBlock(cb, c.checker); err != nil {
 			logger.Warn("verify blocks failed:%v\n", err)
-			return
+			break
 		}
 		bc.add(newBlock(cb, bc.height()+1, false))
+		added = append(added, cb)
+	}
+	if len(added) == 0 {
+		return
 	}
 
-	// 如果不是本地区块的话，那么通知检查，是否要更新最长链等属性
-	// TODO
-	if !local {
-		c.notifyCheck()
+	for _, ch := range c.blocksNotify {
+		select {
+		case ch <- added:
+		default:
+			logger.Warn("blocks notify queue is full, drop %d blocks\n", len(added))
+		}
 	}
+
+	// 通知检查，是否要更新最长链等属性
+	// 本地区块同样需要更新最长链，否则下一轮竞争仍会基于旧的最新区块
+	c.notifyCheck()
 }
 
 // 根据分支最新（末）区块的哈希来获取该分支
@@ -529,14 +755,18 @@ func (c *Chain) createBranch(newBlock *core.Block) (*branch, error) {
 }
 
 // 获取最长分支
+// 高度相同时优先记录未出块胜者较少的分支：胜者的区块晚到、接替者也已出块时，应以胜者的区块为准
 func (c *Chain) getLongestBranch() *branch {
 	var longestBranch *branch
 	var height uint64
+	var missed int
 	for _, b := range c.branches {
-		if b.height() > height {
+		m := b.missedNum()
+		if b.height() > height || (b.height() == height && m < missed) {
 			longestBranch = b
 			height = b.height()
-		} else if b.height() == height {
+			missed = m
+		} else if b.height() == height && m == missed {
 			// 随机选择一条分支
 			if time.Now().Unix()%2 == 0 {
 				longestBranch = b
@@ -550,7 +780,8 @@ func (c *Chain) getLongestBranch() *branch {
 func (c *Chain) notifyCheck() {
 	longestBranch := c.getLongestBranch()
 	// 如果当前最长分支的高度高于最高高度lastHeight，说明链增长了，要更新最长分支等
-	if longestBranch.height() > c.lastHeight {
+	// 高度相同但记录的未出块胜者更少（胜者的区块晚到），同样切换过去
+	if longestBranch.height() > c.lastHeight || c.preferred(longestBranch) {
 		c.longestBranch = longestBranch
 		c.lastHeight = c.longestBranch.height()
 
@@ -564,6 +795,12 @@ func (c *Chain) notifyCheck() {
 	}
 }
 
+// 与当前最长分支高度相同时，b是否更优
+func (c *Chain) preferred(b *branch) bool {
+	return c.longestBranch != nil && b != c.longestBranch && b.height() == c.lastHeight &&
+		b.missedNum() < c.longestBranch.missedNum()
+}
+
 // 状态报告。 用于调试模式
 // 每隔一定时间间隔打印当前Chain的状态
 func (c *Chain) statusReport() {
@@ -0,0 +1,120 @@
+package bc
+
+import (
+	"bytes"
+	"time"
+
+	"github.com/azd1997/ecoin/common/crypto"
+	"github.com/azd1997/ecoin/enode/bc/merkle"
+	"github.com/azd1997/ecoin/protocol/core"
+	"github.com/azd1997/ecoin/store/db"
+)
+
+// MissedRounds PoT竞争胜出却未按时出块的worker（由接替出块者记录在coinbase中，见core.MissedWinners），
+// 在之后MissedRounds个区块的竞争中不能胜出
+const MissedRounds = 3
+
+// MaxFutureBlockTime 区块时间最多比本地时间超前多少
+const MaxFutureBlockTime = 3 * time.Second
+
+// 记录n个未出块胜者的接替区块，其区块时间距父区块至少要多久：
+// 竞争在父区块之后半个周期开始，每个胜者有一个周期的出块时限（见potCompetitor），
+// 依次超时后才轮到接替者出块
+func missedTimeout(n int) time.Duration {
+	return BlockInterval/2 + time.Duration(n)*BlockInterval
+}
+
+// ConsensusChecker 共识相关的区块检查，由共识引擎实现
+// height为待检查区块的高度，missed为父区块及其之前共MissedRounds个区块中记录的未出块胜者，本轮不能胜出
+type ConsensusChecker interface {
+	CheckBlock(cb *core.Block, height uint64, missed []crypto.ID) error
+}
+
+// CheckPoT 检查区块是否由PoT竞争胜者构建，且区块内容与胜者证明一致
+// 胜者证明中的交易数与交易默克尔根都不包含coinbase交易
+// winner为nil（本地没有该轮次的胜者证明，例如同步历史区块时）不做检查
+func CheckPoT(cb *core.Block, winner *core.PoTProof) error {
+	if winner == nil {
+		return nil
+	}
+
+	if !bytes.Equal(winner.Base, cb.PrevHash) {
+		return ErrPoTCheckFailed{cb.Hash, "mismatch winner proof base"}
+	}
+	if winner.From != cb.CreateBy {
+		return ErrNotPoTWinner{cb.Hash, cb.CreateBy.String(), winner.From.String()}
+	}
+
+	own := blockPoTProof(cb)
+	if own.TxsNum != winner.TxsNum {
+		return ErrPoTCheckFailed{cb.Hash, "mismatch txs num"}
+	}
+	if !bytes.Equal(own.TxsMerkle, winner.TxsMerkle) {
+		return ErrPoTCheckFailed{cb.Hash, "mismatch txs merkle"}
+	}
+
+	return nil
+}
+
+// 由区块内容还原出块者的PoT证明（不含签名），用于与其他证明比较排名
+// 交易数与交易默克尔根都不包含coinbase交易
+func blockPoTProof(cb *core.Block) *core.PoTProof {
+	var leafs merkle.MerkleLeafs
+	for _, tx := range cb.Txs {
+		if tx.Type == core.TX_COINBASE {
+			continue
+		}
+		leafs = append(leafs, tx.Id)
+	}
+	root := core.EmptyMerkleRoot
+	if len(leafs) > 0 {
+		root, _ = merkle.ComputeRoot(leafs)
+	}
+	return core.NewPoTProof(cb.CreateBy, uint32(len(leafs)), root, cb.PrevHash)
+}
+
+// 从区块from开始向前共n个区块的coinbase中记录的未出块胜者（去重）
+// 缓存中的区块沿prev回溯，缓存之前的区块从数据库读取
+func recentMissed(from *block, n int) []crypto.ID {
+	var result []crypto.ID
+	height := uint64(0)
+	for iter := from; iter != nil && n > 0; iter = iter.prev {
+		result = appendMissed(result, iter.Block)
+		height = iter.height
+		n--
+	}
+	return storedMissed(result, height, n)
+}
+
+// 从数据库中高度为height的区块之前（不含）向前读取n个区块，将其中记录的未出块胜者加入result
+func storedMissed(result []crypto.ID, height uint64, n int) []crypto.ID {
+	for ; n > 0 && height > 1; n-- {
+		height--
+		cb, _, err := db.GetBlockViaHeight(height)
+		if err != nil {
+			break
+		}
+		result = appendMissed(result, cb)
+	}
+	return result
+}
+
+// 区块中记录的未出块胜者数
+func missedNum(cb *core.Block) int {
+	n := 0
+	for _, tx := range cb.Txs {
+		n += len(tx.Missed())
+	}
+	return n
+}
+
+func appendMissed(result []crypto.ID, cb *core.Block) []crypto.ID {
+	for _, tx := range cb.Txs {
+		for _, p := range tx.Missed() {
+			if !containsID(result, p.From) {
+				result = append(result, p.From)
+			}
+		}
+	}
+	return result
+}
@@ -0,0 +1,138 @@
+package bc
+
+import (
+	"testing"
+	"time"
+
+	"github.com/azd1997/ecoin/account/role"
+	"github.com/azd1997/ecoin/common/crypto"
+	"github.com/azd1997/ecoin/enode/bc/merkle"
+	"github.com/azd1997/ecoin/protocol/core"
+)
+
+func TestCheckPoT(t *testing.T) {
+	winner, loser := genID(role.HOSPITAL), genID(role.RESEARCHER)
+	patient := genID(role.PATIENT)
+	base := crypto.HashD([]byte("base"))
+
+	coinbase := core.NewTx(core.TX_COINBASE, crypto.ZeroID, winner, 100, nil, crypto.ZeroHash, 0, nil)
+	tx := core.NewTx(core.TX_GENERAL, patient, winner, 1, nil, nil, 0, nil)
+	txsMerkle, _ := merkle.ComputeRoot(merkle.MerkleLeafs{tx.Id})
+	proof := core.NewPoTProof(winner, 1, txsMerkle, base)
+
+	genBlock := func(prev crypto.Hash, creator crypto.ID, txs ...*core.Tx) *core.Block {
+		return core.NewBlock(core.NewBlockHeaderV1(prev, creator, nil), txs)
+	}
+
+	if err := CheckPoT(genBlock(base, winner, coinbase, tx), proof); err != nil {
+		t.Fatalf("expect winner block valid, but %v", err)
+	}
+	if err := CheckPoT(genBlock(base, loser, coinbase, tx), nil); err != nil {
+		t.Fatalf("expect block valid without winner proof, but %v", err)
+	}
+	if err := CheckPoT(genBlock(base, loser, coinbase, tx), proof); err == nil {
+		t.Fatal("expect loser block invalid")
+	} else if _, ok := err.(ErrNotPoTWinner); !ok {
+		t.Fatalf("expect ErrNotPoTWinner, but %v", err)
+	}
+	if err := CheckPoT(genBlock(base, winner, coinbase), proof); err == nil {
+		t.Fatal("expect block with mismatch txs num invalid")
+	}
+	if err := CheckPoT(genBlock(crypto.HashD([]byte("other")), winner, coinbase, tx), proof); err == nil {
+		t.Fatal("expect block with mismatch base invalid")
+	}
+
+	emptyProof := core.NewPoTProof(winner, 0, core.EmptyMerkleRoot, base)
+	if err := CheckPoT(genBlock(base, winner, coinbase), emptyProof); err != nil {
+		t.Fatalf("expect empty block valid, but %v", err)
+	}
+}
+
+func TestVerifyMissed(t *testing.T) {
+	creator, first, second, other := genID(role.HOSPITAL), genID(role.HOSPITAL), genID(role.RESEARCHER), genID(role.HOSPITAL)
+	patient := genID(role.PATIENT)
+	base := crypto.HashD([]byte("base"))
+	tx := core.NewTx(core.TX_GENERAL, patient, creator, 1, nil, nil, 0, nil)
+
+	// 出块者打包了1笔交易，排名在其之前的只有交易数更多的证明
+	firstProof := core.NewPoTProof(first, 5, crypto.HashD([]byte("first")), base)
+	secondProof := core.NewPoTProof(second, 3, crypto.HashD([]byte("second")), base)
+	lowerProof := core.NewPoTProof(other, 0, core.EmptyMerkleRoot, base)
+
+	check := func(barred []crypto.ID, proofs ...*core.PoTProof) error {
+		payload := (&core.MissedWinners{Proofs: proofs}).Encode()
+		coinbase := core.NewTx(core.TX_COINBASE, crypto.ZeroID, creator, 100, payload, crypto.ZeroHash, 0, nil)
+		cb := core.NewBlock(core.NewBlockHeaderV1(base, creator, nil), []*core.Tx{coinbase, tx})
+		return verifyMissed(cb, coinbase, cb.Time-int64(missedTimeout(len(proofs))), barred)
+	}
+
+	if err := check(nil, firstProof, secondProof); err != nil {
+		t.Fatalf("expect missed winners ranked above creator valid, but %v", err)
+	}
+	if err := check(nil, lowerProof); err == nil {
+		t.Fatal("expect missed winner ranked below creator invalid")
+	}
+	if err := check(nil, firstProof, lowerProof); err == nil {
+		t.Fatal("expect missed winners containing lower proof invalid")
+	}
+	if err := check(nil, secondProof, firstProof); err == nil {
+		t.Fatal("expect missed winners out of rank order invalid")
+	}
+	if err := check([]crypto.ID{first}, firstProof, secondProof); err == nil {
+		t.Fatal("expect barred worker recorded as missed winner invalid")
+	}
+	otherBase := core.NewPoTProof(first, 5, crypto.HashD([]byte("first")), crypto.HashD([]byte("other")))
+	if err := check(nil, otherBase); err == nil {
+		t.Fatal("expect missed winner on other base invalid")
+	}
+
+	// 胜者出块的时限未到
+	payload := (&core.MissedWinners{Proofs: []*core.PoTProof{firstProof}}).Encode()
+	coinbase := core.NewTx(core.TX_COINBASE, crypto.ZeroID, creator, 100, payload, crypto.ZeroHash, 0, nil)
+	cb := core.NewBlock(core.NewBlockHeaderV1(base, creator, nil), []*core.Tx{coinbase, tx})
+	if err := verifyMissed(cb, coinbase, cb.Time, nil); err == nil {
+		t.Fatal("expect missed winners before timeout invalid")
+	}
+	// 胜者本身在父区块之后一个周期出块，此时接替者还不能记录它
+	if err := verifyMissed(cb, coinbase, cb.Time-int64(BlockInterval), nil); err == nil {
+		t.Fatal("expect missed winners at the winner's deadline invalid")
+	}
+	// 区块时间超前于本地时间
+	future := core.NewBlock(core.NewBlockHeaderV1(base, creator, nil), []*core.Tx{coinbase, tx})
+	future.Time = time.Now().Add(2 * MaxFutureBlockTime).UnixNano()
+	if err := verifyMissed(future, coinbase, cb.Time-int64(missedTimeout(1)), nil); err == nil {
+		t.Fatal("expect missed winners with future block time invalid")
+	}
+}
+
+func TestMissedWinnerBlockSeen(t *testing.T) {
+	winner, creator := genID(role.HOSPITAL), genID(role.RESEARCHER)
+	parent := newBlock(core.NewBlock(core.NewBlockHeaderV1(crypto.HashD([]byte("base")), creator, nil), nil), 1, true)
+	b := newBranch(parent)
+
+	// 胜者的区块已经出现，接替区块不能再记录它
+	missedProof := core.NewPoTProof(winner, 5, crypto.HashD([]byte("winner")), parent.Hash)
+	payload := (&core.MissedWinners{Proofs: []*core.PoTProof{missedProof}}).Encode()
+	coinbase := core.NewTx(core.TX_COINBASE, crypto.ZeroID, creator, CoinbaseReward(creator, 2), payload, crypto.ZeroHash, 0, nil)
+	cb := core.NewBlock(core.NewBlockHeaderV1(parent.Hash, creator, nil), []*core.Tx{coinbase})
+	parent.Time = cb.Time - int64(missedTimeout(1))
+	if err := b.verifyCoinbase(cb, 2, nil); err != nil {
+		t.Fatalf("expect missed winner valid before its block is seen, but %v", err)
+	}
+	parent.addNext(newBlock(core.NewBlock(core.NewBlockHeaderV1(parent.Hash, winner, nil), nil), 2, false))
+	if err := b.verifyCoinbase(cb, 2, nil); err == nil {
+		t.Fatal("expect missed winner invalid after its block is seen")
+	}
+
+	// 高度相同时优先不记录未出块胜者的分支
+	fallback := newBranch(parent)
+	fallback.add(newBlock(cb, 2, false))
+	honest := newBranch(parent)
+	honest.add(newBlock(core.NewBlock(core.NewBlockHeaderV1(parent.Hash, winner, nil), nil), 2, false))
+	c := &Chain{branches: []*branch{fallback, honest}}
+	for i := 0; i < 4; i++ {
+		if c.getLongestBranch() != honest {
+			t.Fatal("expect branch without missed winners preferred")
+		}
+	}
+}
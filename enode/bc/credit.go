@@ -0,0 +1,48 @@
+package bc
+
+import (
+	"github.com/azd1997/ecoin/common/crypto"
+	"github.com/azd1997/ecoin/protocol/core"
+	"github.com/azd1997/ecoin/store/db"
+)
+
+// 信誉分规则（扣分规则见core.CreditDeltas）
+// 被封禁的账户不能发起交易，也不能作为医疗类交易的接收方，不会被选为仲裁者。
+// 区块内交易带来的信誉分变动从下一个区块开始生效
+
+// 查询账户在该分支上的信誉分：已固化的信誉分加上该分支覆盖层中的变动
+func (b *branch) getCredit(id crypto.ID) (int64, error) {
+	dbCredit, err := db.GetCreditViaID(id)
+	if err != nil {
+		return 0, err
+	}
+
+	return dbCredit + b.state.credit(id), nil
+}
+
+// 账户在该分支上是否已被封禁
+func (b *branch) isBanned(id crypto.ID) bool {
+	credit, err := b.getCredit(id)
+	return err == nil && core.CreditBanned(credit)
+}
+
+// 检查交易双方是否已被封禁
+func (b *branch) verifyCredit(tx *core.Tx) error {
+	parties := []crypto.ID{tx.From}
+	if tx.NeedRegistered() {
+		parties = append(parties, tx.To)
+	}
+	for _, id := range parties {
+		if isEmptyID(id) {
+			continue
+		}
+		credit, err := b.getCredit(id)
+		if err != nil {
+			return err
+		}
+		if core.CreditBanned(credit) {
+			return ErrAccountBanned{tx.Id, id.ToHex(), credit}
+		}
+	}
+	return nil
+}
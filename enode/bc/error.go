@@ -47,3 +47,94 @@ type ErrTxAlreadyExist struct {
 func (e ErrTxAlreadyExist) Error() string {
 	return fmt.Sprintf("tx %X exists", e.txId)
 }
+
+type ErrInsufficientBalance struct {
+	id      string
+	balance int64
+	amount  int64
+}
+
+func (e ErrInsufficientBalance) Error() string {
+	return fmt.Sprintf("account %s balance %d is not sufficient for %d", e.id, e.balance, e.amount)
+}
+
+type ErrTxRoleNotAllowed struct {
+	txId  []byte
+	typ   uint8
+	party string
+}
+
+func (e ErrTxRoleNotAllowed) Error() string {
+	return fmt.Sprintf("tx %X (type %d): role of %s is not allowed", e.txId, e.typ, e.party)
+}
+
+type ErrInvalidPrevTx struct {
+	txId []byte
+	info string
+}
+
+func (e ErrInvalidPrevTx) Error() string {
+	return fmt.Sprintf("tx %X: invalid prev tx, %s", e.txId, e.info)
+}
+
+// ErrInvalidWorkflow 交易不是其所在交易流程的合法下一步
+type ErrInvalidWorkflow struct {
+	txId []byte
+	info string
+}
+
+func (e ErrInvalidWorkflow) Error() string {
+	return fmt.Sprintf("tx %X: invalid workflow step, %s", e.txId, e.info)
+}
+
+// ErrNotPoTWinner 区块不是由PoT竞争胜者构建的
+type ErrNotPoTWinner struct {
+	blockHash []byte
+	creator   string
+	winner    string
+}
+
+func (e ErrNotPoTWinner) Error() string {
+	return fmt.Sprintf("block %X is created by %s, but pot winner is %s", e.blockHash, e.creator, e.winner)
+}
+
+// ErrPoTCheckFailed 区块内容与胜者证明不一致
+type ErrPoTCheckFailed struct {
+	blockHash []byte
+	info      string
+}
+
+func (e ErrPoTCheckFailed) Error() string {
+	return fmt.Sprintf("block %X pot check failed: %s", e.blockHash, e.info)
+}
+
+// ErrNotRegistered 参与医疗类交易或审核注册的账户未注册
+type ErrNotRegistered struct {
+	txId []byte
+	id   string
+}
+
+func (e ErrNotRegistered) Error() string {
+	return fmt.Sprintf("tx %X: account %s is not registered", e.txId, e.id)
+}
+
+// ErrInvalidRegistration 注册申请或回复无效
+type ErrInvalidRegistration struct {
+	txId []byte
+	info string
+}
+
+func (e ErrInvalidRegistration) Error() string {
+	return fmt.Sprintf("tx %X: invalid registration, %s", e.txId, e.info)
+}
+
+// ErrAccountBanned 账户信誉分过低，已被封禁
+type ErrAccountBanned struct {
+	txId   []byte
+	id     string
+	credit int64
+}
+
+func (e ErrAccountBanned) Error() string {
+	return fmt.Sprintf("tx %X: account %s is banned with credit %d", e.txId, e.id, e.credit)
+}
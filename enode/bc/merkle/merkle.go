@@ -75,3 +75,59 @@ func SortByteArray(leafs MerkleLeafs) {
 
 	sort.Sort(leafs)
 }
+
+// MerkleProof 叶子到根的路径上各层的兄弟节点，自底向上排列
+// 与ComputeRoot一致，某层节点数为奇数时最后一个节点直接升入上一层，这一层没有兄弟节点
+type MerkleProof [][]byte
+
+// ComputeProof 计算第index个叶子的默克尔证明，不修改输入
+func ComputeProof(leafs MerkleLeafs, index int) (MerkleProof, error) {
+	if index < 0 || index >= leafs.Len() {
+		return nil, fmt.Errorf("index %d out of range [0, %d)", index, leafs.Len())
+	}
+
+	var proof MerkleProof
+	harray := append(MerkleLeafs{}, leafs...)
+	for len(harray) > 1 {
+		sibling := index ^ 1
+		if sibling < len(harray) {
+			proof = append(proof, harray[sibling])
+		}
+
+		next := make(MerkleLeafs, 0, (len(harray)+1)/2)
+		for i := 0; i < len(harray); i += 2 {
+			if i+1 < len(harray) {
+				next = append(next, crypto.HashD(append(append([]byte{}, harray[i]...), harray[i+1]...)))
+			} else {
+				next = append(next, harray[i])
+			}
+		}
+		harray = next
+		index /= 2
+	}
+	return proof, nil
+}
+
+// VerifyProof 检验leaf是否为共total个叶子、默克尔根为root的树中的第index个叶子
+func VerifyProof(root, leaf []byte, index, total int, proof MerkleProof) bool {
+	if index < 0 || index >= total {
+		return false
+	}
+
+	cur, k := leaf, 0
+	for n := total; n > 1; n = (n + 1) / 2 {
+		if index%2 == 1 || index+1 < n {
+			if k >= len(proof) {
+				return false
+			}
+			if index%2 == 1 {
+				cur = crypto.HashD(append(append([]byte{}, proof[k]...), cur...))
+			} else {
+				cur = crypto.HashD(append(append([]byte{}, cur...), proof[k]...))
+			}
+			k++
+		}
+		index /= 2
+	}
+	return k == len(proof) && bytes.Equal(cur, root)
+}
@@ -70,3 +70,29 @@ func toByteArray(sa []string) [][]byte {
 	}
 	return result
 }
+
+func TestMerkleProof(t *testing.T) {
+	for n := 1; n <= 9; n++ {
+		var leafs MerkleLeafs
+		for i := 0; i < n; i++ {
+			leafs = append(leafs, []byte(fmt.Sprintf("leaf_%d", i)))
+		}
+		root, _ := ComputeRoot(append(MerkleLeafs{}, leafs...))
+
+		for i := 0; i < n; i++ {
+			proof, err := ComputeProof(leafs, i)
+			if err != nil {
+				t.Fatalf("[%d/%d] %v", i, n, err)
+			}
+			if !VerifyProof(root, leafs[i], i, n, proof) {
+				t.Fatalf("[%d/%d] expect valid proof", i, n)
+			}
+			if VerifyProof(root, []byte("forged"), i, n, proof) {
+				t.Fatalf("[%d/%d] expect forged leaf rejected", i, n)
+			}
+			if n > 1 && VerifyProof(root, leafs[i], (i+1)%n, n, proof) {
+				t.Fatalf("[%d/%d] expect wrong index rejected", i, n)
+			}
+		}
+	}
+}
@@ -0,0 +1,50 @@
+package bc
+
+import (
+	"github.com/azd1997/ecoin/common/crypto"
+	"github.com/azd1997/ecoin/protocol/core"
+	"github.com/azd1997/ecoin/store/db"
+)
+
+// 账户注册规则
+// 医疗类交易(core.Tx.NeedRegistered)的双方必须为已注册账户。
+// 注册申请只能提交给已注册的医院，且申请者尚未注册；
+// 注册回复必须由申请所提交的医院作出，每个申请只能回复一次
+
+// 账户在该分支上是否已完成注册：区块内上下文、覆盖层、数据库
+func (b *branch) isRegistered(id crypto.ID, ctx *txContext) bool {
+	return ctx.registered[id] || b.state.isRegistered(id) || db.IsRegistered(id)
+}
+
+// 检查交易是否满足注册规则。prev为tx的来源交易
+func (b *branch) verifyRegistration(tx *core.Tx, prev *core.Tx, ctx *txContext) error {
+	switch {
+	case tx.NeedRegistered():
+		for _, id := range []crypto.ID{tx.From, tx.To} {
+			if !b.isRegistered(id, ctx) {
+				return ErrNotRegistered{tx.Id, id.ToHex()}
+			}
+		}
+	case tx.Type == core.TX_REGREQ:
+		if b.isRegistered(tx.From, ctx) {
+			return ErrInvalidRegistration{tx.Id, "applicant is already registered"}
+		}
+		if !b.isRegistered(tx.To, ctx) {
+			return ErrNotRegistered{tx.Id, tx.To.ToHex()}
+		}
+	case tx.Type == core.TX_REGRESP:
+		if !tx.IsNextOf(prev) {
+			return ErrInvalidRegistration{tx.Id, "not a response to the register request"}
+		}
+		if next := b.findNextTx(prev.Id, ctx); next != nil {
+			return ErrInvalidRegistration{tx.Id, "register request has been responded"}
+		}
+		if !b.isRegistered(tx.From, ctx) {
+			return ErrNotRegistered{tx.Id, tx.From.ToHex()}
+		}
+		if id, ok := tx.Registration(); ok && b.isRegistered(id, ctx) {
+			return ErrInvalidRegistration{tx.Id, "applicant is already registered"}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,193 @@
+package bc
+
+import (
+	"github.com/azd1997/ecoin/common/crypto"
+	"github.com/azd1997/ecoin/common/encoding"
+	"github.com/azd1997/ecoin/protocol/core"
+	"github.com/azd1997/ecoin/store/db"
+)
+
+// accountState 分支上的账户状态覆盖层
+// 数据库中只保存已固化（存储）区块的账户状态，
+// 而每条分支上还有若干未存储的区块，这些区块带来的账户状态变动记录在覆盖层中。
+// 分支上账户的真实状态 = 数据库中的状态 + 覆盖层中的变动
+// 注意：覆盖层的读写都在Chain.branchLock的保护下进行，自身不加锁
+type accountState struct {
+	balances map[crypto.ID]int64 // 未存储区块带来的余额变动
+	locked   map[crypto.ID]int64 // 未存储区块带来的冻结款项变动
+	credits  map[crypto.ID]int64 // 未存储区块带来的信誉分变动
+	// 未存储区块带来的托管池变动 <hex(tx.Id), *core.Escrow>，值为nil表示该托管款项已转移或结算
+	escrows map[string]*core.Escrow
+	// 未存储区块中完成注册的账户。同一账户可能在不同区块中重复记录，故计数
+	registered map[crypto.ID]int
+	// 各区块带来的变动。区块存储后据此从覆盖层扣除
+	deltas map[*core.Block]*stateDelta
+}
+
+// stateDelta 一个区块带来的账户状态变动
+type stateDelta struct {
+	balances   map[crypto.ID]int64
+	locked     map[crypto.ID]int64
+	credits    map[crypto.ID]int64
+	created    []string    // 新增的托管款项
+	consumed   []string    // 转移或结算掉的托管款项
+	registered []crypto.ID // 完成注册的账户
+}
+
+func newAccountState() *accountState {
+	return &accountState{
+		balances:   make(map[crypto.ID]int64),
+		locked:     make(map[crypto.ID]int64),
+		credits:    make(map[crypto.ID]int64),
+		escrows:    make(map[string]*core.Escrow),
+		registered: make(map[crypto.ID]int),
+		deltas:     make(map[*core.Block]*stateDelta),
+	}
+}
+
+// 区块加入分支（且未存储）时，将其变动计入覆盖层
+// 区块须按先后顺序加入，托管款项的转移依赖更早区块中的交易
+func (s *accountState) applyBlock(b *core.Block) {
+	d := &stateDelta{
+		balances: make(map[crypto.ID]int64),
+		locked:   make(map[crypto.ID]int64),
+		credits:  make(map[crypto.ID]int64),
+	}
+	applyBlockBalance(d.balances, b)
+	for _, tx := range b.Txs {
+		s.applyTxEscrow(d, tx)
+		if tx.Type == core.TX_COINBASE {
+			addDeltas(d.credits, core.CreditDeltas(tx, nil), 1)
+		}
+		if id, ok := tx.Registration(); ok {
+			d.registered = append(d.registered, id)
+			s.registered[id]++
+		}
+	}
+
+	addDeltas(s.balances, d.balances, 1)
+	addDeltas(s.locked, d.locked, 1)
+	addDeltas(s.credits, d.credits, 1)
+	s.deltas[b] = d
+}
+
+// 区块写入数据库后，其变动已体现在数据库中，需要从覆盖层扣除
+func (s *accountState) revertBlock(b *core.Block) {
+	d, ok := s.deltas[b]
+	if !ok {
+		return
+	}
+	delete(s.deltas, b)
+
+	addDeltas(s.balances, d.balances, -1)
+	addDeltas(s.locked, d.locked, -1)
+	addDeltas(s.credits, d.credits, -1)
+	// 新增的托管款项已写入数据库。若已被后续未存储区块转移，则保留转移标记
+	for _, key := range d.created {
+		if s.escrows[key] != nil {
+			delete(s.escrows, key)
+		}
+	}
+	// 注册记录已写入数据库
+	for _, id := range d.registered {
+		if s.registered[id]--; s.registered[id] <= 0 {
+			delete(s.registered, id)
+		}
+	}
+	// 转移掉的托管款项已从数据库删除
+	for _, key := range d.consumed {
+		if v, ok := s.escrows[key]; ok && v == nil {
+			delete(s.escrows, key)
+		}
+	}
+}
+
+// 覆盖层中账户的余额变动
+func (s *accountState) balance(id crypto.ID) int64 {
+	return s.balances[id]
+}
+
+// 覆盖层中账户的冻结款项变动
+func (s *accountState) lockedBalance(id crypto.ID) int64 {
+	return s.locked[id]
+}
+
+// 覆盖层中账户的信誉分变动
+func (s *accountState) credit(id crypto.ID) int64 {
+	return s.credits[id]
+}
+
+// 覆盖层中账户是否已完成注册
+func (s *accountState) isRegistered(id crypto.ID) bool {
+	return s.registered[id] > 0
+}
+
+// 计算交易对托管池的操作，变动记入d
+func (s *accountState) applyTxEscrow(d *stateDelta, tx *core.Tx) {
+	switch tx.EscrowOp() {
+	case core.EscrowLock:
+		s.putEscrow(d, tx.Id, &core.Escrow{Requester: tx.From, Responder: tx.To, Amount: uint64(tx.Amount)})
+		d.locked[tx.From] += int64(tx.Amount)
+	case core.EscrowCarry:
+		e := s.takeEscrow(d, tx.PrevTxId)
+		if e == nil {
+			return
+		}
+		carried := *e
+		if tx.IsRequest() {
+			carried.Amount += uint64(tx.Amount)
+			d.locked[carried.Requester] += int64(tx.Amount)
+		}
+		s.putEscrow(d, tx.Id, &carried)
+	case core.EscrowRelease, core.EscrowSplit:
+		e := s.takeEscrow(d, tx.PrevTxId)
+		if e == nil {
+			e = &core.Escrow{Requester: tx.From, Responder: tx.To}
+		} else {
+			// 仲裁结果影响交易双方的信誉分
+			addDeltas(d.credits, core.CreditDeltas(tx, e), 1)
+		}
+		for id, amount := range e.Settle(tx) {
+			d.balances[id] += int64(amount)
+		}
+		d.locked[e.Requester] -= int64(e.Amount)
+	}
+}
+
+// 查询托管款项：先查覆盖层，再查数据库
+func (s *accountState) getEscrow(hash crypto.Hash) *core.Escrow {
+	if e, ok := s.escrows[encoding.ToHex(hash)]; ok {
+		return e
+	}
+	if e, err := db.GetEscrow(hash); err == nil {
+		return e
+	}
+	return nil
+}
+
+func (s *accountState) putEscrow(d *stateDelta, hash crypto.Hash, e *core.Escrow) {
+	key := encoding.ToHex(hash)
+	s.escrows[key] = e
+	d.created = append(d.created, key)
+}
+
+// 取出托管款项并标记为已转移
+func (s *accountState) takeEscrow(d *stateDelta, hash crypto.Hash) *core.Escrow {
+	e := s.getEscrow(hash)
+	if e == nil {
+		return nil
+	}
+	key := encoding.ToHex(hash)
+	s.escrows[key] = nil
+	d.consumed = append(d.consumed, key)
+	return e
+}
+
+func addDeltas(dst, src map[crypto.ID]int64, sign int64) {
+	for id, delta := range src {
+		dst[id] += sign * delta
+		if dst[id] == 0 {
+			delete(dst, id)
+		}
+	}
+}
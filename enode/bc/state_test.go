@@ -0,0 +1,203 @@
+package bc
+
+import (
+	"testing"
+
+	"github.com/azd1997/ecoin/account/role"
+	"github.com/azd1997/ecoin/common/crypto"
+	"github.com/azd1997/ecoin/common/encoding"
+	"github.com/azd1997/ecoin/protocol/core"
+)
+
+func TestAccountState(t *testing.T) {
+	patient, hospital := genID(role.PATIENT), genID(role.HOSPITAL)
+
+	header := core.NewBlockHeaderV1(nil, hospital, nil)
+	b1 := core.NewBlock(header, []*core.Tx{
+		core.NewTx(core.TX_GENERAL, patient, hospital, 30, nil, nil, 0, nil),
+	})
+	b2 := core.NewBlock(header, []*core.Tx{
+		core.NewTx(core.TX_GENERAL, hospital, patient, 10, nil, nil, 0, nil),
+	})
+
+	s := newAccountState()
+	s.applyBlock(b1)
+	s.applyBlock(b2)
+	if s.balance(patient) != -20 || s.balance(hospital) != 20 {
+		t.Fatalf("expect -20/20, result %d/%d", s.balance(patient), s.balance(hospital))
+	}
+
+	// b1被写入数据库之后，覆盖层只剩b2的变动
+	s.revertBlock(b1)
+	if s.balance(patient) != 10 || s.balance(hospital) != -10 {
+		t.Fatalf("expect 10/-10, result %d/%d", s.balance(patient), s.balance(hospital))
+	}
+
+	s.revertBlock(b2)
+	if len(s.balances) != 0 {
+		t.Fatalf("expect empty overlay, result %v", s.balances)
+	}
+}
+
+func TestAccountStateFee(t *testing.T) {
+	patient, doctor, hospital := genID(role.PATIENT), genID(role.DOCTOR), genID(role.HOSPITAL)
+
+	tx := core.NewTx(core.TX_GENERAL, patient, doctor, 30, nil, nil, 0, nil)
+	tx.SetFee(5)
+	b := core.NewBlock(core.NewBlockHeaderV1(nil, hospital, nil), []*core.Tx{tx})
+
+	// 发起方支付转账数额与交易费，交易费归区块构建者
+	s := newAccountState()
+	s.applyBlock(b)
+	if s.balance(patient) != -35 || s.balance(doctor) != 30 || s.balance(hospital) != 5 {
+		t.Fatalf("expect -35/30/5, result %d/%d/%d",
+			s.balance(patient), s.balance(doctor), s.balance(hospital))
+	}
+
+	s.revertBlock(b)
+	if len(s.balances) != 0 {
+		t.Fatalf("expect empty overlay, result %v", s.balances)
+	}
+}
+
+func TestAccountStateEscrow(t *testing.T) {
+	patient, hospital, worker := genID(role.PATIENT), genID(role.HOSPITAL), genID(role.HOSPITAL)
+	header := core.NewBlockHeaderV1(nil, worker, nil)
+
+	// 病人发起诊断请求，30冻结在托管池中，医院暂不入账
+	p2h := core.NewTx(core.TX_P2H, patient, hospital, 30, nil, nil, 0, nil)
+	h2p := core.NewTx(core.TX_H2P, hospital, patient, 0, nil, p2h.Id, 0, nil)
+	b1 := core.NewBlock(header, []*core.Tx{p2h, h2p})
+	s := newAccountState()
+	s.applyBlock(b1)
+	if s.balance(patient) != -30 || s.balance(hospital) != 0 || s.lockedBalance(patient) != 30 {
+		t.Fatalf("expect -30/0/locked 30, result %d/%d/locked %d",
+			s.balance(patient), s.balance(hospital), s.lockedBalance(patient))
+	}
+
+	// 再次请求追加冻结10，随后确认完成，托管款项全部支付给医院
+	again := core.NewTx(core.TX_P2H, patient, hospital, 10, nil, h2p.Id, 1, nil)
+	h2p2 := core.NewTx(core.TX_H2P, hospital, patient, 0, nil, again.Id, 0, nil)
+	confirm := core.NewTx(core.TX_P2H, patient, hospital, 5, nil, h2p2.Id, 0, nil)
+	b2 := core.NewBlock(header, []*core.Tx{again, h2p2})
+	b3 := core.NewBlock(header, []*core.Tx{confirm})
+	s.applyBlock(b2)
+	if s.lockedBalance(patient) != 40 {
+		t.Fatalf("expect locked 40, result %d", s.lockedBalance(patient))
+	}
+	s.applyBlock(b3)
+	if s.balance(patient) != -45 || s.balance(hospital) != 45 || s.lockedBalance(patient) != 0 {
+		t.Fatalf("expect -45/45/locked 0, result %d/%d/locked %d",
+			s.balance(patient), s.balance(hospital), s.lockedBalance(patient))
+	}
+
+	// b1、b2写入数据库之后，覆盖层中只保留b3带来的变动，b1中的托管款项已被后续区块转移
+	s.revertBlock(b1)
+	s.revertBlock(b2)
+	if e, ok := s.escrows[encoding.ToHex(h2p2.Id)]; !ok || e != nil {
+		t.Fatalf("expect escrow of %X consumed in overlay, result %v", h2p2.Id, e)
+	}
+	if s.balance(patient) != -5 || s.balance(hospital) != 45 || s.lockedBalance(patient) != -40 {
+		t.Fatalf("expect -5/45/locked -40, result %d/%d/locked %d",
+			s.balance(patient), s.balance(hospital), s.lockedBalance(patient))
+	}
+	s.revertBlock(b3)
+	if len(s.balances) != 0 || len(s.locked) != 0 || len(s.escrows) != 0 {
+		t.Fatalf("expect empty overlay, result %v %v %v", s.balances, s.locked, s.escrows)
+	}
+}
+
+// PrevTxId为ZeroHash的请求与没有来源交易的请求一样，是流程的初始交易，冻结款项
+func TestAccountStateEscrowZeroPrev(t *testing.T) {
+	patient, hospital, worker := genID(role.PATIENT), genID(role.HOSPITAL), genID(role.HOSPITAL)
+	p2h := core.NewTx(core.TX_P2H, patient, hospital, 30, nil, crypto.ZeroHash, 0, nil)
+	if op := p2h.EscrowOp(); op != core.EscrowLock {
+		t.Fatalf("expect EscrowLock, result %d", op)
+	}
+	if _, err := newWorkflow(p2h); err != nil {
+		t.Fatalf("expect workflow origin, but %v", err)
+	}
+
+	s := newAccountState()
+	s.applyBlock(core.NewBlock(core.NewBlockHeaderV1(nil, worker, nil), []*core.Tx{p2h}))
+	if s.balance(patient) != -30 || s.balance(hospital) != 0 || s.lockedBalance(patient) != 30 {
+		t.Fatalf("expect -30/0/locked 30, result %d/%d/locked %d",
+			s.balance(patient), s.balance(hospital), s.lockedBalance(patient))
+	}
+}
+
+func TestEscrowSettle(t *testing.T) {
+	researcher, patient, worker := genID(role.RESEARCHER), genID(role.PATIENT), genID(role.HOSPITAL)
+	e := &core.Escrow{Requester: researcher, Responder: patient, Amount: 11}
+
+	// 请求方作恶：一半给响应方，一半给仲裁者
+	ta := &core.TargetArbitrate{Bad: false}
+	arb := core.NewTx(core.TX_ARBITRATE, worker, "", 0, ta.Encode(), crypto.ZeroHash, 0, nil)
+	result := e.Settle(arb)
+	if result[patient] != 5 || result[worker] != 6 || result[researcher] != 0 {
+		t.Fatalf("expect 5/6/0, result %v", result)
+	}
+
+	// 响应方作恶：全部退还请求方
+	ta.Bad = true
+	arb = core.NewTx(core.TX_ARBITRATE, worker, "", 0, ta.Encode(), crypto.ZeroHash, 0, nil)
+	result = e.Settle(arb)
+	if result[researcher] != 11 || len(result) != 1 {
+		t.Fatalf("expect refund 11, result %v", result)
+	}
+}
+
+func TestAccountStateRegistered(t *testing.T) {
+	patient, hospital := genID(role.PATIENT), genID(role.HOSPITAL)
+
+	req := core.NewTx(core.TX_REGREQ, patient, hospital, 0, nil, nil, 0, nil)
+	reject := core.NewTx(core.TX_REGRESP, hospital, patient, 0,
+		(&core.RegisterResp{Reason: "fake"}).Encode(), req.Id, 0, nil)
+	approve := core.NewTx(core.TX_REGRESP, hospital, patient, 0,
+		(&core.RegisterResp{Approved: true}).Encode(), req.Id, 0, nil)
+	header := core.NewBlockHeaderV1(nil, hospital, nil)
+	b1 := core.NewBlock(header, []*core.Tx{req, reject})
+	b2 := core.NewBlock(header, []*core.Tx{approve})
+
+	s := newAccountState()
+	s.applyBlock(b1)
+	if s.isRegistered(patient) {
+		t.Fatal("expect rejected patient not registered")
+	}
+	s.applyBlock(b2)
+	if !s.isRegistered(patient) {
+		t.Fatal("expect approved patient registered")
+	}
+
+	// 写入数据库之后，注册记录从覆盖层移除
+	s.revertBlock(b2)
+	if s.isRegistered(patient) || len(s.registered) != 0 {
+		t.Fatalf("expect empty overlay, result %v", s.registered)
+	}
+}
+
+func TestAccountStateCredit(t *testing.T) {
+	researcher, patient, worker := genID(role.RESEARCHER), genID(role.PATIENT), genID(role.HOSPITAL)
+	header := core.NewBlockHeaderV1(nil, worker, nil)
+
+	// 响应方作恶，两段数据中有一段无法解开
+	r2p := core.NewTx(core.TX_R2P, researcher, patient, 10, nil, nil, 0, nil)
+	ta := &core.TargetArbitrate{Arbs: []bool{true, false}, Bad: true}
+	arb := core.NewTx(core.TX_ARBITRATE, worker, "", 0, ta.Encode(), r2p.Id, 0, nil)
+	b1 := core.NewBlock(header, []*core.Tx{r2p})
+	b2 := core.NewBlock(header, []*core.Tx{arb})
+
+	s := newAccountState()
+	s.applyBlock(b1)
+	s.applyBlock(b2)
+	if expect := int64(-core.CreditArbitrateLoss - core.CreditBadUpload); s.credit(patient) != expect ||
+		s.credit(researcher) != 0 {
+		t.Fatalf("expect %d/0, result %d/%d", expect, s.credit(patient), s.credit(researcher))
+	}
+
+	s.revertBlock(b1)
+	s.revertBlock(b2)
+	if len(s.credits) != 0 {
+		t.Fatalf("expect empty overlay, result %v", s.credits)
+	}
+}
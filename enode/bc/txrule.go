@@ -0,0 +1,183 @@
+package bc
+
+import (
+	"math"
+
+	"github.com/azd1997/ecoin/account/role"
+	"github.com/azd1997/ecoin/common/crypto"
+	"github.com/azd1997/ecoin/common/encoding"
+	"github.com/azd1997/ecoin/protocol/core"
+)
+
+// 交易规则：结合账户角色与来源交易对交易做上下文无关的检查
+// 余额等需要查询区块链状态的检查在branch.verifyTx中完成
+
+// roleRule 某一交易类型对发起方与接收方角色的要求
+// 为nil表示该方必须为空（ZeroID或不填）
+type roleRule struct {
+	from func(no uint8) bool
+	to   func(no uint8) bool
+}
+
+// 各类交易对双方角色的要求
+var txRoleRules = map[uint8]roleRule{
+	core.TX_COINBASE:  {nil, role.IsARole},                 // 出块奖励只发给A类账户
+	core.TX_GENERAL:   {role.IsRole, role.IsRole},          // 通用转账
+	core.TX_R2P:       {role.IsResearcher, role.IsPatient}, // 研究机构->病人
+	core.TX_P2R:       {role.IsPatient, role.IsResearcher}, // 病人->研究机构
+	core.TX_P2H:       {role.IsPatient, role.IsHospital},   // 病人->医院
+	core.TX_H2P:       {role.IsHospital, role.IsPatient},   // 医院->病人
+	core.TX_P2D:       {role.IsPatient, role.IsDoctor},     // 病人->医生
+	core.TX_D2P:       {role.IsDoctor, role.IsPatient},     // 医生->病人
+	core.TX_ARBITRATE: {role.IsARole, nil},                 // 仲裁者为worker
+	core.TX_UPLOAD:    {role.IsPatient, role.IsHospital},   // 病人上传数据摘要到医院
+	core.TX_REGREQ:    {role.IsRole, role.IsHospital},      // 向医院申请注册
+	core.TX_REGRESP:   {role.IsHospital, role.IsRole},      // 医院回复注册
+}
+
+// 各类交易所允许的来源交易类型
+// 不在表中的交易类型不允许有来源交易
+// originAllowed为true表示该类交易可以作为初始交易（没有来源交易）
+type prevRule struct {
+	originAllowed bool
+	prevTypes     []uint8
+}
+
+var txPrevRules = map[uint8]prevRule{
+	core.TX_R2P:       {true, []uint8{core.TX_P2R}},
+	core.TX_P2R:       {false, []uint8{core.TX_R2P}},
+	core.TX_P2H:       {true, []uint8{core.TX_H2P}},
+	core.TX_H2P:       {false, []uint8{core.TX_P2H}},
+	core.TX_P2D:       {true, []uint8{core.TX_D2P}},
+	core.TX_D2P:       {false, []uint8{core.TX_P2D}},
+	core.TX_ARBITRATE: {false, []uint8{core.TX_R2P, core.TX_P2R, core.TX_P2H, core.TX_H2P, core.TX_P2D, core.TX_D2P}},
+	core.TX_REGRESP:   {false, []uint8{core.TX_REGREQ}},
+}
+
+// 检查交易双方的角色是否满足该交易类型的要求
+func checkTxRoles(tx *core.Tx) error {
+	rule, ok := txRoleRules[tx.Type]
+	if !ok {
+		return ErrTxRoleNotAllowed{tx.Id, tx.Type, "unknown tx type"}
+	}
+
+	if !checkPartyRole(tx.From, rule.from) {
+		return ErrTxRoleNotAllowed{tx.Id, tx.Type, "from"}
+	}
+	if !checkPartyRole(tx.To, rule.to) {
+		return ErrTxRoleNotAllowed{tx.Id, tx.Type, "to"}
+	}
+	return nil
+}
+
+func checkPartyRole(id crypto.ID, allow func(no uint8) bool) bool {
+	if allow == nil {
+		return isEmptyID(id)
+	}
+	if len(id) != crypto.ID_LEN_WITH_ROLE || id == crypto.ZeroID {
+		return false
+	}
+	return allow(id.RoleNo())
+}
+
+// 检查来源交易的类型是否与当前交易匹配。prev为nil表示当前交易没有来源交易
+func checkPrevTxType(tx *core.Tx, prev *core.Tx) error {
+	rule, ok := txPrevRules[tx.Type]
+	if prev == nil {
+		if ok && !rule.originAllowed {
+			return ErrInvalidPrevTx{tx.Id, "missing prev tx"}
+		}
+		return nil
+	}
+
+	if !ok {
+		return ErrInvalidPrevTx{tx.Id, "tx type can't have prev tx"}
+	}
+	for _, typ := range rule.prevTypes {
+		if prev.Type == typ {
+			return nil
+		}
+	}
+	return ErrInvalidPrevTx{tx.Id, "mismatch prev tx type " + core.TxTypes[prev.Type]}
+}
+
+// CoinbaseReward 由creator构建的高度为height的区块的出块奖励，由creator的角色配置决定
+func CoinbaseReward(creator crypto.ID, height uint64) uint32 {
+	if len(creator) != crypto.ID_LEN_WITH_ROLE {
+		return 0
+	}
+	r := role.Get(creator.RoleNo())
+	if r == nil {
+		return 0
+	}
+	reward := r.Reward(height)
+	if reward > math.MaxUint32 {
+		return math.MaxUint32
+	}
+	return uint32(reward)
+}
+
+// 计算交易给各账户带来的余额变动，并累加到deltas
+// 发起方支付转账数额与交易费，交易费由区块构建者获得，见applyBlockBalance
+// 请求类交易的转账数额冻结在托管池，接收方暂不入账，见accountState.applyTxEscrow
+func applyTxBalance(deltas map[crypto.ID]int64, tx *core.Tx) {
+	if !isEmptyID(tx.From) {
+		deltas[tx.From] -= txCost(tx)
+	}
+	if !isEmptyID(tx.To) && !tx.IsRequest() {
+		deltas[tx.To] += int64(tx.Amount)
+	}
+}
+
+// 计算区块给各账户带来的余额变动（包括区块构建者获得的交易费），并累加到deltas
+func applyBlockBalance(deltas map[crypto.ID]int64, b *core.Block) {
+	var fees int64
+	for _, tx := range b.Txs {
+		applyTxBalance(deltas, tx)
+		if !isEmptyID(tx.From) {
+			fees += int64(tx.Fee)
+		}
+	}
+	if fees > 0 {
+		deltas[b.CreateBy] += fees
+	}
+}
+
+// 交易发起方需要支付的总额
+func txCost(tx *core.Tx) int64 {
+	return int64(tx.Amount) + int64(tx.Fee)
+}
+
+func isEmptyID(id crypto.ID) bool {
+	return id == "" || id == crypto.ZeroID
+}
+
+// txContext 校验同一区块内多笔交易时的上下文
+// 区块内的交易可能依赖区块内更早的交易（例如先收款再转出，或者引用区块内更早的交易作为来源交易）
+type txContext struct {
+	deltas     map[crypto.ID]int64 // 区块内已校验交易带来的余额变动
+	txs        map[string]*core.Tx // 区块内已校验的交易 <hex(tx.Id), *core.Tx>
+	next       map[string]*core.Tx // 区块内已校验交易的来源交易 <hex(tx.PrevTxId), *core.Tx>
+	registered map[crypto.ID]bool  // 区块内已完成注册的账户
+}
+
+func newTxContext() *txContext {
+	return &txContext{
+		deltas:     make(map[crypto.ID]int64),
+		txs:        make(map[string]*core.Tx),
+		next:       make(map[string]*core.Tx),
+		registered: make(map[crypto.ID]bool),
+	}
+}
+
+// 将校验通过的交易加入上下文
+func (ctx *txContext) add(tx *core.Tx) {
+	ctx.txs[encoding.ToHex(tx.Id)] = tx
+	if tx.HasPrevTx() {
+		ctx.next[encoding.ToHex(tx.PrevTxId)] = tx
+	}
+	applyTxBalance(ctx.deltas, tx)
+	if id, ok := tx.Registration(); ok {
+		ctx.registered[id] = true
+	}
+}
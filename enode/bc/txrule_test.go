@@ -0,0 +1,86 @@
+package bc
+
+import (
+	"testing"
+
+	"github.com/azd1997/ecoin/account/role"
+	"github.com/azd1997/ecoin/common/crypto"
+	"github.com/azd1997/ecoin/protocol/core"
+)
+
+func genID(roleNo uint8) crypto.ID {
+	priv, _ := crypto.NewPrivateKeyS256()
+	return crypto.PrivateKey2ID(priv, roleNo)
+}
+
+func TestCheckTxRoles(t *testing.T) {
+	patient, researcher, hospital := genID(role.PATIENT), genID(role.RESEARCHER), genID(role.HOSPITAL)
+
+	cases := []struct {
+		typ    uint8
+		from   crypto.ID
+		to     crypto.ID
+		expect bool
+	}{
+		{core.TX_GENERAL, patient, hospital, true},
+		{core.TX_R2P, researcher, patient, true},
+		{core.TX_R2P, patient, researcher, false},
+		{core.TX_P2R, patient, researcher, true},
+		{core.TX_P2H, patient, researcher, false},
+		{core.TX_COINBASE, crypto.ZeroID, hospital, true},
+		{core.TX_COINBASE, crypto.ZeroID, patient, false},
+		{core.TX_ARBITRATE, hospital, crypto.ZeroID, true},
+		{core.TX_ARBITRATE, patient, crypto.ZeroID, false},
+	}
+
+	for i, cs := range cases {
+		tx := core.NewTx(cs.typ, cs.from, cs.to, 0, nil, nil, 0, nil)
+		err := checkTxRoles(tx)
+		if cs.expect && err != nil {
+			t.Fatalf("[%d] expect valid, but %v", i, err)
+		}
+		if !cs.expect && err == nil {
+			t.Fatalf("[%d] expect role error", i)
+		}
+	}
+}
+
+func TestCheckPrevTxType(t *testing.T) {
+	patient, researcher := genID(role.PATIENT), genID(role.RESEARCHER)
+	r2p := core.NewTx(core.TX_R2P, researcher, patient, 10, nil, nil, 0, nil)
+	p2r := core.NewTx(core.TX_P2R, patient, researcher, 0, nil, r2p.Id, 0, nil)
+	general := core.NewTx(core.TX_GENERAL, patient, researcher, 10, nil, nil, 0, nil)
+
+	if err := checkPrevTxType(r2p, nil); err != nil {
+		t.Fatalf("expect origin r2p valid, but %v", err)
+	}
+	if err := checkPrevTxType(p2r, r2p); err != nil {
+		t.Fatalf("expect p2r after r2p valid, but %v", err)
+	}
+	if err := checkPrevTxType(p2r, nil); err == nil {
+		t.Fatal("expect p2r without prev tx invalid")
+	}
+	if err := checkPrevTxType(p2r, general); err == nil {
+		t.Fatal("expect p2r after general tx invalid")
+	}
+	if err := checkPrevTxType(general, r2p); err == nil {
+		t.Fatal("expect general tx with prev tx invalid")
+	}
+}
+
+func TestCoinbaseReward(t *testing.T) {
+	hospital, patient := genID(role.HOSPITAL), genID(role.PATIENT)
+
+	if reward := CoinbaseReward(hospital, 1); reward != uint32(role.Get(role.HOSPITAL).GenesisReward()) {
+		t.Fatalf("expect genesis reward, but %d", reward)
+	}
+	if reward := CoinbaseReward(hospital, 2); reward != uint32(role.Get(role.HOSPITAL).CoinbaseReward()) {
+		t.Fatalf("expect coinbase reward, but %d", reward)
+	}
+	if reward := CoinbaseReward(patient, 2); reward != 0 {
+		t.Fatalf("expect no reward for B role, but %d", reward)
+	}
+	if reward := CoinbaseReward(crypto.ZeroID[:1], 2); reward != 0 {
+		t.Fatalf("expect no reward for invalid id, but %d", reward)
+	}
+}
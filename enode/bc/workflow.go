@@ -0,0 +1,200 @@
+package bc
+
+import (
+	"fmt"
+
+	"github.com/azd1997/ecoin/common/crypto"
+	"github.com/azd1997/ecoin/protocol/core"
+)
+
+// 两方交易流程（workflow）
+// R2P->P2R、P2H->H2P、P2D->D2P 三类交易活动都是由请求方发起、响应方回复的交替过程：
+//
+//	请求(初始，Uncompleted=0) -> 回复 -> 请求方确认(Uncompleted=0，流程完成)
+//	                                  -> 请求方再次请求(Uncompleted=1) -> 回复 -> ...
+//
+// 请求方最多可以标记3轮未完成，第3次标记未完成后流程进入纠纷状态，只能由worker发起仲裁交易结束
+// 每个流程由其初始交易标识，流程中的每一笔交易只能有一个后续交易
+
+// 请求方标记未完成的最大轮数
+const maxUncompletedRounds = 3
+
+// 一个流程最多包含的交易数：初始请求与回复，每一轮未完成各一次再请求与回复，最后一笔确认或仲裁
+const maxWorkflowTxs = 2*maxUncompletedRounds + 3
+
+// WorkflowState 交易流程的状态
+type WorkflowState uint8
+
+const (
+	WorkflowRequested  WorkflowState = iota + 1 // 等待响应方回复
+	WorkflowResponded                           // 等待请求方确认或再次请求
+	WorkflowCompleted                           // 请求方确认完成
+	WorkflowDisputed                            // 未完成轮数达到上限，等待仲裁
+	WorkflowArbitrated                          // 已仲裁
+)
+
+var workflowStates = map[WorkflowState]string{
+	WorkflowRequested:  "Requested",
+	WorkflowResponded:  "Responded",
+	WorkflowCompleted:  "Completed",
+	WorkflowDisputed:   "Disputed",
+	WorkflowArbitrated: "Arbitrated",
+}
+
+func (s WorkflowState) String() string {
+	if name, ok := workflowStates[s]; ok {
+		return name
+	}
+	return fmt.Sprintf("Unknown(%d)", s)
+}
+
+// 请求类交易及其对应的回复类交易
+var workflowResponses = map[uint8]uint8{
+	core.TX_R2P: core.TX_P2R,
+	core.TX_P2H: core.TX_H2P,
+	core.TX_P2D: core.TX_D2P,
+}
+
+// 判断交易是否属于两方交易流程
+func isWorkflowTx(tx *core.Tx) bool {
+	if tx.Type == core.TX_ARBITRATE {
+		return true
+	}
+	for req, resp := range workflowResponses {
+		if tx.Type == req || tx.Type == resp {
+			return true
+		}
+	}
+	return false
+}
+
+// Workflow 一个两方交易流程
+type Workflow struct {
+	Origin    crypto.Hash   // 初始交易的哈希，作为流程标识
+	Requester crypto.ID     // 请求方
+	Responder crypto.ID     // 响应方
+	Txs       []*core.Tx    // 流程中的交易，从初始交易开始按先后顺序
+	Rounds    int           // 请求方标记未完成的轮数
+	State     WorkflowState // 当前状态
+}
+
+// 以初始交易origin创建流程
+func newWorkflow(origin *core.Tx) (*Workflow, error) {
+	if _, ok := workflowResponses[origin.Type]; !ok {
+		return nil, ErrInvalidWorkflow{origin.Id, "origin tx must be a request"}
+	}
+	if origin.HasPrevTx() {
+		return nil, ErrInvalidWorkflow{origin.Id, "origin tx must not have prev tx"}
+	}
+	if origin.Uncompleted != 0 {
+		return nil, ErrInvalidWorkflow{origin.Id, "origin tx must not be uncompleted"}
+	}
+
+	return &Workflow{
+		Origin:    origin.Id,
+		Requester: origin.From,
+		Responder: origin.To,
+		Txs:       []*core.Tx{origin},
+		State:     WorkflowRequested,
+	}, nil
+}
+
+// Last 流程中最新的交易
+func (w *Workflow) Last() *core.Tx {
+	return w.Txs[len(w.Txs)-1]
+}
+
+// Closed 流程是否已经结束
+func (w *Workflow) Closed() bool {
+	return w.State == WorkflowCompleted || w.State == WorkflowArbitrated
+}
+
+// 流程的请求类交易类型，即初始交易的类型
+func (w *Workflow) kind() uint8 {
+	return w.Txs[0].Type
+}
+
+// KeyRecipients 流程中全部密钥信封的共同接收方，即能打开流程中所有数据密钥的账户。流程中没有密钥信封时返回false
+func (w *Workflow) KeyRecipients() ([]crypto.ID, bool) {
+	var result []crypto.ID
+	sealed := false
+	for _, tx := range w.Txs {
+		ids, ok := txKeyRecipients(tx)
+		if !ok {
+			continue
+		}
+		if !sealed {
+			result, sealed = ids, true
+			continue
+		}
+		result = intersectIDs(result, ids)
+	}
+	return result, sealed
+}
+
+// 检查tx是否为流程的合法下一步，是则推进流程状态
+func (w *Workflow) apply(tx *core.Tx) error {
+	if !tx.IsNextOf(w.Last()) {
+		return ErrInvalidWorkflow{tx.Id, "not the next of last tx in workflow"}
+	}
+
+	switch w.State {
+	case WorkflowRequested:
+		if tx.Type != workflowResponses[w.kind()] {
+			return ErrInvalidWorkflow{tx.Id, "expect a response from " + w.Responder.ToHex()}
+		}
+		w.State = WorkflowResponded
+	case WorkflowResponded:
+		if tx.Type != w.kind() {
+			return ErrInvalidWorkflow{tx.Id, "expect a confirmation from " + w.Requester.ToHex()}
+		}
+		if tx.Uncompleted == 0 {
+			w.State = WorkflowCompleted
+			break
+		}
+		w.Rounds++
+		if w.Rounds >= maxUncompletedRounds {
+			w.State = WorkflowDisputed
+		} else {
+			w.State = WorkflowRequested
+		}
+	case WorkflowDisputed:
+		if tx.Type != core.TX_ARBITRATE {
+			return ErrInvalidWorkflow{tx.Id, "disputed workflow can only be arbitrated"}
+		}
+		w.State = WorkflowArbitrated
+	default:
+		return ErrInvalidWorkflow{tx.Id, "workflow is closed as " + w.State.String()}
+	}
+
+	w.Txs = append(w.Txs, tx)
+	return nil
+}
+
+// 从流程中的某笔交易tx沿PrevTxId回溯到初始交易，并按顺序重放得到流程（到tx为止）
+// lookup用来查找交易，找不到时返回nil
+func buildWorkflow(tx *core.Tx, lookup func(hash crypto.Hash) *core.Tx) (*Workflow, error) {
+	txs := []*core.Tx{tx}
+	for iter := tx; iter.HasPrevTx(); {
+		if len(txs) >= maxWorkflowTxs {
+			return nil, ErrInvalidWorkflow{tx.Id, "too many txs in workflow"}
+		}
+		prev := lookup(iter.PrevTxId)
+		if prev == nil {
+			return nil, ErrInvalidWorkflow{tx.Id, fmt.Sprintf("tx %X in workflow not found", iter.PrevTxId)}
+		}
+		txs = append(txs, prev)
+		iter = prev
+	}
+
+	w, err := newWorkflow(txs[len(txs)-1])
+	if err != nil {
+		return nil, err
+	}
+	for i := len(txs) - 2; i >= 0; i-- {
+		if err := w.apply(txs[i]); err != nil {
+			return nil, err
+		}
+	}
+	return w, nil
+}
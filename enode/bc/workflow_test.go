@@ -0,0 +1,104 @@
+package bc
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/azd1997/ecoin/account/role"
+	"github.com/azd1997/ecoin/common/crypto"
+	"github.com/azd1997/ecoin/common/encoding"
+	"github.com/azd1997/ecoin/protocol/core"
+)
+
+func TestWorkflow(t *testing.T) {
+	patient, hospital, worker := genID(role.PATIENT), genID(role.HOSPITAL), genID(role.HOSPITAL)
+
+	txs := make(map[string]*core.Tx)
+	lookup := func(hash crypto.Hash) *core.Tx {
+		return txs[encoding.ToHex(hash)]
+	}
+	next := func(typ uint8, prev *core.Tx, uncompleted uint8) *core.Tx {
+		from, to := prev.To, prev.From
+		if typ == core.TX_ARBITRATE {
+			from, to = worker, ""
+		}
+		tx := core.NewTx(typ, from, to, 0, nil, prev.Id, uncompleted, nil)
+		txs[encoding.ToHex(tx.Id)] = tx
+		return tx
+	}
+
+	origin := core.NewTx(core.TX_P2H, patient, hospital, 10, nil, nil, 0, nil)
+	txs[encoding.ToHex(origin.Id)] = origin
+	w, err := buildWorkflow(origin, lookup)
+	if err != nil {
+		t.Fatalf("build workflow from origin: %v", err)
+	}
+	if w.State != WorkflowRequested || w.Requester != patient || w.Responder != hospital {
+		t.Fatalf("unexpected origin workflow %+v", w)
+	}
+
+	// 请求方只能在收到回复之后确认或再次请求
+	if err := w.apply(next(core.TX_P2H, origin, 1)); err == nil {
+		t.Fatal("expect request before response invalid")
+	}
+	// 回复方向必须与请求相反
+	wrong := core.NewTx(core.TX_H2P, hospital, genID(role.PATIENT), 0, nil, origin.Id, 0, nil)
+	if err := w.apply(wrong); err == nil {
+		t.Fatal("expect response to another patient invalid")
+	}
+
+	// 3轮未完成之后进入纠纷状态
+	last := origin
+	for i := 1; i <= maxUncompletedRounds; i++ {
+		resp := next(core.TX_H2P, last, 0)
+		if err := w.apply(resp); err != nil {
+			t.Fatalf("[%d] apply response: %v", i, err)
+		}
+		last = next(core.TX_P2H, resp, 1)
+		if err := w.apply(last); err != nil {
+			t.Fatalf("[%d] apply uncompleted request: %v", i, err)
+		}
+		if w.Rounds != i {
+			t.Fatalf("[%d] expect %d rounds, but %d", i, i, w.Rounds)
+		}
+	}
+	if w.State != WorkflowDisputed {
+		t.Fatalf("expect disputed, but %s", w.State)
+	}
+	if err := w.apply(next(core.TX_H2P, last, 0)); err == nil {
+		t.Fatal("expect response in disputed workflow invalid")
+	}
+	arb := next(core.TX_ARBITRATE, last, 0)
+	if err := w.apply(arb); err != nil {
+		t.Fatalf("apply arbitrate: %v", err)
+	}
+	if !w.Closed() {
+		t.Fatalf("expect closed, but %s", w.State)
+	}
+
+	// 从流程中任意一笔交易回溯，得到相同的流程
+	rebuilt, err := buildWorkflow(arb, lookup)
+	if err != nil {
+		t.Fatalf("rebuild workflow: %v", err)
+	}
+	if rebuilt.State != WorkflowArbitrated || len(rebuilt.Txs) != len(w.Txs) ||
+		!bytes.Equal(rebuilt.Origin, origin.Id) {
+		t.Fatalf("rebuilt workflow mismatch: %s, %d txs", rebuilt.State, len(rebuilt.Txs))
+	}
+
+	// 确认完成
+	origin2 := core.NewTx(core.TX_P2D, patient, genID(role.DOCTOR), 0, nil, nil, 0, nil)
+	txs[encoding.ToHex(origin2.Id)] = origin2
+	confirm := next(core.TX_P2D, next(core.TX_D2P, origin2, 0), 0)
+	if w, err = buildWorkflow(confirm, lookup); err != nil || w.State != WorkflowCompleted {
+		t.Fatalf("expect completed workflow, but %v %v", w, err)
+	}
+	if err := w.apply(next(core.TX_D2P, confirm, 0)); err == nil {
+		t.Fatal("expect tx after completed workflow invalid")
+	}
+
+	// 初始交易不能为未完成
+	if _, err := newWorkflow(core.NewTx(core.TX_P2H, patient, hospital, 0, nil, nil, 1, nil)); err == nil {
+		t.Fatal("expect uncompleted origin invalid")
+	}
+}
@@ -0,0 +1,70 @@
+package enode
+
+import (
+	"fmt"
+
+	"github.com/azd1997/ecoin/account"
+	"github.com/azd1997/ecoin/common/crypto"
+	"github.com/azd1997/ecoin/common/params"
+	"github.com/azd1997/ecoin/enode/bc"
+	"github.com/azd1997/ecoin/enode/bc/merkle"
+	"github.com/azd1997/ecoin/protocol/core"
+)
+
+// Consensus 共识引擎
+// potCompetitor 负责出块周期的调度（何时收集交易、何时判定出块者、何时等待新区块），
+// 由谁出块、如何封装与检查区块则由共识引擎决定
+type Consensus interface {
+	// Name 共识名称
+	Name() string
+
+	// GenProof 竞争开始时，生成本节点基于父区块base、打包交易txs的证明，并记录到本地
+	// 返回nil表示该共识不需要广播证明。证明的具体类型由共识引擎决定
+	GenProof(base crypto.Hash, txs []*core.Tx) core.Proof
+
+	// Winner 返回以base为父区块的这一轮的出块者。无法判断时返回空ID
+	Winner(base crypto.Hash) crypto.ID
+
+	// WinnerProof 返回以base为父区块的这一轮胜者的证明。不需要证明的共识返回nil
+	WinnerProof(base crypto.Hash) core.Proof
+
+	// Missed 记录胜出却未按时出块的胜者，本轮改由接替者出块
+	Missed(proof core.Proof)
+
+	// Seal 封装区块。txs已包含coinbase交易
+	Seal(base crypto.Hash, txs []*core.Tx) *core.Block
+
+	// CheckBlock 共识相关的区块检查
+	bc.ConsensusChecker
+}
+
+// 根据名称创建共识引擎
+func newConsensus(name string, acc *account.Account, pp *proofPool,
+	c *bc.Chain, authorities []crypto.ID) (Consensus, error) {
+	switch name {
+	case "", params.ConsensusPoT:
+		return newPoTConsensus(acc, pp, c), nil
+	case params.ConsensusRoundRobin:
+		if len(authorities) == 0 {
+			return nil, fmt.Errorf("consensus %s: empty authorities", name)
+		}
+		return newRRConsensus(acc.UserId(), authorities, c), nil
+	default:
+		return nil, fmt.Errorf("unknown consensus %s", name)
+	}
+}
+
+// 以creator的名义基于父区块base封装区块，区块头的默克尔根包含所有交易（含coinbase）
+func sealBlock(base crypto.Hash, creator crypto.ID, txs []*core.Tx) *core.Block {
+	var txLeafs merkle.MerkleLeafs
+	for _, tx := range txs {
+		txLeafs = append(txLeafs, tx.Id)
+	}
+	txRoot := core.EmptyMerkleRoot
+	if len(txLeafs) > 0 {
+		txRoot, _ = merkle.ComputeRoot(txLeafs)
+	}
+
+	header := core.NewBlockHeaderV1(base, creator, txRoot)
+	return core.NewBlock(header, txs)
+}
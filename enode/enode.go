@@ -1,21 +1,26 @@
 package enode
 
 import (
+	"bytes"
 	"fmt"
 	"github.com/azd1997/ecoin/account"
 	"github.com/azd1997/ecoin/account/role"
 	"github.com/azd1997/ecoin/common/crypto"
+	"github.com/azd1997/ecoin/common/encoding"
 	"github.com/azd1997/ecoin/enode/bc"
 	"github.com/azd1997/ecoin/p2p"
 	"github.com/azd1997/ecoin/protocol/core"
 	"github.com/azd1997/ecoin/protocol/raw"
 	"github.com/azd1997/ecoin/protocol/view"
+	"github.com/azd1997/ecoin/store/db"
 	"sort"
 )
 
 type Config struct {
 	Node         p2p.Node	// p2p 节点
 	Account       *account.Account	// 代表账户的私钥(有了私钥和橘色编号可以得到完整账户)
+	Consensus    string	// 共识名称，见params.ConsensusXXX。为空则使用PoT
+	Authorities  []crypto.ID	// 授权出块的节点，仅roundrobin共识使用
 
 	*bc.Config
 }
@@ -37,6 +42,9 @@ type Enode struct {
 	// 证明池
 	pp *proofPool
 
+	// 共识引擎
+	cons Consensus
+
 	// 网络模块
 	net *net
 
@@ -46,6 +54,9 @@ type Enode struct {
 	// potCompetitor。共识竞争器。轮询/同步区块；构造区块
 	pc *potCompetitor
 
+	// arbitrator。仲裁器。仲裁陷入纠纷的交易流程
+	arb *arbitrator
+
 	// workerNode 工人节点 账户角色为A类账户，则有义务承担worker的职责，负责出块
 	workerNode bool
 }
@@ -56,18 +67,33 @@ func NewEnode(conf *Config) *Enode {
 	if err := chain.Init(conf.Config); err != nil {
 		logger.Fatal("init enode module failed: %v\n", err)
 	}
-	chain.Start()
-
-	// txPool
-	txPool := newTxPool(conf.Account)
 
 	// proofPool
 	proofPool := NewProofPool()
+	proofPool.start()
+
+	// consensus
+	cons, err := newConsensus(conf.Consensus, conf.Account, proofPool, chain, conf.Authorities)
+	if err != nil {
+		logger.Fatal("init consensus failed: %v\n", err)
+	}
+	logger.Info("the enode instance is running with consensus %s\n", cons.Name())
+	// 区块链根据共识规则检查区块
+	chain.SetConsensusChecker(cons)
+	chain.Start()
+
+	// txPool
+	txPool := newTxPool(conf.Account, chain)
+	chain.AddBlocksNotify(txPool.blocks)
 
 	// net
-	network := newNet(conf.Node, chain, txPool, conf.Account.RoleNo)
+	network := newNet(conf.Node, chain, txPool, proofPool, conf.Account.RoleNo)
 	// txPool设置
 	txPool.setBroadcastChan(network.txsToBroadcast)
+	// worker节点入池前检查上传交易所声称的数据
+	if role.IsARole(conf.Account.RoleNo) {
+		txPool.checkUpload = checkUpload
+	}
 	// network启动
 	network.start()
 	// txPool启动
@@ -78,12 +104,15 @@ func NewEnode(conf *Config) *Enode {
 
 	// potCompetitor
 	var pot *potCompetitor
+	var arb *arbitrator
 	workerNode := false
 	if role.IsARole(conf.Account.RoleNo) {
 		logger.Info("the enode instance is running with a worker ID\n")
-		pot = newPotCompetitor(txPool, chain, network,
-			crypto.PrivateKey2ID(conf.Account.PrivateKey, conf.Account.RoleNo))
+		pot = newPotCompetitor(cons, txPool, chain, network, conf.Account)
 		pot.start()
+		arb = newArbitrator(conf.Account, chain, txPool)
+		chain.AddBlocksNotify(arb.blocks)
+		arb.start()
 		workerNode = true
 	} else {
 		logger.Info("the enode instance is running with a non-worker ID\n")
@@ -95,9 +124,11 @@ func NewEnode(conf *Config) *Enode {
 		chain:chain,
 		tp:txPool,
 		pp: proofPool,
+		cons: cons,
 		qc:queryCache,
 		net:network,
 		pc:pot,
+		arb:arb,
 		workerNode:workerNode,
 	}
 }
@@ -106,6 +137,7 @@ func (en *Enode) Stop() {
 	// 对于工人节点，首先关闭竞争器
 	if en.workerNode {
 		en.pc.stop()
+		en.arb.stop()
 	}
 	// 交易池关闭
 	en.tp.stop()
@@ -137,8 +169,126 @@ func (en *Enode) BuildTx(txs []*core.Tx) error {
 		}
 	}
 
-	en.tp.addTx(txs, false)	// 自己上传，当然不是来自广播
-	return nil
+	return en.tp.addTx(txs, false)	// 自己上传，当然不是来自广播
+}
+
+// 向医院hospital申请注册。病人的个人信息info使用医院公钥加密，其他角色以name和info（资质）明文注册
+func (en *Enode) Register(hospital crypto.ID, name string, info []byte) (crypto.Hash, error) {
+	ri := &core.RegisterInfo{Name: name, Credential: info}
+	if role.IsPatient(en.acc.RoleNo) {
+		var err error
+		if ri, err = core.NewPatientRegisterInfo(hospital, info); err != nil {
+			return nil, err
+		}
+	}
+
+	tx := core.NewTx(core.TX_REGREQ, en.id, hospital, 0, ri.Encode(), nil, 0, nil)
+	if err := tx.Sign(en.acc.PrivateKey); err != nil {
+		return nil, err
+	}
+	return tx.Id, en.BuildTx([]*core.Tx{tx})
+}
+
+// 医院回复注册申请。approved为false时须给出不通过的原因reason
+func (en *Enode) ReplyRegistration(hexHash string, approved bool, reason string) (crypto.Hash, error) {
+	hash, err := encoding.FromHex(hexHash)
+	if err != nil {
+		return nil, err
+	}
+	req := en.chain.GetTx(hash)
+	if req == nil || req.Type != core.TX_REGREQ || req.To != en.id {
+		return nil, fmt.Errorf("register request %s to this hospital not found", hexHash)
+	}
+
+	rr := &core.RegisterResp{Approved: approved, Reason: reason}
+	tx := core.NewTx(core.TX_REGRESP, en.id, req.From, 0, rr.Encode(), req.Id, 0, nil)
+	if err := tx.Sign(en.acc.PrivateKey); err != nil {
+		return nil, err
+	}
+	return tx.Id, en.BuildTx([]*core.Tx{tx})
+}
+
+// 病人向研究机构回复其请求hexReq所需目标数据的密钥keys（TxP2R）
+// 密钥包装给请求方、本账户以及候选仲裁者，流程陷入纠纷时仲裁者从中选出，因而能够检验
+func (en *Enode) SendTargetKeys(hexReq string, keys [][]byte) (crypto.Hash, error) {
+	hash, err := encoding.FromHex(hexReq)
+	if err != nil {
+		return nil, err
+	}
+	req := en.chain.GetTx(hash)
+	if req == nil || req.Type != core.TX_R2P || req.To != en.id {
+		return nil, fmt.Errorf("data request %s to this account not found", hexReq)
+	}
+
+	candidates, err := en.chain.ArbitratorCandidates(req.Id)
+	if err != nil {
+		return nil, err
+	}
+	tk, err := core.NewTargetKey(keys, append([]crypto.ID{req.From, en.id}, candidates...)...)
+	if err != nil {
+		return nil, err
+	}
+	tx := core.NewTx(core.TX_P2R, en.id, req.From, 0, tk.Encode(), req.Id, 0, nil)
+	if err := tx.Sign(en.acc.PrivateKey); err != nil {
+		return nil, err
+	}
+	return tx.Id, en.BuildTx([]*core.Tx{tx})
+}
+
+// 病人将目标数据hashes及其密钥keys交给医院或医生to请求诊断（TxP2H/TxP2D），支付amount
+// 密钥包装给to、本账户以及候选仲裁者，流程陷入纠纷时仲裁者从中选出
+func (en *Enode) RequestDiagnosis(to crypto.ID, hashes []crypto.Hash, keys [][]byte, amount uint32) (crypto.Hash, error) {
+	var typ uint8
+	switch {
+	case role.IsHospital(to.RoleNo()):
+		typ = core.TX_P2H
+	case role.IsDoctor(to.RoleNo()):
+		typ = core.TX_P2D
+	default:
+		return nil, fmt.Errorf("%s is neither hospital nor doctor", to)
+	}
+
+	candidates, err := en.chain.ArbitratorCandidates(nil)
+	if err != nil {
+		return nil, err
+	}
+	tdk, err := core.NewTargetDataWithKey(hashes, keys, append([]crypto.ID{to, en.id}, candidates...)...)
+	if err != nil {
+		return nil, err
+	}
+	tx := core.NewTx(typ, en.id, to, amount, tdk.Encode(), nil, 0, nil)
+	if err := tx.Sign(en.acc.PrivateKey); err != nil {
+		return nil, err
+	}
+	return tx.Id, en.BuildTx([]*core.Tx{tx})
+}
+
+// 使用本账户私钥打开交易hexHash（TxP2R/TxP2H/TxP2D）中的目标数据密钥
+func (en *Enode) OpenKeys(hexHash string) ([][]byte, error) {
+	hash, err := encoding.FromHex(hexHash)
+	if err != nil {
+		return nil, err
+	}
+	tx := en.chain.GetTx(hash)
+	if tx == nil {
+		return nil, fmt.Errorf("tx %s not found", hexHash)
+	}
+	switch tx.Type {
+	case core.TX_P2R:
+		tk := &core.TargetKey{}
+		if err := tk.Decode(bytes.NewReader(tx.Payload)); err != nil {
+			return nil, err
+		}
+		return tk.OpenKeys(en.id, en.acc.PrivateKey)
+	case core.TX_P2H, core.TX_P2D:
+		tdk := &core.TargetDataWithKey{}
+		if err := tdk.Decode(bytes.NewReader(tx.Payload)); err != nil {
+			return nil, err
+		}
+		return tdk.OpenKeys(en.id, en.acc.PrivateKey)
+	default:
+		return nil, fmt.Errorf("tx %s of type %s carries no keys", hexHash, core.TxTypes[tx.Type])
+	}
 }
 
 // 查询交易
@@ -146,8 +296,54 @@ func (en *Enode) QueryTx(hexHashes []string) []*view.TxInfo {
 	return en.qc.getTx(hexHashes)
 }
 
+// 查询交易所在的两方交易流程的当前状态
+func (en *Enode) QueryWorkflow(hexHash string) (*view.WorkflowInfo, error) {
+	hash, err := encoding.FromHex(hexHash)
+	if err != nil {
+		return nil, err
+	}
+	w, err := en.chain.GetWorkflow(hash)
+	if err != nil {
+		return nil, err
+	}
+
+	return &view.WorkflowInfo{
+		Origin:    w.Origin,
+		Requester: w.Requester,
+		Responder: w.Responder,
+		State:     w.State.String(),
+		Rounds:    w.Rounds,
+		Txs:       w.Txs,
+	}, nil
+}
+
+// 按条件检索上传交易，返回第offset条起最多limit条以及满足条件的总数
+// 只有已存储区块中的上传交易建立了索引
+func (en *Enode) QueryUploads(filter *db.UploadFilter, offset, limit int) ([]*view.UploadInfo, int, error) {
+	uploads, total, err := db.GetUploads(filter, offset, limit)
+	if err != nil {
+		return nil, 0, err
+	}
+	var result []*view.UploadInfo
+	for _, u := range uploads {
+		result = append(result, &view.UploadInfo{
+			Hash:      u.Hash,
+			Uploader:  u.Uploader,
+			To:        u.To,
+			Type:      u.Type,
+			Ill:       u.Ill,
+			TimeStart: u.TimeStart,
+			TimeEnd:   u.TimeEnd,
+			Num:       u.Num,
+			StoreAt:   u.StoreAt,
+			Height:    u.Height,
+		})
+	}
+	return result, total, nil
+}
+
 // 查询账户
-func (en *Enode) QueryAccount(id crypto.ID) ([]crypto.Hash, []crypto.Hash, uint64, int64) {
+func (en *Enode) QueryAccount(id crypto.ID) *view.AccountInfo {
 	return en.qc.getAccountInfo(id)
 }
 
@@ -0,0 +1,41 @@
+package enode
+
+import (
+	"fmt"
+
+	"github.com/azd1997/ecoin/common/crypto"
+)
+
+type ErrTxInPool struct {
+	txId []byte
+}
+
+func (e ErrTxInPool) Error() string {
+	return fmt.Sprintf("tx %X is already in pool", e.txId)
+}
+
+type ErrTxPoolFull struct {
+	txId []byte
+}
+
+func (e ErrTxPoolFull) Error() string {
+	return fmt.Sprintf("tx pool is full, tx %X has lower priority than all pending txs", e.txId)
+}
+
+type ErrSenderTxsLimit struct {
+	txId   []byte
+	sender crypto.ID
+}
+
+func (e ErrSenderTxsLimit) Error() string {
+	return fmt.Sprintf("sender %s has %d pending txs, tx %X refused",
+		e.sender, maxTxsPerSender, e.txId)
+}
+
+type ErrUploadCheckBusy struct {
+	txId []byte
+}
+
+func (e ErrUploadCheckBusy) Error() string {
+	return fmt.Sprintf("too many upload txs waiting for sample check, tx %X refused", e.txId)
+}
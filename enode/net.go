@@ -17,6 +17,7 @@ import (
 	"github.com/azd1997/ecoin/common/utils"
 	"github.com/azd1997/ecoin/enode/bc"
 	"github.com/azd1997/ecoin/p2p"
+	"github.com/azd1997/ecoin/p2p/peer"
 	"github.com/azd1997/ecoin/protocol/core"
 	"github.com/azd1997/ego/epattern"
 )
@@ -46,6 +47,9 @@ type net struct {
 	// workerNode 工人节点 账户角色为A类账户，则有义务承担worker的职责，负责出块
 	workerNode bool
 
+	// node 本机P2P节点，用于报告对端节点的作恶行为
+	node p2p.Node
+
 	// protocolRunner 协议运行器。 net实现了core协议，但它得添加到p2p.Node中，生成一个protocolRunner
 	// 这其实就相当于http WEB编程中的handlerMux。
 	protocolRunner p2p.ProtocolRunner
@@ -77,8 +81,7 @@ type net struct {
 	proofPool *proofPool
 
 	// potProof POT证明。本机的PotProof产生的通道
-	potProof chan *core.PoTProof
-	potProofCollect chan *core.PoTProof	// 网络模块收集到的proof从这个chan传给pot竞争器
+	potProof chan core.Proof
 
 	// potWinnerBlock 本机节点作为出块节点
 	potWinnerBlock chan *core.Block
@@ -87,22 +90,23 @@ type net struct {
 	lm *epattern.LoopMode
 }
 
-func newNet(node p2p.Node, chain *bc.Chain, pool *txPool, nodeRole uint8) *net {
+func newNet(node p2p.Node, chain *bc.Chain, pool *txPool, proofPool *proofPool, nodeRole uint8) *net {
 	result := &net{
 		InitFinishC:     make(chan bool, 1),
 		inited:          false,
+		node:            node,
 		workerNode:      role.IsARole(nodeRole), // A类节点才具有出块权利和义务
 		sendQ:           make(chan *p2p.PeerData, 512),
 		chain:           chain,
 		txPool:          pool,
+		proofPool:       proofPool,
 		syncTicker:      time.NewTicker(initializingSyncInterval),
 		syncHashResp:    make(map[crypto.ID]*core.SyncRespMsg),
 		waitingHash:     false,
 		txsToBroadcast:  make(chan []*core.Tx, txsCacheSize),
 		broadcastFilter: make(map[string]time.Time),
 
-		potProof:make(chan *core.PoTProof, 1),
-		potProofCollect:make(chan *core.PoTProof, 128),
+		potProof:make(chan core.Proof, 1),
 		potWinnerBlock:make(chan *core.Block),
 
 		lm:              epattern.NewLoop(2),
@@ -154,6 +158,7 @@ func (n *net) loop() {
 		case pot := <-n.potProof:
 			n.broadcastProof(pot)
 		case newBlock := <-n.potWinnerBlock:
+			n.chain.AddBlocks([]*core.Block{newBlock}, true)
 			n.broadcastBlock(newBlock)
 		case txs := <-n.txsToBroadcast: // 广播交易
 			n.broadcastTx(txs)
@@ -240,6 +245,8 @@ func (n *net) sync() {
 		logger.Info("peer %s response blockInfos timeout(now %s, last active %s), remain %d\n",
 			exp.peerID, utils.TimeToString(now),
 			utils.TimeToString(exp.lastResponseTime), exp.remainNums)
+		n.reportPeer(exp.peerID, peer.BadSyncTimeout,
+			fmt.Errorf("block sync timeout, remain %d", exp.remainNums))
 
 	}
 	n.waitingBlocks = waiting
@@ -318,9 +325,14 @@ func (n *net) broadcastTx(txs []*core.Tx) {
 	n.broadcast(content)
 }
 
-// 广播证明
-func (n *net) broadcastProof(proof *core.PoTProof) {
-	content := core.NewProofBroadcastMsg(proof).Encode()
+// 广播证明。目前只有PoT证明需要广播
+func (n *net) broadcastProof(proof core.Proof) {
+	potProof, ok := proof.(*core.PoTProof)
+	if !ok {
+		logger.Warn("broadcast proof: unsupported proof type %T\n", proof)
+		return
+	}
+	content := core.NewProofBroadcastMsg(potProof).Encode()
 	n.broadcast(content)
 }
 
@@ -333,11 +345,24 @@ func (n *net) handleRecvPacket(pd *p2p.PeerData) {
 
 	// 解码出消息头
 	if err = msg.Decode(bytes.NewReader(pd.Data)); err != nil {
+		n.reportPeer(pd.Peer, peer.BadMalformedMsg, err)
 		return
 	}
 
+	// 消息版本须与握手时协商的核心协议版本一致
+	if pd.Caps != nil && uint16(msg.Version) != pd.Caps.CoreVersion {
+		n.reportPeer(pd.Peer, peer.BadMalformedMsg,
+			fmt.Errorf("msg version %d, negotiated core version %d", msg.Version, pd.Caps.CoreVersion))
+		return
+	}
+
+	// 无法解码或未知类型的消息
 	errorLog := func() {
 		logger.Warn("receive err type(%d) msg from %s\n", msg.Type, pd.Peer)
+		if err == nil {
+			err = fmt.Errorf("unknown msg type %d", msg.Type)
+		}
+		n.reportPeer(pd.Peer, peer.BadMalformedMsg, err)
 		return
 	}
 
@@ -517,11 +542,34 @@ func (n *net) handleBlocksRespMsg(r *core.BlockRespMsg, peerID crypto.ID) {
 }
 
 func (n *net) handleBlockBroadcastMsg(originData []byte, b *core.BlockBroadcastMsg, peerID crypto.ID) {
-	if n.relayBroadcast(originData) { // 该广播数据第一次收到
-		hash := b.Block.Hash
-		logger.Debug("first time receive block broadcast from %s, hash %X\n", peerID, hash)
-		n.chain.AddBlocks([]*core.Block{b.Block}, false)
+	if !n.markBroadcast(originData) { // 该广播数据已经收到过
+		return
+	}
+
+	hash := b.Block.Hash
+	logger.Debug("first time receive block broadcast from %s, hash %X\n", peerID, hash)
+	// 哈希与区块头不符，与本地视图无关，说明区块被伪造或篡改。
+	// 只有出块者本人广播时才能确定是其作恶，转发者可能只是没有检查，轻微扣分
+	if err := b.Block.VerifyHash(); err != nil {
+		if peerID == b.Block.CreateBy {
+			n.reportPeer(peerID, peer.BadInvalidBlock, err)
+		} else {
+			n.reportPeer(peerID, peer.BadDisputedBlock, err)
+		}
+		return
 	}
+	// 交易检查（含时间戳）或共识规则（例如非PoT竞争胜者构建）不通过的区块不予接收，也不帮忙转发。
+	// 这些检查依赖本地的证明池、链状态和时钟，对方可能只是视图或时序不同，只轻微扣分
+	if err := b.Block.Verify(); err != nil {
+		n.reportPeer(peerID, peer.BadDisputedBlock, err)
+		return
+	}
+	if err := n.chain.VerifyConsensus(b.Block); err != nil {
+		n.reportPeer(peerID, peer.BadDisputedBlock, err)
+		return
+	}
+	n.broadcast(originData) // 帮忙广播
+	n.chain.AddBlocks([]*core.Block{b.Block}, false)
 }
 
 func (n *net) handleTxBroadcastMsg(originData []byte, b *core.TxBroadcastMsg, peerID crypto.ID) {
@@ -532,16 +580,32 @@ func (n *net) handleTxBroadcastMsg(originData []byte, b *core.TxBroadcastMsg, pe
 }
 
 func (n *net) handleProofBroadcastMsg(originData []byte, b *core.ProofBroadcastMsg, peerID crypto.ID) {
-	if n.relayBroadcast(originData) {
-		logger.Debug("first time receive tx broadcast from %s, %v\n", peerID, b)
-		//n.txPool.addTx(b.Txs, true)
-		n.potProofCollect <- b.PoTProof
+	if !n.markBroadcast(originData) {
+		return
+	}
+
+	logger.Debug("first time receive proof broadcast from %s, %v\n", peerID, b)
+	// 伪造或被篡改的证明不予转发，并报告转发者
+	if err := n.proofPool.addProof([]*core.PoTProof{b.PoTProof}, true); err != nil {
+		n.reportPeer(peerID, peer.BadForgedProof, err)
+		return
 	}
+	n.broadcast(originData) // 帮忙广播
 }
 
 // 检查该区块或者交易的广播数据originData是否收到过，收到过返回false
 // 如果以前没收到过，那么帮忙接替广播relayBroadcast
 func (n *net) relayBroadcast(originData []byte) bool {
+	if !n.markBroadcast(originData) {
+		return false
+	}
+
+	n.broadcast(originData) // 帮忙广播
+	return true
+}
+
+// 将广播数据originData记入广播过滤表。收到过返回false
+func (n *net) markBroadcast(originData []byte) bool {
 	h := crypto.HashD(originData)
 	encoded := base64.StdEncoding.EncodeToString(h)
 	if _, ok := n.broadcastFilter[encoded]; ok {
@@ -549,6 +613,13 @@ func (n *net) relayBroadcast(originData []byte) bool {
 	}
 
 	n.broadcastFilter[encoded] = time.Now()
-	n.broadcast(originData) // 帮忙广播
 	return true
 }
+
+// 报告对端节点的违规行为（例如广播非胜者构建的区块），由p2p层扣除其信誉分，信誉分耗尽则封禁
+func (n *net) reportPeer(peerID crypto.ID, badType uint8, reason error) {
+	logger.Warn("peer %s misbehaves: %v\n", peerID, reason)
+	if n.node != nil {
+		n.node.ReportPeer(peerID, badType, reason)
+	}
+}
@@ -7,11 +7,13 @@
 package enode
 
 import (
+	"bytes"
 	"fmt"
+	"github.com/azd1997/ecoin/account"
 	"github.com/azd1997/ecoin/common/crypto"
 	"github.com/azd1997/ecoin/common/encoding"
+	"github.com/azd1997/ecoin/common/params"
 	"github.com/azd1997/ecoin/enode/bc"
-	"github.com/azd1997/ecoin/enode/bc/merkle"
 	"github.com/azd1997/ecoin/protocol/core"
 	"github.com/azd1997/ego/epattern"
 	"time"
@@ -21,6 +23,7 @@ import (
 // scheduler 只对worker节点生效
 // 其从本地区块链以及交易池收集信息，参与竞争并尝试出块
 // 当POT获胜时将区块广播出去
+// 出块周期的调度由potCompetitor负责，由谁出块、如何封装区块由共识引擎cons决定
 type potCompetitor struct {
 
 	HalfEP int64	// 半个出块周期 ns
@@ -30,36 +33,35 @@ type potCompetitor struct {
 	waitBlockTimeout *time.Timer	// 等待新区块的超时定时器
 
 	tbtxp []*core.Tx	// 待出块的交易池
-	selfProof *core.PoTProof
+	base crypto.Hash	// 本轮竞争所基于的父区块。为nil表示本轮没有参与竞争
 
-	proofs map[string]*core.PoTProof	// 证明列表
-	recvProof chan *core.PoTProof	// 从net模块接收网络中得到的证明消息
-	winnerProof *core.PoTProof
-
-	winnerHistory map[string]*core.PoTProof		// 历史证明，键为hex(base)
-	waitingBlockProof *core.PoTProof	// 等待的区块
+	waitingWinner crypto.ID	// 等待其出块的出块者
+	missed []core.Proof	// 胜出却未出块的胜者的证明，由本节点之后构建的区块记录
 
+	cons Consensus	// 共识引擎
 	txPool    *txPool
 	chain   *bc.Chain
 	network *net
+	acc *account.Account	// worker账户，用于签名coinbase
 	workerID crypto.ID
 
 	lm *epattern.LoopMode
 }
 
 
-func newPotCompetitor(p *txPool, c *bc.Chain,
-	n *net, workerID crypto.ID) *potCompetitor {
+func newPotCompetitor(cons Consensus, p *txPool, c *bc.Chain,
+	n *net, acc *account.Account) *potCompetitor {
 	pc := &potCompetitor{
+		HalfEP: int64(bc.BlockInterval / 2),
+		cons: cons,
 		txPool:    p,
 		chain:   c,
 		network: n,
-		workerID: workerID,
+		acc: acc,
+		workerID: acc.UserId(),
 		lm:      epattern.NewLoop(1),
 	}
 
-	pc.recvProof = pc.network.potProofCollect	// 设置接收通道
-
 	return pc
 }
 
@@ -114,29 +116,21 @@ func (pc *potCompetitor) compete() {
 			logger.Debug("terminate competing, start next turn\n")
 			// 归还交易
 			pc.returnTxs()
+			pc.waitingWinner = ""
 			newRound = true		// 接收到新区块则将之置为true
 			// 更新定时器
 			pc.potStart.Reset(time.Unix(0, lastestBlockTime + pc.HalfEP).Sub(time.Now()))
 			pc.potEnd.Stop()
 			pc.waitBlockTimeout.Stop()
 		case <-pc.potStart.C:				// pot竞争开始
+			newRound = false
 			pc.genAndBroadcastPoTProof()
 		case <-pc.potEnd.C:					// pot竞争结束
 			pc.judgeCompetitionAndHandle()
 		case <-pc.waitBlockTimeout.C:
-			if !newRound {	// 在超时时间到时仍未收到新区块（开启下一轮）
-				// 重新开始新round
-				// 惩罚原winner
-				newRound = true
+			if !newRound {	// 在超时时间到时仍未收到新区块
+				// 惩罚原winner，由接替者出块，避免链停滞
 				pc.waitWinnerBlockTimeout()
-
-			}
-		case proof := <- pc.recvProof:		// 接收到新证明
-			pc.proofs[proof.From.ToHex()] = proof
-			if pc.winnerProof == nil {
-				pc.winnerProof = proof
-			} else if proof.GreaterThan(pc.winnerProof) {
-				pc.winnerProof = proof
 			}
 		}
 	}
@@ -162,139 +156,177 @@ func (pc *potCompetitor) getTxs() {
 	//	}
 	//}
 
-	for pc.txPool.txsSize() > 0 {
+	var candidates []*core.Tx
+	for pc.txPool.txsSize() > 0 && len(candidates) < params.MaxTxsPerBlock {
 		tx := pc.txPool.nextTx()
 		if tx == nil {
 			break
 		}
 
-		if err := pc.chain.VerifyTx(tx); err == nil {
-			// exclude the same tx
-			txs[encoding.ToHex(tx.Id)] = tx
+		// exclude the same tx
+		key := encoding.ToHex(tx.Id)
+		if _, ok := txs[key]; ok {
+			continue
 		}
+		txs[key] = tx
+		candidates = append(candidates, tx)
 	}
 
-	var result []*core.Tx
-	for _, tx := range txs {
-		result = append(result, tx)
+	// 按出队顺序（优先级）整体校验，避免同一账户的多笔交易合起来透支
+	pc.tbtxp = pc.chain.FilterTxs(candidates)
+
+	// 被过滤的交易可能只是暂时无效（如依赖的交易尚未上链、与本轮其他交易合起来透支），
+	// 归还交易池，由addTx重新单独校验，彻底无效的交易在那里被丢弃
+	if len(pc.tbtxp) < len(candidates) {
+		picked := make(map[string]bool, len(pc.tbtxp))
+		for _, tx := range pc.tbtxp {
+			picked[encoding.ToHex(tx.Id)] = true
+		}
+		var rejected []*core.Tx
+		for _, tx := range candidates {
+			if !picked[encoding.ToHex(tx.Id)] {
+				rejected = append(rejected, tx)
+			}
+		}
+		pc.txPool.addTx(rejected, true)
 	}
-	pc.tbtxp = result
 }
 
 // 向交易池归还交易（POT竞争失败）
 func (pc *potCompetitor) returnTxs()  {
-	pc.txPool.addTx(pc.tbtxp, false)
+	// 这些交易入池时已经广播过了，不必再广播。已被胜者打包的交易会在校验时被过滤
+	pc.txPool.addTx(pc.tbtxp, true)
 	pc.tbtxp = nil
-	pc.selfProof = nil
+	pc.base = nil
 }
 
 // 传入得交易列表不含coinbase交易
-func (pc *potCompetitor) genBlock() *core.Block {
-	if len(pc.tbtxp) == 0 {
-		return pc.genEmptyBlock()
+func (pc *potCompetitor) genBlock() (*core.Block, error) {
+	height, err := pc.chain.GetHeightViaHash(pc.base)
+	if err != nil {
+		return nil, err
 	}
 
-	// TODO：coinbase也需要增加签名项
-	// 构造coinbase交易
+	// 构造coinbase交易，奖励数额由出块者角色与区块高度决定，并由出块者签名
 	coinbase := core.NewTx(
 		core.TX_COINBASE,
 		crypto.ZeroID,		// ZeroID不能被个人使用，一方面作为判空条件，一方面作为发币来源
 		pc.workerID,
-		100,			// amount之后需要进行定义，暂且写100
-		nil,
+		bc.CoinbaseReward(pc.workerID, height+1),
+		pc.missedWinners(),
 		crypto.ZeroHash,	// 作为哈希的零值
 		0,
 		[]byte(fmt.Sprintf("THIS IS COINBASE FOR [%s]", pc.workerID.ToHex())),
 		)
+	if err := coinbase.Sign(pc.acc.PrivateKey); err != nil {
+		return nil, err
+	}
 	txs := append([]*core.Tx{coinbase}, pc.tbtxp...)
 
-	// 构造区块
-	header := core.NewBlockHeaderV1(pc.chain.LatestBlockHash(), pc.workerID, pc.selfProof.TxsMerkle)
-	block := core.NewBlock(header, txs)
-
-	return block
-}
-
-func (pc *potCompetitor) genEmptyBlock() *core.Block {
-	// TODO：coinbase也需要增加签名项
-	// 构造coinbase交易
-	coinbase := core.NewTx(
-		core.TX_COINBASE,
-		crypto.ZeroID,		// ZeroID不能被个人使用，一方面作为判空条件，一方面作为发币来源
-		pc.workerID,
-		100,			// amount之后需要进行定义，暂且写100
-		nil,
-		crypto.ZeroHash,	// 作为哈希的零值
-		0,
-		[]byte(fmt.Sprintf("THIS IS COINBASE FOR [%s]", pc.workerID.ToHex())),
-	)
-
-	// 构造区块
-	header := core.NewBlockHeaderV1(pc.chain.LatestBlockHash(), pc.workerID, core.EmptyMerkleRoot)
-	block := core.NewBlock(header, []*core.Tx{coinbase})
-
-	return block
+	// 构造区块。区块必须基于本轮竞争的父区块
+	return pc.cons.Seal(pc.base, txs), nil
 }
 
 func (pc *potCompetitor) genAndBroadcastPoTProof() {
+	// 上一轮等待出块时保留的交易先归还
+	if pc.base != nil {
+		pc.returnTxs()
+	}
+	pc.waitingWinner = ""
 	// 1. 收集交易
 	pc.getTxs()
-	// 2. 计算默克尔根
-	var txLeafs merkle.MerkleLeafs
-	for _, tx := range pc.tbtxp {
-		txLeafs = append(txLeafs, tx.Id)
-	}
-	txRoot, _ := merkle.ComputeRoot(txLeafs)
-	// 3. 自己的pot证明
-	pc.selfProof = &core.PoTProof{
-		From:pc.workerID,
-		TxsNum:uint32(len(pc.tbtxp)),
-		TxsMerkle:txRoot,
-		Base:pc.chain.LatestBlockHash(),
+	pc.base = pc.chain.LatestBlockHash()
+	// 2. 生成自己的证明，并通过网络模块发送出去
+	if proof := pc.cons.GenProof(pc.base, pc.tbtxp); proof != nil {
+		pc.network.potProof <- proof
+		logger.Debug("start competing... my proof is: [%s]\n", proof)
 	}
-	// 4. 通过网络模块发送出去
-	pc.network.potProof <- pc.selfProof
 
-	logger.Debug("start competing... my proof is: [%d|%x|%x]\n",
-		pc.selfProof.TxsNum, pc.selfProof.TxsMerkle, pc.selfProof.Base)
+	// 3. 半个周期后判定胜负，一个周期后检查是否收到了新区块
+	pc.potEnd.Reset(time.Duration(pc.HalfEP))
+	pc.waitBlockTimeout.Reset(time.Duration(2 * pc.HalfEP))
 }
 
 func (pc *potCompetitor) judgeCompetitionAndHandle() bool {
-	if pc.selfProof.From == pc.winnerProof.From {
-		logger.Debug("end competing, I win... my proof is: [%d|%x|%x]\n",
-			pc.selfProof.TxsNum, pc.selfProof.TxsMerkle, pc.selfProof.Base)
+	if pc.base == nil {	// 本轮没有参与竞争
+		return false
+	}
+
+	winner := pc.cons.Winner(pc.base)
+	if winner == pc.workerID {
+		logger.Debug("end competing, I win... base is: [%x]\n", pc.base)
 
 		// 自己出块
-		b := pc.genBlock()
+		b, err := pc.genBlock()
+		if err != nil {
+			logger.Warn("generate block failed: %v\n", err)
+			pc.returnTxs()
+			return false
+		}
 		pc.network.potWinnerBlock <- b	// 发给网络模块
 		// 清理掉临时状态
-		pc.winnerHistory[encoding.ToHex(pc.winnerProof.Base)] = pc.winnerProof
-		pc.winnerProof = nil
-		pc.selfProof = nil
-		pc.proofs = make(map[string]*core.PoTProof)
+		pc.tbtxp = nil
+		pc.base = nil
 
 		return true
 	} else {
-		logger.Debug("end competing, I lose... winner proof is: [%d|%x|%x]\n",
-			pc.winnerProof.TxsNum, pc.winnerProof.TxsMerkle, pc.winnerProof.Base)
+		logger.Debug("end competing, I lose... winner is: [%s], base is: [%x]\n", winner, pc.base)
 		// 别人出块，等待这个区块
-		pc.waitingBlockProof = pc.winnerProof
-		pc.winnerHistory[encoding.ToHex(pc.winnerProof.Base)] = pc.winnerProof
-		pc.winnerProof = nil
-		pc.selfProof = nil
-		pc.proofs = make(map[string]*core.PoTProof)
-		// 归还交易
-		pc.returnTxs()
+		// 暂不归还交易：胜者未按时出块时，本节点可能接替出块。收到新区块后再归还
+		pc.waitingWinner = winner
 
 		return false
 	}
 }
 
+// 等待胜者出块超时
+// 惩罚原winner：记下其证明，此后该轮由其余证明中最优者接替出块。
+// 若本节点接替出块，区块在coinbase中记录未出块的胜者，使其被扣除信誉分并在之后若干轮中不能胜出；
+// 否则继续等待接替者出块，接替者同样超时则依次顺延
 func (pc *potCompetitor) waitWinnerBlockTimeout() {
-	// 重新开始新round
+	winner := pc.waitingWinner
+	pc.waitingWinner = ""
+	if winner == "" || winner == pc.workerID || pc.base == nil {
+		return
+	}
+	proof := pc.cons.WinnerProof(pc.base)
+	if proof == nil || proof.Creator() != winner {
+		return
+	}
+	logger.Info("pot winner %s missed block on base %x\n", winner, proof.Parent())
+	pc.cons.Missed(proof)
+	pc.addMissed(proof)
 
+	// 重新判定本轮出块者
+	if !pc.judgeCompetitionAndHandle() && pc.waitingWinner != "" {
+		pc.waitBlockTimeout.Reset(time.Duration(2 * pc.HalfEP))
+	}
+}
 
-	// 惩罚原winner
+func (pc *potCompetitor) addMissed(proof core.Proof) {
+	for _, p := range pc.missed {
+		if p.Creator() == proof.Creator() && bytes.Equal(p.Parent(), proof.Parent()) {
+			return
+		}
+	}
+	pc.missed = append(pc.missed, proof)
+}
+
+// 与本轮父区块相同的未出块胜者证明，编码为coinbase的Payload。没有则返回nil
+// 其他父区块上的记录已经过时，一并清理
+func (pc *potCompetitor) missedWinners() []byte {
+	// 目前只有PoT共识会记录未出块胜者
+	var proofs []*core.PoTProof
+	for _, p := range pc.missed {
+		if potProof, ok := p.(*core.PoTProof); ok && bytes.Equal(p.Parent(), pc.base) {
+			proofs = append(proofs, potProof)
+		}
+	}
+	pc.missed = nil
+	if len(proofs) == 0 {
+		return nil
+	}
+	return (&core.MissedWinners{Proofs: proofs}).Encode()
 }
 
 
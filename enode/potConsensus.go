@@ -0,0 +1,94 @@
+package enode
+
+import (
+	"github.com/azd1997/ecoin/account"
+	"github.com/azd1997/ecoin/common/crypto"
+	"github.com/azd1997/ecoin/common/params"
+	"github.com/azd1997/ecoin/enode/bc"
+	"github.com/azd1997/ecoin/enode/bc/merkle"
+	"github.com/azd1997/ecoin/protocol/core"
+)
+
+// potConsensus PoT共识（交易量证明）
+// 每一轮各worker广播自己打包的交易数与交易默克尔根，证明最大者出块
+// 胜者未按时出块时，由其余证明中最优者接替出块，并在coinbase中记录未出块的胜者，
+// 被记录者在之后bc.MissedRounds个区块的竞争中不能胜出
+type potConsensus struct {
+	acc       *account.Account // worker账户，用于签名证明
+	proofPool *proofPool       // 证明池，记录各轮竞争收到的证明及胜者
+	chain     *bc.Chain        // 查询链上记录的未出块胜者
+}
+
+func newPoTConsensus(acc *account.Account, pp *proofPool, c *bc.Chain) *potConsensus {
+	return &potConsensus{
+		acc:       acc,
+		proofPool: pp,
+		chain:     c,
+	}
+}
+
+func (pot *potConsensus) Name() string {
+	return params.ConsensusPoT
+}
+
+// 证明中的默克尔根不包含coinbase
+func (pot *potConsensus) GenProof(base crypto.Hash, txs []*core.Tx) core.Proof {
+	txRoot := core.EmptyMerkleRoot
+	if len(txs) > 0 {
+		var txLeafs merkle.MerkleLeafs
+		for _, tx := range txs {
+			txLeafs = append(txLeafs, tx.Id)
+		}
+		txRoot, _ = merkle.ComputeRoot(txLeafs)
+	}
+
+	proof := core.NewPoTProof(pot.acc.UserId(), uint32(len(txs)), txRoot, base)
+	if err := proof.Sign(pot.acc.PrivateKey); err != nil {
+		logger.Warn("sign pot proof failed: %v\n", err)
+	}
+	pot.proofPool.insert(proof)
+	return proof
+}
+
+func (pot *potConsensus) Winner(base crypto.Hash) crypto.ID {
+	winnerProof := pot.winnerProof(base)
+	if winnerProof == nil {
+		return ""
+	}
+	return winnerProof.From
+}
+
+// 注意不能直接返回值为nil的*core.PoTProof，否则得到的接口值不为nil
+func (pot *potConsensus) WinnerProof(base crypto.Hash) core.Proof {
+	if winnerProof := pot.winnerProof(base); winnerProof != nil {
+		return winnerProof
+	}
+	return nil
+}
+
+// 链上记录的近期未出块胜者以及本轮本节点观察到的未出块胜者不能胜出
+func (pot *potConsensus) winnerProof(base crypto.Hash) *core.PoTProof {
+	exclude := pot.proofPool.missedOf(base)
+	if pot.chain != nil {
+		exclude = append(exclude, pot.chain.RecentMissed(base)...)
+	}
+	return pot.proofPool.WinnerProof(base, exclude...)
+}
+
+func (pot *potConsensus) Missed(proof core.Proof) {
+	pot.proofPool.markMissed(proof)
+}
+
+func (pot *potConsensus) Seal(base crypto.Hash, txs []*core.Tx) *core.Block {
+	return sealBlock(base, pot.acc.UserId(), txs)
+}
+
+// 区块自身coinbase中记录的未出块胜者同样不能胜出，此时出块者应为接替者
+func (pot *potConsensus) CheckBlock(cb *core.Block, height uint64, missed []crypto.ID) error {
+	for _, tx := range cb.Txs {
+		for _, p := range tx.Missed() {
+			missed = append(missed, p.From)
+		}
+	}
+	return bc.CheckPoT(cb, pot.proofPool.WinnerProof(cb.PrevHash, missed...))
+}
@@ -7,25 +7,37 @@
 package enode
 
 import (
+	"sync"
+
 	"github.com/azd1997/ecoin/common/crypto"
+	"github.com/azd1997/ecoin/common/encoding"
+	"github.com/azd1997/ecoin/enode/bc"
 	"github.com/azd1997/ecoin/protocol/core"
 	"github.com/azd1997/ego/epattern"
-	"sync"
 )
 
+// 证明池最多保留最近proofRounds轮竞争的证明
+const proofRounds = bc.ReferenceBlocks
+
+// proofPool 证明池
+// 每一轮PoT竞争都基于同一个父区块，因此以证明的Base（hex编码）区分不同轮次
 type proofPool struct {
-	CleanC chan bool	// 接收外界的通知，清理表信息
-	proofs map[crypto.ID]*core.PoTProof		// 证明表
-	winner *core.PoTProof	// 胜者的证明
-	lock sync.RWMutex		// 锁
-	broadcast chan<- []*core.PoTProof	// 广播
-	lm *epattern.LoopMode	// 循环模式
+	CleanC    chan bool                               // 接收外界的通知，清理表信息
+	proofs    map[string]map[crypto.ID]*core.PoTProof // 各轮的证明表 <hex(base), <From, proof>>
+	winners   map[string]*core.PoTProof               // 各轮胜者的证明 <hex(base), proof>
+	missed    map[string][]crypto.ID                  // 各轮中本节点观察到胜出却未按时出块的worker <hex(base), []From>
+	rounds    []string                                // 按接收先后记录的各轮base，用于淘汰过旧的轮次
+	lock      sync.RWMutex                            // 锁
+	broadcast chan<- []*core.PoTProof                 // 广播
+	lm        *epattern.LoopMode                      // 循环模式
 }
 
 func NewProofPool() *proofPool {
 	return &proofPool{
-		proofs:make(map[crypto.ID]*core.PoTProof),
-		lm:epattern.NewLoop(1),
+		proofs:  make(map[string]map[crypto.ID]*core.PoTProof),
+		winners: make(map[string]*core.PoTProof),
+		missed:  make(map[string][]crypto.ID),
+		lm:      epattern.NewLoop(1),
 	}
 }
 
@@ -41,7 +53,7 @@ func (pp *proofPool) start() {
 			select {
 			case <-pp.lm.D:
 				return
-			case <- pp.CleanC:
+			case <-pp.CleanC:
 				pp.cleanUp()
 			}
 		}
@@ -50,43 +62,71 @@ func (pp *proofPool) start() {
 	pp.lm.StartWorking()
 }
 
-
-func (pp proofPool) stop() {
+func (pp *proofPool) stop() {
 	pp.lm.Stop()
 }
 
 ////////////////////////////////////////////////
 
-// 以后再考虑记录证明历史的问题
-// 以及证明被篡改的安全性问题
-
-func (pp *proofPool) addProof(proofs []*core.PoTProof, fromBroadcast bool) {
-	// 全部插入表中
+// 添加证明。格式或签名无效的证明会被丢弃，并返回第一个遇到的错误
+func (pp *proofPool) addProof(proofs []*core.PoTProof, fromBroadcast bool) error {
+	var err error
+	var valid []*core.PoTProof
 	for _, proof := range proofs {
-		pp.insert(proof)
+		if e := proof.Verify(); e != nil {
+			if err == nil {
+				err = e
+			}
+			continue
+		}
+		// 已存在的证明无需再次广播
+		if pp.insert(proof) {
+			valid = append(valid, proof)
+		}
 	}
 
 	// 如果不是来自广播，需要广播出去
-	if !fromBroadcast {
-		pp.broadcast <- proofs
+	if !fromBroadcast && pp.broadcast != nil && len(valid) > 0 {
+		pp.broadcast <- valid
 	}
+	return err
 }
 
-func (pp *proofPool) insert(proof *core.PoTProof) {
+// 插入证明，并更新该轮的胜者。证明此前已存在则返回false
+func (pp *proofPool) insert(proof *core.PoTProof) bool {
 	pp.lock.Lock()
 	defer pp.lock.Unlock()
 
-	// 插入表中
-	if _, ok := pp.proofs[proof.From]; !ok {
-		pp.proofs[proof.From] = proof
-	}	// 暂时考虑以最早接收到的那一条证明为准，所以如果已经存在就跳过
-	// 更新winner
-	if pp.winner == nil {	// 还没设置winner则直接设置
-		pp.winner = proof
+	key := encoding.ToHex(proof.Base)
+	round, ok := pp.proofs[key]
+	if !ok {
+		round = make(map[crypto.ID]*core.PoTProof)
+		pp.proofs[key] = round
+		pp.rounds = append(pp.rounds, key)
+		pp.evict()
 	}
-	// 否则需要比较
-	if proof.GreaterThan(pp.winner) {
-		pp.winner = proof
+
+	// 暂时考虑以最早接收到的那一条证明为准，所以如果已经存在就跳过
+	if _, ok := round[proof.From]; ok {
+		return false
+	}
+	round[proof.From] = proof
+
+	// 更新该轮winner
+	if winner := pp.winners[key]; winner == nil || proof.GreaterThan(winner) {
+		pp.winners[key] = proof
+	}
+	return true
+}
+
+// 淘汰过旧的轮次。调用者需持有锁
+func (pp *proofPool) evict() {
+	for len(pp.rounds) > proofRounds {
+		oldest := pp.rounds[0]
+		pp.rounds = pp.rounds[1:]
+		delete(pp.proofs, oldest)
+		delete(pp.winners, oldest)
+		delete(pp.missed, oldest)
 	}
 }
 
@@ -95,16 +135,60 @@ func (pp *proofPool) cleanUp() {
 	pp.lock.Lock()
 	defer pp.lock.Unlock()
 
-	// 清除表
-	pp.proofs = make(map[crypto.ID]*core.PoTProof)
-	// 清除winner
-	pp.winner = nil
+	pp.proofs = make(map[string]map[crypto.ID]*core.PoTProof)
+	pp.winners = make(map[string]*core.PoTProof)
+	pp.missed = make(map[string][]crypto.ID)
+	pp.rounds = nil
+}
+
+// WinnerProof 获取以base为父区块的那一轮竞争的胜者。实现bc.WinnerQuerier
+// exclude中的worker不能胜出，此时胜者为其余证明中最优者
+func (pp *proofPool) WinnerProof(base crypto.Hash, exclude ...crypto.ID) *core.PoTProof {
+	pp.lock.RLock()
+	defer pp.lock.RUnlock()
+
+	key := encoding.ToHex(base)
+	winner := pp.winners[key]
+	if winner == nil || !containsID(exclude, winner.From) {
+		return winner
+	}
+	winner = nil
+	for from, proof := range pp.proofs[key] {
+		if containsID(exclude, from) {
+			continue
+		}
+		if winner == nil || proof.GreaterThan(winner) {
+			winner = proof
+		}
+	}
+	return winner
+}
+
+// 记录胜出却未按时出块的胜者，之后该轮的胜者由其余证明中最优者接替
+func (pp *proofPool) markMissed(proof core.Proof) {
+	pp.lock.Lock()
+	defer pp.lock.Unlock()
+
+	key := encoding.ToHex(proof.Parent())
+	if _, ok := pp.proofs[key]; !ok || containsID(pp.missed[key], proof.Creator()) {
+		return
+	}
+	pp.missed[key] = append(pp.missed[key], proof.Creator())
 }
 
-// 获取胜者
-func (pp *proofPool) winnerProof() *core.PoTProof {
+// 以base为父区块的那一轮中本节点观察到的未出块胜者
+func (pp *proofPool) missedOf(base crypto.Hash) []crypto.ID {
 	pp.lock.RLock()
 	defer pp.lock.RUnlock()
 
-	return pp.winner
+	return append([]crypto.ID(nil), pp.missed[encoding.ToHex(base)]...)
+}
+
+func containsID(ids []crypto.ID, id crypto.ID) bool {
+	for _, v := range ids {
+		if v == id {
+			return true
+		}
+	}
+	return false
 }
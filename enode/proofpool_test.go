@@ -0,0 +1,61 @@
+package enode
+
+import (
+	"testing"
+
+	"github.com/azd1997/ecoin/account/role"
+	"github.com/azd1997/ecoin/common/crypto"
+	"github.com/azd1997/ecoin/protocol/core"
+)
+
+func TestProofPoolMissedWinner(t *testing.T) {
+	newID := func() crypto.ID {
+		priv, _ := crypto.NewPrivateKeyS256()
+		return crypto.PrivateKey2ID(priv, role.HOSPITAL)
+	}
+	base := crypto.HashD([]byte("base"))
+	first, second, third := newID(), newID(), newID()
+
+	pp := NewProofPool()
+	proofs := map[crypto.ID]*core.PoTProof{
+		first:  core.NewPoTProof(first, 10, core.EmptyMerkleRoot, base),
+		second: core.NewPoTProof(second, 7, core.EmptyMerkleRoot, base),
+		third:  core.NewPoTProof(third, 4, core.EmptyMerkleRoot, base),
+	}
+	for _, id := range []crypto.ID{third, first, second} {
+		pp.insert(proofs[id])
+	}
+
+	if winner := pp.WinnerProof(base); winner == nil || winner.From != first {
+		t.Fatalf("expect winner %s, but %v", first, winner)
+	}
+	// 胜者被排除时，由次优者接替；全部被排除时没有胜者
+	if winner := pp.WinnerProof(base, first); winner == nil || winner.From != second {
+		t.Fatalf("expect fallback winner %s, but %v", second, winner)
+	}
+	if winner := pp.WinnerProof(base, first, second); winner == nil || winner.From != third {
+		t.Fatalf("expect fallback winner %s, but %v", third, winner)
+	}
+	if winner := pp.WinnerProof(base, first, second, third); winner != nil {
+		t.Fatalf("expect no winner, but %s", winner.From)
+	}
+
+	// 本地记录的未出块胜者
+	pp.markMissed(proofs[first])
+	pp.markMissed(proofs[first])
+	if missed := pp.missedOf(base); len(missed) != 1 || missed[0] != first {
+		t.Fatalf("expect missed [%s], but %v", first, missed)
+	}
+	pot := newPoTConsensus(nil, pp, nil)
+	if winner := pot.Winner(base); winner != second {
+		t.Fatalf("expect fallback winner %s, but %s", second, winner)
+	}
+	if proof := pot.WinnerProof(crypto.HashD([]byte("other"))); proof != nil {
+		t.Fatalf("expect no winner proof, but %v", proof)
+	}
+
+	pp.cleanUp()
+	if missed := pp.missedOf(base); len(missed) != 0 {
+		t.Fatalf("expect no missed after clean up, but %v", missed)
+	}
+}
@@ -145,7 +145,7 @@ func (qc *qCache) getTx(hexHashes []string) []*view.TxInfo {
 }
 
 // 获取账户信息：账户相关的交易与账户余额
-func (qc *qCache) getAccountInfo(id crypto.ID) ([]crypto.Hash, []crypto.Hash, uint64, int64) {
+func (qc *qCache) getAccountInfo(id crypto.ID) *view.AccountInfo {
 	// 刷新缓存
 	qc.refresh()
 
@@ -153,7 +153,6 @@ func (qc *qCache) getAccountInfo(id crypto.ID) ([]crypto.Hash, []crypto.Hash, ui
 
 	var txsFrom, txsTo []crypto.Hash
 	fromAdded, toAdded := make(map[string]bool), make(map[string]bool)	// 用于去重
-	balance := uint64(0)
 
 	// 缓存中查询
 	if acc, ok := cacheAccounts[id]; ok {
@@ -165,7 +164,6 @@ func (qc *qCache) getAccountInfo(id crypto.ID) ([]crypto.Hash, []crypto.Hash, ui
 		for _, v := range acc.TxsHashTo {
 			toAdded[encoding.ToHex(v)] = true
 		}
-		balance = acc.Balance
 	}
 
 	// 数据库中查找. 同时去除与缓存中重复的数据
@@ -184,12 +182,29 @@ func (qc *qCache) getAccountInfo(id crypto.ID) ([]crypto.Hash, []crypto.Hash, ui
 		}
 	}
 
-	// TODO： Balance的处理逻辑
-	if dbBalance, err := db.GetBalanceViaID(id); err == nil {
-		balance += dbBalance
+	// 余额以最长分支上的账户状态为准（数据库中的余额 + 最长分支未存储区块带来的变动）
+	// 余额为可用余额，冻结在托管池中的款项单独列出
+	balance, err := qc.c.GetBalance(id)
+	if err != nil {
+		logger.Warn("query balance of %s failed: %v\n", id.ToHex(), err)
+	}
+	locked, err := qc.c.GetLocked(id)
+	if err != nil {
+		logger.Warn("query locked balance of %s failed: %v\n", id.ToHex(), err)
+	}
+	credit, err := qc.c.GetCredit(id)
+	if err != nil {
+		logger.Warn("query credit of %s failed: %v\n", id.ToHex(), err)
 	}
 
-	return txsFrom, txsTo, balance, 0	// TODO: 信誉分
+	return &view.AccountInfo{
+		TxsHashFrom: txsFrom,
+		TxsHashTo:   txsTo,
+		Balance:     balance,
+		Locked:      locked,
+		Registered:  qc.c.IsRegistered(id),
+		Credit:      credit,
+	}
 }
 
 // 刷新查询缓存状态
@@ -241,15 +256,6 @@ func (qc *qCache) refresh() {
 				}
 				account.TxsHashFrom = append(account.TxsHashFrom, tx.Id)
 			}
-
-			minerID := blocks[i].CreateBy
-			var miner *view.AccountInfo
-			var ok bool
-			if miner, ok = latestAccounts[minerID]; !ok {
-				miner = &view.AccountInfo{}
-				latestAccounts[minerID] = miner
-			}
-			miner.Balance++
 		}
 
 		qc.sortedBlocks = latestSortedBlocks
@@ -0,0 +1,66 @@
+package enode
+
+import (
+	"fmt"
+
+	"github.com/azd1997/ecoin/common/crypto"
+	"github.com/azd1997/ecoin/common/params"
+	"github.com/azd1997/ecoin/enode/bc"
+	"github.com/azd1997/ecoin/protocol/core"
+)
+
+// rrConsensus 授权节点轮流出块（round-robin）
+// 高度为h的区块由authorities[h % len(authorities)]构建，不需要广播证明
+// 主要作为与PoT对比的基准共识
+type rrConsensus struct {
+	id          crypto.ID
+	authorities []crypto.ID // 授权出块的节点，所有节点须配置相同的列表
+	chain       *bc.Chain
+}
+
+func newRRConsensus(id crypto.ID, authorities []crypto.ID, c *bc.Chain) *rrConsensus {
+	return &rrConsensus{
+		id:          id,
+		authorities: authorities,
+		chain:       c,
+	}
+}
+
+func (rr *rrConsensus) Name() string {
+	return params.ConsensusRoundRobin
+}
+
+func (rr *rrConsensus) GenProof(base crypto.Hash, txs []*core.Tx) core.Proof {
+	return nil
+}
+
+func (rr *rrConsensus) Winner(base crypto.Hash) crypto.ID {
+	height, err := rr.chain.GetHeightViaHash(base)
+	if err != nil {
+		return ""
+	}
+	return rr.leader(height + 1)
+}
+
+func (rr *rrConsensus) WinnerProof(base crypto.Hash) core.Proof {
+	return nil
+}
+
+func (rr *rrConsensus) Seal(base crypto.Hash, txs []*core.Tx) *core.Block {
+	return sealBlock(base, rr.id, txs)
+}
+
+func (rr *rrConsensus) Missed(proof core.Proof) {}
+
+func (rr *rrConsensus) CheckBlock(cb *core.Block, height uint64, missed []crypto.ID) error {
+	if leader := rr.leader(height); cb.CreateBy != leader {
+		return fmt.Errorf("block %X at height %d is created by %s, but leader is %s",
+			cb.Hash, height, cb.CreateBy, leader)
+	}
+	return nil
+}
+
+// 高度为height的区块的出块者
+func (rr *rrConsensus) leader(height uint64) crypto.ID {
+	return rr.authorities[height%uint64(len(rr.authorities))]
+}
@@ -13,12 +13,25 @@ import (
 	"time"
 
 	"github.com/azd1997/ecoin/account"
+	"github.com/azd1997/ecoin/common/crypto"
+	"github.com/azd1997/ecoin/enode/bc"
 	"github.com/azd1997/ecoin/protocol/core"
+	"github.com/azd1997/ecoin/common/encoding"
 	"github.com/azd1997/ego/epattern"
 )
 
 const txsCacheSize  = 1024
 
+// 单个发起方在交易池中最多排队的交易数，避免单个账户塞满交易池
+const maxTxsPerSender = 64
+
+// 来自广播的上传交易在后台抽样检查数据仓库：同时检查的协程数，以及等待检查的队列长度
+// 检查需要访问交易所声称的数据仓库，不能在网络模块的处理循环中同步进行，否则任一节点都能以慢速的数据仓库拖住交易与区块的处理
+const (
+	uploadCheckWorkers = 4
+	uploadCheckQueue   = 64
+)
+
 
 // 带权重的交易
 // 考虑当交易量升到比较大时，如果仍是固定间隔出块
@@ -26,13 +39,20 @@ const txsCacheSize  = 1024
 // 最终会影响POT的策略
 // 考虑交易排队，权重高者优先出块
 // 权重考虑因素目前考虑：
-// TODO: 交易类型 * factor + 交易时间（越早越大）
+// 交易类型 * factor + 交易时间（越早越大）+ 交易费 * feeFactor
 // 假设交易时间单位s，考虑其他类型交易与诊断类交易相比
 // 要落后1分钟，那么交易类型 * 60 +交易时间权重　为总体权重
 // 权重大者先打包
-// TODO: 使用优先队列
 type weightedTx struct {
 	*core.Tx
+	index int	// 在优先队列中的下标，用于从队列中间移除
+}
+
+// 交易在now时刻的权重
+func (wtx *weightedTx) weight(now int64) int64 {
+	return int64(txTypeWeight[wtx.Type]) * weightFactor +
+		(now - wtx.TimeUnix) +
+		int64(wtx.Fee) * feeWeightFactor
 }
 
 type txPool struct {
@@ -40,17 +60,31 @@ type txPool struct {
 	raws      chan *raw.Tx
 	txs *txsPriorityQueue	// UBTXP 相对应的TBTXP是POT竞争时临时出现的
 
+	index map[string]*weightedTx	// 交易ID(hex) -> 队列中的交易，用于去重与移除
+	senders map[crypto.ID]int	// 各发起方在队列中的交易数
+
 	txsLock sync.RWMutex
+	chain *bc.Chain	// 入池前在最长链上校验交易
+	checkUpload func(tx *core.Tx, remote bool) error	// 入池前检查上传交易所声称的数据是否存在于数据仓库。只有worker节点设置
+	uploads chan *core.Tx	// 等待后台检查的来自广播的上传交易
+	checkedUploads map[string]bool	// 已通过检查的上传交易ID(hex)，交易出池后被归还时不必重复检查
+	blocks chan []*core.Block	// 新加入链的区块，其中的交易需要从交易池移除
 	broadcast chan<- []*core.Tx
 	lm *epattern.LoopMode
 }
 
-func newTxPool(acc *account.Account) *txPool {
+func newTxPool(acc *account.Account, chain *bc.Chain) *txPool {
 	tp := &txPool{
 		acc : acc,
 		raws: make(chan *raw.Tx, txsCacheSize),
 		txs:new(txsPriorityQueue),
-		lm:   epattern.NewLoop(1),
+		index: make(map[string]*weightedTx),
+		senders: make(map[crypto.ID]int),
+		uploads: make(chan *core.Tx, uploadCheckQueue),
+		checkedUploads: make(map[string]bool),
+		chain: chain,
+		blocks: make(chan []*core.Block, 16),
+		lm:   epattern.NewLoop(1 + uploadCheckWorkers),
 	}
 	return tp
 }
@@ -70,13 +104,43 @@ func (tp *txPool) start() {
 			case rawTx := <-tp.raws:
 				// TODO: 处理原始交易，调用core.Tx的协议方法，转为core.Tx
 				tp.processRaw(rawTx) // TODO
+			case blocks := <-tp.blocks:
+				// 其他worker打包了的交易不需要再排队
+				tp.removeIncluded(blocks)
 			}
 		}
 	}()
+	for i := 0; i < uploadCheckWorkers; i++ {
+		go tp.uploadCheckLoop()
+	}
 
 	tp.lm.StartWorking()
 }
 
+// 后台检查来自广播的上传交易，通过后入池
+func (tp *txPool) uploadCheckLoop() {
+	tp.lm.Add()
+	defer tp.lm.Done()
+	for {
+		select {
+		case <-tp.lm.D:
+			return
+		case tx := <-tp.uploads:
+			if err := tp.checkUpload(tx, true); err != nil {
+				logger.Debug("upload tx %X is refused by pool: %v\n", tx.Id, err)
+				continue
+			}
+			tp.markUploadChecked(tx)
+			if err := tp.insert(&weightedTx{Tx: tx}); err != nil {
+				if _, dup := err.(ErrTxInPool); !dup {
+					tp.forgetUpload(tx)
+				}
+				logger.Debug("tx %X is refused by pool: %v\n", tx.Id, err)
+			}
+		}
+	}
+}
+
 
 func (tp *txPool) stop() {
 	tp.lm.Stop()
@@ -94,16 +158,47 @@ func (tp *txPool) addRawTx(txs []*raw.Tx) {
 }
 
 
-func (tp *txPool) addTx(txs []*core.Tx, fromBroadcast bool) {
-	// 将txs插入到优先队列中，排队
+// 校验并将txs插入到优先队列中排队，返回第一个被拒绝的交易的原因
+// 只有被接收的交易会被广播
+// 来自广播的上传交易交给后台检查，检查通过后才入池，不在此处等待
+func (tp *txPool) addTx(txs []*core.Tx, fromBroadcast bool) error {
+	var accepted []*core.Tx
+	var firstErr error
 	for _, tx := range txs {
-		tp.insert(&weightedTx{tx})
+		err := tp.chain.VerifyTx(tx)
+		if err == nil && tx.Type == core.TX_UPLOAD && tp.checkUpload != nil && !tp.uploadChecked(tx) {
+			if fromBroadcast {
+				select {
+				case tp.uploads <- tx:
+					continue
+				default:
+					err = ErrUploadCheckBusy{tx.Id}
+				}
+			} else if err = tp.checkUpload(tx, false); err == nil {
+				tp.markUploadChecked(tx)
+			}
+		}
+		if err == nil {
+			err = tp.insert(&weightedTx{Tx: tx})
+		}
+		if err != nil {
+			if _, dup := err.(ErrTxInPool); !dup {
+				tp.forgetUpload(tx)
+			}
+			logger.Debug("tx %X is refused by pool: %v\n", tx.Id, err)
+			if firstErr == nil {
+				firstErr = err
+			}
+			continue
+		}
+		accepted = append(accepted, tx)
 	}
 
 	// 如果不是来自广播的交易，那么需要将其广播出去
-	if !fromBroadcast {
-		tp.broadcast <- txs
+	if !fromBroadcast && len(accepted) > 0 {
+		tp.broadcast <- accepted
 	}
+	return firstErr
 }
 
 
@@ -116,7 +211,9 @@ func (tp *txPool) nextTx() *core.Tx {
 		return nil
 	}
 
-	return tp.txs.pop().Tx
+	wtx := tp.txs.pop()
+	tp.untrack(wtx)
+	return wtx.Tx
 }
 
 func (tp *txPool) txsSize() int {
@@ -135,13 +232,30 @@ func (tp *txPool) processRaw(raw *raw.Tx) {
 
 	// 2. 新建core.Tx
 	tx := core.NewTx(raw.Type, tp.acc.UserId(), raw.To, raw.Amount, raw.Payload, raw.PrevTxId, raw.Uncompleted, raw.Description)
+	if raw.Fee != 0 {
+		tx.SetFee(raw.Fee)
+	}
 	if err := tx.Sign(tp.acc.PrivateKey); err != nil {
 		logger.Warn("sign tx failed:%v\n", err)
 		return
 	}
 
 	// 3.加入本地的交易队列，并且广播出去
-	tp.txs.push(&weightedTx{tx})
+	if err := tp.chain.VerifyTx(tx); err != nil {
+		logger.Warn("verify tx %X failed: %v\n", tx.Id, err)
+		return
+	}
+	if tx.Type == core.TX_UPLOAD && tp.checkUpload != nil {
+		if err := tp.checkUpload(tx, false); err != nil {
+			logger.Warn("check upload tx %X failed: %v\n", tx.Id, err)
+			return
+		}
+		tp.markUploadChecked(tx)
+	}
+	if err := tp.insert(&weightedTx{Tx: tx}); err != nil {
+		logger.Warn("insert tx %X failed: %v\n", tx.Id, err)
+		return
+	}
 	select {
 	case tp.broadcast <- []*core.Tx{tx}: 	// 推到广播队列去
 	default:
@@ -149,14 +263,82 @@ func (tp *txPool) processRaw(raw *raw.Tx) {
 	}
 }
 
-func (tp *txPool) insert(wtx *weightedTx) {
+// 插入交易。重复的交易、超出发起方限额的交易会被拒绝
+// 交易池满时，若新交易的优先级高于队列中最低者，则淘汰最低者，否则拒绝新交易
+func (tp *txPool) insert(wtx *weightedTx) error {
 	tp.txsLock.Lock()
 	defer tp.txsLock.Unlock()
 
+	if _, ok := tp.index[encoding.ToHex(wtx.Id)]; ok {
+		return ErrTxInPool{wtx.Id}
+	}
+	if tp.senders[wtx.From] >= maxTxsPerSender {
+		return ErrSenderTxsLimit{wtx.Id, wtx.From}
+	}
+
 	if tp.txs.len() >= txsCacheSize {
-		return
+		now := time.Now().Unix()
+		lowest := tp.txs.lowest(now)
+		if lowest.weight(now) >= wtx.weight(now) {
+			return ErrTxPoolFull{wtx.Id}
+		}
+		logger.Debug("tx pool is full, evict tx %X\n", lowest.Id)
+		tp.txs.remove(lowest)
+		tp.untrack(lowest)
+		delete(tp.checkedUploads, encoding.ToHex(lowest.Id))
 	}
+
 	tp.txs.push(wtx)
+	tp.index[encoding.ToHex(wtx.Id)] = wtx
+	tp.senders[wtx.From]++
+	return nil
+}
+
+// 移除已被打包进区块的交易
+func (tp *txPool) removeIncluded(blocks []*core.Block) {
+	tp.txsLock.Lock()
+	defer tp.txsLock.Unlock()
+
+	for _, b := range blocks {
+		for _, tx := range b.Txs {
+			delete(tp.checkedUploads, encoding.ToHex(tx.Id))
+			if wtx, ok := tp.index[encoding.ToHex(tx.Id)]; ok {
+				tp.txs.remove(wtx)
+				tp.untrack(wtx)
+			}
+		}
+	}
+}
+
+// 上传交易是否已通过检查
+func (tp *txPool) uploadChecked(tx *core.Tx) bool {
+	tp.txsLock.RLock()
+	defer tp.txsLock.RUnlock()
+
+	return tp.checkedUploads[encoding.ToHex(tx.Id)]
+}
+
+func (tp *txPool) markUploadChecked(tx *core.Tx) {
+	tp.txsLock.Lock()
+	defer tp.txsLock.Unlock()
+
+	tp.checkedUploads[encoding.ToHex(tx.Id)] = true
+}
+
+// 交易被拒绝（如被归还时已经失效）后不再记录
+func (tp *txPool) forgetUpload(tx *core.Tx) {
+	tp.txsLock.Lock()
+	defer tp.txsLock.Unlock()
+
+	delete(tp.checkedUploads, encoding.ToHex(tx.Id))
+}
+
+// 交易出队后清除索引与发起方计数。调用者需持有txsLock
+func (tp *txPool) untrack(wtx *weightedTx) {
+	delete(tp.index, encoding.ToHex(wtx.Id))
+	if tp.senders[wtx.From]--; tp.senders[wtx.From] <= 0 {
+		delete(tp.senders, wtx.From)
+	}
 }
 
 /////////////////////////////////////////////
@@ -166,12 +348,10 @@ func (tp *txPool) insert(wtx *weightedTx) {
 type txsPriorityQueue []*weightedTx
 
 // Less函数。
-// NOTICE: 调整权重设计需要修改此处
-// TODO: 是否引入交易费机制参与排队，这需要在core.Tx增加字段
+// NOTICE: 调整权重设计需要修改此处，见weightedTx.weight
 func (q *txsPriorityQueue) Less(i, j int) bool {
-	weightI := txTypeWeight[(*q)[i].Type] * weightFactor + int(time.Now().Unix() - (*q)[i].TimeUnix)
-	weightJ := txTypeWeight[(*q)[j].Type] * weightFactor + int(time.Now().Unix() - (*q)[j].TimeUnix)
-	return weightI > weightJ
+	now := time.Now().Unix()
+	return (*q)[i].weight(now) > (*q)[j].weight(now)
 }
 
 func (q *txsPriorityQueue) Len() int {
@@ -180,14 +360,18 @@ func (q *txsPriorityQueue) Len() int {
 
 func (q *txsPriorityQueue) Swap(i, j int) {
 	(*q)[i], (*q)[j] = (*q)[j], (*q)[i]
+	(*q)[i].index = i
+	(*q)[j].index = j
 }
 
 func (q *txsPriorityQueue) Push(wtx interface{}) {
+	wtx.(*weightedTx).index = len(*q)
 	*q = append(*q, wtx.(*weightedTx))
 }
 
 func (q *txsPriorityQueue) Pop() (wtx interface{}) {
 	wtx, *q = (*q)[len(*q)-1], (*q)[:len(*q)-1]
+	wtx.(*weightedTx).index = -1
 	return
 }
 
@@ -210,6 +394,22 @@ func (q *txsPriorityQueue) peek() *weightedTx {
 	return (*q)[0]
 }
 
+// 从队列中移除wtx
+func (q *txsPriorityQueue) remove(wtx *weightedTx) {
+	heap.Remove(q, wtx.index)
+}
+
+// 优先级最低的交易。最低者必在叶子节点中，但这里直接遍历
+func (q *txsPriorityQueue) lowest(now int64) *weightedTx {
+	var result *weightedTx
+	for _, wtx := range *q {
+		if result == nil || wtx.weight(now) < result.weight(now) {
+			result = wtx
+		}
+	}
+	return result
+}
+
 // 为了保持这些方法的一致性，尽管有个Len()，还是再搞个len()方法
 // 这样使用该队列只使用小写字母开头的方法
 func (q *txsPriorityQueue) len() int {
@@ -239,4 +439,8 @@ var txTypeWeight = map[uint8]int{
 	core.TX_REGRESP:0,		// 注册账号用 register response
 }
 
-const weightFactor = 120	// 120相当于2min
\ No newline at end of file
+const weightFactor = 120	// 120相当于2min
+
+// 每1个币的交易费相当于提前10s
+// 诊断类交易相当于带了12个币的交易费，因此少量的交易费不会使普通交易排到诊断类交易之前
+const feeWeightFactor = 10
\ No newline at end of file
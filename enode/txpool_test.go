@@ -0,0 +1,112 @@
+package enode
+
+import (
+	"testing"
+	"time"
+
+	"github.com/azd1997/ecoin/account/role"
+	"github.com/azd1997/ecoin/common/crypto"
+	"github.com/azd1997/ecoin/protocol/core"
+)
+
+func TestTxsPriorityQueue(t *testing.T) {
+	priv, _ := crypto.NewPrivateKeyS256()
+	patient := crypto.PrivateKey2ID(priv, role.PATIENT)
+	priv, _ = crypto.NewPrivateKeyS256()
+	hospital := crypto.PrivateKey2ID(priv, role.HOSPITAL)
+
+	general := core.NewTx(core.TX_GENERAL, patient, hospital, 1, nil, nil, 0, nil)
+	withFee := core.NewTx(core.TX_GENERAL, patient, hospital, 1, nil, nil, 0, nil)
+	withFee.SetFee(5)
+	older := core.NewTx(core.TX_GENERAL, patient, hospital, 1, nil, nil, 0, nil)
+	older.TimeUnix -= 30
+	diagnosis := core.NewTx(core.TX_P2H, patient, hospital, 1, nil, nil, 0, nil)
+
+	q := new(txsPriorityQueue)
+	for _, tx := range []*core.Tx{general, older, withFee, diagnosis} {
+		q.push(&weightedTx{Tx: tx})
+	}
+
+	// 诊断类交易 > 带交易费的交易(50s) > 较早的交易(30s) > 普通交易
+	expect := []*core.Tx{diagnosis, withFee, older, general}
+	for i, tx := range expect {
+		if got := q.pop().Tx; got != tx {
+			t.Fatalf("[%d] expect tx %X, but %X", i, tx.Id, got.Id)
+		}
+	}
+}
+
+func TestTxPoolInsert(t *testing.T) {
+	newID := func(roleNo uint8) crypto.ID {
+		priv, _ := crypto.NewPrivateKeyS256()
+		return crypto.PrivateKey2ID(priv, roleNo)
+	}
+	hospital := newID(role.HOSPITAL)
+	tp := newTxPool(nil, nil)
+
+	// 同一发起方最多maxTxsPerSender笔
+	patient := newID(role.PATIENT)
+	for i := 0; i < maxTxsPerSender; i++ {
+		tx := core.NewTx(core.TX_GENERAL, patient, hospital, uint32(i+1), nil, nil, 0, nil)
+		if err := tp.insert(&weightedTx{Tx: tx}); err != nil {
+			t.Fatalf("insert tx %d: %v", i, err)
+		}
+	}
+	dup := (*tp.txs)[0].Tx
+	if err := tp.insert(&weightedTx{Tx: dup}); err == nil {
+		t.Fatal("duplicated tx should be refused")
+	} else if _, ok := err.(ErrTxInPool); !ok {
+		t.Fatalf("expect ErrTxInPool, but %v", err)
+	}
+	over := core.NewTx(core.TX_GENERAL, patient, hospital, 1000, nil, nil, 0, nil)
+	if _, ok := tp.insert(&weightedTx{Tx: over}).(ErrSenderTxsLimit); !ok {
+		t.Fatal("expect ErrSenderTxsLimit")
+	}
+
+	// 填满交易池
+	for tp.txsSize() < txsCacheSize {
+		sender := newID(role.PATIENT)
+		for i := 0; i < maxTxsPerSender && tp.txsSize() < txsCacheSize; i++ {
+			tx := core.NewTx(core.TX_GENERAL, sender, hospital, uint32(i+1), nil, nil, 0, nil)
+			if err := tp.insert(&weightedTx{Tx: tx}); err != nil {
+				t.Fatalf("insert tx: %v", err)
+			}
+		}
+	}
+
+	// 交易池满时，优先级不高于最低者的交易被拒绝，更高者淘汰最低者
+	sender := newID(role.PATIENT)
+	low := core.NewTx(core.TX_GENERAL, sender, hospital, 1, nil, nil, 0, nil)
+	low.TimeUnix += 60
+	if _, ok := tp.insert(&weightedTx{Tx: low}).(ErrTxPoolFull); !ok {
+		t.Fatal("expect ErrTxPoolFull")
+	}
+	high := core.NewTx(core.TX_P2H, sender, hospital, 1, nil, nil, 0, nil)
+	if err := tp.insert(&weightedTx{Tx: high}); err != nil {
+		t.Fatalf("insert high priority tx: %v", err)
+	}
+	if tp.txsSize() != txsCacheSize || len(tp.index) != txsCacheSize {
+		t.Fatalf("expect %d txs, but %d(index %d)", txsCacheSize, tp.txsSize(), len(tp.index))
+	}
+
+	// 移除已打包的交易
+	included := (*tp.txs)[1].Tx
+	tp.removeIncluded([]*core.Block{{Txs: []*core.Tx{high, included}}})
+	if tp.txsSize() != txsCacheSize-2 || len(tp.index) != txsCacheSize-2 {
+		t.Fatalf("expect %d txs after removal, but %d", txsCacheSize-2, tp.txsSize())
+	}
+	if _, ok := tp.senders[sender]; ok {
+		t.Fatalf("sender count should be removed, but %d", tp.senders[sender])
+	}
+	// 出队顺序仍按优先级
+	prev := tp.nextTx()
+	for tx := tp.nextTx(); tx != nil; tx = tp.nextTx() {
+		if (&weightedTx{Tx: tx}).weight(time.Now().Unix()) > (&weightedTx{Tx: prev}).weight(time.Now().Unix()) {
+			t.Fatal("txs are not popped in priority order")
+		}
+		prev = tx
+	}
+	if len(tp.index) != 0 || len(tp.senders) != 0 {
+		t.Fatal("index should be empty after draining the pool")
+	}
+}
@@ -3,58 +3,207 @@ package p2p
 import (
 	"crypto/aes"
 	"crypto/cipher"
-	"crypto/sha512"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"math"
+	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/azd1997/ecoin/common/crypto"
+	"github.com/azd1997/ecoin/protocol/handshake"
 )
 
 // codec 用来加解密会话消息
 type codec interface {
 	encrypt(plainText []byte) ([]byte, error)
 	decrypt(cipherText []byte) ([]byte, error)
+	// 是否为握手的发起方。只有发起方主动轮换会话密钥，见rekey.go
+	isInitiator() bool
+	// 当前会话密钥已加解密的字节数及其使用时长
+	usage() (uint64, time.Duration)
+	// 由新的共享秘密派生发送/接收方向的密钥，帧计数从0重新开始
+	rekeySend(shared []byte) error
+	rekeyRecv(shared []byte) error
+}
+
+/*
+会话加密方案 handshake.CipherAESGCMV2:
+	1. 由双方临时会话密钥得到共享秘密P
+	2. 两个方向各自使用独立的密钥： HMAC-SHA256(P, 方向标签)，发起握手的一方用initiatorLabel的密钥发送，另一方用其接收
+	3. 每个方向维护从0开始递增的帧计数seq，帧格式为 seq(8B, 大端) | AES-GCM-256(nonce = 0x00000000 | seq, aad = seq)
+	4. 接收方只接受 seq 等于期望值的帧，重放（seq偏小）、乱序或丢帧（seq偏大）都被拒绝
+TCP保证了同一连接上帧的顺序，因此任何不连续的seq都意味着帧被篡改或重放
+长期存在的连接会定期以新的临时密钥重新协商P并替换两个方向的密钥（见rekey.go），seq随之归零
+*/
+
+const (
+	seqSize = 8
+	// 会话帧相对明文的额外长度： seq头部 + GCM认证标签(16B)
+	frameOverhead = seqSize + 16
+
+	initiatorLabel = "ecoin p2p aesgcm v2 initiator"
+	responderLabel = "ecoin p2p aesgcm v2 responder"
+)
+
+// ErrCodecExhausted 帧计数用尽，会话必须重建
+var ErrCodecExhausted = errors.New("session frame counter exhausted")
+
+// ErrCodecShortFrame 帧长度不足
+var ErrCodecShortFrame = errors.New("session frame too short")
+
+// ErrCodecBadSequence 帧计数与期望不符：重放或乱序
+type ErrCodecBadSequence struct {
+	expected uint64
+	got      uint64
+}
+
+func (e ErrCodecBadSequence) Error() string {
+	if e.got < e.expected {
+		return "replayed session frame"
+	}
+	return "out of order session frame"
 }
 
 // 实现 codec 接口
 type aesgcmCodec struct {
-	aead  cipher.AEAD	// AEAD是一种加密模式
-	nonce []byte
+	initiator bool
+	usedBytes uint64    // 当前密钥已加解密的字节数，原子操作
+	keyTime   time.Time // 发送密钥的启用时间，由sendLock保护
+
+	sendLock sync.Mutex
+	sendAEAD cipher.AEAD // AEAD是一种加密模式
+	sendSeq  uint64      // 下一个发送帧的计数
+
+	recvLock sync.Mutex
+	recvAEAD cipher.AEAD
+	recvSeq  uint64 // 期望接收的下一帧的计数
+}
+
+func (c *aesgcmCodec) encrypt(plainText []byte) ([]byte, error) {
+	c.sendLock.Lock()
+	defer c.sendLock.Unlock()
+
+	if c.sendSeq == math.MaxUint64 {
+		return nil, ErrCodecExhausted
+	}
+	header := make([]byte, seqSize)
+	binary.BigEndian.PutUint64(header, c.sendSeq)
+	frame := c.sendAEAD.Seal(header, seqNonce(header), plainText, header)
+	c.sendSeq++
+	atomic.AddUint64(&c.usedBytes, uint64(len(plainText)))
+	return frame, nil
 }
 
-func (aes *aesgcmCodec) encrypt(plainText []byte) ([]byte, error) {
-	cipherText := aes.aead.Seal(nil, aes.nonce, plainText, nil)
-	return cipherText, nil
+func (c *aesgcmCodec) decrypt(cipherText []byte) ([]byte, error) {
+	c.recvLock.Lock()
+	defer c.recvLock.Unlock()
+
+	if len(cipherText) < seqSize {
+		return nil, ErrCodecShortFrame
+	}
+	header := cipherText[:seqSize]
+	if seq := binary.BigEndian.Uint64(header); seq != c.recvSeq {
+		return nil, ErrCodecBadSequence{expected: c.recvSeq, got: seq}
+	}
+	plainText, err := c.recvAEAD.Open(nil, seqNonce(header), cipherText[seqSize:], header)
+	if err != nil {
+		return nil, err
+	}
+	c.recvSeq++
+	atomic.AddUint64(&c.usedBytes, uint64(len(plainText)))
+	return plainText, nil
 }
 
-func (aes *aesgcmCodec) decrypt(cipherText []byte) ([]byte, error) {
-	plainText, err := aes.aead.Open(nil, aes.nonce, cipherText, nil)
-	return plainText, err
+func (c *aesgcmCodec) isInitiator() bool {
+	return c.initiator
 }
 
-// remotePubKey 对方的临时会话公钥； randPrivKey 自己生成的随机私钥
-func newAESGCMCodec(remotePubKey *crypto.PublicKey, randPrivKey *crypto.PrivateKey) (*aesgcmCodec, error) {
+func (c *aesgcmCodec) usage() (uint64, time.Duration) {
+	c.sendLock.Lock()
+	defer c.sendLock.Unlock()
 
-	sharedKey := sha512.Sum512(crypto.GenerateSharedSecret(randPrivKey, remotePubKey))
+	return atomic.LoadUint64(&c.usedBytes), time.Since(c.keyTime)
+}
 
-	block, err := aes.NewCipher(sharedKey[:32])		// 取前32位作对称密钥
+// 发送方向换钥时重新开始统计用量
+func (c *aesgcmCodec) rekeySend(shared []byte) error {
+	aead, err := newSessionAEAD(shared, directionLabel(c.initiator))
+	if err != nil {
+		return err
+	}
+
+	c.sendLock.Lock()
+	defer c.sendLock.Unlock()
+
+	c.sendAEAD, c.sendSeq, c.keyTime = aead, 0, time.Now()
+	atomic.StoreUint64(&c.usedBytes, 0)
+	return nil
+}
+
+func (c *aesgcmCodec) rekeyRecv(shared []byte) error {
+	aead, err := newSessionAEAD(shared, directionLabel(!c.initiator))
+	if err != nil {
+		return err
+	}
+
+	c.recvLock.Lock()
+	defer c.recvLock.Unlock()
+
+	c.recvAEAD, c.recvSeq = aead, 0
+	return nil
+}
+
+// 某一方向的密钥标签：由握手发起方发出的方向使用initiatorLabel
+func directionLabel(fromInitiator bool) string {
+	if fromInitiator {
+		return initiatorLabel
+	}
+	return responderLabel
+}
+
+// 帧计数对应的Nonce：4字节0 | 8字节计数
+func seqNonce(header []byte) []byte {
+	nonce := make([]byte, 4, 4+seqSize)
+	return append(nonce, header...)
+}
+
+// remotePubKey 对方的临时会话公钥； randPrivKey 自己生成的随机私钥； initiator 自己是否为握手的发起方
+func newAESGCMCodec(remotePubKey *crypto.PublicKey, randPrivKey *crypto.PrivateKey, initiator bool) (*aesgcmCodec, error) {
+	shared := crypto.GenerateSharedSecret(randPrivKey, remotePubKey)
+
+	initiatorAEAD, err := newSessionAEAD(shared, initiatorLabel)
 	if err != nil {
 		return nil, err
 	}
-	aesgcm, err := cipher.NewGCM(block)
+	responderAEAD, err := newSessionAEAD(shared, responderLabel)
 	if err != nil {
 		return nil, err
 	}
 
-	return &aesgcmCodec{
-		aead:  aesgcm,
-		nonce: sharedKey[32 : 32+12],	// 取后12位作随机数Nonce
-	}, nil
+	c := &aesgcmCodec{initiator: initiator, keyTime: time.Now()}
+	if initiator {
+		c.sendAEAD, c.recvAEAD = initiatorAEAD, responderAEAD
+	} else {
+		c.sendAEAD, c.recvAEAD = responderAEAD, initiatorAEAD
+	}
+	return c, nil
 }
 
-// 对两个字节数组作异或
-func xor(one, other []byte) (xor []byte) {
-	xor = make([]byte, len(one))
-	for i := 0; i < len(one); i++ {
-		xor[i] = one[i] ^ other[i]
+// 由共享秘密派生某个方向的AES-256-GCM
+func newSessionAEAD(shared []byte, label string) (cipher.AEAD, error) {
+	mac := hmac.New(sha256.New, shared)
+	mac.Write([]byte(label))
+	block, err := aes.NewCipher(mac.Sum(nil))
+	if err != nil {
+		return nil, err
 	}
-	return xor
+	return cipher.NewGCM(block)
+}
+
+// 是否支持对方提出的会话加密方案
+func supportedCipher(c uint8) bool {
+	return c == handshake.CipherAESGCMV2
 }
@@ -0,0 +1,71 @@
+package p2p
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/azd1997/ecoin/common/crypto"
+)
+
+func TestAESGCMCodec(t *testing.T) {
+	initiatorKey, _ := crypto.NewPrivateKeyS256()
+	responderKey, _ := crypto.NewPrivateKeyS256()
+	initiator, err := newAESGCMCodec(responderKey.PubKey(), initiatorKey, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	responder, err := newAESGCMCodec(initiatorKey.PubKey(), responderKey, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 相同的明文每帧密文不同；两个方向使用不同的密钥
+	msg := []byte("patient payload")
+	frame1, _ := initiator.encrypt(msg)
+	frame2, _ := initiator.encrypt(msg)
+	if bytes.Equal(frame1[seqSize:], frame2[seqSize:]) {
+		t.Fatal("frames of the same message should differ")
+	}
+	back, _ := responder.encrypt(msg)
+	if _, err := responder.decrypt(back); err == nil {
+		t.Fatal("frame should not be decrypted with the send key of the same direction")
+	}
+
+	// 按顺序接收
+	for i, frame := range [][]byte{frame1, frame2} {
+		plain, err := responder.decrypt(frame)
+		if err != nil || !bytes.Equal(plain, msg) {
+			t.Fatalf("decrypt frame %d failed: %v", i, err)
+		}
+	}
+	if plain, err := initiator.decrypt(back); err != nil || !bytes.Equal(plain, msg) {
+		t.Fatalf("decrypt reverse frame failed: %v", err)
+	}
+
+	// 重放
+	if _, err := responder.decrypt(frame1); err == nil {
+		t.Fatal("replayed frame should be rejected")
+	} else if e, ok := err.(ErrCodecBadSequence); !ok || e.got != 0 || e.expected != 2 {
+		t.Fatalf("expect replay error, but %v", err)
+	}
+
+	// 乱序（丢帧）
+	frame3, _ := initiator.encrypt(msg)
+	frame4, _ := initiator.encrypt(msg)
+	if _, err := responder.decrypt(frame4); err == nil {
+		t.Fatal("out of order frame should be rejected")
+	}
+
+	// 篡改计数或密文；失败的帧不影响后续正常的帧
+	tampered := append([]byte{}, frame3...)
+	tampered[len(tampered)-1] ^= 1
+	if _, err := responder.decrypt(tampered); err == nil {
+		t.Fatal("tampered frame should be rejected")
+	}
+	if _, err := responder.decrypt(frame3[:seqSize-1]); err != ErrCodecShortFrame {
+		t.Fatalf("expect short frame error, but %v", err)
+	}
+	if plain, err := responder.decrypt(frame3); err != nil || !bytes.Equal(plain, msg) {
+		t.Fatalf("decrypt frame 3 failed: %v", err)
+	}
+}
@@ -1,15 +1,20 @@
 package p2p
 
 import (
+	"sync"
+	"time"
+
 	"github.com/azd1997/ego/epattern"
 
+	"github.com/azd1997/ecoin/common/crypto"
 	"github.com/azd1997/ecoin/p2p/peer"
+	"github.com/azd1997/ecoin/protocol/handshake"
 )
 
-type recvHandler = func(peer peer.ID, protocolID uint8, data []byte)
+type recvHandler = func(p *peer.Peer, protocolID uint8, data []byte)
 
 // conn 代表了本机节点node与对方节点peer之间通信的链接，包括通信双方（node, p），TCP链接conn，会话加解密模块ec
-// 接收事务处理器（决定接收到某种消息时执行什么任务）handler， lm循环工作模式
+// 接收事务处理器（决定接收到某种消息时执行什么任务）handler， lm循环工作模式， rekey会话密钥轮换策略
 type conn struct {
 	node    *Node
 	p       *peer.Peer
@@ -17,15 +22,30 @@ type conn struct {
 	ec      codec
 	handler recvHandler
 	lm      *epattern.LoopMode
+	// 是否为对方发起的（入站）链接
+	inbound bool
+	// 加密与发送须在同一把锁下进行，保证帧按计数顺序发出
+	sendLock sync.Mutex
+
+	// 换钥状态，只在工作循环中访问，见rekey.go
+	rekey       rekeyPolicy
+	rekeyPriv   *crypto.PrivateKey // 发起方：等待REKEY_ACK时的新临时私钥
+	rekeyAt     time.Time          // 发起方：发出REKEY_INIT的时间
+	rekeyShared []byte             // 接受方：已改用新密钥发送，等待REKEY_DONE后改用新密钥接收
+
+	// 链接出错时的回调，由链接管理器设置
+	onError  func(err error)
+	failOnce sync.Once
 }
 
-func newConn(p *peer.Peer, nc TCPConn, ec codec, handler recvHandler) *conn {
+func newConn(p *peer.Peer, nc TCPConn, ec codec, handler recvHandler, rekey rekeyPolicy) *conn {
 	c := &conn{
 		p:       p,
 		conn:    nc,
 		ec:      ec,
 		handler: handler,
 		lm:      epattern.NewLoop(1),	// 每一个链接只会起一个go程用于循环处理事务
+		rekey:   rekey,
 	}
 
 	return c
@@ -44,50 +64,108 @@ func (c *conn) stop() {
 	}
 }
 
-// 工作循环。 接收数据包并相应处理
+// 链接出错。交由链接管理器记录并移除该链接，未设置回调时直接关闭链接。只处理第一次出错
+func (c *conn) fail(err error) {
+	c.failOnce.Do(func() {
+		if c.onError != nil {
+			c.onError(err)
+			return
+		}
+		logger.Warn("connection to %v failed: %v, close connection\n", c.p.ID, err)
+		go c.stop()
+	})
+}
+
+// 工作循环。 接收数据包并相应处理，并定期检查是否需要换钥
 func (c *conn) loop() {
 	c.lm.Add()	// 添加当前goroutine，等待结束
 	defer c.lm.Done()
 
+	ticker := time.NewTicker(c.rekey.check)
+	defer ticker.Stop()
+
 	// TCP链接 数据packet接收通道
 	recvC := c.conn.GetRecvChannel()
 	for {
 		select {
 		case <-c.lm.D:
 			return
-		case pkt := <-recvC:
-			var ok bool
-			var payload []byte
-			var protocolID uint8
-			// 验证packet是否合法、完整
-			if ok, payload, protocolID = verifyTCPPacket(pkt); !ok {
-				logger.Warnln("verify packet failed, close connection")
-				go c.stop()
-				break
+		case <-ticker.C:
+			if err := c.checkRekey(); err != nil {
+				c.fail(err)
+				return
 			}
-			// 将payload解密成明文
-			plaintext, err := c.ec.decrypt(payload)
-			if err != nil {
-				logger.Warnln("decrypt packet failed, close connection")
-				go c.stop()
-				break
+		case pkt := <-recvC:
+			if err := c.recvPacket(pkt); err != nil {
+				c.fail(err)
+				return
 			}
-			// 处理当前payload
-			c.handler(c.p.ID, protocolID, plaintext)
 		}
 	}
 }
 
-// 发送数据。 参数data即为payload明文
-func (c *conn) send(protocolID uint8, data []byte) {
+// 处理接收到的一个数据包
+func (c *conn) recvPacket(pkt []byte) error {
+	// 验证packet是否合法、完整
+	ok, payload, protocolID := verifyTCPPacket(pkt)
+	if !ok {
+		return ErrConnBrokenPacket
+	}
+	// 将payload解密成明文
+	plaintext, err := c.ec.decrypt(payload)
+	if err != nil {
+		return err
+	}
+	// 超过协商的最大消息长度，对方违反了握手时的约定。 换钥消息同样受此限制
+	if max := c.maxMsgSize(); uint32(len(plaintext)) > max {
+		return ErrMsgTooLarge{size: len(plaintext), max: max}
+	}
+	// 会话中的握手协议消息只用于换钥
+	if protocolID == handshakeProtocolID {
+		return c.handleRekey(plaintext)
+	}
+	// 处理当前payload
+	c.handler(c.p, protocolID, plaintext)
+	return nil
+}
+
+// 发送数据。 参数data即为payload明文，超过协商的最大消息长度时不发送
+// 加密失败时链接随即出错关闭，错误同时返回给调用方
+func (c *conn) send(protocolID uint8, data []byte) error {
+	if max := c.maxMsgSize(); uint32(len(data)) > max {
+		return ErrMsgTooLarge{size: len(data), max: max}
+	}
+	if err := c.sendAndRekey(protocolID, data, nil); err != nil {
+		c.fail(err)
+		return err
+	}
+	return nil
+}
+
+// 与对方协商的最大消息长度，未协商时取默认值
+func (c *conn) maxMsgSize() uint32 {
+	if c.p.Caps == nil || c.p.Caps.MaxMsgSize == 0 {
+		return handshake.DefaultMaxMsgSize
+	}
+	return c.p.Caps.MaxMsgSize
+}
+
+// 加密并发送。shared不为空时，在同一把锁下随即改用由其派生的新密钥发送，此后的帧都使用新密钥
+func (c *conn) sendAndRekey(protocolID uint8, data, shared []byte) error {
+	c.sendLock.Lock()
+	defer c.sendLock.Unlock()
+
 	// 加密
 	cipherText, err := c.ec.encrypt(data)
 	if err != nil {
-		logger.Warn("encrypt payload failed, close connection")
-		go c.stop()
-		return
+		return err
 	}
 	// 构建TCP packet
 	pkt := buildTCPPacket(cipherText, protocolID)
 	c.conn.Send(pkt)
+
+	if shared != nil {
+		return c.ec.rekeySend(shared)
+	}
+	return nil
 }
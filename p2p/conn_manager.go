@@ -25,29 +25,50 @@ type connManager interface {
 	isExist(peerID peer.ID) bool
 	// 向某个对端节点发送某种协议的数据。 对端节点和数据封装在PeerData。 Protocol代表了通信的协议：handshake/discover/storage/core
 	send(p Protocol, pd *PeerData) error
-	// 添加一个新链接。 传入的是创建新链接所需的参数
-	add(peer *peer.Peer, conn TCPConn, ec codec, handler recvHandler) error
+	// 添加一个新链接。 传入的是创建新链接所需的参数，inbound表示是否为对方发起的链接。 须符合链接策略ConnPolicy
+	add(peer *peer.Peer, conn TCPConn, ec codec, handler recvHandler, inbound bool) error
+	// 握手前检查是否还能接受来自ip的入站链接
+	acceptable(ip net.IP) bool
+	// 还可以发起的出站链接数
+	outboundSlots() int
+	// 断开并移除与某个对端节点的链接
+	disconnect(peerID peer.ID)
 	// 用于打印一些信息
 	String() string
 }
 
-func newConnManager(maxPeerNum int) connManager {
+func newConnManager(maxPeerNum int, policy ConnPolicy, rekey rekeyPolicy) connManager {
 	return &connManagerImp{
 		conns:      make(map[peer.ID]*conn),
 		maxPeerNum: maxPeerNum,
+		policy:     newConnPolicy(maxPeerNum, policy),
+		rekey:      rekey,
 		removing:   make(chan peer.ID, maxPeerNum),
+		failing:    make(chan *connError, maxPeerNum),
 		lm:         epattern.NewLoop(1),
 	}
 }
 
+// 链接出错（换钥失败、数据包异常等）
+type connError struct {
+	conn *conn
+	err  error
+}
+
 type connManagerImp struct {
 	sync.RWMutex
 	// 链接表 <peer ID, conn>
 	conns      map[peer.ID]*conn
 	// 最大链接节点数量
 	maxPeerNum int
+	// 链接准入策略
+	policy     *connPolicy
+	// 新链接的会话密钥轮换策略
+	rekey      rekeyPolicy
 	// 移除链接的有缓冲通道，缓冲容量为maxPeerNum
 	removing   chan peer.ID
+	// 出错链接的有缓冲通道，缓冲容量为maxPeerNum
+	failing    chan *connError
 	// 循环模式
 	lm         *epattern.LoopMode
 }
@@ -104,8 +125,10 @@ func (c *connManagerImp) send(p Protocol, data *PeerData) error {
 	// broadcast 广播
 	if data.Peer == crypto.ZeroID {
 		c.Lock()
-		for _, conn := range c.conns {
-			conn.send(p.ID(), data.Data)
+		for id, conn := range c.conns {
+			if err := conn.send(p.ID(), data.Data); err != nil {
+				logger.Warn("broadcast protocol %s to %v failed: %v\n", p.Name(), id, err)
+			}
 		}
 		c.Unlock()
 		return nil
@@ -118,12 +141,24 @@ func (c *connManagerImp) send(p Protocol, data *PeerData) error {
 	if !ok {
 		return ErrPeerNotFound{Peer: data.Peer}
 	}
-	conn.send(p.ID(), data.Data)
+	return conn.send(p.ID(), data.Data)
+}
 
-	return nil
+func (c *connManagerImp) acceptable(ip net.IP) bool {
+	c.RLock()
+	defer c.RUnlock()
+
+	return c.policy.acceptable(c.conns, ip)
 }
 
-func (c *connManagerImp) add(peer *peer.Peer, conn TCPConn, ec codec, handler recvHandler) error {
+func (c *connManagerImp) outboundSlots() int {
+	c.RLock()
+	defer c.RUnlock()
+
+	return c.policy.outboundSlots(c.conns)
+}
+
+func (c *connManagerImp) add(peer *peer.Peer, conn TCPConn, ec codec, handler recvHandler, inbound bool) error {
 	c.Lock()
 	defer c.Unlock()
 
@@ -135,8 +170,18 @@ func (c *connManagerImp) add(peer *peer.Peer, conn TCPConn, ec codec, handler re
 		return fmt.Errorf("over max peer(%d) limits", len(c.conns))
 	}
 
-	connection := newConn(peer, conn, ec, handler)
+	// 入站/出站数量、保留位置、同一IP/子网的限制
+	if err := c.policy.admit(c.conns, peer, inbound); err != nil {
+		return err
+	}
+
+	connection := newConn(peer, conn, ec, handler, c.rekey)
+	connection.inbound = inbound
 	c.conns[peer.ID] = connection
+	// 链接出错时交由链接管理器关闭并移除
+	connection.onError = func(err error) {
+		c.failConn(connection, err)
+	}
 	// 设置链接断开时的回调函数：打印信息，并从链接管理器移除该链接
 	conn.SetDisconnectCb(func(addr net.Addr) {
 		logger.Info("disconnect peer %v, address %v\n", peer.ID, addr)
@@ -148,6 +193,17 @@ func (c *connManagerImp) add(peer *peer.Peer, conn TCPConn, ec codec, handler re
 	return nil
 }
 
+func (c *connManagerImp) disconnect(peerID peer.ID) {
+	c.Lock()
+	conn, ok := c.conns[peerID]
+	delete(c.conns, peerID)
+	c.Unlock()
+
+	if ok {
+		go conn.stop()
+	}
+}
+
 func (c *connManagerImp) String() string {
 	c.RLock()
 	defer c.RUnlock()
@@ -171,10 +227,28 @@ func (c *connManagerImp) loop() {
 			c.Lock()
 			delete(c.conns, rmID)
 			c.Unlock()
+		case ce := <-c.failing:	// 关闭并移除出错的链接
+			logger.Warn("connection to %v failed: %v, close connection\n", ce.conn.p.ID, ce.err)
+			c.Lock()
+			if c.conns[ce.conn.p.ID] == ce.conn {
+				delete(c.conns, ce.conn.p.ID)
+			}
+			c.Unlock()
+			go ce.conn.stop()
 		}
 	}
 }
 
+// 链接出错。通道已满时直接关闭链接，随后由断开回调移除
+func (c *connManagerImp) failConn(conn *conn, err error) {
+	select {
+	case c.failing <- &connError{conn: conn, err: err}:
+	default:
+		logger.Warn("connection to %v failed: %v, close connection\n", conn.p.ID, err)
+		go conn.stop()
+	}
+}
+
 func (c *connManagerImp) removeConn(peerID peer.ID) {
 	c.removing <- peerID
 }
@@ -0,0 +1,233 @@
+package p2p
+
+import (
+	"fmt"
+	"net"
+
+	"github.com/azd1997/ecoin/p2p/peer"
+)
+
+// 子网的前缀长度，用于限制同一子网的链接数
+const (
+	subnetPrefixV4 = 24
+	subnetPrefixV6 = 64
+)
+
+// ConnPolicy 链接管理器的准入策略，各项为0表示不限制
+//
+//	入站/出站：分别限制对方发起（入站）和本方发起（出站）的链接数，总数仍受最大链接数限制
+//	保留位置：在每个方向及总数中为种子节点和A类角色（医院、研究机构）保留位置。
+//		种子可以使用任意位置，A类角色可以使用除为种子保留以外的位置，其他节点（如病人的轻节点）只能使用剩余的位置。
+//		ID中的角色是对方自行声明的，不能据此认定A类角色：只有在配置的Workers中，或IsWorker（如链上注册表）认可的节点才算
+//	同一IP/子网：防止攻击者以少量地址占满链接（日蚀攻击）。种子不受此限制
+type ConnPolicy struct {
+	MaxInbound      int
+	MaxOutbound     int
+	ReservedSeeds   int
+	ReservedWorkers int
+	MaxPerIP        int
+	MaxPerSubnet    int
+	// 种子节点，按ID或IP识别（种子可以没有ID）
+	Seeds []*peer.Peer
+	// 配置的A类角色节点
+	Workers []peer.ID
+	// 查询节点是否为已在链上注册的A类角色，为nil时只认Workers
+	IsWorker func(id peer.ID) bool
+}
+
+// 节点在准入策略中的类别
+type peerClass int
+
+const (
+	classOther peerClass = iota
+	classWorker
+	classSeed
+)
+
+// 某一范围内各类别链接的数量
+type slotCount struct {
+	all     int // 全部
+	nonSeed int // 非种子
+	other   int // 既非种子也非A类角色
+}
+
+func (s *slotCount) add(class peerClass) {
+	s.all++
+	if class != classSeed {
+		s.nonSeed++
+	}
+	if class == classOther {
+		s.other++
+	}
+}
+
+// 按准入策略检查链接，链接管理器持有
+type connPolicy struct {
+	ConnPolicy
+	maxPeerNum int
+	seedIDs    map[peer.ID]bool
+	seedIPs    map[string]bool
+	workerIDs  map[peer.ID]bool
+}
+
+func newConnPolicy(maxPeerNum int, p ConnPolicy) *connPolicy {
+	result := &connPolicy{
+		ConnPolicy: p,
+		maxPeerNum: maxPeerNum,
+		seedIDs:    make(map[peer.ID]bool),
+		seedIPs:    make(map[string]bool),
+		workerIDs:  make(map[peer.ID]bool),
+	}
+	for _, seed := range p.Seeds {
+		if seed.ID != "" {
+			result.seedIDs[seed.ID] = true
+		}
+		if seed.IP != nil {
+			result.seedIPs[seed.IP.String()] = true
+		}
+	}
+	for _, id := range p.Workers {
+		result.workerIDs[id] = true
+	}
+	return result
+}
+
+func (p *connPolicy) classify(pr *peer.Peer) peerClass {
+	if p.seedIDs[pr.ID] || (pr.IP != nil && p.seedIPs[pr.IP.String()]) {
+		return classSeed
+	}
+	if p.workerIDs[pr.ID] || (p.IsWorker != nil && pr.ID.IsValid() && p.IsWorker(pr.ID)) {
+		return classWorker
+	}
+	return classOther
+}
+
+// 某一方向的链接上限
+func (p *connPolicy) dirLimit(inbound bool) int {
+	limit := p.MaxOutbound
+	if inbound {
+		limit = p.MaxInbound
+	}
+	if limit <= 0 || limit > p.maxPeerNum {
+		limit = p.maxPeerNum
+	}
+	return limit
+}
+
+// 检查是否可以添加与pr的链接。conns为已有的全部链接
+func (p *connPolicy) admit(conns map[peer.ID]*conn, pr *peer.Peer, inbound bool) error {
+	class := p.classify(pr)
+
+	var total, dir slotCount
+	var sameIP, sameSubnet int
+	for _, c := range conns {
+		cc := p.classify(c.p)
+		total.add(cc)
+		if c.inbound == inbound {
+			dir.add(cc)
+		}
+		if pr.IP != nil && c.p.IP != nil {
+			if c.p.IP.Equal(pr.IP) {
+				sameIP++
+			}
+			if subnetOf(c.p.IP) == subnetOf(pr.IP) {
+				sameSubnet++
+			}
+		}
+	}
+
+	if err := p.checkSlots("total", p.maxPeerNum, &total, class); err != nil {
+		return err
+	}
+	direction := "outbound"
+	if inbound {
+		direction = "inbound"
+	}
+	if err := p.checkSlots(direction, p.dirLimit(inbound), &dir, class); err != nil {
+		return err
+	}
+
+	if class == classSeed {
+		return nil
+	}
+	if p.MaxPerIP > 0 && sameIP >= p.MaxPerIP {
+		return ErrConnRejected{info: fmt.Sprintf("over max connections(%d) per ip %s", p.MaxPerIP, pr.IP)}
+	}
+	if p.MaxPerSubnet > 0 && sameSubnet >= p.MaxPerSubnet {
+		return ErrConnRejected{info: fmt.Sprintf("over max connections(%d) per subnet %s", p.MaxPerSubnet, subnetOf(pr.IP))}
+	}
+	return nil
+}
+
+// 在limit个位置中检查保留位置
+func (p *connPolicy) checkSlots(scope string, limit int, n *slotCount, class peerClass) error {
+	if n.all >= limit {
+		return ErrConnRejected{info: fmt.Sprintf("over max %s peer(%d) limits", scope, limit)}
+	}
+	if class != classSeed && n.nonSeed >= limit-p.ReservedSeeds {
+		return ErrConnRejected{info: fmt.Sprintf("remaining %s slots are reserved for seeds", scope)}
+	}
+	if class == classOther && n.other >= limit-p.ReservedSeeds-p.ReservedWorkers {
+		return ErrConnRejected{info: fmt.Sprintf("remaining %s slots are reserved for seeds and workers", scope)}
+	}
+	return nil
+}
+
+// 握手前粗略检查是否还能接受来自ip的入站链接，对方的身份要在握手后由admit检查
+func (p *connPolicy) acceptable(conns map[peer.ID]*conn, ip net.IP) bool {
+	var total, inbound, sameIP, sameSubnet int
+	for _, c := range conns {
+		total++
+		if c.inbound {
+			inbound++
+		}
+		if ip != nil && c.p.IP != nil {
+			if c.p.IP.Equal(ip) {
+				sameIP++
+			}
+			if subnetOf(c.p.IP) == subnetOf(ip) {
+				sameSubnet++
+			}
+		}
+	}
+
+	if total >= p.maxPeerNum || inbound >= p.dirLimit(true) {
+		return false
+	}
+	if ip != nil && p.seedIPs[ip.String()] {
+		return true
+	}
+	if p.MaxPerIP > 0 && sameIP >= p.MaxPerIP {
+		return false
+	}
+	if p.MaxPerSubnet > 0 && sameSubnet >= p.MaxPerSubnet {
+		return false
+	}
+	return true
+}
+
+// 还可以发起的出站链接数
+func (p *connPolicy) outboundSlots(conns map[peer.ID]*conn) int {
+	var outbound int
+	for _, c := range conns {
+		if !c.inbound {
+			outbound++
+		}
+	}
+	slots := p.dirLimit(false) - outbound
+	if free := p.maxPeerNum - len(conns); free < slots {
+		slots = free
+	}
+	if slots < 0 {
+		return 0
+	}
+	return slots
+}
+
+// ip所在的子网：IPv4取/24，IPv6取/64
+func subnetOf(ip net.IP) string {
+	if v4 := ip.To4(); v4 != nil {
+		return v4.Mask(net.CIDRMask(subnetPrefixV4, 32)).String()
+	}
+	return ip.Mask(net.CIDRMask(subnetPrefixV6, 128)).String()
+}
@@ -0,0 +1,104 @@
+package p2p
+
+import (
+	"net"
+	"strings"
+	"testing"
+
+	"github.com/azd1997/ecoin/account/role"
+	"github.com/azd1997/ecoin/common/crypto"
+	"github.com/azd1997/ecoin/p2p/peer"
+)
+
+func newPolicyTestPeer(ip string, rol role.No) *peer.Peer {
+	priv, _ := crypto.NewPrivateKeyS256()
+	return peer.NewPeer(net.ParseIP(ip), 10000, crypto.PrivateKey2ID(priv, rol))
+}
+
+// 检查准入，通过则加入conns
+func admitPeer(t *testing.T, p *connPolicy, conns map[peer.ID]*conn, pr *peer.Peer, inbound bool, reject string) {
+	err := p.admit(conns, pr, inbound)
+	if reject == "" {
+		if err != nil {
+			t.Fatalf("admit %s failed: %v", pr.IP, err)
+		}
+		conns[pr.ID] = &conn{p: pr, inbound: inbound}
+		return
+	}
+	if _, ok := err.(ErrConnRejected); !ok || !strings.Contains(err.Error(), reject) {
+		t.Fatalf("admit %s: expect rejected for %q, but %v", pr.IP, reject, err)
+	}
+}
+
+func TestConnPolicySlots(t *testing.T) {
+	seed := peer.NewPeer(net.ParseIP("10.0.0.1"), 10000, "")
+	// 链上已注册的A类角色
+	registered := make(map[peer.ID]bool)
+	newWorker := func(ip string, rol role.No) *peer.Peer {
+		pr := newPolicyTestPeer(ip, rol)
+		registered[pr.ID] = true
+		return pr
+	}
+	configured := newPolicyTestPeer("4.4.4.4", role.RESEARCHER)
+	p := newConnPolicy(6, ConnPolicy{
+		MaxInbound:      4,
+		MaxOutbound:     4,
+		ReservedSeeds:   1,
+		ReservedWorkers: 2,
+		Seeds:           []*peer.Peer{seed},
+		Workers:         []peer.ID{configured.ID},
+		IsWorker:        func(id peer.ID) bool { return registered[id] },
+	})
+	conns := make(map[peer.ID]*conn)
+
+	// 入站4个位置：1个留给种子，2个留给A类角色，病人只能使用剩下的1个
+	admitPeer(t, p, conns, newPolicyTestPeer("1.1.1.1", role.PATIENT), true, "")
+	admitPeer(t, p, conns, newPolicyTestPeer("2.2.2.2", role.PATIENT), true, "reserved for seeds and workers")
+	// 自称医院但未注册也未配置的节点不能使用A类角色的位置
+	admitPeer(t, p, conns, newPolicyTestPeer("2.2.2.3", role.HOSPITAL), true, "reserved for seeds and workers")
+	admitPeer(t, p, conns, newWorker("3.3.3.3", role.HOSPITAL), true, "")
+	admitPeer(t, p, conns, configured, true, "")
+	admitPeer(t, p, conns, newWorker("5.5.5.5", role.HOSPITAL), true, "reserved for seeds")
+	if !p.acceptable(conns, net.ParseIP("5.5.5.5")) {
+		t.Fatal("inbound slot reserved for seeds should still be acceptable before handshake")
+	}
+	admitPeer(t, p, conns, newPolicyTestPeer("10.0.0.1", role.PATIENT), true, "")
+	admitPeer(t, p, conns, newWorker("3.3.3.4", role.HOSPITAL), true, "over max inbound")
+	if p.acceptable(conns, net.ParseIP("10.0.0.1")) {
+		t.Fatal("inbound is full")
+	}
+
+	// 出站不受入站占用的影响，但总数受最大链接数限制
+	if slots := p.outboundSlots(conns); slots != 2 {
+		t.Fatalf("expect 2 outbound slots, got %d", slots)
+	}
+	admitPeer(t, p, conns, newPolicyTestPeer("6.6.6.6", role.PATIENT), false, "")
+	admitPeer(t, p, conns, newPolicyTestPeer("7.7.7.7", role.PATIENT), false, "reserved for seeds and workers")
+	admitPeer(t, p, conns, newWorker("8.8.8.8", role.HOSPITAL), false, "")
+	if slots := p.outboundSlots(conns); slots != 0 {
+		t.Fatalf("expect no outbound slots, got %d", slots)
+	}
+	admitPeer(t, p, conns, newWorker("9.9.9.9", role.HOSPITAL), false, "over max total")
+}
+
+func TestConnPolicyIPLimits(t *testing.T) {
+	seed := newPolicyTestPeer("10.0.0.1", role.HOSPITAL)
+	p := newConnPolicy(16, ConnPolicy{
+		MaxPerIP:     1,
+		MaxPerSubnet: 2,
+		Seeds:        []*peer.Peer{{ID: seed.ID}},
+	})
+	conns := make(map[peer.ID]*conn)
+
+	admitPeer(t, p, conns, newPolicyTestPeer("192.168.1.1", role.HOSPITAL), true, "")
+	admitPeer(t, p, conns, newPolicyTestPeer("192.168.1.1", role.HOSPITAL), false, "per ip")
+	if p.acceptable(conns, net.ParseIP("192.168.1.1")) {
+		t.Fatal("over max connections per ip")
+	}
+	admitPeer(t, p, conns, newPolicyTestPeer("192.168.1.2", role.HOSPITAL), false, "")
+	admitPeer(t, p, conns, newPolicyTestPeer("192.168.1.3", role.HOSPITAL), true, "per subnet")
+	admitPeer(t, p, conns, newPolicyTestPeer("192.168.2.3", role.HOSPITAL), true, "")
+
+	// 种子（按ID识别）不受IP限制
+	admitPeer(t, p, conns, peer.NewPeer(net.ParseIP("192.168.1.1"), 10000, seed.ID), true, "")
+}
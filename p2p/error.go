@@ -5,6 +5,7 @@ import (
 	"fmt"
 
 	"github.com/azd1997/ecoin/common/params"
+	"github.com/azd1997/ecoin/protocol/handshake"
 )
 
 var ErrNegotiateInvalidSig = errors.New("invalid signature")
@@ -27,6 +28,25 @@ func (n ErrNegotiateCodeVersionMismatch) Error() string {
 		n.minimizeVersionRequired, n.remoteVersion)
 }
 
+type ErrNegotiateCipherMismatch struct {
+	remoteCipher uint8
+}
+
+func (n ErrNegotiateCipherMismatch) Error() string {
+	return fmt.Sprintf("session cipher mismatch, support %d, got %d",
+		handshake.CurrentCipher, n.remoteCipher)
+}
+
+type ErrNegotiateCoreVersionMismatch struct {
+	localMin, localMax   uint16
+	remoteMin, remoteMax uint16
+}
+
+func (n ErrNegotiateCoreVersionMismatch) Error() string {
+	return fmt.Sprintf("no common core protocol version, support [%d, %d], got [%d, %d]",
+		n.localMin, n.localMax, n.remoteMin, n.remoteMax)
+}
+
 type ErrNegotiateBrokenData struct {
 	info string
 }
@@ -34,3 +54,54 @@ type ErrNegotiateBrokenData struct {
 func (n ErrNegotiateBrokenData) Error() string {
 	return n.info
 }
+
+var ErrConnBrokenPacket = errors.New("verify packet failed")
+
+// ErrConnRejected 新链接不符合链接策略
+type ErrConnRejected struct {
+	info string
+}
+
+func (c ErrConnRejected) Error() string {
+	return c.info
+}
+
+// ErrMsgTooLarge 消息超过与对方协商的最大长度
+type ErrMsgTooLarge struct {
+	size int
+	max  uint32
+}
+
+func (m ErrMsgTooLarge) Error() string {
+	return fmt.Sprintf("message size %d exceeds negotiated limit %d", m.size, m.max)
+}
+
+// ErrFrameTooLarge TCP帧头部声明的长度超过上限，不再缓冲其余数据
+type ErrFrameTooLarge struct {
+	length uint32
+	max    uint32
+}
+
+func (f ErrFrameTooLarge) Error() string {
+	return fmt.Sprintf("frame length %d exceeds limit %d", f.length, f.max)
+}
+
+var ErrRekeyTimeout = errors.New("session rekey timeout")
+
+var ErrRekeyOverdue = errors.New("session key overdue, remote never rekeyed")
+
+type ErrRekeyUnexpected struct {
+	msgType uint8
+}
+
+func (r ErrRekeyUnexpected) Error() string {
+	return fmt.Sprintf("unexpected session rekey message %d", r.msgType)
+}
+
+type ErrRekeyBrokenData struct {
+	info string
+}
+
+func (r ErrRekeyBrokenData) Error() string {
+	return r.info
+}
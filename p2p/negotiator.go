@@ -26,13 +26,14 @@ receiver:
 	5. reply
 final:
 	1. get shared secret P from two temporary key
-	2. sha512(P), use first 32 bytes as secret key and rest 12 bytes as nonce
-	3. use AES-GCM-256 to encrypt/decrypt following message
+	2. derive one key per direction from P, see handshake.Request.Cipher and codec.go
+	3. use AES-GCM-256 with per-frame counter nonce to encrypt/decrypt following message
+	4. both sides negotiate capabilities (highest common core protocol version etc.) from Request.Caps and Response.Caps,
+	   the result is recorded on peer.Peer.Caps, see handshake.Negotiate
 */
 
 const (
 	handshakeProtocolID = 0
-	nonceSize           = 12
 )
 
 type negotiator interface {
@@ -46,6 +47,7 @@ type negotiatorImp struct {
 	codeVersion             params.CodeVersion
 	minimizeVersionRequired params.CodeVersion
 	genSessionKeyFunc       func() (*crypto.PrivateKey, error) // for test stub
+	caps                    *handshake.Capabilities            // 本节点声明的能力
 }
 
 func newNegotiator(account *account.Account, chainID uint8) negotiator {
@@ -55,6 +57,7 @@ func newNegotiator(account *account.Account, chainID uint8) negotiator {
 		codeVersion:             params.CurrentCodeVersion,
 		minimizeVersionRequired: params.MinimizeVersionRequired,
 		genSessionKeyFunc:       genSessionKeyFunc,
+		caps:                    handshake.DefaultCapabilities(),
 	}
 	return result
 }
@@ -82,6 +85,13 @@ func (n *negotiatorImp) handshakeTo(conn TCPConn, peer *peer.Peer) (codec, error
 		return nil, err
 	}
 
+	// 协商双方的能力，记录在peer上
+	caps, err := n.negotiateCaps(response.Caps)
+	if err != nil {
+		return nil, err
+	}
+	peer.Caps = caps
+
 	// 接受回应之后，根据回应解析出对方生成的临时会话私钥中的公钥
 	peerSessionKey, err := crypto.ParsePubKeyS256(response.SessionKey)
 	if err != nil {
@@ -89,7 +99,7 @@ func (n *negotiatorImp) handshakeTo(conn TCPConn, peer *peer.Peer) (codec, error
 	}
 
 	// 根据对方的临时公钥和自己的临时私钥生成会话加解密模块
-	return newAESGCMCodec(peerSessionKey, sessionPrivKey)
+	return newAESGCMCodec(peerSessionKey, sessionPrivKey, true)
 }
 
 // recvHandshake 接受握手消息
@@ -125,6 +135,12 @@ func (n *negotiatorImp) recvHandshake(conn TCPConn, accept bool) (*peer.Peer, co
 		return nil, nil, err
 	}
 
+	// 协商双方的能力，没有共同的核心协议版本则拒绝
+	caps, err := n.negotiateCaps(request.Caps)
+	if err != nil {
+		return nil, nil, err
+	}
+
 	// 接受请求
 	// 生成会话用的临时私钥。 该私钥将用来生成会话加密用的对称密钥以及其Nonce值
 	sessionPrivKey, err := n.genSessionKeyFunc()
@@ -137,7 +153,7 @@ func (n *negotiatorImp) recvHandshake(conn TCPConn, accept bool) (*peer.Peer, co
 	conn.Send(acceptRsp)
 
 	// 根据对方的临时公钥和自己的临时私钥 生成加解密模块
-	ec, err := newAESGCMCodec(peerSessionKey, sessionPrivKey)
+	ec, err := newAESGCMCodec(peerSessionKey, sessionPrivKey, false)
 	if err != nil {
 		return nil, nil, err
 	}
@@ -147,6 +163,7 @@ func (n *negotiatorImp) recvHandshake(conn TCPConn, accept bool) (*peer.Peer, co
 	if err != nil {
 		return nil, nil, err
 	}
+	peer1.Caps = caps
 
 	return peer1, ec, nil
 }
@@ -200,6 +217,7 @@ func (n *negotiatorImp) genRequest(sessionPrivKey *crypto.PrivateKey) []byte {
 	// 构造握手请求并签名
 	req := handshake.NewRequestV1(n.chainID, n.codeVersion, n.account.RoleNo,
 		crypto.PrivateKey2ID(n.account.PrivateKey, n.account.RoleNo), sessionPubKeyBytes)
+	req.Caps = n.caps
 	req.Sign(n.account.PrivateKey)
 
 	// 构造TCP packet
@@ -218,6 +236,7 @@ func (n *negotiatorImp) genRejectResponse() []byte {
 func (n *negotiatorImp) genAcceptResponse(sessionPrivKey *crypto.PrivateKey) []byte {
 	resp := handshake.NewAcceptResponseV1(n.codeVersion, n.account.RoleNo,
 		sessionPrivKey.PubKey().SerializeCompressed())
+	resp.Caps = n.caps
 	resp.Sign(n.account.PrivateKey)
 
 	return buildTCPPacket(resp.Encode(), handshakeProtocolID)
@@ -263,6 +282,11 @@ func (n *negotiatorImp) whetherRejectReq(request *handshake.Request) error {
 		return ErrNegotiateCodeVersionMismatch{n.minimizeVersionRequired, request.CodeVersion}
 	}
 
+	// 检查会话加密方案
+	if !supportedCipher(request.Cipher) {
+		return ErrNegotiateCipherMismatch{request.Cipher}
+	}
+
 	// TODO: 检查请求的来源节点类型(节点/账户的角色)
 	// 暂时假设只有同角色类型的结点才可以通信
 	if request.NodeRole != n.account.RoleNo {
@@ -290,6 +314,11 @@ func (n *negotiatorImp) whetherRejectResp(response *handshake.Response, remoteID
 		return ErrNegotiateCodeVersionMismatch{n.minimizeVersionRequired, response.CodeVersion}
 	}
 
+	// 对方确认的会话加密方案须为本方提出的方案
+	if response.Cipher != handshake.CurrentCipher {
+		return ErrNegotiateCipherMismatch{response.Cipher}
+	}
+
 	// TODO： 检查response来源的节点角色
 	// 暂时假设只有同角色类型的结点才可以通信
 	if response.NodeRole != n.account.RoleNo {
@@ -299,6 +328,23 @@ func (n *negotiatorImp) whetherRejectResp(response *handshake.Response, remoteID
 	return nil
 }
 
+// 由对方声明的能力协商，取双方都支持的最高核心协议版本
+func (n *negotiatorImp) negotiateCaps(remote *handshake.Capabilities) (*handshake.Negotiated, error) {
+	if remote == nil {
+		remote = handshake.LegacyCapabilities()
+	}
+	caps, ok := handshake.Negotiate(n.caps, remote)
+	if !ok {
+		return nil, ErrNegotiateCoreVersionMismatch{
+			localMin:  n.caps.MinCoreVersion,
+			localMax:  n.caps.MaxCoreVersion,
+			remoteMin: remote.MinCoreVersion,
+			remoteMax: remote.MaxCoreVersion,
+		}
+	}
+	return caps, nil
+}
+
 // 从握手请求中获取对方结点信息
 func (n *negotiatorImp) getPeerFromRequest(conn TCPConn, request *handshake.Request) (*peer.Peer, error) {
 	addr := conn.RemoteAddr()
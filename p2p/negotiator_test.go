@@ -26,8 +26,6 @@ var negotiatorTestVar = &struct {
 	recvSessionPrivKey *crypto.PrivateKey
 	recvSessionPubKey  *crypto.PublicKey
 
-	expectCodec codec
-
 	remoteIP   net.IP
 	remotePort int
 
@@ -52,8 +50,6 @@ func init() {
 	keyBytes, _ = encoding.FromHex(recvSessionPrivKeyHex)
 	tv.recvSessionPrivKey, tv.recvSessionPubKey = crypto.PrivKeyFromBytesS256(keyBytes)
 
-	tv.expectCodec, _ = newAESGCMCodec(tv.recvSessionPubKey, tv.sendSessionPrivKey)
-
 	tv.remoteIP = net.ParseIP("192.168.1.2")
 	tv.remotePort = 10000
 
@@ -77,6 +73,7 @@ func TestHandshakeTo(t *testing.T) {
 	if err != nil {
 		t.Fatalf("handshakeTo err:%v\n", err)
 	}
+	checkCaps(t, peer2)
 
 	// check handshake request
 	_, reqPkt, _ := verifyTCPPacket(conn.getSendPkt())
@@ -87,8 +84,9 @@ func TestHandshakeTo(t *testing.T) {
 	}
 	checkRequest(t, req)
 
-	// check codec
-	checkCodec(t, codec, tv.expectCodec)
+	// check codec, the receiver holds the other side of the session
+	expectCodec, _ := newAESGCMCodec(tv.sendSessionPubKey, tv.recvSessionPrivKey, false)
+	checkCodec(t, codec, expectCodec)
 }
 
 func TestRecvHandshake(t *testing.T) {
@@ -118,9 +116,11 @@ func TestRecvHandshake(t *testing.T) {
 
 	// check peer2
 	checkPeer(t, peer2)
+	checkCaps(t, peer2)
 
-	// check codec
-	checkCodec(t, codec, tv.expectCodec)
+	// check codec, the sender holds the other side of the session
+	expectCodec, _ := newAESGCMCodec(tv.recvSessionPubKey, tv.sendSessionPrivKey, true)
+	checkCodec(t, codec, expectCodec)
 }
 
 func TestReject(t *testing.T) {
@@ -238,6 +238,86 @@ func TestReceiverCoderVersionMismatch(t *testing.T) {
 	}
 }
 
+func TestCipherMismatch(t *testing.T) {
+	tv := negotiatorTestVar
+	sender := newSender(role.HOSPITAL)
+	receiver := newReceiver(role.HOSPITAL)
+
+	// request from a node without session cipher version
+	conn := newTCPConnMock()
+	req := handshake.NewRequestV1(tv.chainID, params.CurrentCodeVersion, role.HOSPITAL, tv.sendID,
+		tv.sendSessionPubKey.SerializeCompressed())
+	req.Cipher = 0
+	req.Sign(tv.sendPrivKey)
+	conn.setRecvPkt(buildTCPPacket(req.Encode(), handshakeProtocolID))
+
+	_, _, err := receiver.recvHandshake(conn, true)
+	if _, ok := err.(ErrNegotiateCipherMismatch); !ok {
+		t.Fatalf("expect cipher mismatch error, %v\n", err)
+	}
+
+	// response confirming another session cipher
+	conn = newTCPConnMock()
+	resp := handshake.NewAcceptResponseV1(params.CurrentCodeVersion, role.HOSPITAL,
+		tv.recvSessionPubKey.SerializeCompressed())
+	resp.Cipher = 1
+	resp.Sign(tv.recvPrivKey)
+	conn.setRecvPkt(buildTCPPacket(resp.Encode(), handshakeProtocolID))
+
+	peer2 := peer.NewPeer(tv.remoteIP, tv.remotePort, tv.recvID)
+	_, err = sender.handshakeTo(conn, peer2)
+	if _, ok := err.(ErrNegotiateCipherMismatch); !ok {
+		t.Fatalf("expect cipher mismatch error, %v\n", err)
+	}
+}
+
+func TestCoreVersionNegotiate(t *testing.T) {
+	tv := negotiatorTestVar
+
+	// 滚动升级：新节点支持[1, 3]，旧节点支持[1, 2]，取共同的最高版本2
+	sender := newSender(role.HOSPITAL)
+	sender.caps = &handshake.Capabilities{MinCoreVersion: 1, MaxCoreVersion: 3}
+	receiver := newReceiver(role.HOSPITAL)
+	receiver.caps = &handshake.Capabilities{MinCoreVersion: 1, MaxCoreVersion: 2, LightClient: true}
+
+	conn := newTCPConnMock()
+	conn.setRecvPkt(sender.genRequest(tv.sendSessionPrivKey))
+	peer1, _, err := receiver.recvHandshake(conn, true)
+	if err != nil {
+		t.Fatalf("recvHandshake err:%v\n", err)
+	}
+	conn = newTCPConnMock()
+	conn.setRecvPkt(receiver.genAcceptResponse(tv.recvSessionPrivKey))
+	peer2 := peer.NewPeer(tv.remoteIP, tv.remotePort, tv.recvID)
+	if _, err := sender.handshakeTo(conn, peer2); err != nil {
+		t.Fatalf("handshakeTo err:%v\n", err)
+	}
+	if peer1.Caps.CoreVersion != 2 || peer2.Caps.CoreVersion != 2 {
+		t.Fatalf("expect core version 2, got %d and %d", peer1.Caps.CoreVersion, peer2.Caps.CoreVersion)
+	}
+	if peer1.Caps.LightClient || !peer2.Caps.LightClient {
+		t.Fatal("light client mode should be recorded on the peer")
+	}
+
+	// 没有共同版本
+	receiver.caps = &handshake.Capabilities{MinCoreVersion: 4, MaxCoreVersion: 4}
+	conn = newTCPConnMock()
+	conn.setRecvPkt(sender.genRequest(tv.sendSessionPrivKey))
+	if _, _, err := receiver.recvHandshake(conn, true); err == nil {
+		t.Fatal("expect core version mismatch error")
+	} else if _, ok := err.(ErrNegotiateCoreVersionMismatch); !ok {
+		t.Fatalf("expect core version mismatch error, %v\n", err)
+	}
+	conn = newTCPConnMock()
+	conn.setRecvPkt(receiver.genAcceptResponse(tv.recvSessionPrivKey))
+	peer2 = peer.NewPeer(tv.remoteIP, tv.remotePort, tv.recvID)
+	if _, err := sender.handshakeTo(conn, peer2); err == nil {
+		t.Fatal("expect core version mismatch error")
+	} else if _, ok := err.(ErrNegotiateCoreVersionMismatch); !ok {
+		t.Fatalf("expect core version mismatch error, %v\n", err)
+	}
+}
+
 func newSender(rol role.No) *negotiatorImp {
 	tv := negotiatorTestVar
 	ng := newNegotiator(&account.Account{RoleNo:rol, PrivateKey:tv.sendPrivKey}, tv.chainID)
@@ -279,6 +359,9 @@ func checkRequest(t *testing.T, req *handshake.Request) {
 	if err := utils.TCheckBytes("session key", tv.sendSessionPubKey.SerializeCompressed(), req.SessionKey); err != nil {
 		t.Fatal(err)
 	}
+	if err := utils.TCheckUint8("cipher", handshake.CurrentCipher, req.Cipher); err != nil {
+		t.Fatal(err)
+	}
 }
 
 func checkResponse(t *testing.T, resp *handshake.Response) {
@@ -303,6 +386,9 @@ func checkResponse(t *testing.T, resp *handshake.Response) {
 	if err := utils.TCheckBytes("session key", tv.recvSessionPubKey.SerializeCompressed(), resp.SessionKey); err != nil {
 		t.Fatal(err)
 	}
+	if err := utils.TCheckUint8("cipher", handshake.CurrentCipher, resp.Cipher); err != nil {
+		t.Fatal(err)
+	}
 }
 
 func checkPeer(t *testing.T, p *peer.Peer) {
@@ -319,6 +405,18 @@ func checkPeer(t *testing.T, p *peer.Peer) {
 	}
 }
 
+func checkCaps(t *testing.T, p *peer.Peer) {
+	if p.Caps == nil {
+		t.Fatal("negotiated capabilities should be recorded on the peer")
+	}
+	if err := utils.TCheckUint16("core version", handshake.MaxCoreProtocol, p.Caps.CoreVersion); err != nil {
+		t.Fatal(err)
+	}
+	if err := utils.TCheckUint8("compression", handshake.CompressNone, p.Caps.Compression); err != nil {
+		t.Fatal(err)
+	}
+}
+
 func checkCodec(t *testing.T, result codec, expect codec) {
 	originText := []byte("negotiator test codec check")
 
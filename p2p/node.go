@@ -24,10 +24,15 @@ type Config struct {
 	Provider   peer.Provider
 	// 最大连接节点数量
 	MaxPeerNum int
+	// 链接准入策略：入站/出站上限、保留位置、同一IP/子网上限
+	ConnPolicy ConnPolicy
 	// 本机结点账户
 	Account *account.Account	// Account包含了类型角色类型信息
 	// 本机区块链的ID
 	ChainID    uint8
+	// 会话密钥轮换条件：当前密钥加解密的字节数或使用时长达到其一即换钥。为0时取默认值（1GiB/1小时）
+	RekeyBytes    uint64
+	RekeyInterval time.Duration
 }
 
 // Node P2P网络节点
@@ -35,6 +40,8 @@ type Node interface {
 	AddProtocol(p Protocol) ProtocolRunner
 	Start()
 	Stop()
+	// ReportPeer 报告对端节点的作恶行为（badType见peer包的BadType），信誉分耗尽的节点被封禁并断开链接
+	ReportPeer(id peer.ID, badType uint8, reason error)
 }
 
 // NewNode 新建一个节点
@@ -53,7 +60,7 @@ func NewNode(c *Config) Node {
 		ngBlackList:    make(map[peer.ID]time.Time),
 		tcpConnectFunc: TCPConnectTo,
 		connectTask:    make(chan *peer.Peer, c.MaxPeerNum),
-		connMgr:        newConnManager(c.MaxPeerNum),
+		connMgr:        newConnManager(c.MaxPeerNum, c.ConnPolicy, newRekeyPolicy(c.RekeyBytes, c.RekeyInterval)),
 		lm:             epattern.NewLoop(1),
 	}
 	n.ng = newNegotiator(n.account, n.chainID)
@@ -173,7 +180,6 @@ func (n *node) loop() {
 		case newPeerConn := <-acceptConn:	// 有新TCP链接，那么让其到一个go程自己去跑
 			go func() {
 				n.lm.Add()
-				newPeerConn.SetSplitFunc(splitTCPStream)
 				n.recvConn(newPeerConn)
 				n.lm.Done()
 			}()
@@ -190,6 +196,13 @@ func (n *node) getPeersToConnect() {
 	}
 
 	expectNum := n.maxPeersNum - peersNum
+	// 出站链接数受链接策略限制
+	if slots := n.connMgr.outboundSlots(); slots < expectNum {
+		expectNum = slots
+	}
+	if expectNum <= 0 {
+		return
+	}
 	excludePeers := n.getExcludePeers()
 	newPeers, err := n.peerProvider.GetPeers(expectNum, excludePeers)
 	if err != nil {
@@ -227,7 +240,8 @@ func (n *node) setupConn(newPeer *peer.Peer) {
 		return
 	}
 	// 设置数据流分割方法
-	conn.SetSplitFunc(splitTCPStream)
+	splitter := newTCPSplitter()
+	conn.SetSplitFunc(splitter.split)
 
 	// 与对方进行握手协商，获取消息加密模块
 	ec, err := n.ng.handshakeTo(conn, newPeer)
@@ -237,17 +251,22 @@ func (n *node) setupConn(newPeer *peer.Peer) {
 		n.addNgBlackList(newPeer.ID)
 		return
 	}
+	splitter.setMaxMsgSize(newPeer.Caps)
 
 	// 将对方添加到本机节点的链接管理器当中
-	n.addConn(newPeer, conn, ec)
+	n.addConn(newPeer, conn, ec, false)
 }
 
 // 接受链接
 // 当某个结点（对端结点）向本机发起连接时（此时已经建立了TCP链接，但是我们要决定是否建立P2P链接），
-// 要查看是否连接管理器还有位置、 尝试接受握手。 都没有问题，才将该链接添加到本机结点的连接管理器
+// 要查看是否连接管理器还有位置（含链接策略的入站及同一IP/子网限制）、 尝试接受握手。 都没有问题，才将该链接添加到本机结点的连接管理器
 func (n *node) recvConn(conn TCPConn) {
+	// 设置数据流分割方法
+	splitter := newTCPSplitter()
+	conn.SetSplitFunc(splitter.split)
+
 	accept := false
-	if n.connMgr.size() < n.maxPeersNum {
+	if n.connMgr.size() < n.maxPeersNum && n.connMgr.acceptable(remoteIP(conn)) {
 		accept = true
 	}
 
@@ -262,30 +281,46 @@ func (n *node) recvConn(conn TCPConn) {
 		conn.Disconnect()
 		return
 	}
+	splitter.setMaxMsgSize(peer1.Caps)
 
-	n.addConn(peer1, conn, ec)
+	n.addConn(peer1, conn, ec, true)
 }
 
-// 将某个链接添加到连接管理器
-func (n *node) addConn(peer *peer.Peer, conn TCPConn, ec codec) {
-	if err := n.connMgr.add(peer, conn, ec, n.recv); err != nil {
+// 将某个链接添加到连接管理器。 封禁期内的节点不予添加
+func (n *node) addConn(peer *peer.Peer, conn TCPConn, ec codec, inbound bool) {
+	if n.peerProvider.IsBanned(peer.ID) {
+		logger.Info("addConn failed: peer %v is banned\n", peer.ID)
+		conn.Disconnect()
+		return
+	}
+	if err := n.connMgr.add(peer, conn, ec, n.recv, inbound); err != nil {
 		logger.Info("addConn failed:%v\n", err)
 		conn.Disconnect()
 	}
 }
 
+// ReportPeer 报告对端节点的作恶行为。节点被封禁则断开与其的链接
+func (n *node) ReportPeer(id peer.ID, badType uint8, reason error) {
+	logger.Warn("peer %v misbehaves(%d): %v\n", id, badType, reason)
+	if n.peerProvider.ReportPeer(id, badType) {
+		logger.Warn("peer %v is banned, disconnect it\n", id)
+		n.connMgr.disconnect(id)
+	}
+}
+
 // 以某种协议向对端结点发送数据
 func (n *node) send(p Protocol, dp *PeerData) error {
 	return n.connMgr.send(p, dp)
 }
 
 // 接受数据，将其丢给对应的protocolRunner去处理
-func (n *node) recv(peer peer.ID, protocolID uint8, data []byte) {
+func (n *node) recv(p *peer.Peer, protocolID uint8, data []byte) {
 	logger.Debug("recv a protocol[%d] packet, size %d\n", protocolID, len(data))
 	if runner, ok := n.protocols[protocolID]; ok {
 		select {
 		case runner.Data <- &PeerData{
-			Peer: peer,
+			Peer: p.ID,
+			Caps: p.Caps,
 			Data: data,
 		}:
 		default:
@@ -11,6 +11,7 @@ import (
 	"github.com/azd1997/ecoin/account/role"
 	"github.com/azd1997/ecoin/common/utils"
 	"github.com/azd1997/ecoin/p2p/peer"
+	"github.com/azd1997/ecoin/protocol/handshake"
 )
 
 var nodeTestVar = &struct {
@@ -179,6 +180,39 @@ func TestRecvConn(t *testing.T) {
 	if connManager.addPeer != nil {
 		t.Fatal("expect not adding peer")
 	}
+
+	// fail via banned
+	n = newNodeForTest()
+	n.peerProvider.(*providerMock).banned[tv.remotePeer.ID] = true
+	n.recvConn(newTCPConnMock())
+
+	connManager = n.connMgr.(*connManagerMock)
+	if connManager.addPeer != nil {
+		t.Fatal("expect not adding banned peer")
+	}
+}
+
+func TestReportPeer(t *testing.T) {
+	tv := nodeTestVar
+	n := newNodeForTest()
+	provider := n.peerProvider.(*providerMock)
+	connManager := n.connMgr.(*connManagerMock)
+
+	// not banned yet, keep the connection
+	n.ReportPeer(tv.remotePeer.ID, peer.BadMalformedMsg, errors.New("malformed"))
+	if err := utils.TCheckInt("reported", 1, len(provider.reported)); err != nil {
+		t.Fatal(err)
+	}
+	if connManager.disconnected != "" {
+		t.Fatal("expect not disconnecting")
+	}
+
+	// banned, disconnect
+	provider.banned[tv.remotePeer.ID] = true
+	n.ReportPeer(tv.remotePeer.ID, peer.BadForgedProof, errors.New("forged proof"))
+	if err := utils.TCheckString("disconnected", string(tv.remotePeer.ID), string(connManager.disconnected)); err != nil {
+		t.Fatal(err)
+	}
 }
 
 func TestCleanNgBlackList(t *testing.T) {
@@ -224,7 +258,9 @@ func TestProtocolRecv(t *testing.T) {
 	runner := n.AddProtocol(p)
 	recvChan := runner.GetRecvChan()
 
-	n.recv(tv.remotePeer.ID, p.ID(), tv.networkData)
+	remote := *tv.remotePeer
+	remote.Caps = &handshake.Negotiated{CoreVersion: handshake.CoreProtocolV1}
+	n.recv(&remote, p.ID(), tv.networkData)
 
 	select {
 	case pd := <-recvChan:
@@ -234,6 +270,9 @@ func TestProtocolRecv(t *testing.T) {
 		if err := utils.TCheckBytes("recv data", tv.networkData, pd.Data); err != nil {
 			t.Fatal(err)
 		}
+		if pd.Caps != remote.Caps {
+			t.Fatal("recv data should carry the negotiated capabilities of the peer")
+		}
 	default:
 		t.Fatal("expect recv data")
 	}
@@ -244,11 +283,14 @@ type providerMock struct {
 	peers           []*peer.Peer
 	getPeersExpect  int
 	getPeersExclude map[peer.ID]bool
+	banned          map[peer.ID]bool
+	reported        []peer.ID
 }
 
 func newProviderMock(peers []*peer.Peer) *providerMock {
 	return &providerMock{
-		peers: peers,
+		peers:  peers,
+		banned: make(map[peer.ID]bool),
 	}
 }
 
@@ -260,6 +302,13 @@ func (p *providerMock) GetPeers(expect int, exclude map[peer.ID]bool) ([]*peer.P
 	return p.peers, nil
 }
 func (p *providerMock) AddSeeds(seeds []*peer.Peer) {}
+func (p *providerMock) ReportPeer(id peer.ID, badType uint8) bool {
+	p.reported = append(p.reported, id)
+	return p.banned[id]
+}
+func (p *providerMock) IsBanned(id peer.ID) bool {
+	return p.banned[id]
+}
 
 ///////////////////////////////////////negotiatorMock
 type negotiatorMock struct {
@@ -288,8 +337,9 @@ func (n *negotiatorMock) recvHandshake(conn TCPConn, accept bool) (*peer.Peer, c
 
 ///////////////////////////////////////connManagerMock
 type connManagerMock struct {
-	ids     []peer.ID
-	addPeer *peer.Peer
+	ids          []peer.ID
+	addPeer      *peer.Peer
+	disconnected peer.ID
 
 	sendProtocol Protocol
 	sendData     *PeerData
@@ -323,10 +373,19 @@ func (c *connManagerMock) send(p Protocol, dp *PeerData) error {
 	c.sendData = dp
 	return nil
 }
-func (c *connManagerMock) add(peer *peer.Peer, conn TCPConn, ec codec, handler recvHandler) error {
+func (c *connManagerMock) add(peer *peer.Peer, conn TCPConn, ec codec, handler recvHandler, inbound bool) error {
 	c.addPeer = peer
 	return nil
 }
+func (c *connManagerMock) acceptable(ip net.IP) bool {
+	return true
+}
+func (c *connManagerMock) outboundSlots() int {
+	return 1 << 10
+}
+func (c *connManagerMock) disconnect(peerID peer.ID) {
+	c.disconnected = peerID
+}
 func (c *connManagerMock) String() string {
 	return ""
 }
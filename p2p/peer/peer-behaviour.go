@@ -8,7 +8,11 @@ import "github.com/azd1997/ecoin/common"
 const (
 	BadUnknown  = iota
 	BadConnFail // 注意连接失败一次扣固定分值。并视为节点掉线，不继续扣分，也不会再给它发消息
-
+	BadInvalidBlock // 广播了伪造或被篡改的区块（如哈希不符），与本地视图无关
+	BadForgedProof  // 广播了伪造或被篡改的证明
+	BadMalformedMsg // 发送了无法解码或未知类型的消息
+	BadSyncTimeout  // 同步区块时超时未响应
+	BadDisputedBlock // 广播的区块不被本地认可，但可能只是双方视图或时序不同（如证明池不同、时钟偏差）
 )
 
 // GoodType
@@ -24,6 +28,11 @@ var CreditPolicy = map[uint8]int{
 	// 作恶情况
 	BadUnknown:  -1,
 	BadConnFail: -1,
+	BadInvalidBlock: -5,
+	BadForgedProof:  -10, // 初始信誉分只够一次
+	BadMalformedMsg: -2,
+	BadSyncTimeout:  -1,
+	BadDisputedBlock: -1,
 
 	// 合规情况
 	GoodUnknown: 1,
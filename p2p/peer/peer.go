@@ -3,6 +3,7 @@ package peer
 import (
 	"fmt"
 	"github.com/azd1997/ecoin/common/crypto"
+	"github.com/azd1997/ecoin/protocol/handshake"
 	"net"
 )
 
@@ -23,6 +24,8 @@ type Peer struct {
 	IP   net.IP
 	Port int
 	ID ID
+	// 握手时与该节点协商得到的能力，尚未握手时为nil
+	Caps *handshake.Negotiated
 }
 
 // NewPeer 新建一个节点标识
@@ -3,6 +3,8 @@ package peer
 import (
 	"math"
 	"time"
+
+	"github.com/azd1997/ecoin/common"
 )
 
 
@@ -27,7 +29,8 @@ import (
 // 对于peer包以外，不需要直接访问这些表，因此都设为私有
 // 对于外部需要知道的信息，通过State的聚合体(上层结构)提供API返回
 //
-// TODO: 信誉机制暂时不使用
+// 信誉机制: 上层通过Provider.ReportPeer报告节点的作恶行为（见peer-behaviour.go），按CreditPolicy扣除信誉分，
+// 信誉分耗尽的节点被封禁（移入bannedPeers），第i次封禁时长为 defaultBanDuration * defaultBanBase^(i-1)，解封后信誉分恢复
 
 
 //////////////////////////// Const & Var /////////////////////////////
@@ -117,7 +120,38 @@ func (p *state) isReachable() bool {
 
 // isHonest 检查是否诚实
 func (p *state) isHonest() bool {
-	return true
+	return !p.cState.dishonest
+}
+
+// isBanned 是否处于封禁期
+func (p *state) isBanned() bool {
+	return time.Now().Before(p.cState.unbanTime)
+}
+
+// 记录一次作恶，按CreditPolicy扣除信誉分，信誉分耗尽则置为不诚实
+func (p *state) recordBad(badType uint8) {
+	punish, ok := CreditPolicy[badType]
+	if !ok {
+		punish = CreditPolicy[BadUnknown]
+	}
+
+	record := &BadRecord{
+		Time:    common.TimeStamp(time.Now().Unix()),
+		BadType: badType,
+		Punish:  punish,
+		Next:    p.cState.badRecords,
+	}
+	if p.cState.badRecords != nil {
+		p.cState.badRecords.Prev = record
+	}
+	p.cState.badRecords = record
+	p.cState.continuousBadNum++
+	p.cState.totalBadNum++
+
+	p.cState.credit += punish
+	if p.cState.credit <= 0 {
+		p.cState.dishonest = true
+	}
 }
 
 // isTimeToGetNeighbours 判断是否到时间去查询邻居节点
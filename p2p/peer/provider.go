@@ -31,6 +31,12 @@ type Provider interface {
 
 	// AddSeeds 添加seed种子节点，用于provider初始化
 	AddSeeds(seeds []*Peer)
+
+	// ReportPeer 报告节点的作恶行为（badType见peer-behaviour.go），扣除其信誉分。返回节点是否被封禁
+	ReportPeer(id ID, badType uint8) bool
+
+	// IsBanned 节点是否处于封禁期
+	IsBanned(id ID) bool
 }
 
 
@@ -87,6 +93,14 @@ func (p *provider) AddSeeds(seeds []*Peer) {
 	p.table.addPeers(seeds, true)
 }
 
+func (p *provider) ReportPeer(id ID, badType uint8) bool {
+	return p.table.reportPeer(id, badType)
+}
+
+func (p *provider) IsBanned(id ID) bool {
+	return p.table.isBanned(id)
+}
+
 func (p *provider) GetPeers(expect int, exclude map[ID]bool) ([]*Peer, error) {
 	return p.table.getPeers(expect, exclude), nil
 }
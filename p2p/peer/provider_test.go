@@ -301,6 +301,12 @@ func (t *tableMock) getPeersToGetNeighbours() []*Peer {
 func (t *tableMock) recvPing(p *Peer) {}
 func (t *tableMock) recvPong(p *Peer) {}
 func (t *tableMock) refresh()         {}
+func (t *tableMock) reportPeer(id ID, badType uint8) bool {
+	return false
+}
+func (t *tableMock) isBanned(id ID) bool {
+	return false
+}
 
 ////////////////////////////////////////////////udpServerMock
 
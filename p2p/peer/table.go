@@ -19,6 +19,10 @@ type table interface {
 	recvPing(p *Peer)
 	recvPong(p *Peer)
 
+	// 报告节点作恶，返回节点是否被封禁
+	reportPeer(id ID, badType uint8) bool
+	isBanned(id ID) bool
+
 	refresh()
 }
 
@@ -189,6 +193,7 @@ func (t *tableImp) recvPing(p *Peer) {
 	// 移除可能的过期节点(不可达状态)，转移到peers下
 	if peer, ok := t.expiredPeers[p.ID]; ok {
 		peer.recoverFromExpired()
+		peer.Peer = p // 更新为ping的来源地址
 		t.peers[p.ID] = peer
 		delete(t.expiredPeers, p.ID)
 	}
@@ -216,6 +221,55 @@ func (t *tableImp) recvPong(p *Peer) {
 	}
 }
 
+// 报告节点作恶，扣除信誉分；信誉分耗尽的节点立即移入bannedPeers。种子节点只记录，不封禁
+// 表中没有的节点（例如只通过TCP链接过来的节点）记入expiredPeers，待其ping通后带着信誉记录移回peers
+func (t *tableImp) reportPeer(id ID, badType uint8) bool {
+	t.Lock()
+	defer t.Unlock()
+
+	if banned, ok := t.bannedPeers[id]; ok {
+		if banned.isBanned() {
+			return true
+		}
+		// 封禁期已过但尚未刷新，先解封再记录本次作恶
+		t.unban(banned)
+	}
+	if seed, ok := t.seeds[id]; ok {
+		seed.recordBad(badType)
+		return false
+	}
+
+	peer, inPeers := t.peers[id]
+	if !inPeers {
+		var ok bool
+		if peer, ok = t.expiredPeers[id]; !ok {
+			peer = newState(&Peer{ID: id}, false)
+			t.expiredPeers[id] = peer
+		}
+	}
+
+	peer.recordBad(badType)
+	if peer.isHonest() {
+		return false
+	}
+
+	logger.Info("p2p peer %v turn banned, credit %d\n", peer.Peer, peer.cState.credit)
+	peer.turnBanned()
+	t.bannedPeers[id] = peer
+	delete(t.peers, id)
+	delete(t.expiredPeers, id)
+	return true
+}
+
+// isBanned 是否处于封禁期
+func (t *tableImp) isBanned(id ID) bool {
+	t.RLock()
+	defer t.RUnlock()
+
+	peer, ok := t.bannedPeers[id]
+	return ok && peer.isBanned()
+}
+
 // 刷新
 // 检查节点是否不可达/不诚实/是否过期/是否解封
 // 不诚实了要移入dishonest
@@ -246,13 +300,23 @@ func (t *tableImp) refresh() {
 	for _, peer := range t.bannedPeers {
 		// 解封
 		if curr.After(peer.cState.unbanTime) {
-			peer.recoverFromBanned()
-			t.peers[peer.ID] = peer
-			delete(t.bannedPeers, peer.ID)
+			t.unban(peer)
 		}
 	}
 }
 
+// unban helper(should call with lock) 解封节点，移出bannedPeers
+func (t *tableImp) unban(peer *state) {
+	peer.recoverFromBanned()
+	// 地址未知的节点待其ping通后再移回peers
+	if peer.IP == nil {
+		t.expiredPeers[peer.ID] = peer
+	} else {
+		t.peers[peer.ID] = peer
+	}
+	delete(t.bannedPeers, peer.ID)
+}
+
 // add helper(should call with lock)
 func (t *tableImp) add(pst *state, isSeed bool) {
 	// 种子节点
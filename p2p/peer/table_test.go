@@ -0,0 +1,82 @@
+package peer
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/azd1997/ecoin/common/crypto"
+)
+
+func TestReportPeer(t *testing.T) {
+	tb := newTable(crypto.RandID()).(*tableImp)
+	honest := NewPeer(net.ParseIP("192.168.1.2"), 10000, crypto.RandID())
+	liar := NewPeer(net.ParseIP("192.168.1.3"), 10000, crypto.RandID())
+	seed := NewPeer(net.ParseIP("192.168.1.4"), 10000, crypto.RandID())
+	tb.addPeers([]*Peer{honest, liar}, false)
+	tb.addPeers([]*Peer{seed}, true)
+
+	// 信誉分未耗尽前不封禁
+	if tb.reportPeer(honest.ID, BadSyncTimeout) || tb.reportPeer(honest.ID, BadMalformedMsg) {
+		t.Fatal("peer with credit left should not be banned")
+	}
+	if !tb.exists(honest.ID) || tb.isBanned(honest.ID) {
+		t.Fatal("honest peer should stay in peers")
+	}
+	if s := tb.peers[honest.ID]; s.cState.credit != initCredit-3 || s.cState.badRecords.BadType != BadMalformedMsg ||
+		s.cState.badRecords.Next.BadType != BadSyncTimeout {
+		t.Fatalf("unexpected credit state: %+v", s.cState)
+	}
+
+	// 伪造证明立即耗尽信誉分，移入bannedPeers，不再提供给上层
+	if !tb.reportPeer(liar.ID, BadForgedProof) {
+		t.Fatal("peer forging proof should be banned")
+	}
+	if tb.exists(liar.ID) || !tb.isBanned(liar.ID) {
+		t.Fatal("banned peer should be moved to bannedPeers")
+	}
+	for _, p := range tb.getPeers(10, nil) {
+		if p.ID == liar.ID {
+			t.Fatal("banned peer should not be provided")
+		}
+	}
+	tb.addPeers([]*Peer{liar}, false)
+	if tb.exists(liar.ID) {
+		t.Fatal("banned peer should not be added again")
+	}
+
+	// 封禁时长按次数指数增长；解封后信誉分恢复
+	banned := tb.bannedPeers[liar.ID]
+	if d := time.Until(banned.cState.unbanTime); d < defaultBanDuration-time.Minute || d > defaultBanDuration {
+		t.Fatalf("first ban duration %v, expect %v", d, defaultBanDuration)
+	}
+	banned.cState.unbanTime = time.Now().Add(-time.Second)
+	banned.dState.lastPingOKTime = time.Now()
+	tb.refresh()
+	if !tb.exists(liar.ID) || tb.isBanned(liar.ID) || banned.cState.credit != initCredit {
+		t.Fatal("peer should recover from banned")
+	}
+	tb.reportPeer(liar.ID, BadForgedProof)
+	if d := time.Until(banned.cState.unbanTime); d < defaultBanDuration*defaultBanBase-time.Minute {
+		t.Fatalf("second ban duration %v, expect %v", d, defaultBanDuration*defaultBanBase)
+	}
+
+	// 封禁期已过而尚未刷新时，新的轻微作恶先解封再计分，不视为仍被封禁
+	banned.cState.unbanTime = time.Now().Add(-time.Second)
+	banned.dState.lastPingOKTime = time.Now()
+	if tb.reportPeer(liar.ID, BadSyncTimeout) {
+		t.Fatal("peer whose ban expired should not be reported as banned")
+	}
+	if !tb.exists(liar.ID) || tb.isBanned(liar.ID) || banned.cState.credit != initCredit+CreditPolicy[BadSyncTimeout] {
+		t.Fatalf("peer should recover from expired ban before recording: %+v", banned.cState)
+	}
+
+	// 种子节点不封禁；表中没有的节点也记录信誉
+	if tb.reportPeer(seed.ID, BadForgedProof) || tb.isBanned(seed.ID) {
+		t.Fatal("seed should never be banned")
+	}
+	stranger := crypto.RandID()
+	if tb.reportPeer(stranger, BadInvalidBlock) || !tb.reportPeer(stranger, BadInvalidBlock) {
+		t.Fatal("unknown peer should be banned after credit used up")
+	}
+}
@@ -5,6 +5,7 @@ import (
 	"github.com/pkg/errors"
 
 	"github.com/azd1997/ecoin/p2p/peer"
+	"github.com/azd1997/ecoin/protocol/handshake"
 )
 
 const defaultPeerDataChanSize = 2048
@@ -32,6 +33,9 @@ type PeerData struct {
 	// Peer是发送的对端节点ID或者是接受的源节点ID
 	Peer peer.ID
 
+	// 接收时为与源节点协商得到的能力，上层据此检查消息版本；发送时忽略
+	Caps *handshake.Negotiated
+
 	// payload负载数据
 	Data []byte
 }
@@ -0,0 +1,185 @@
+package p2p
+
+import (
+	"bytes"
+	"fmt"
+	"time"
+
+	"github.com/azd1997/ecoin/common/crypto"
+	"github.com/azd1997/ecoin/protocol/handshake"
+)
+
+/*
+会话密钥轮换:
+	握手得到的会话密钥不会在整个链接期间一直使用。当前密钥加解密的字节数或使用时长达到rekeyPolicy的限制时，
+	握手发起方在会话中（handshakeProtocolID）发起一次临时密钥交换（handshake.Rekey），双方由新的临时密钥得到新的共享秘密，
+	替换两个方向的密钥，旧的临时私钥随即丢弃，因此之后泄露的密钥无法解密此前的会话（前向安全）。
+	链接不会因为换钥而中断；换钥失败（超时、消息异常）或对方迟迟不换钥时，链接出错并交由链接管理器关闭
+*/
+
+const (
+	// 默认换钥条件
+	defaultRekeyBytes    = uint64(1) << 30 // 1GiB
+	defaultRekeyInterval = time.Hour
+
+	// 配置所允许的最大换钥条件
+	MaxRekeyBytes    = uint64(1) << 35 // 32GiB
+	MaxRekeyInterval = 12 * time.Hour
+
+	// 等待REKEY_ACK的时限
+	rekeyTimeout = 10 * time.Second
+	// 检查换钥条件的周期
+	rekeyCheckPeriod = 10 * time.Second
+)
+
+// rekeyPolicy 会话密钥轮换策略
+type rekeyPolicy struct {
+	bytes    uint64        // 当前密钥加解密的字节数达到该值时换钥
+	interval time.Duration // 当前密钥使用时长达到该值时换钥
+	timeout  time.Duration // 发起方等待REKEY_ACK的时限
+	check    time.Duration // 检查周期
+
+	// 接受方不主动换钥，当前密钥的用量超过以下限制时认为对方不再换钥
+	overdueBytes    uint64
+	overdueInterval time.Duration
+}
+
+// bytes、interval为0时取默认值，超过最大值时取最大值
+func newRekeyPolicy(bytes uint64, interval time.Duration) rekeyPolicy {
+	if bytes == 0 {
+		bytes = defaultRekeyBytes
+	}
+	if bytes > MaxRekeyBytes {
+		bytes = MaxRekeyBytes
+	}
+	if interval <= 0 {
+		interval = defaultRekeyInterval
+	}
+	if interval > MaxRekeyInterval {
+		interval = MaxRekeyInterval
+	}
+
+	return rekeyPolicy{
+		bytes:           bytes,
+		interval:        interval,
+		timeout:         rekeyTimeout,
+		check:           rekeyCheckPeriod,
+		overdueBytes:    2 * MaxRekeyBytes,
+		overdueInterval: 2 * MaxRekeyInterval,
+	}
+}
+
+// 周期性检查是否需要换钥。只在链接工作循环中调用
+func (c *conn) checkRekey() error {
+	used, age := c.ec.usage()
+
+	if !c.ec.isInitiator() {
+		if used >= c.rekey.overdueBytes || age >= c.rekey.overdueInterval {
+			return ErrRekeyOverdue
+		}
+		return nil
+	}
+
+	// 正在等待对方回应
+	if c.rekeyPriv != nil {
+		if time.Since(c.rekeyAt) > c.rekey.timeout {
+			return ErrRekeyTimeout
+		}
+		return nil
+	}
+
+	if used < c.rekey.bytes && age < c.rekey.interval {
+		return nil
+	}
+	return c.startRekey()
+}
+
+// 发起方生成新的临时私钥，发起换钥
+func (c *conn) startRekey() error {
+	priv, err := crypto.NewPrivateKeyS256()
+	if err != nil {
+		return err
+	}
+
+	msg := handshake.NewRekey(handshake.REKEY_INIT, priv.PubKey().SerializeCompressed())
+	if err := c.sendAndRekey(handshakeProtocolID, msg.Encode(), nil); err != nil {
+		return err
+	}
+	c.rekeyPriv, c.rekeyAt = priv, time.Now()
+
+	logger.Debug("start session rekey with %v\n", c.p.ID)
+	return nil
+}
+
+// 处理会话中的换钥消息。只在链接工作循环中调用
+func (c *conn) handleRekey(data []byte) error {
+	msg := &handshake.Rekey{}
+	if err := msg.Decode(bytes.NewReader(data)); err != nil {
+		return ErrRekeyBrokenData{info: fmt.Sprintf("decode rekey message failed: %v", err)}
+	}
+
+	switch msg.Type {
+	case handshake.REKEY_INIT:
+		if c.ec.isInitiator() || c.rekeyShared != nil {
+			return ErrRekeyUnexpected{msgType: msg.Type}
+		}
+		shared, pub, err := rekeyShared(msg.SessionKey, nil)
+		if err != nil {
+			return err
+		}
+		// 回应仍用旧密钥加密，此后改用新密钥发送
+		ack := handshake.NewRekey(handshake.REKEY_ACK, pub)
+		if err := c.sendAndRekey(handshakeProtocolID, ack.Encode(), shared); err != nil {
+			return err
+		}
+		c.rekeyShared = shared
+
+	case handshake.REKEY_ACK:
+		if !c.ec.isInitiator() || c.rekeyPriv == nil {
+			return ErrRekeyUnexpected{msgType: msg.Type}
+		}
+		shared, _, err := rekeyShared(msg.SessionKey, c.rekeyPriv)
+		if err != nil {
+			return err
+		}
+		c.rekeyPriv = nil
+		// 对方此后的帧使用新密钥
+		if err := c.ec.rekeyRecv(shared); err != nil {
+			return err
+		}
+		done := handshake.NewRekey(handshake.REKEY_DONE, nil)
+		if err := c.sendAndRekey(handshakeProtocolID, done.Encode(), shared); err != nil {
+			return err
+		}
+		logger.Debug("session rekey with %v done\n", c.p.ID)
+
+	case handshake.REKEY_DONE:
+		if c.ec.isInitiator() || c.rekeyShared == nil {
+			return ErrRekeyUnexpected{msgType: msg.Type}
+		}
+		shared := c.rekeyShared
+		c.rekeyShared = nil
+		if err := c.ec.rekeyRecv(shared); err != nil {
+			return err
+		}
+
+	default:
+		return ErrRekeyUnexpected{msgType: msg.Type}
+	}
+
+	return nil
+}
+
+// 由对方新的临时公钥与自己新的临时私钥得到共享秘密。priv为空时生成新的临时私钥，并返回其公钥
+func rekeyShared(remote []byte, priv *crypto.PrivateKey) ([]byte, []byte, error) {
+	remotePub, err := crypto.ParsePubKeyS256(remote)
+	if err != nil {
+		return nil, nil, ErrRekeyBrokenData{info: fmt.Sprintf("parse rekey session public key failed: %v", err)}
+	}
+	if priv == nil {
+		if priv, err = crypto.NewPrivateKeyS256(); err != nil {
+			return nil, nil, err
+		}
+	}
+	return crypto.GenerateSharedSecret(priv, remotePub), priv.PubKey().SerializeCompressed(), nil
+}
@@ -0,0 +1,274 @@
+package p2p
+
+import (
+	"bytes"
+	"math"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/azd1997/ecoin/account/role"
+	"github.com/azd1997/ecoin/common/crypto"
+	"github.com/azd1997/ecoin/p2p/peer"
+	"github.com/azd1997/ecoin/protocol/handshake"
+)
+
+// 记录全部发送的数据包
+type tcpConnQueueMock struct {
+	*tcpConnMock
+	sent [][]byte
+}
+
+func (t *tcpConnQueueMock) Send(data []byte) {
+	t.sent = append(t.sent, data)
+}
+
+// 取出已发送的数据包
+func (t *tcpConnQueueMock) take() [][]byte {
+	result := t.sent
+	t.sent = nil
+	return result
+}
+
+type rekeyTestConn struct {
+	*conn
+	nc   *tcpConnQueueMock
+	recv [][]byte
+}
+
+func newRekeyTestConns(t *testing.T, policy rekeyPolicy) (*rekeyTestConn, *rekeyTestConn) {
+	initiatorKey, _ := crypto.NewPrivateKeyS256()
+	responderKey, _ := crypto.NewPrivateKeyS256()
+	initiatorCodec, err := newAESGCMCodec(responderKey.PubKey(), initiatorKey, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	responderCodec, err := newAESGCMCodec(initiatorKey.PubKey(), responderKey, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	newTestConn := func(ec codec) *rekeyTestConn {
+		priv, _ := crypto.NewPrivateKeyS256()
+		p := peer.NewPeer(net.ParseIP("127.0.0.1"), 10000, crypto.PrivateKey2ID(priv, role.HOSPITAL))
+		tc := &rekeyTestConn{nc: &tcpConnQueueMock{tcpConnMock: newTCPConnMock()}}
+		tc.conn = newConn(p, tc.nc, ec, func(p *peer.Peer, protocolID uint8, data []byte) {
+			tc.recv = append(tc.recv, data)
+		}, policy)
+		return tc
+	}
+	return newTestConn(initiatorCodec), newTestConn(responderCodec)
+}
+
+// 将from已发送的数据包交给to处理
+func deliver(t *testing.T, from, to *rekeyTestConn) {
+	for _, pkt := range from.nc.take() {
+		if err := to.recvPacket(pkt); err != nil {
+			t.Fatalf("recv packet failed: %v", err)
+		}
+	}
+}
+
+func TestConnRekey(t *testing.T) {
+	policy := newRekeyPolicy(64, time.Hour)
+	a, b := newRekeyTestConns(t, policy)
+
+	a.send(1, []byte("before rekey"))
+	deliver(t, a, b)
+	if err := a.checkRekey(); err != nil || a.rekeyPriv != nil {
+		t.Fatalf("should not rekey under the limit: %v", err)
+	}
+
+	// 用量达到限制，发起方发起换钥；换钥期间双方照常收发数据
+	a.send(1, make([]byte, 64))
+	if err := a.checkRekey(); err != nil || a.rekeyPriv == nil {
+		t.Fatalf("should start rekey over the limit: %v", err)
+	}
+	a.send(1, []byte("a old key"))
+	deliver(t, a, b) // b收到REKEY_INIT，回应REKEY_ACK并改用新密钥发送
+	if b.rekeyShared == nil {
+		t.Fatal("responder should wait for REKEY_DONE")
+	}
+	b.send(1, []byte("b new key"))
+	deliver(t, b, a) // a收到REKEY_ACK，改用新密钥接收，发出REKEY_DONE后改用新密钥发送
+	if a.rekeyPriv != nil {
+		t.Fatal("initiator should finish rekey")
+	}
+	a.send(1, []byte("a new key"))
+	deliver(t, a, b)
+	if b.rekeyShared != nil {
+		t.Fatal("responder should finish rekey")
+	}
+
+	expectA := []string{"b new key"}
+	expectB := []string{"before rekey", string(make([]byte, 64)), "a old key", "a new key"}
+	for _, x := range []struct {
+		recv   [][]byte
+		expect []string
+	}{{a.recv, expectA}, {b.recv, expectB}} {
+		if len(x.recv) != len(x.expect) {
+			t.Fatalf("recv %d messages, expect %d", len(x.recv), len(x.expect))
+		}
+		for i := range x.recv {
+			if string(x.recv[i]) != x.expect[i] {
+				t.Fatalf("message %d: %q, expect %q", i, x.recv[i], x.expect[i])
+			}
+		}
+	}
+
+	// 新密钥的用量从0开始统计
+	if used, _ := a.ec.usage(); used >= policy.bytes {
+		t.Fatalf("usage should be reset after rekey, but %d", used)
+	}
+	if err := a.checkRekey(); err != nil || a.rekeyPriv != nil {
+		t.Fatalf("should not rekey again: %v", err)
+	}
+}
+
+func TestConnRekeyFailed(t *testing.T) {
+	policy := newRekeyPolicy(64, time.Hour)
+	policy.timeout = 10 * time.Millisecond
+	policy.overdueBytes = 128
+
+	// 对方不回应
+	a, b := newRekeyTestConns(t, policy)
+	a.rekey.bytes = 1
+	a.send(1, []byte("data"))
+	if err := a.checkRekey(); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(2 * policy.timeout)
+	if err := a.checkRekey(); err != ErrRekeyTimeout {
+		t.Fatalf("expect ErrRekeyTimeout, but %v", err)
+	}
+
+	// 接受方不会主动发起换钥，也不接受发起方的消息
+	a, b = newRekeyTestConns(t, policy)
+	b.sendAndRekey(handshakeProtocolID, handshake.NewRekey(handshake.REKEY_INIT, nil).Encode(), nil)
+	if err := a.recvPacket(b.nc.take()[0]); err == nil {
+		t.Fatal("initiator should reject REKEY_INIT")
+	}
+	a, b = newRekeyTestConns(t, policy)
+	a.sendAndRekey(handshakeProtocolID, handshake.NewRekey(handshake.REKEY_DONE, nil).Encode(), nil)
+	if err := b.recvPacket(a.nc.take()[0]); err == nil {
+		t.Fatal("responder should reject REKEY_DONE without REKEY_INIT")
+	}
+
+	// 发起方一直不换钥
+	a, b = newRekeyTestConns(t, policy)
+	a.send(1, make([]byte, 128))
+	deliver(t, a, b)
+	if err := b.checkRekey(); err != ErrRekeyOverdue {
+		t.Fatalf("expect ErrRekeyOverdue, but %v", err)
+	}
+}
+
+func TestConnManagerRemoveFailedConn(t *testing.T) {
+	policy := newRekeyPolicy(0, 0)
+	policy.check = 10 * time.Millisecond
+	policy.timeout = 10 * time.Millisecond
+	policy.bytes = 1
+	a, _ := newRekeyTestConns(t, policy)
+
+	cm := newConnManager(4, ConnPolicy{}, policy).(*connManagerImp)
+	cm.start()
+	defer cm.stop()
+	if err := cm.add(a.p, a.nc, a.ec, a.handler, false); err != nil {
+		t.Fatal(err)
+	}
+	cm.RLock()
+	cm.conns[a.p.ID].send(1, []byte("data"))
+	cm.RUnlock()
+
+	// 对方不回应换钥，链接出错并被移除
+	for i := 0; cm.isExist(a.p.ID); i++ {
+		if i > 100 {
+			t.Fatal("failed connection should be removed")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestConnMaxMsgSize(t *testing.T) {
+	a, b := newRekeyTestConns(t, newRekeyPolicy(1<<20, time.Hour))
+	a.p.Caps = &handshake.Negotiated{MaxMsgSize: 8}
+	b.p.Caps = &handshake.Negotiated{MaxMsgSize: 8}
+
+	// 超过协商的长度不发送
+	if err := a.send(1, make([]byte, 9)); err == nil {
+		t.Fatal("oversize message should not be sent")
+	} else if _, ok := err.(ErrMsgTooLarge); !ok {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(a.nc.sent) != 0 {
+		t.Fatal("oversize message should not reach the connection")
+	}
+	if err := a.send(1, make([]byte, 8)); err != nil {
+		t.Fatal(err)
+	}
+	deliver(t, a, b)
+
+	// 对方违反约定发来超长消息，链接出错
+	a.p.Caps.MaxMsgSize = 16
+	if err := a.send(1, make([]byte, 12)); err != nil {
+		t.Fatal(err)
+	}
+	for _, pkt := range a.nc.take() {
+		if _, ok := b.recvPacket(pkt).(ErrMsgTooLarge); !ok {
+			t.Fatal("oversize message should be rejected by receiver")
+		}
+	}
+	if len(b.recv) != 1 {
+		t.Fatalf("recv %d messages, expect 1", len(b.recv))
+	}
+}
+
+func TestConnSendFailed(t *testing.T) {
+	a, _ := newRekeyTestConns(t, newRekeyPolicy(1<<20, time.Hour))
+	var failed error
+	a.onError = func(err error) { failed = err }
+
+	// 帧计数用尽，加密失败须返回给调用方，同时链接出错
+	a.ec.(*aesgcmCodec).sendSeq = math.MaxUint64
+	if err := a.send(1, []byte("data")); err != ErrCodecExhausted {
+		t.Fatalf("send should fail with %v, got %v", ErrCodecExhausted, err)
+	}
+	if failed != ErrCodecExhausted {
+		t.Fatalf("connection should fail with %v, got %v", ErrCodecExhausted, failed)
+	}
+}
+
+func TestTCPSplitterMaxFrame(t *testing.T) {
+	s := newTCPSplitter()
+	s.setMaxMsgSize(&handshake.Negotiated{MaxMsgSize: 8})
+
+	// 不超过上限的帧正常分割，不完整的帧留待后续数据
+	buf := new(bytes.Buffer)
+	buf.Write(buildTCPPacket(make([]byte, 8+frameOverhead), 1))
+	buf.Write(buildTCPPacket(make([]byte, 4), handshakeProtocolID)[:tcpHeaderSize+1])
+	pkts, err := s.split(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pkts) != 1 {
+		t.Fatalf("split %d packets, expect 1", len(pkts))
+	}
+
+	// 头部声明超长，包括握手协议帧，只凭头部即拒绝
+	for _, protocolID := range []uint8{1, handshakeProtocolID} {
+		buf := new(bytes.Buffer)
+		buf.Write(buildTCPPacket(make([]byte, 9+frameOverhead), protocolID)[:tcpHeaderSize+1])
+		if _, err := s.split(buf); err == nil {
+			t.Fatalf("protocol %d: oversize frame should be rejected", protocolID)
+		} else if _, ok := err.(ErrFrameTooLarge); !ok {
+			t.Fatalf("protocol %d: unexpected error: %v", protocolID, err)
+		}
+	}
+
+	// 握手前使用默认上限
+	buf = new(bytes.Buffer)
+	buf.Write(buildTCPPacket(make([]byte, 9+frameOverhead), handshakeProtocolID))
+	if pkts, err := newTCPSplitter().split(buf); err != nil || len(pkts) != 1 {
+		t.Fatalf("frame within default limit should be split, err %v", err)
+	}
+}
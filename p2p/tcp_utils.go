@@ -5,6 +5,10 @@ import (
 	"encoding/binary"
 	"github.com/azd1997/ecoin/common/utils"
 	"hash/crc32"
+	"net"
+	"sync/atomic"
+
+	"github.com/azd1997/ecoin/protocol/handshake"
 )
 
 /*
@@ -40,18 +44,44 @@ func buildTCPPacket(payload []byte, protocolID uint8) []byte {
 	return buf.Bytes()
 }
 
+// tcpSplitter 按帧长度上限分割TCP字节流，每个链接一个
+// 握手前上限为默认的最大消息长度，握手后收紧为协商值。 上限均加上会话帧的加密开销
+type tcpSplitter struct {
+	maxMsgSize uint32 // 原子操作
+}
+
+func newTCPSplitter() *tcpSplitter {
+	return &tcpSplitter{maxMsgSize: handshake.DefaultMaxMsgSize}
+}
+
+// 设置为与对方协商的最大消息长度，未协商时不变
+func (s *tcpSplitter) setMaxMsgSize(caps *handshake.Negotiated) {
+	if caps == nil || caps.MaxMsgSize == 0 {
+		return
+	}
+	atomic.StoreUint32(&s.maxMsgSize, caps.MaxMsgSize)
+}
+
+// 帧payload长度上限
+func (s *tcpSplitter) maxFrameSize() uint32 {
+	return atomic.LoadUint32(&s.maxMsgSize) + frameOverhead
+}
+
 // 从TCP连接读取的数据存入缓冲bytes.Buffer，而本函数则读取bytes.Buffer将数据分割成一个个的packet
-func splitTCPStream(received *bytes.Buffer) ([][]byte, error) {
+// 头部声明的长度超过上限时立即报错，不等待（缓冲）其余数据
+func (s *tcpSplitter) split(received *bytes.Buffer) ([][]byte, error) {
 	var length uint32
 	var packets [][]byte
 
+	max := s.maxFrameSize()
 	for received.Len() > tcpHeaderSize {
-		// peeker' reading has no effect on received
-		peeker := bytes.NewReader(received.Bytes())
-		binary.Read(peeker, binary.BigEndian, &length)
+		length = binary.BigEndian.Uint32(received.Bytes())
+		if length > max {
+			return nil, ErrFrameTooLarge{length: length, max: max}
+		}
 
-		packetLen := tcpHeaderSize + length
-		if received.Len() < int(packetLen) {
+		packetLen := tcpHeaderSize + int(length)
+		if received.Len() < packetLen {
 			break
 		}
 
@@ -87,3 +117,19 @@ func verifyTCPPacket(packet []byte) (bool, []byte, uint8) {
 
 	return true, payload, protocolID
 }
+
+// 链接对端的IP，无法解析时返回nil
+func remoteIP(conn TCPConn) net.IP {
+	addr := conn.RemoteAddr()
+	if addr == nil {
+		return nil
+	}
+	if tcpAddr, ok := addr.(*net.TCPAddr); ok {
+		return tcpAddr.IP
+	}
+	host, _, err := net.SplitHostPort(addr.String())
+	if err != nil {
+		return nil
+	}
+	return net.ParseIP(host)
+}
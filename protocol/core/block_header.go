@@ -140,6 +140,14 @@ func (b *BlockHeader) CalcHash() []byte {
 	return h
 }
 
+// VerifyHash 检查区块哈希是否与区块头内容相符。与本地视图无关，不符说明区块头被篡改或伪造
+func (b *BlockHeader) VerifyHash() error {
+	if h := b.CalcHash(); !bytes.Equal(b.Hash, h) {
+		return fmt.Errorf("block hash mismatch, expect %X, got %X", h, b.Hash)
+	}
+	return nil
+}
+
 // 是否为空默克尔根
 func (b *BlockHeader) IsEmptyMerkleRoot() bool {
 	return bytes.Equal(b.MerkleRoot, EmptyMerkleRoot)
@@ -0,0 +1,94 @@
+package core
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+
+	"github.com/azd1997/ecoin/common/crypto"
+	"github.com/azd1997/ecoin/enode/bc/merkle"
+)
+
+// 上传数据的承诺
+// 上传交易的TargetInfo.Merkle是对数据仓库中各段数据记录（按时间先后，加密后的原样）的默克尔根，
+// 叶子为各段记录的哈希。购买方、仲裁者取到数据后可对照链上的承诺检验，
+// worker在接受上传交易前可对数据仓库做随机抽样挑战：抽取若干段记录及其默克尔证明，检验是否与承诺一致
+
+// SegmentLeaf 数据记录在默克尔树中的叶子
+func SegmentLeaf(segment []byte) []byte {
+	return crypto.HashD(segment)
+}
+
+func segmentLeafs(segments [][]byte) merkle.MerkleLeafs {
+	leafs := make(merkle.MerkleLeafs, len(segments))
+	for i, segment := range segments {
+		leafs[i] = SegmentLeaf(segment)
+	}
+	return leafs
+}
+
+// CommitSegments 计算各段数据记录的默克尔根
+func CommitSegments(segments [][]byte) ([]byte, error) {
+	if len(segments) == 0 {
+		return nil, errors.New("no segment to commit")
+	}
+	return merkle.ComputeRoot(segmentLeafs(segments))
+}
+
+// SegmentProof 第index段数据记录的默克尔证明
+func SegmentProof(segments [][]byte, index int) (merkle.MerkleProof, error) {
+	return merkle.ComputeProof(segmentLeafs(segments), index)
+}
+
+// NewTargetInfo 构造上传数据的摘要，segments为存储在storeAt中、采集时间在[start, end]内的各段数据记录
+func NewTargetInfo(storeAt string, typ, ill uint8, start, end int64, segments [][]byte) (*TargetInfo, error) {
+	root, err := CommitSegments(segments)
+	if err != nil {
+		return nil, err
+	}
+	return &TargetInfo{
+		StoreAt:   storeAt,
+		Type:      typ,
+		Ill:       ill,
+		TimeStart: start,
+		TimeEnd:   end,
+		Num:       int64(len(segments)),
+		Merkle:    root,
+	}, nil
+}
+
+// CheckSegments 检验取回的全部数据记录是否与承诺一致
+func (ti *TargetInfo) CheckSegments(segments [][]byte) bool {
+	if int64(len(segments)) != ti.Num {
+		return false
+	}
+	root, err := CommitSegments(segments)
+	return err == nil && bytes.Equal(root, ti.Merkle)
+}
+
+// CheckSegment 检验第index段数据记录及其默克尔证明是否与承诺一致
+func (ti *TargetInfo) CheckSegment(index int, segment []byte, proof merkle.MerkleProof) bool {
+	return merkle.VerifyProof(ti.Merkle, SegmentLeaf(segment), index, int(ti.Num), proof)
+}
+
+// SampleIndexes 随机抽取min(k, Num)段不重复的数据记录的序号，用于抽样挑战
+func (ti *TargetInfo) SampleIndexes(k int) []int {
+	if int64(k) > ti.Num {
+		k = int(ti.Num)
+	}
+	picked := make(map[int]bool)
+	var result []int
+	buf := make([]byte, 8)
+	for len(result) < k {
+		if _, err := rand.Read(buf); err != nil {
+			break
+		}
+		i := int(binary.BigEndian.Uint64(buf) % uint64(ti.Num))
+		if !picked[i] {
+			picked[i] = true
+			result = append(result, i)
+		}
+	}
+	return result
+}
@@ -0,0 +1,79 @@
+package core
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/azd1997/ecoin/account/role"
+	"github.com/azd1997/ecoin/common/crypto"
+)
+
+func TestTargetInfoCommitment(t *testing.T) {
+	var segments [][]byte
+	for i := 0; i < 5; i++ {
+		segments = append(segments, []byte(fmt.Sprintf("segment_%d", i)))
+	}
+	end := time.Now().Unix() - 1
+	ti, err := NewTargetInfo("file:///data", 1, 0, end-60, end, segments)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ti.Num != 5 || !ti.formatOK() {
+		t.Fatalf("unexpected target info %s", ti)
+	}
+
+	// 全部记录
+	if !ti.CheckSegments(segments) {
+		t.Fatal("expect segments match commitment")
+	}
+	tampered := append([][]byte{}, segments...)
+	tampered[2] = []byte("tampered")
+	if ti.CheckSegments(tampered) || ti.CheckSegments(segments[:4]) {
+		t.Fatal("expect tampered or missing segments mismatch commitment")
+	}
+
+	// 单条记录及其证明
+	for i := range segments {
+		proof, err := SegmentProof(segments, i)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !ti.CheckSegment(i, segments[i], proof) {
+			t.Fatalf("[%d] expect segment match commitment", i)
+		}
+		if ti.CheckSegment(i, tampered[2], proof) {
+			t.Fatalf("[%d] expect tampered segment mismatch commitment", i)
+		}
+	}
+
+	// 抽样不重复且不越界
+	indexes := ti.SampleIndexes(3)
+	seen := make(map[int]bool)
+	for _, i := range indexes {
+		if i < 0 || i >= 5 || seen[i] {
+			t.Fatalf("invalid sample indexes %v", indexes)
+		}
+		seen[i] = true
+	}
+	if len(indexes) != 3 || len(ti.SampleIndexes(10)) != 5 {
+		t.Fatalf("unexpected sample size")
+	}
+
+	// 上传交易须包含承诺
+	patientKey, _ := crypto.NewPrivateKeyS256()
+	patient := crypto.PrivateKey2ID(patientKey, role.PATIENT)
+	hospitalKey, _ := crypto.NewPrivateKeyS256()
+	hospital := crypto.PrivateKey2ID(hospitalKey, role.HOSPITAL)
+	upload := NewTx(TX_UPLOAD, patient, hospital, 0, ti.Encode(), nil, 0, nil)
+	upload.Sign(patientKey)
+	if err := upload.Verify(); err != nil {
+		t.Fatalf("verify upload: %v", err)
+	}
+	ti.Merkle = nil
+	upload = NewTx(TX_UPLOAD, patient, hospital, 0, ti.Encode(), nil, 0, nil)
+	upload.Sign(patientKey)
+	if err := upload.Verify(); err == nil {
+		t.Fatal("expect upload without commitment invalid")
+	}
+}
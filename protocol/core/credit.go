@@ -0,0 +1,106 @@
+package core
+
+import (
+	"bytes"
+	"encoding/gob"
+	"io"
+
+	"github.com/pkg/errors"
+
+	"github.com/azd1997/ecoin/common/crypto"
+	"github.com/azd1997/ecoin/common/encoding"
+)
+
+// 信用积分
+// 账户的信用积分由链上记录确定性地计算得到，所有节点的结果相同。账户初始积分为CreditInit，
+// 在仲裁中被判定作恶、上传的数据在仲裁中无法解开、PoT竞争胜出却未出块都会被扣分。
+// 积分降至CreditBanLine及以下的账户被封禁，不能再发起交易
+
+const (
+	CreditInit          = 100 // 初始信用积分
+	CreditBanLine       = 0   // 封禁线
+	CreditArbitrateLoss = 20  // 在仲裁中被判定作恶
+	CreditBadUpload     = 10  // 每段在仲裁中无法解开的目标数据
+	CreditMissedBlock   = 10  // PoT竞争胜出却未出块
+)
+
+// CreditBanned 信用积分为credit的账户是否被封禁
+func CreditBanned(credit int64) bool {
+	return credit <= CreditBanLine
+}
+
+// MissedWinners coinbase交易的Payload：基于同一父区块胜出却未出块的胜者的证明
+// 由接替出块的worker记录，胜者证明带有胜者本人的签名，无法伪造
+type MissedWinners struct {
+	Proofs []*PoTProof
+}
+
+func (mw *MissedWinners) Encode() []byte {
+	res, _ := encoding.GobEncode(mw)
+	return res
+}
+
+func (mw *MissedWinners) Decode(data io.Reader) error {
+	err := gob.NewDecoder(data).Decode(mw)
+	if err != nil {
+		return errors.Wrap(err, "MissedWinners_Decode")
+	}
+	return nil
+}
+
+// 证明须有效，且每个胜者只记录一次
+func (mw *MissedWinners) formatOK() bool {
+	if len(mw.Proofs) == 0 {
+		return false
+	}
+	seen := make(map[crypto.ID]bool)
+	for _, p := range mw.Proofs {
+		if p == nil || p.Verify() != nil || seen[p.From] {
+			return false
+		}
+		seen[p.From] = true
+	}
+	return true
+}
+
+// Missed coinbase交易所记录的未出块胜者的证明
+func (tx *Tx) Missed() []*PoTProof {
+	if tx.Type != TX_COINBASE || len(tx.Payload) == 0 {
+		return nil
+	}
+	mw := &MissedWinners{}
+	if err := mw.Decode(bytes.NewReader(tx.Payload)); err != nil {
+		return nil
+	}
+	return mw.Proofs
+}
+
+// CreditDeltas 交易带来的信用积分变动
+// 仲裁交易：e为被仲裁流程的托管款项，据此确定交易双方。被判定作恶的一方扣分；
+// 响应方作恶时，每段无法解开的目标数据另行扣分
+// coinbase交易：所记录的未出块胜者扣分
+func CreditDeltas(tx *Tx, e *Escrow) map[crypto.ID]int64 {
+	result := make(map[crypto.ID]int64)
+	switch tx.Type {
+	case TX_ARBITRATE:
+		ta := &TargetArbitrate{}
+		if e == nil || ta.Decode(bytes.NewReader(tx.Payload)) != nil {
+			break
+		}
+		if !ta.Bad {
+			result[e.Requester] -= CreditArbitrateLoss
+			break
+		}
+		result[e.Responder] -= CreditArbitrateLoss
+		for _, ok := range ta.Arbs {
+			if !ok {
+				result[e.Responder] -= CreditBadUpload
+			}
+		}
+	case TX_COINBASE:
+		for _, p := range tx.Missed() {
+			result[p.From] -= CreditMissedBlock
+		}
+	}
+	return result
+}
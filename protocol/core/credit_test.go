@@ -0,0 +1,58 @@
+package core
+
+import (
+	"testing"
+
+	"github.com/azd1997/ecoin/account/role"
+	"github.com/azd1997/ecoin/common/crypto"
+)
+
+func TestCreditDeltas(t *testing.T) {
+	newID := func(roleNo uint8) (*crypto.PrivateKey, crypto.ID) {
+		priv, _ := crypto.NewPrivateKeyS256()
+		return priv, crypto.PrivateKey2ID(priv, roleNo)
+	}
+	_, researcher := newID(role.RESEARCHER)
+	_, patient := newID(role.PATIENT)
+	workerKey, worker := newID(role.HOSPITAL)
+	missedKey, missed := newID(role.HOSPITAL)
+	e := &Escrow{Requester: researcher, Responder: patient}
+
+	// 请求方作恶
+	ta := &TargetArbitrate{Arbs: []bool{true}}
+	arb := NewTx(TX_ARBITRATE, worker, "", 0, ta.Encode(), crypto.RandHash(), 0, nil)
+	if d := CreditDeltas(arb, e); d[researcher] != -CreditArbitrateLoss || len(d) != 1 {
+		t.Fatalf("expect requester lose credit, result %v", d)
+	}
+	// 没有托管记录时无法确定交易双方
+	if d := CreditDeltas(arb, nil); len(d) != 0 {
+		t.Fatalf("expect no delta without escrow, result %v", d)
+	}
+
+	// coinbase记录未出块的胜者
+	base := crypto.RandHash()
+	proof := NewPoTProof(missed, 1, crypto.RandHash(), base)
+	proof.Sign(missedKey)
+	payload := (&MissedWinners{Proofs: []*PoTProof{proof}}).Encode()
+	coinbase := NewTx(TX_COINBASE, crypto.ZeroID, worker, 1, payload, crypto.ZeroHash, 0, nil)
+	coinbase.Sign(workerKey)
+	if err := coinbase.Verify(); err != nil {
+		t.Fatalf("verify coinbase with missed winners: %v", err)
+	}
+	if d := CreditDeltas(coinbase, nil); d[missed] != -CreditMissedBlock || len(d) != 1 {
+		t.Fatalf("expect missed winner lose credit, result %v", d)
+	}
+
+	// 胜者证明须带有胜者本人的签名
+	proof.Sig = nil
+	payload = (&MissedWinners{Proofs: []*PoTProof{proof}}).Encode()
+	coinbase = NewTx(TX_COINBASE, crypto.ZeroID, worker, 1, payload, crypto.ZeroHash, 0, nil)
+	coinbase.Sign(workerKey)
+	if err := coinbase.Verify(); err == nil {
+		t.Fatal("expect coinbase with unsigned proof invalid")
+	}
+
+	if !CreditBanned(CreditBanLine) || CreditBanned(CreditInit) {
+		t.Fatal("unexpected ban line")
+	}
+}
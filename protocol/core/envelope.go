@@ -0,0 +1,101 @@
+package core
+
+import (
+	"github.com/azd1997/ecoin/common/crypto"
+)
+
+// 交易Payload中的数据密钥以密钥信封（见crypto.KeyEnvelope）的形式给出，只有接收方能打开
+// 旧的明文密钥仍然可以被读取
+
+// NewTargetKey 将各段目标数据的密钥keys包装给recipients，作为TxP2R的Payload
+func NewTargetKey(keys [][]byte, recipients ...crypto.ID) (*TargetKey, error) {
+	wrapped, err := wrapKeys(keys, recipients)
+	if err != nil {
+		return nil, err
+	}
+	return &TargetKey{Keys: wrapped}, nil
+}
+
+// OpenKeys 接收方id使用私钥取出各段目标数据的密钥
+func (tk *TargetKey) OpenKeys(id crypto.ID, priv *crypto.PrivateKey) ([][]byte, error) {
+	return openKeys(tk.Keys, id, priv)
+}
+
+// NewTargetDataWithKey 目标数据hashes及其密钥keys，密钥包装给recipients，作为TxP2H/P2D的Payload
+func NewTargetDataWithKey(hashes []crypto.Hash, keys [][]byte, recipients ...crypto.ID) (*TargetDataWithKey, error) {
+	wrapped, err := wrapKeys(keys, recipients)
+	if err != nil {
+		return nil, err
+	}
+	return &TargetDataWithKey{Hashes: hashes, Keys: wrapped}, nil
+}
+
+// OpenKeys 接收方id使用私钥取出各段目标数据的密钥
+func (tdk *TargetDataWithKey) OpenKeys(id crypto.ID, priv *crypto.PrivateKey) ([][]byte, error) {
+	return openKeys(tdk.Keys, id, priv)
+}
+
+// Recipients 能打开全部密钥的接收方。存在旧的明文密钥（任何人都能读取）或没有密钥时返回false
+func (tk *TargetKey) Recipients() ([]crypto.ID, bool) {
+	return keyRecipients(tk.Keys)
+}
+
+// Recipients 能打开全部密钥的接收方。存在旧的明文密钥（任何人都能读取）或没有密钥时返回false
+func (tdk *TargetDataWithKey) Recipients() ([]crypto.ID, bool) {
+	return keyRecipients(tdk.Keys)
+}
+
+func wrapKeys(keys [][]byte, recipients []crypto.ID) ([][]byte, error) {
+	wrapped := make([][]byte, len(keys))
+	for i, key := range keys {
+		env, err := crypto.WrapKey(key, recipients...)
+		if err != nil {
+			return nil, err
+		}
+		wrapped[i] = env.Encode()
+	}
+	return wrapped, nil
+}
+
+func openKeys(keys [][]byte, id crypto.ID, priv *crypto.PrivateKey) ([][]byte, error) {
+	opened := make([][]byte, len(keys))
+	for i, key := range keys {
+		var err error
+		if opened[i], err = crypto.OpenKey(key, id, priv); err != nil {
+			return nil, err
+		}
+	}
+	return opened, nil
+}
+
+// 各个密钥信封共同的接收方。无法解码的信封谁也打不开
+func keyRecipients(keys [][]byte) ([]crypto.ID, bool) {
+	if len(keys) == 0 {
+		return nil, false
+	}
+	var result []crypto.ID
+	for i, key := range keys {
+		if !crypto.IsKeyEnvelope(key) {
+			return nil, false
+		}
+		env, err := crypto.DecodeKeyEnvelope(key)
+		if err != nil {
+			return nil, true
+		}
+		if i == 0 {
+			result = append(result, env.Recipients...)
+			continue
+		}
+		var common []crypto.ID
+		for _, id := range result {
+			for _, r := range env.Recipients {
+				if id == r {
+					common = append(common, id)
+					break
+				}
+			}
+		}
+		result = common
+	}
+	return result, true
+}
@@ -0,0 +1,94 @@
+package core
+
+import (
+	"bytes"
+	"encoding/gob"
+	"io"
+
+	"github.com/pkg/errors"
+
+	"github.com/azd1997/ecoin/common/crypto"
+	"github.com/azd1997/ecoin/common/encoding"
+)
+
+// 托管池（中转池）
+// 请求类交易(R2P/P2H/P2D)的转账数额不直接转给接收方，而是冻结在托管池中。
+// 托管款项记在交易流程最新一笔交易的名下，随流程推进而转移：
+// 请求方确认完成时支付给响应方；流程陷入纠纷时由仲裁交易按TargetArbitrate.Bad分配
+
+// 交易对托管池的操作
+const (
+	EscrowNone    = iota // 与托管池无关
+	EscrowLock           // 初始请求：冻结请求方支付的款项
+	EscrowCarry          // 流程中间步骤：托管款项转到当前交易名下，再次请求时追加冻结
+	EscrowRelease        // 请求方确认完成：托管款项支付给响应方
+	EscrowSplit          // 仲裁：按仲裁结果分配托管款项
+)
+
+// Escrow 一个交易流程的托管款项
+type Escrow struct {
+	Requester crypto.ID // 请求方，即款项的支付方
+	Responder crypto.ID // 响应方
+	Amount    uint64    // 冻结的数额
+}
+
+// IsRequest 是否为请求类交易。请求类交易的转账数额冻结在托管池，不直接转给接收方
+func (tx *Tx) IsRequest() bool {
+	return tx.Type == TX_R2P || tx.Type == TX_P2H || tx.Type == TX_P2D
+}
+
+// EscrowOp 交易对托管池的操作
+func (tx *Tx) EscrowOp() int {
+	switch tx.Type {
+	case TX_R2P, TX_P2H, TX_P2D:
+		if !tx.HasPrevTx() {
+			return EscrowLock
+		}
+		if tx.Uncompleted == 0 {
+			return EscrowRelease
+		}
+		return EscrowCarry
+	case TX_P2R, TX_H2P, TX_D2P:
+		return EscrowCarry
+	case TX_ARBITRATE:
+		return EscrowSplit
+	default:
+		return EscrowNone
+	}
+}
+
+// Settle 按结算交易tx（请求方确认完成或仲裁）分配托管款项，返回各账户所得
+// 确认完成时，托管款项连同tx本身的转账数额一起支付给响应方
+// 仲裁时，请求方作恶(Bad=false)则托管款项一半给响应方，一半给仲裁者；响应方作恶(Bad=true)则全部退还请求方
+// 仲裁结果无法解析时，全部退还请求方
+func (e *Escrow) Settle(tx *Tx) map[crypto.ID]uint64 {
+	result := make(map[crypto.ID]uint64)
+	switch tx.EscrowOp() {
+	case EscrowRelease:
+		result[e.Responder] += e.Amount + uint64(tx.Amount)
+	case EscrowSplit:
+		ta := &TargetArbitrate{}
+		if err := ta.Decode(bytes.NewReader(tx.Payload)); err != nil || ta.Bad {
+			result[e.Requester] += e.Amount
+			break
+		}
+		half := e.Amount / 2
+		result[e.Responder] += half
+		result[tx.From] += e.Amount - half
+	}
+	return result
+}
+
+// Encode 序列化编码
+func (e *Escrow) Encode() []byte {
+	res, _ := encoding.GobEncode(e)
+	return res
+}
+
+// Decode 解码
+func (e *Escrow) Decode(data io.Reader) error {
+	if err := gob.NewDecoder(data).Decode(e); err != nil {
+		return errors.Wrap(err, "Escrow_Decode")
+	}
+	return nil
+}
@@ -12,8 +12,15 @@ import (
 )
 
 // 为了支持多种共识协议，定义Proof接口
+// 共识引擎以外的模块（如出块调度）只通过该接口使用证明，不依赖具体共识的证明结构
 type Proof interface {
-
+	// Creator 证明者，即竞争胜出后的出块者
+	Creator() crypto.ID
+	// Parent 证明所基于的父区块
+	Parent() crypto.Hash
+	// Verify 格式与签名检查
+	Verify() error
+	String() string
 }
 
 
@@ -21,7 +28,7 @@ type Proof interface {
 
 
 // PoT为winner's PotMsg，主要包含交易数与交易总哈希，其实可以通过区块交易列表取长度和merkleroot得到
-// TODO：暂时不考虑PotMsg多次传播过程中被篡改的问题，有待解决
+// 证明由From签名，避免证明在多次传播过程中被篡改或被他人冒名构造
 type PoTProof struct {
 	From crypto.ID
 	TxsNum uint32	// 有效交易数
@@ -34,6 +41,8 @@ type PoTProof struct {
 	// 另外一种可选的做法是提供区块高度信息。但那样的话区块头结构也需要包含高度信息
 	// 否则无法自解释自证明
 	Base crypto.Hash
+	// From对证明其余内容（Hash()）的签名
+	Sig []byte
 }
 
 func NewPoTProof(from crypto.ID, txsNum uint32, txsMerkle crypto.Hash, base crypto.Hash) *PoTProof {
@@ -45,6 +54,14 @@ func NewPoTProof(from crypto.ID, txsNum uint32, txsMerkle crypto.Hash, base cryp
 	}
 }
 
+func (p *PoTProof) Creator() crypto.ID {
+	return p.From
+}
+
+func (p *PoTProof) Parent() crypto.Hash {
+	return p.Base
+}
+
 func (p *PoTProof) Encode() []byte {
 	buf := utils.GetBuf()
 	defer utils.ReturnBuf(buf)
@@ -57,6 +74,9 @@ func (p *PoTProof) Encode() []byte {
 	binary.Write(buf, binary.BigEndian, p.TxsMerkle)
 	// Base
 	binary.Write(buf, binary.BigEndian, p.Base)
+	// Sig
+	binary.Write(buf, binary.BigEndian, uint16(len(p.Sig)))
+	binary.Write(buf, binary.BigEndian, p.Sig)
 
 	return buf.Bytes()
 }
@@ -82,24 +102,65 @@ func (p *PoTProof) Decode(data io.Reader) error {
 	if err := binary.Read(data, binary.BigEndian, p.Base); err != nil {
 		return errors.Wrap(err, "PoTProof_Decode: Base")
 	}
+	// Sig
+	sigL := uint16(0)
+	if err := binary.Read(data, binary.BigEndian, &sigL); err != nil {
+		return errors.Wrap(err, "PoTProof_Decode: sigL")
+	}
+	p.Sig = make([]byte, sigL)
+	if err := binary.Read(data, binary.BigEndian, p.Sig); err != nil {
+		return errors.Wrap(err, "PoTProof_Decode: Sig")
+	}
 
 	return nil
 }
 
-// Verify只作格式检查
+// Hash 取哈希 取哈希时不算签名在内
+func (p *PoTProof) Hash() crypto.Hash {
+	pCopy := *p
+	pCopy.Sig = nil
+	return crypto.HashD(pCopy.Encode())
+}
+
+// Sign 签名，对p.Hash()签名，必须在其他各项填好之后
+func (p *PoTProof) Sign(priv *crypto.PrivateKey) error {
+	sig, err := crypto.Sign(priv, p.Hash())
+	if err != nil {
+		return errors.Wrap(err, "PoTProof_Sign")
+	}
+	p.Sig = sig.Serialize()
+	return nil
+}
+
+// Verify 作格式检查，并检查From的签名
 func (p *PoTProof) Verify() error {
-	// 1. 检查From的角色
+	// 1. 检查From的长度与角色
+	if len(p.From) != crypto.ID_LEN_WITH_ROLE {
+		return errors.New("PoTProof_Verify: invalid From length")
+	}
 	if !role.IsARole(p.From.RoleNo()) {
 		return errors.New("PoTProof_Verify: not a A role")
 	}
 	// 2. 检查TxsMerkle
-	if len(p.TxsMerkle) != crypto.ID_LEN_WITH_ROLE {
+	if len(p.TxsMerkle) != crypto.HASH_LENGTH {
 		return errors.New("PoTProof_Verify: invalid TxsMerkle length")
 	}
 	// 3. 检查Base
-	if len(p.Base) != crypto.ID_LEN_WITH_ROLE {
+	if len(p.Base) != crypto.HASH_LENGTH {
 		return errors.New("PoTProof_Verify: invalid Base length")
 	}
+	// 4. 检查签名
+	fromPublicKey := crypto.ID2PublicKey(p.From)
+	if fromPublicKey == nil {
+		return errors.Wrap(ErrID2PublicKeyFailed{errID: p.From}, "PoTProof_Verify")
+	}
+	sig, err := crypto.ParseSignatureS256(p.Sig)
+	if err != nil {
+		return errors.Wrap(err, "PoTProof_Verify")
+	}
+	if !sig.Verify(p.Hash(), fromPublicKey) {
+		return errors.New("PoTProof_Verify: verify Sig failed")
+	}
 
 	return nil
 }
@@ -114,13 +175,9 @@ func (p *PoTProof) GreaterThan(ap *PoTProof) bool {
 		// Merkle根相同（这是有可能的，但概率极低。
 		// 这是因为哪怕收集了完全一样的有效交易，但插入的顺序也很难一致，
 		// 计算出的Merkle根就不同）
-		if !bytes.Equal(p.TxsMerkle, ap.TxsMerkle) {
-			for i:=0; i<crypto.HASH_LENGTH; i++ {
-				if p.TxsMerkle[i] > ap.TxsMerkle[i] {
-					return true
-				}
-			}
-			return false
+		// 按字节序比较，保证排序是严格的：p、ap互不相同时二者恰有一个更大
+		if cmp := bytes.Compare(p.TxsMerkle, ap.TxsMerkle); cmp != 0 {
+			return cmp > 0
 		}
 		// 实在是连Merkle根都相同，那就直接比较ID以及Base
 		// 为方便起见，直接取Base第一个字节，查看其奇偶性
@@ -6,6 +6,8 @@ import (
 	"testing"
 	"time"
 
+	"github.com/azd1997/ecoin/account/role"
+	"github.com/azd1997/ecoin/common/crypto"
 	"github.com/azd1997/ecoin/common/utils"
 )
 
@@ -97,6 +99,63 @@ func TestTxVerify(t *testing.T) {
 	}
 }
 
+func TestWorkflowTxVerify(t *testing.T) {
+	patientKey, _ := crypto.NewPrivateKeyS256()
+	patient := crypto.PrivateKey2ID(patientKey, role.PATIENT)
+	hospitalKey, _ := crypto.NewPrivateKeyS256()
+	hospital := crypto.PrivateKey2ID(hospitalKey, role.HOSPITAL)
+	otherKey, _ := crypto.NewPrivateKeyS256()
+
+	dataKey, _ := crypto.NewDataKey()
+	tdk, err := NewTargetDataWithKey([]crypto.Hash{crypto.HashD([]byte("upload"))}, [][]byte{dataKey}, hospital, patient)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p2h := NewTx(TX_P2H, patient, hospital, 10, tdk.Encode(), nil, 0, nil)
+	p2h.Sign(patientKey)
+	if err := p2h.Verify(); err != nil {
+		t.Fatalf("expect valid P2H, but %v", err)
+	}
+	diag := &TargetDiagnosis{Diags: [][]byte{[]byte("healthy")}}
+	h2p := NewTx(TX_H2P, hospital, patient, 0, diag.Encode(), p2h.Id, 0, nil)
+	h2p.Sign(hospitalKey)
+	if err := h2p.Verify(); err != nil {
+		t.Fatalf("expect valid H2P, but %v", err)
+	}
+
+	// 未签名、他人签名或篡改后的交易都不能通过
+	unsigned := NewTx(TX_P2H, patient, hospital, 10, tdk.Encode(), nil, 0, nil)
+	if err := unsigned.Verify(); err == nil {
+		t.Fatal("expect unsigned P2H invalid")
+	}
+	forged := NewTx(TX_P2H, patient, hospital, 10, tdk.Encode(), nil, 0, nil)
+	forged.Sign(otherKey)
+	if err := forged.Verify(); err == nil {
+		t.Fatal("expect P2H signed by other key invalid")
+	}
+	forgedReply := NewTx(TX_H2P, hospital, patient, 0, diag.Encode(), p2h.Id, 0, nil)
+	forgedReply.Sign(patientKey)
+	if err := forgedReply.Verify(); err == nil {
+		t.Fatal("expect H2P signed by patient invalid")
+	}
+	p2h.Amount = 1
+	if err := p2h.Verify(); err == nil {
+		t.Fatal("expect P2H with unmatched Id invalid")
+	}
+
+	// Payload必须能够解析
+	broken := NewTx(TX_P2H, patient, hospital, 10, []byte("not a payload"), nil, 0, nil)
+	broken.Sign(patientKey)
+	if err := broken.Verify(); err == nil {
+		t.Fatal("expect P2H with broken payload invalid")
+	}
+	noDiag := NewTx(TX_H2P, hospital, patient, 0, nil, h2p.PrevTxId, 0, nil)
+	noDiag.Sign(hospitalKey)
+	if err := noDiag.Verify(); err == nil {
+		t.Fatal("expect H2P without diagnosis invalid")
+	}
+}
+
 func TestBlockHeader(t *testing.T) {
 	bp := NewBlockHeaderParams()
 
@@ -120,6 +179,15 @@ func TestBlockHeader(t *testing.T) {
 	if err := rBlockHeader.Verify(); err != nil {
 		t.Fatalf("expect valid:%v\n", err)
 	}
+	if err := rBlockHeader.VerifyHash(); err != nil {
+		t.Fatalf("expect hash match:%v\n", err)
+	}
+
+	// 篡改区块头内容后哈希不再相符
+	rBlockHeader.Time++
+	if err := rBlockHeader.VerifyHash(); err == nil {
+		t.Fatal("expect hash mismatch after tampering")
+	}
 }
 
 func TestEmptyBlock(t *testing.T) {
@@ -340,5 +408,44 @@ func TestTxBroadcastMsg(t *testing.T) {
 }
 
 func TestProofBroadcastMsg(t *testing.T) {
+	priv, _ := crypto.NewPrivateKeyS256()
+	from := crypto.PrivateKey2ID(priv, role.HOSPITAL)
+	proof := NewPoTProof(from, randNum(), randHash(), randHash())
+	if err := proof.Sign(priv); err != nil {
+		t.Fatal(err)
+	}
+
+	broadcast := NewProofBroadcastMsg(proof)
+	broadcastBytes := broadcast.Encode()
+
+	rBroadcast := &ProofBroadcastMsg{}
+	err := rBroadcast.Decode(bytes.NewReader(broadcastBytes))
+	if err != nil {
+		t.Fatalf("decode ProofBroadcastMsg failed: %v\n", err)
+	}
 
+	if err := utils.TCheckUint8("type", MsgProofBroadcast, rBroadcast.Type); err != nil {
+		t.Fatal(err)
+	}
+	if err := rBroadcast.Verify(); err != nil {
+		t.Fatalf("verify ProofBroadcastMsg failed: %v\n", err)
+	}
+	if !bytes.Equal(proof.Encode(), rBroadcast.PoTProof.Encode()) {
+		t.Fatal("mismatch proof")
+	}
+
+	// 篡改证明内容后签名校验失败
+	rBroadcast.TxsNum++
+	if err := rBroadcast.Verify(); err == nil {
+		t.Fatal("expect tampered proof invalid")
+	}
+	// 他人冒名构造的证明签名校验失败
+	otherPriv, _ := crypto.NewPrivateKeyS256()
+	forged := NewPoTProof(from, proof.TxsNum, proof.TxsMerkle, proof.Base)
+	if err := forged.Sign(otherPriv); err != nil {
+		t.Fatal(err)
+	}
+	if err := forged.Verify(); err == nil {
+		t.Fatal("expect forged proof invalid")
+	}
 }
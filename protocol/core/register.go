@@ -0,0 +1,33 @@
+package core
+
+import (
+	"bytes"
+
+	"github.com/azd1997/ecoin/common/crypto"
+)
+
+// 账户注册
+// 账户向医院发起注册申请(TxRegreq)，医院回复(TxRegresp)通过后，账户即完成注册。
+// 只有已注册的账户才能参与医疗类交易（数据请求、诊断、上传等）
+
+// NeedRegistered 该类交易的双方是否必须为已注册账户
+func (tx *Tx) NeedRegistered() bool {
+	switch tx.Type {
+	case TX_R2P, TX_P2R, TX_P2H, TX_H2P, TX_P2D, TX_D2P, TX_UPLOAD:
+		return true
+	default:
+		return false
+	}
+}
+
+// Registration 若tx为通过注册的回复，返回完成注册的账户
+func (tx *Tx) Registration() (crypto.ID, bool) {
+	if tx.Type != TX_REGRESP {
+		return "", false
+	}
+	rr := &RegisterResp{}
+	if err := rr.Decode(bytes.NewReader(tx.Payload)); err != nil || !rr.Approved {
+		return "", false
+	}
+	return tx.To, true
+}
@@ -0,0 +1,73 @@
+package core
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/azd1997/ecoin/account/role"
+	"github.com/azd1997/ecoin/common/crypto"
+)
+
+func TestRegister(t *testing.T) {
+	hospitalKey, _ := crypto.NewPrivateKeyS256()
+	hospital := crypto.PrivateKey2ID(hospitalKey, role.HOSPITAL)
+	patientKey, _ := crypto.NewPrivateKeyS256()
+	patient := crypto.PrivateKey2ID(patientKey, role.PATIENT)
+	doctorKey, _ := crypto.NewPrivateKeyS256()
+	doctor := crypto.PrivateKey2ID(doctorKey, role.DOCTOR)
+
+	newTx := func(typ uint8, priv *crypto.PrivateKey, from, to crypto.ID, payload []byte, prev crypto.Hash) *Tx {
+		tx := NewTx(typ, from, to, 0, payload, prev, 0, nil)
+		tx.Sign(priv)
+		return tx
+	}
+
+	// 病人的个人信息只有注册医院能解开
+	ri, err := NewPatientRegisterInfo(hospital, []byte("patient info"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info, err := ri.Open(hospitalKey); err != nil || !bytes.Equal(info, []byte("patient info")) {
+		t.Fatalf("open patient info: %s %v", info, err)
+	}
+	if _, err := ri.Open(doctorKey); err == nil {
+		t.Fatal("expect other account can't open patient info")
+	}
+	req := newTx(TX_REGREQ, patientKey, patient, hospital, ri.Encode(), nil)
+	if err := req.Verify(); err != nil {
+		t.Fatalf("verify patient register request: %v", err)
+	}
+
+	// 医生须明文注册资质，不能使用加密信息
+	plain := &RegisterInfo{Name: "doctor", Credential: []byte("license")}
+	if err := newTx(TX_REGREQ, doctorKey, doctor, hospital, plain.Encode(), nil).Verify(); err != nil {
+		t.Fatalf("verify doctor register request: %v", err)
+	}
+	if err := newTx(TX_REGREQ, doctorKey, doctor, hospital, ri.Encode(), nil).Verify(); err == nil {
+		t.Fatal("expect doctor register with private info invalid")
+	}
+	if err := newTx(TX_REGREQ, patientKey, patient, hospital, plain.Encode(), nil).Verify(); err == nil {
+		t.Fatal("expect patient register with plain info invalid")
+	}
+
+	// 通过注册
+	approve := newTx(TX_REGRESP, hospitalKey, hospital, patient, (&RegisterResp{Approved: true}).Encode(), req.Id)
+	if err := approve.Verify(); err != nil {
+		t.Fatalf("verify register response: %v", err)
+	}
+	if !approve.IsNextOf(req) {
+		t.Fatal("expect register response is next of request")
+	}
+	if id, ok := approve.Registration(); !ok || id != patient {
+		t.Fatalf("expect patient registered, but %v", ok)
+	}
+
+	// 不通过须说明原因，且不完成注册
+	if err := newTx(TX_REGRESP, hospitalKey, hospital, patient, (&RegisterResp{}).Encode(), req.Id).Verify(); err == nil {
+		t.Fatal("expect rejection without reason invalid")
+	}
+	reject := newTx(TX_REGRESP, hospitalKey, hospital, patient, (&RegisterResp{Reason: "fake"}).Encode(), req.Id)
+	if _, ok := reject.Registration(); ok {
+		t.Fatal("expect rejection not register")
+	}
+}
@@ -51,6 +51,8 @@ func newTxCoinbaseParams() *TxParams {
 		txType:TX_COINBASE,
 		amount:randNum(),
 		description: []byte("[DESCRIPTION] " + string(randBytes())),
+		privateKey:toPriv,	// coinbase由出块者签名
+		from:crypto.ZeroID,
 		to: to,
 	}
 }
@@ -68,7 +68,6 @@ func (err ErrID2PublicKeyFailed) Error() string {
 // 每一笔交易都是一个交易单链表，只有在初始交易才需要填交易双方ID
 // 和购买目标数据索引(Target)
 // TxMsg 在Tx基础上包装通信头Header，用于广播
-// TODO： Tx还应包含支付款项相关的成员变量，暂时不添加进去
 type Tx struct {
 	Version uint8	// 协议版本
 	Type uint8		// 交易类型
@@ -89,7 +88,11 @@ type Tx struct {
 	Amount uint32	// 转账数额
 	//TODO: 要检查转账数目，由于检查转账树木需要进行查询，所以在协议层没法检查，丢给上层去做
 
-	Sig []byte		// 发起者的签名. TxCoinbase无需签名
+	// Fee 交易费，可选。由发起者支付，在交易被打包时奖励给区块构建者
+	// 交易费越高的交易在交易池中越优先被打包。TxCoinbase的交易费只能为0
+	Fee uint32
+
+	Sig []byte		// 发起者的签名. TxCoinbase由接收者（出块者）签名
 
 	// Target 用来指定目标数据的索引
 	// 目标数据的索引是通过TxUpload实现的
@@ -191,6 +194,12 @@ func (tx *Tx) Hash() crypto.Hash {
 	return crypto.HashD(enced)
 }
 
+// SetFee 设置交易费，并重新计算Id。必须在签名之前调用
+func (tx *Tx) SetFee(fee uint32) {
+	tx.Fee = fee
+	tx.Id = tx.Hash()
+}
+
 // Sign 签名，对tx.Id签名，必须是在tx.SetId()之后
 func (tx *Tx) Sign(priv *crypto.PrivateKey) error {
 	sig, err := crypto.Sign(priv, tx.Id)
@@ -201,10 +210,17 @@ func (tx *Tx) Sign(priv *crypto.PrivateKey) error {
 	return nil
 }
 
+// HasPrevTx 是否有来源交易。PrevTxId为空或为crypto.ZeroHash（coinbase的PrevTxId）都视为没有，
+// 没有来源交易的请求类交易即为交易流程的初始交易。
+// 判断交易流程的起点（校验、托管、流程状态、存储）都必须使用该方法，以保证各处判定一致
+func (tx *Tx) HasPrevTx() bool {
+	return len(tx.PrevTxId) > 0 && !bytes.Equal(tx.PrevTxId, crypto.ZeroHash)
+}
+
 // IsNextOf 判断当前交易是否是prevTx的下一步交易
 func (tx *Tx) IsNextOf(prevTx *Tx) bool {
 	// 1. 检查tx.PrevTxId
-	if tx.PrevTxId == nil {
+	if !tx.HasPrevTx() {
 		return false
 	}
 
@@ -213,12 +229,45 @@ func (tx *Tx) IsNextOf(prevTx *Tx) bool {
 		return false
 	}
 
-	// 3. TODO ：检查其他各项内容是否匹配
+	// 3. 检查交易类型是否衔接
+	if !isNextType(tx.Type, prevTx.Type) {
+		return false
+	}
 
+	// 4. 检查交易双方：回复方向与来源交易相反。仲裁交易由worker发起，不检查
+	if tx.Type != TX_ARBITRATE && (tx.From != prevTx.To || tx.To != prevTx.From) {
+		return false
+	}
+
+	// 5. 检查时间：不能早于来源交易
+	if tx.TimeUnix < prevTx.TimeUnix {
+		return false
+	}
 
 	return true
 }
 
+// 各类交易的下一步交易类型
+// 请求与回复交替出现，任何一步都可以转入仲裁。仲裁之后交易活动结束
+var txNextTypes = map[uint8][]uint8{
+	TX_R2P: {TX_P2R, TX_ARBITRATE},
+	TX_P2R: {TX_R2P, TX_ARBITRATE},
+	TX_P2H: {TX_H2P, TX_ARBITRATE},
+	TX_H2P: {TX_P2H, TX_ARBITRATE},
+	TX_P2D: {TX_D2P, TX_ARBITRATE},
+	TX_D2P: {TX_P2D, TX_ARBITRATE},
+	TX_REGREQ: {TX_REGRESP},
+}
+
+func isNextType(typ, prevType uint8) bool {
+	for _, t := range txNextTypes[prevType] {
+		if t == typ {
+			return true
+		}
+	}
+	return false
+}
+
 
 ///////////////////////////////////////////////////////////////////////////////////////////
 
@@ -236,8 +285,8 @@ func (tx *Tx) Verify() error {
 	if len(tx.Id) != crypto.HASH_LENGTH {
 		return fmt.Errorf("invalid hash length %d", len(tx.Id))
 	}
-	// 交易时间
-	if tx.TimeUnix >= time.Now().Unix() {
+	// 交易时间（秒级，允许与当前时间相同，否则刚构建的区块内的coinbase无法通过本地校验）
+	if tx.TimeUnix > time.Now().Unix() {
 		return fmt.Errorf("invalid tx timeunix %d", tx.TimeUnix)
 	}
 	// 描述不能过长
@@ -256,7 +305,7 @@ func (tx *Tx) Verify() error {
 			return err
 		}
 	case TX_R2P:
-		if err := tx.verifyTxGeneral(); err != nil {
+		if err := tx.verifyTxR2P(); err != nil {
 			return err
 		}
 	case TX_P2R:
@@ -305,8 +354,18 @@ func (tx *Tx) Verify() error {
 // tx.Type = Txcoinbase 检查
 func (tx *Tx) verifyTxCoinBase() error {
 	// 检查应空项
-	if tx.From != crypto.ZeroID || tx.Sig != nil || tx.Payload != nil {
-		return errors.New("TxCoinbase: From/Sig/Payload must be empty")
+	if tx.From != crypto.ZeroID || tx.Fee != 0 {
+		return errors.New("TxCoinbase: From/Fee must be empty")
+	}
+	// Payload为空，或者记录未出块的胜者
+	if tx.Payload != nil {
+		mw := &MissedWinners{}
+		if err := mw.Decode(bytes.NewReader(tx.Payload)); err != nil {
+			return errors.Wrap(err, "TxCoinbase")
+		}
+		if !mw.formatOK() {
+			return errors.New("TxCoinbase: invalid MissedWinners")
+		}
 	}
 	// 检查uncompleted:应为0(false)
 	if tx.Uncompleted != 0 {
@@ -324,6 +383,14 @@ func (tx *Tx) verifyTxCoinBase() error {
 	if toPublicKey == nil {
 		return errors.Wrap(ErrID2PublicKeyFailed{errID:tx.To}, "TxCoinbase")
 	}
+	// 检查出块者的签名
+	sig, err := crypto.ParseSignatureS256(tx.Sig)
+	if err != nil {
+		return errors.Wrap(err, "TxCoinbase")
+	}
+	if !sig.Verify(tx.Id, toPublicKey) {
+		return errors.New("TxCoinbase: verify Sig failed")
+	}
 	// txId是否吻合
 	if !bytes.Equal(tx.Hash(), tx.Id) {
 		return errors.New("TxCoinbase: unmatched Id")
@@ -375,7 +442,7 @@ func (tx *Tx) verifyTxGeneral() error {
 // 检查TxR2P
 func (tx *Tx) verifyTxR2P() error {
 	// r2p要考虑两种情况:prev==nil 和prev != nil
-	if tx.PrevTxId == nil {
+	if !tx.HasPrevTx() {
 		return tx.verifyTxR2P_0()
 	} else {
 		return tx.verifyTxR2P_1()
@@ -436,175 +503,318 @@ func (tx *Tx) verifyTxR2P_0() error {
 }
 
 // 对非初始的TxR2P的检查
-// 需要注意：上层调用时还需要检查prev链路上的交易是否存在
-//func (tx *Tx) verifyTxR2P_1() error {
-//	// 1. 检查应空项 (设计为不允许更改TargetData)
-//	if tx.Payload != nil || tx.From != crypto.ZeroID || tx.To != crypto.ZeroID {
-//		return errors.New("TxR2P(1): From/To/Payload must be empty")
-//	}
-//	// 2. 迭代到初始R2P，并统计出现多少uncompleted，uncompleted不能超过3次
-//	r2p0 := tx.PrevTxId
-//	isr2p := 1		// 1表示是
-//	sign := -1		// 用来改变isr2p
-//	uncompletedByR := 0
-//	for r2p0.PrevTxId != nil {
-//		if isr2p == 1 {
-//			if r2p0.Uncompleted == 0 {	// 0表示完成，这是不正常的
-//				return errors.New("TxR2P(1): wrong tx history")
-//			}
-//			uncompletedByR++
-//		}
-//		r2p0 = r2p0.PrevTxId
-//		isr2p = isr2p * sign
-//	}
-//	if tx.Uncompleted == 1 {uncompletedByR++}	// 如果tx这次是未完成的，那么需要加一
-//	// 现在r2p0为初始交易
-//	// TODO: NOTICE!! 初始交易的正确性不检查
-//	// 现在要检查r2p0是不是r2p(看isr2p就行)以及uncompletedByR是否超过3
-//	if isr2p == 0 || uncompletedByR > 3 {
-//		return errors.New("TxR2P(1): wrong tx history")
-//	}
-//	// 2. 发起者是否有效：角色/长度/解析
-//	if len(r2p0.From) != crypto.ID_LEN_WITH_ROLE {
-//		return errors.New("TxR2P(1): len(r2p0.From) != 33(crypto.ID_LEN_WITH_ROLE)")
-//	}
-//	if !role.IsResearcher(r2p0.From[0]) {
-//		return errors.New("TxR2P(1): r2p0.From is not Researcher")
-//	}
-//	fromPublicKey := crypto.ID2PublicKey(tx.From)
-//	if fromPublicKey == nil {
-//		return errors.Wrap(ErrID2PublicKeyFailed{errID:tx.From}, "TxR2P(1)")
-//	}
-//	// 3. 接收者是否有效: 角色/长度/解析
-//	if len(r2p0.To) != crypto.ID_LEN_WITH_ROLE {
-//		return errors.New("TxR2P(1): len(r2p0.To) != 333(crypto.ID_LEN_WITH_ROLE)4")
-//	}
-//	if !role.IsPatient(r2p0.To[0]) {
-//		return errors.New("TxR2P(1): r2p0.To is not Patient")
-//	}
-//	toPublicKey := crypto.ID2PublicKey(tx.To)
-//	if toPublicKey == nil {
-//		return errors.Wrap(ErrID2PublicKeyFailed{errID:tx.To}, "TxR2P(1)")
-//	}
-//	// 4. 检查签名
-//	sig, err := crypto.ParseSignatureS256(tx.Sig)
-//	if err != nil {
-//		return errors.Wrap(err, "TxR2P(1)")
-//	}
-//	if !sig.Verify(tx.Id, fromPublicKey) {
-//		return errors.New("TxR2P(1): verify Sig failed")
-//	}
-//	// 6. txId是否吻合
-//	if !bytes.Equal(tx.Hash(), tx.Id) {
-//		return errors.New("TxR2P(1): unmatched Id")
-//	}
-//
-//	return nil
-//}
-
-// 对非初始的TxR2P的检查
-// 需要注意：上层调用时还需要检查prev链路上的交易是否存在
-// TODO： 对于非初始的交易，允许缺省参数
+// 非初始的TxR2P是研究机构对病人回复的确认(Uncompleted=0)或者再次请求(Uncompleted=1)
+// 需要注意：来源交易链路（是否存在、是否衔接、未完成轮数不超过3）由上层(enode/bc)沿PrevTxId检查
 func (tx *Tx) verifyTxR2P_1() error {
-	//// 1. 检查应空项 (设计为不允许更改TargetData)
-	//if tx.Payload != nil || tx.From != crypto.ZeroID || tx.To != crypto.ZeroID {
-	//	return errors.New("TxR2P(1): From/To/Payload must be empty")
-	//}
-	//// 2. 迭代到初始R2P，并统计出现多少uncompleted，uncompleted不能超过3次
-	//r2p0 := tx.PrevTxId
-	//isr2p := 1		// 1表示是
-	//sign := -1		// 用来改变isr2p
-	//uncompletedByR := 0
-	//for r2p0.PrevTxId != nil {
-	//	if isr2p == 1 {
-	//		if r2p0.Uncompleted == 0 {	// 0表示完成，这是不正常的
-	//			return errors.New("TxR2P(1): wrong tx history")
-	//		}
-	//		uncompletedByR++
-	//	}
-	//	r2p0 = r2p0.PrevTxId
-	//	isr2p = isr2p * sign
-	//}
-	//if tx.Uncompleted == 1 {uncompletedByR++}	// 如果tx这次是未完成的，那么需要加一
-	//// 现在r2p0为初始交易
-	//// TODO: NOTICE!! 初始交易的正确性不检查
-	//// 现在要检查r2p0是不是r2p(看isr2p就行)以及uncompletedByR是否超过3
-	//if isr2p == 0 || uncompletedByR > 3 {
-	//	return errors.New("TxR2P(1): wrong tx history")
-	//}
-	//// 2. 发起者是否有效：角色/长度/解析
-	//if len(r2p0.From) != crypto.ID_LEN_WITH_ROLE {
-	//	return errors.New("TxR2P(1): len(r2p0.From) != 33(crypto.ID_LEN_WITH_ROLE)")
-	//}
-	//if !role.IsResearcher(r2p0.From[0]) {
-	//	return errors.New("TxR2P(1): r2p0.From is not Researcher")
-	//}
-	//fromPublicKey := crypto.ID2PublicKey(tx.From)
-	//if fromPublicKey == nil {
-	//	return errors.Wrap(ErrID2PublicKeyFailed{errID:tx.From}, "TxR2P(1)")
-	//}
-	//// 3. 接收者是否有效: 角色/长度/解析
-	//if len(r2p0.To) != crypto.ID_LEN_WITH_ROLE {
-	//	return errors.New("TxR2P(1): len(r2p0.To) != 333(crypto.ID_LEN_WITH_ROLE)4")
-	//}
-	//if !role.IsPatient(r2p0.To[0]) {
-	//	return errors.New("TxR2P(1): r2p0.To is not Patient")
-	//}
-	//toPublicKey := crypto.ID2PublicKey(tx.To)
-	//if toPublicKey == nil {
-	//	return errors.Wrap(ErrID2PublicKeyFailed{errID:tx.To}, "TxR2P(1)")
-	//}
-	//// 4. 检查签名
-	//sig, err := crypto.ParseSignatureS256(tx.Sig)
-	//if err != nil {
-	//	return errors.Wrap(err, "TxR2P(1)")
-	//}
-	//if !sig.Verify(tx.Id, fromPublicKey) {
-	//	return errors.New("TxR2P(1): verify Sig failed")
-	//}
-	//// 6. txId是否吻合
-	//if !bytes.Equal(tx.Hash(), tx.Id) {
-	//	return errors.New("TxR2P(1): unmatched Id")
-	//}
+	// 1. 检查应空项 (设计为不允许更改TargetData)
+	if tx.Payload != nil {
+		return errors.New("TxR2P(1): Payload must be empty")
+	}
+	// 2. 检查uncompleted:只能为0或1
+	if tx.Uncompleted > 1 {
+		return errors.New("TxR2P(1): Uncompleted should be 0 or 1")
+	}
+	// 3. 发起者是否有效：角色/长度/解析
+	if len(tx.From) != crypto.ID_LEN_WITH_ROLE {
+		return errors.New("TxR2P(1): len(From) != 33(crypto.ID_LEN_WITH_ROLE)")
+	}
+	if !role.IsResearcher(tx.From[0]) {
+		return errors.New("TxR2P(1): From is not Researcher")
+	}
+	fromPublicKey := crypto.ID2PublicKey(tx.From)
+	if fromPublicKey == nil {
+		return errors.Wrap(ErrID2PublicKeyFailed{errID:tx.From}, "TxR2P(1)")
+	}
+	// 4. 接收者是否有效: 角色/长度
+	if len(tx.To) != crypto.ID_LEN_WITH_ROLE {
+		return errors.New("TxR2P(1): len(To) != 33(crypto.ID_LEN_WITH_ROLE)")
+	}
+	if !role.IsPatient(tx.To[0]) {
+		return errors.New("TxR2P(1): To is not Patient")
+	}
+	// 5. 检查签名
+	sig, err := crypto.ParseSignatureS256(tx.Sig)
+	if err != nil {
+		return errors.Wrap(err, "TxR2P(1)")
+	}
+	if !sig.Verify(tx.Id, fromPublicKey) {
+		return errors.New("TxR2P(1): verify Sig failed")
+	}
+	// 6. txId是否吻合
+	if !bytes.Equal(tx.Hash(), tx.Id) {
+		return errors.New("TxR2P(1): unmatched Id")
+	}
 
 	return nil
 }
 
-// TODO: 剩余待实现
-
+// 检查TxP2R：病人对研究机构数据请求的回复，必须携带目标数据的密钥
 func (tx *Tx) verifyTxP2R() error {
-	return nil
+	if !tx.HasPrevTx() {
+		return errors.New("TxP2R: PrevTxId must not be empty")
+	}
+	tk := &TargetKey{}
+	if err := tk.Decode(bytes.NewReader(tx.Payload)); err != nil {
+		return errors.Wrap(err, "TxP2R")
+	}
+	if !tk.formatOK() {
+		return errors.New("TxP2R: TargetKey has no key")
+	}
+	return tx.verifyWorkflowTx("TxP2R", role.IsPatient, role.IsResearcher)
 }
 
+// 检查TxP2H：病人向医院请求诊断
 func (tx *Tx) verifyTxP2H() error {
-	return nil
+	if err := tx.verifyDiagnosisRequest("TxP2H"); err != nil {
+		return err
+	}
+	return tx.verifyWorkflowTx("TxP2H", role.IsPatient, role.IsHospital)
 }
 
+// 检查TxH2P：医院回复诊断结果
 func (tx *Tx) verifyTxH2P() error {
-	return nil
+	if err := tx.verifyDiagnosisReply("TxH2P"); err != nil {
+		return err
+	}
+	return tx.verifyWorkflowTx("TxH2P", role.IsHospital, role.IsPatient)
 }
 
+// 检查TxP2D：病人向医生请求诊断
 func (tx *Tx) verifyTxP2D() error {
-	return nil
+	if err := tx.verifyDiagnosisRequest("TxP2D"); err != nil {
+		return err
+	}
+	return tx.verifyWorkflowTx("TxP2D", role.IsPatient, role.IsDoctor)
 }
 
+// 检查TxD2P：医生回复诊断结果
 func (tx *Tx) verifyTxD2P() error {
+	if err := tx.verifyDiagnosisReply("TxD2P"); err != nil {
+		return err
+	}
+	return tx.verifyWorkflowTx("TxD2P", role.IsDoctor, role.IsPatient)
+}
+
+// 诊断请求（P2H/P2D）：初始请求必须携带目标数据及其密钥；
+// 后续的再次请求或确认可以不携带，携带则必须能够解析
+func (tx *Tx) verifyDiagnosisRequest(name string) error {
+	if tx.HasPrevTx() && tx.Payload == nil {
+		return nil
+	}
+	tdk := &TargetDataWithKey{}
+	if err := tdk.Decode(bytes.NewReader(tx.Payload)); err != nil {
+		return errors.Wrap(err, name)
+	}
+	if !tdk.formatOK() {
+		return errors.New(name + ": invalid TargetDataWithKey")
+	}
+	return nil
+}
+
+// 诊断回复（H2P/D2P）：必须是对请求的回复，并携带诊断结果
+func (tx *Tx) verifyDiagnosisReply(name string) error {
+	if !tx.HasPrevTx() {
+		return errors.New(name + ": PrevTxId must not be empty")
+	}
+	td := &TargetDiagnosis{}
+	if err := td.Decode(bytes.NewReader(tx.Payload)); err != nil {
+		return errors.Wrap(err, name)
+	}
+	if !td.formatOK() {
+		return errors.New(name + ": TargetDiagnosis has no diagnosis")
+	}
+	return nil
+}
+
+// 两方交易流程中交易的公共检查：双方的角色/长度/解析、From的签名以及txId
+// 这些交易会锁定、释放托管款项并推进流程状态，必须确认由From本人发出
+func (tx *Tx) verifyWorkflowTx(name string, fromRole, toRole func(uint8) bool) error {
+	// 1. 检查uncompleted:只能为0或1
+	if tx.Uncompleted > 1 {
+		return errors.New(name + ": Uncompleted should be 0 or 1")
+	}
+	// 2. 发起者是否有效：角色/长度/解析
+	if len(tx.From) != crypto.ID_LEN_WITH_ROLE {
+		return errors.New(name + ": len(From) != 33(crypto.ID_LEN_WITH_ROLE)")
+	}
+	if !fromRole(tx.From[0]) {
+		return errors.New(name + ": invalid From role")
+	}
+	fromPublicKey := crypto.ID2PublicKey(tx.From)
+	if fromPublicKey == nil {
+		return errors.Wrap(ErrID2PublicKeyFailed{errID:tx.From}, name)
+	}
+	// 3. 接收者是否有效: 角色/长度
+	if len(tx.To) != crypto.ID_LEN_WITH_ROLE {
+		return errors.New(name + ": len(To) != 33(crypto.ID_LEN_WITH_ROLE)")
+	}
+	if !toRole(tx.To[0]) {
+		return errors.New(name + ": invalid To role")
+	}
+	// 4. 检查签名
+	sig, err := crypto.ParseSignatureS256(tx.Sig)
+	if err != nil {
+		return errors.Wrap(err, name)
+	}
+	if !sig.Verify(tx.Id, fromPublicKey) {
+		return errors.New(name + ": verify Sig failed")
+	}
+	// 5. txId是否吻合
+	if !bytes.Equal(tx.Hash(), tx.Id) {
+		return errors.New(name + ": unmatched Id")
+	}
 	return nil
 }
 
 func (tx *Tx) verifyTxArbitrate() error {
+	// 仲裁者是否有效：长度/解析
+	if len(tx.From) != crypto.ID_LEN_WITH_ROLE {
+		return errors.New("TxArbitrate: len(From) != 33(crypto.ID_LEN_WITH_ROLE)")
+	}
+	fromPublicKey := crypto.ID2PublicKey(tx.From)
+	if fromPublicKey == nil {
+		return errors.Wrap(ErrID2PublicKeyFailed{errID:tx.From}, "TxArbitrate")
+	}
+	// 仲裁结果决定托管款项的分配，必须能够解析
+	ta := &TargetArbitrate{}
+	if err := ta.Decode(bytes.NewReader(tx.Payload)); err != nil {
+		return errors.Wrap(err, "TxArbitrate")
+	}
+	// 检查签名
+	sig, err := crypto.ParseSignatureS256(tx.Sig)
+	if err != nil {
+		return errors.Wrap(err, "TxArbitrate")
+	}
+	if !sig.Verify(tx.Id, fromPublicKey) {
+		return errors.New("TxArbitrate: verify Sig failed")
+	}
+	// txId是否吻合
+	if !bytes.Equal(tx.Hash(), tx.Id) {
+		return errors.New("TxArbitrate: unmatched Id")
+	}
 	return nil
 }
 
+// 检查TxUpload：病人向医院上传数据摘要，摘要须包含对数据的默克尔承诺
 func (tx *Tx) verifyTxUpload() error {
+	// 检查应空项
+	if tx.PrevTxId != nil || tx.Uncompleted != 0 {
+		return errors.New("TxUpload: PrevTxId/Uncompleted must be empty")
+	}
+	// 上传者与医院是否有效：长度/解析
+	if len(tx.From) != crypto.ID_LEN_WITH_ROLE || len(tx.To) != crypto.ID_LEN_WITH_ROLE {
+		return errors.New("TxUpload: len(From/To) != 33(crypto.ID_LEN_WITH_ROLE)")
+	}
+	fromPublicKey := crypto.ID2PublicKey(tx.From)
+	if fromPublicKey == nil {
+		return errors.Wrap(ErrID2PublicKeyFailed{errID:tx.From}, "TxUpload")
+	}
+	// 数据摘要
+	ti := &TargetInfo{}
+	if err := ti.Decode(bytes.NewReader(tx.Payload)); err != nil {
+		return errors.Wrap(err, "TxUpload")
+	}
+	if !ti.formatOK() {
+		return errors.New("TxUpload: invalid TargetInfo")
+	}
+	// 检查签名
+	sig, err := crypto.ParseSignatureS256(tx.Sig)
+	if err != nil {
+		return errors.Wrap(err, "TxUpload")
+	}
+	if !sig.Verify(tx.Id, fromPublicKey) {
+		return errors.New("TxUpload: verify Sig failed")
+	}
+	// txId是否吻合
+	if !bytes.Equal(tx.Hash(), tx.Id) {
+		return errors.New("TxUpload: unmatched Id")
+	}
 	return nil
 }
 
+// 检查TxRegreq：病人提交加密的个人信息，其他角色提交明文资质
 func (tx *Tx) verifyTxRegreq() error {
+	// 检查应空项
+	if tx.PrevTxId != nil || tx.Uncompleted != 0 {
+		return errors.New("TxRegreq: PrevTxId/Uncompleted must be empty")
+	}
+	// 申请者与医院是否有效：长度/解析
+	if len(tx.From) != crypto.ID_LEN_WITH_ROLE || len(tx.To) != crypto.ID_LEN_WITH_ROLE {
+		return errors.New("TxRegreq: len(From/To) != 33(crypto.ID_LEN_WITH_ROLE)")
+	}
+	if tx.From == tx.To {
+		return errors.New("TxRegreq: can not register to self")
+	}
+	fromPublicKey := crypto.ID2PublicKey(tx.From)
+	if fromPublicKey == nil {
+		return errors.Wrap(ErrID2PublicKeyFailed{errID:tx.From}, "TxRegreq")
+	}
+	if crypto.ID2PublicKey(tx.To) == nil {
+		return errors.Wrap(ErrID2PublicKeyFailed{errID:tx.To}, "TxRegreq")
+	}
+	// 注册信息
+	ri := &RegisterInfo{}
+	if err := ri.Decode(bytes.NewReader(tx.Payload)); err != nil {
+		return errors.Wrap(err, "TxRegreq")
+	}
+	if !ri.formatOK() {
+		return errors.New("TxRegreq: invalid RegisterInfo")
+	}
+	if ri.IsPrivate() != role.IsPatient(tx.From.RoleNo()) {
+		return errors.New("TxRegreq: only patient register with private info")
+	}
+	// 检查签名
+	sig, err := crypto.ParseSignatureS256(tx.Sig)
+	if err != nil {
+		return errors.Wrap(err, "TxRegreq")
+	}
+	if !sig.Verify(tx.Id, fromPublicKey) {
+		return errors.New("TxRegreq: verify Sig failed")
+	}
+	// txId是否吻合
+	if !bytes.Equal(tx.Hash(), tx.Id) {
+		return errors.New("TxRegreq: unmatched Id")
+	}
 	return nil
 }
 
+// 检查TxRegresp：医院回复注册申请
 func (tx *Tx) verifyTxRegresp() error {
+	// 检查应有项
+	if len(tx.PrevTxId) != crypto.HASH_LENGTH {
+		return errors.New("TxRegresp: invalid PrevTxId")
+	}
+	if tx.Uncompleted != 0 {
+		return errors.New("TxRegresp: Uncompleted should be 0(false)")
+	}
+	// 医院与申请者是否有效：长度/解析
+	if len(tx.From) != crypto.ID_LEN_WITH_ROLE || len(tx.To) != crypto.ID_LEN_WITH_ROLE {
+		return errors.New("TxRegresp: len(From/To) != 33(crypto.ID_LEN_WITH_ROLE)")
+	}
+	fromPublicKey := crypto.ID2PublicKey(tx.From)
+	if fromPublicKey == nil {
+		return errors.Wrap(ErrID2PublicKeyFailed{errID:tx.From}, "TxRegresp")
+	}
+	// 注册结果
+	rr := &RegisterResp{}
+	if err := rr.Decode(bytes.NewReader(tx.Payload)); err != nil {
+		return errors.Wrap(err, "TxRegresp")
+	}
+	if !rr.formatOK() {
+		return errors.New("TxRegresp: rejection without reason")
+	}
+	// 检查签名
+	sig, err := crypto.ParseSignatureS256(tx.Sig)
+	if err != nil {
+		return errors.Wrap(err, "TxRegresp")
+	}
+	if !sig.Verify(tx.Id, fromPublicKey) {
+		return errors.New("TxRegresp: verify Sig failed")
+	}
+	// txId是否吻合
+	if !bytes.Equal(tx.Hash(), tx.Id) {
+		return errors.New("TxRegresp: unmatched Id")
+	}
 	return nil
 }
 
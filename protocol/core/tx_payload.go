@@ -276,11 +276,12 @@ type TargetInfo struct {
 	TimeStart int64	// 该段数据采集的开始时间	Unix时间戳
 	TimeEnd  int64	// 该段数据采集的结束时间
 	Num int64			// 这段数据中总共的数据点数，例如1个小时区间的数据被打包在一起，总共有60条数据在里边
+	Merkle []byte	// 对这Num条数据记录（按时间先后，存储在数据仓库中的原样）的默克尔承诺，见CommitSegments
 }
 
 func (ti *TargetInfo) String() string {
-	return fmt.Sprintf("TargetInfo=>{StoreAt=>{\"%s\"}, Type=>{%d}, Ill=>{%d}, TimeStart=>{%d}, TimeEnd=>{%d}, Num=>{%d}}",
-		ti.StoreAt, ti.Type, ti.Ill, ti.TimeStart, ti.TimeEnd, ti.Num)
+	return fmt.Sprintf("TargetInfo=>{StoreAt=>{\"%s\"}, Type=>{%d}, Ill=>{%d}, TimeStart=>{%d}, TimeEnd=>{%d}, Num=>{%d}, Merkle=>{%x}}",
+		ti.StoreAt, ti.Type, ti.Ill, ti.TimeStart, ti.TimeEnd, ti.Num, ti.Merkle)
 }
 
 func (ti *TargetInfo) Encode() []byte {
@@ -295,24 +296,47 @@ func (ti *TargetInfo) Decode(data io.Reader) error {
 }
 
 func (ti *TargetInfo) formatOK() bool {
-	return ti.StoreAt != "" && ti.Num > 0 && ti.TimeStart < ti.TimeEnd && ti.TimeEnd < time.Now().Unix()
+	return ti.StoreAt != "" && ti.Num > 0 && ti.TimeStart < ti.TimeEnd && ti.TimeEnd < time.Now().Unix() &&
+		len(ti.Merkle) == crypto.HASH_LENGTH
 }
 
 
 //////////////////////////////////////////////////////////////////////////////
 
-// TODO:
-
 // 对于TxRegreq，Payload存注册信息。而且对于注册信息，病人可以使用注册的那家医院的公钥加密，以保证隐私
 // 而对于其他三类对外提供服务的角色，必须明文注册其资质，也就是说区块链可以查到它们的身份信息
 
 type RegisterInfo struct {
+	Name string	// 名称。医院/研究机构/医生须填写，病人不填
+	Credential []byte	// 资质信息(明文)，例如执业许可证。病人不填
+	Private []byte	// 病人的个人信息，使用注册医院的公钥加密，只有该医院能解开。其他角色不填
+}
+
+// NewPatientRegisterInfo 病人的注册信息，个人信息info使用注册医院hospital的公钥加密
+func NewPatientRegisterInfo(hospital crypto.ID, info []byte) (*RegisterInfo, error) {
+	pub := crypto.ID2PublicKey(hospital)
+	if pub == nil {
+		return nil, ErrID2PublicKeyFailed{errID:hospital}
+	}
+	private, err := crypto.Encrypt(pub, info)
+	if err != nil {
+		return nil, errors.Wrap(err, "NewPatientRegisterInfo")
+	}
+	return &RegisterInfo{Private:private}, nil
+}
 
+// Open 医院使用自己的私钥解开病人的个人信息
+func (ri *RegisterInfo) Open(priv *crypto.PrivateKey) ([]byte, error) {
+	return crypto.Decrypt(priv, ri.Private)
+}
+
+// IsPrivate 是否为加密的(病人)注册信息
+func (ri *RegisterInfo) IsPrivate() bool {
+	return len(ri.Private) > 0
 }
 
-// TODO
 func (ri *RegisterInfo) String() string {
-	return ""
+	return fmt.Sprintf("RegisterInfo=>{Name=>%s, Credential=>%s, Private=>%x}", ri.Name, ri.Credential, ri.Private)
 }
 
 func (ri *RegisterInfo) Encode() []byte {
@@ -326,8 +350,12 @@ func (ri *RegisterInfo) Decode(data io.Reader) error {
 	return nil
 }
 
+// 明文资质与加密信息二者只能填其一
 func (ri *RegisterInfo) formatOK() bool {
-	return true
+	if ri.IsPrivate() {
+		return ri.Name == "" && len(ri.Credential) == 0
+	}
+	return ri.Name != "" && len(ri.Credential) > 0
 }
 
 /////////////////////////////////////////////////////////////////////
@@ -335,12 +363,12 @@ func (ri *RegisterInfo) formatOK() bool {
 // 对于TxRegresp，Payload需要存通过注册还是不通过
 
 type RegisterResp struct {
-
+	Approved bool	// 是否通过注册
+	Reason string	// 不通过的原因
 }
 
-// TODO
 func (rr *RegisterResp) String() string {
-	return ""
+	return fmt.Sprintf("RegisterResp=>{Approved=>%v, Reason=>%s}", rr.Approved, rr.Reason)
 }
 
 func (rr *RegisterResp) Encode() []byte {
@@ -354,8 +382,9 @@ func (rr *RegisterResp) Decode(data io.Reader) error {
 	return nil
 }
 
+// 不通过注册时须说明原因
 func (rr *RegisterResp) formatOK() bool {
-	return true
+	return rr.Approved || rr.Reason != ""
 }
 
 
@@ -0,0 +1,104 @@
+package handshake
+
+// 节点能力，握手时双方各自在请求/回应中声明（Request.Caps、Response.Caps），再由Negotiate独立得出相同的协商结果。
+// 核心协议版本取双方都支持的最高版本，因此新旧版本的节点可以在滚动升级期间共存
+
+// 核心协议（区块、交易等消息）版本
+const (
+	CoreProtocolV1 = uint16(1)
+
+	// 本节点支持的核心协议版本范围
+	MinCoreProtocol = CoreProtocolV1
+	MaxCoreProtocol = CoreProtocolV1
+)
+
+// 消息压缩算法，编号越大越优先。
+// 目前链接层尚未实现压缩，DefaultCapabilities只声明CompressNone，实现之前不要声明其他算法
+const (
+	CompressNone  = uint8(0)
+	CompressFlate = uint8(1)
+)
+
+// DefaultMaxMsgSize 默认可接收的单条消息最大长度
+const DefaultMaxMsgSize = uint32(16 << 20)
+
+// Capabilities 节点声明的能力
+type Capabilities struct {
+	MinCoreVersion uint16  // 支持的最低核心协议版本
+	MaxCoreVersion uint16  // 支持的最高核心协议版本
+	Compression    []uint8 // 支持的压缩算法，CompressNone总是被支持
+	MaxMsgSize     uint32  // 可接收的单条消息最大长度
+	LightClient    bool    // 是否为轻客户端（不保存完整区块链）
+}
+
+// DefaultCapabilities 本节点默认的能力
+func DefaultCapabilities() *Capabilities {
+	return &Capabilities{
+		MinCoreVersion: MinCoreProtocol,
+		MaxCoreVersion: MaxCoreProtocol,
+		Compression:    []uint8{CompressNone},
+		MaxMsgSize:     DefaultMaxMsgSize,
+	}
+}
+
+// LegacyCapabilities 握手消息不带能力声明的旧节点，只支持CoreProtocolV1且不压缩
+func LegacyCapabilities() *Capabilities {
+	return &Capabilities{
+		MinCoreVersion: CoreProtocolV1,
+		MaxCoreVersion: CoreProtocolV1,
+		MaxMsgSize:     DefaultMaxMsgSize,
+	}
+}
+
+// Negotiated 与对方协商得到的能力
+type Negotiated struct {
+	CoreVersion uint16 // 双方都支持的最高核心协议版本
+	Compression uint8  // 双方都支持的编号最大的压缩算法
+	MaxMsgSize  uint32 // 双方可接收的最大消息长度中的较小者
+	LightClient bool   // 对方是否为轻客户端
+}
+
+// Negotiate 由本方能力local和对方能力remote协商。双方没有共同的核心协议版本时返回false
+// 除LightClient外，协商结果与参数顺序无关，因此双方独立协商即可得到相同的结果
+func Negotiate(local, remote *Capabilities) (*Negotiated, bool) {
+	if remote == nil {
+		remote = LegacyCapabilities()
+	}
+
+	version := local.MaxCoreVersion
+	if remote.MaxCoreVersion < version {
+		version = remote.MaxCoreVersion
+	}
+	if version < local.MinCoreVersion || version < remote.MinCoreVersion {
+		return nil, false
+	}
+
+	compression := CompressNone
+	for _, l := range local.Compression {
+		for _, r := range remote.Compression {
+			if l == r && l > compression {
+				compression = l
+			}
+		}
+	}
+
+	maxMsgSize := local.maxMsgSize()
+	if remote.maxMsgSize() < maxMsgSize {
+		maxMsgSize = remote.maxMsgSize()
+	}
+
+	return &Negotiated{
+		CoreVersion: version,
+		Compression: compression,
+		MaxMsgSize:  maxMsgSize,
+		LightClient: remote.LightClient,
+	}, true
+}
+
+// 未声明时取默认值
+func (c *Capabilities) maxMsgSize() uint32 {
+	if c.MaxMsgSize == 0 {
+		return DefaultMaxMsgSize
+	}
+	return c.MaxMsgSize
+}
@@ -5,4 +5,14 @@ const (
 	V1 = 1
 )
 
+// 会话消息的加密方案，握手时由请求方提出（Request.Cipher），接受方在回应中确认（Response.Cipher）
+// 早期整个会话使用同一个Nonce的方案（编号1）不安全，已不再支持；不带该字段的旧节点编号为0，同样被拒绝
+const (
+	// CipherAESGCMV2 AES-256-GCM，两个方向使用不同的密钥，每帧以递增计数作为Nonce，拒绝重放和乱序的帧
+	CipherAESGCMV2 = uint8(2)
+
+	// CurrentCipher 本节点使用的会话加密方案
+	CurrentCipher = CipherAESGCMV2
+)
+
 
@@ -112,3 +112,57 @@ func TestRejectResponse(t *testing.T) {
 		t.Fatal("verify failed\n")
 	}
 }
+
+func TestNegotiate(t *testing.T) {
+	old := &Capabilities{MinCoreVersion: 1, MaxCoreVersion: 2, Compression: []uint8{CompressNone},
+		MaxMsgSize: 1 << 20}
+	cur := &Capabilities{MinCoreVersion: 2, MaxCoreVersion: 4, Compression: []uint8{CompressNone, CompressFlate},
+		LightClient: true}
+	next := &Capabilities{MinCoreVersion: 3, MaxCoreVersion: 5, Compression: []uint8{CompressFlate, CompressNone}}
+
+	// 双方独立协商得到相同的结果（对方是否为轻客户端除外）
+	n1, ok1 := Negotiate(cur, next)
+	n2, ok2 := Negotiate(next, cur)
+	if !ok1 || !ok2 {
+		t.Fatal("expect negotiated")
+	}
+	if err := utils.TCheckUint16("core version", 4, n1.CoreVersion); err != nil {
+		t.Fatal(err)
+	}
+	if n1.CoreVersion != n2.CoreVersion || n1.Compression != n2.Compression || n1.MaxMsgSize != n2.MaxMsgSize {
+		t.Fatalf("asymmetric negotiation: %+v, %+v", n1, n2)
+	}
+	if err := utils.TCheckUint8("compression", CompressFlate, n1.Compression); err != nil {
+		t.Fatal(err)
+	}
+	if n1.MaxMsgSize != DefaultMaxMsgSize || n1.LightClient || !n2.LightClient {
+		t.Fatalf("unexpected negotiation: %+v, %+v", n1, n2)
+	}
+
+	n3, ok := Negotiate(cur, old)
+	if !ok || n3.CoreVersion != 2 || n3.Compression != CompressNone || n3.MaxMsgSize != 1<<20 {
+		t.Fatalf("unexpected negotiation with old node: %+v", n3)
+	}
+
+	// 没有共同版本；不声明能力的旧节点只支持V1
+	if _, ok := Negotiate(old, next); ok {
+		t.Fatal("expect no common core version")
+	}
+	if _, ok := Negotiate(cur, nil); ok {
+		t.Fatal("expect no common core version with legacy node")
+	}
+	if n, ok := Negotiate(old, nil); !ok || n.CoreVersion != CoreProtocolV1 {
+		t.Fatalf("unexpected negotiation with legacy node: %+v", n)
+	}
+
+	// 能力随请求编码
+	req := NewRequestV1(1, params.CurrentCodeVersion, role.HOSPITAL, crypto.ZeroID, nil)
+	req.Caps = cur
+	rReq := &Request{}
+	if err := rReq.Decode(bytes.NewReader(req.Encode())); err != nil {
+		t.Fatal(err)
+	}
+	if rReq.Caps == nil || rReq.Caps.MaxCoreVersion != 4 || !rReq.Caps.LightClient {
+		t.Fatalf("decoded capabilities: %+v", rReq.Caps)
+	}
+}
@@ -0,0 +1,46 @@
+package handshake
+
+import (
+	"encoding/gob"
+	"io"
+
+	"github.com/pkg/errors"
+
+	"github.com/azd1997/ecoin/common/encoding"
+)
+
+// 会话密钥轮换消息，在已加密的会话中交换，双方各自生成新的临时会话密钥
+//  1. 握手发起方发送 REKEY_INIT，携带新的临时公钥
+//  2. 接受方回应 REKEY_ACK，携带自己新的临时公钥。该消息仍用旧密钥加密，之后接受方改用新密钥发送
+//  3. 发起方收到ACK后改用新密钥接收，并用旧密钥发送 REKEY_DONE，之后改用新密钥发送
+//  4. 接受方收到DONE后改用新密钥接收
+const (
+	REKEY_INIT = uint8(1)
+	REKEY_ACK  = uint8(2)
+	REKEY_DONE = uint8(3)
+)
+
+type Rekey struct {
+	Type       uint8
+	SessionKey []byte // 新的临时会话公钥，REKEY_DONE不携带
+}
+
+func NewRekey(typ uint8, sessionKey []byte) *Rekey {
+	return &Rekey{
+		Type:       typ,
+		SessionKey: sessionKey,
+	}
+}
+
+func (r *Rekey) Decode(data io.Reader) error {
+	err := gob.NewDecoder(data).Decode(r)
+	if err != nil {
+		return errors.Wrap(err, "Rekey_Decode")
+	}
+	return nil
+}
+
+func (r *Rekey) Encode() []byte {
+	res, _ := encoding.GobEncode(r)
+	return res
+}
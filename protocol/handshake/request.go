@@ -17,6 +17,8 @@ type Request struct {
 	NodeRole    uint8
 	From crypto.ID
 	SessionKey  []byte
+	Cipher      uint8 // 会话加密方案，见CipherAESGCMV2
+	Caps        *Capabilities // 节点能力，见capability.go
 	Sig         []byte
 }
 
@@ -30,6 +32,8 @@ func NewRequestV1(chainID uint8, codeVersion params.CodeVersion, nodeRole uint8,
 		NodeRole:    nodeRole,
 		From:        from,
 		SessionKey:  sessionKey,
+		Cipher:      CurrentCipher,
+		Caps:        DefaultCapabilities(),
 	}
 }
 
@@ -21,6 +21,8 @@ type Response struct {
 	CodeVersion params.CodeVersion
 	NodeRole    uint8		// 节点类型
 	SessionKey  []byte		// 临时会话密钥
+	Cipher      uint8		// 接受的会话加密方案
+	Caps        *Capabilities // 节点能力，见capability.go
 	Sig         []byte
 }
 
@@ -32,6 +34,8 @@ func NewAcceptResponseV1(codeVersion params.CodeVersion, nodeRole uint8,
 		CodeVersion: codeVersion,
 		NodeRole:    nodeRole,
 		SessionKey:  sessionKey,
+		Cipher:      CurrentCipher,
+		Caps:        DefaultCapabilities(),
 	}
 }
 
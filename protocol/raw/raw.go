@@ -20,6 +20,7 @@ type Tx struct {
 	Uncompleted uint8	// 交易活动未完成? 0表示false(完成)， 1表示true(未完成)
 	To crypto.ID		// 接收者账户ID
 	Amount uint32	// 转账数额
+	Fee uint32	// 交易费，可选。交易费越高越优先被打包
 	Description []byte	// 描述
 
 	// Payload 关于Payload，见core.Tx
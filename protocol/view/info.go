@@ -23,9 +23,35 @@ type TxInfo struct {
 	BlockTime      int64	// 区块构建时间（交易构建时间在core.Tx有）
 }
 
+// WorkflowInfo 两方交易流程（R2P/P2H/P2D开启的交易活动）的当前状态
+type WorkflowInfo struct {
+	Origin    crypto.Hash	// 初始交易哈希
+	Requester crypto.ID
+	Responder crypto.ID
+	State     string
+	Rounds    int	// 请求方标记未完成的轮数
+	Txs       []*core.Tx	// 从初始交易开始按先后顺序
+}
+
+// UploadInfo 已存储的上传交易的数据摘要，供数据检索
+type UploadInfo struct {
+	Hash      crypto.Hash	// 上传交易哈希
+	Uploader  crypto.ID
+	To        crypto.ID
+	Type      uint8	// 数据类型
+	Ill       uint8	// 疾病类型
+	TimeStart int64
+	TimeEnd   int64
+	Num       int64	// 数据点数
+	StoreAt   string
+	Height    uint64	// 上传交易所在区块高度
+}
+
 type AccountInfo struct {
 	TxsHashFrom []crypto.Hash	// 由该账户构建的交易
 	TxsHashTo []crypto.Hash	// 由该账户接收的交易
-	Balance    uint64
-	// TODO: Credit等
+	Balance    uint64	// 可用余额
+	Locked     uint64	// 冻结在托管池中的款项
+	Registered bool	// 是否已完成注册
+	Credit     int64	// 信誉分
 }
@@ -23,6 +23,7 @@ type TxInBlockJSON struct {
 	From string `json:"from"`
 	To     string `json:"to"`   // To.ToHex()
 	Amount uint32 `json:"amount"`
+	Fee    uint32 `json:"fee"`
 
 	// TODO
 }
@@ -53,6 +54,7 @@ func (b *BlockJSON) FromBlockInfo(info *BlockInfo) {
 		txJSON.From = tx.From.ToHex()
 		txJSON.To = tx.To.ToHex()
 		txJSON.Amount = tx.Amount
+		txJSON.Fee = tx.Fee
 		txJSON.Type = tx.Type
 		b.Txs = append(b.Txs, txJSON)
 	}
@@ -70,6 +72,7 @@ type TxJSON struct {
 	From   string `json:"from"` // From.ToHex()
 	To     string `json:"to"`   // To.ToHex()
 	Amount uint32 `json:"amount"`
+	Fee    uint32 `json:"fee"`
 	Sig    string `json:"signature"` // hex(Sig)
 
 	Payload  string `json:"payload"`    // string(Payload)
@@ -106,6 +109,9 @@ func (t *TxJSON) ToCoreTx() *core.Tx {
 	}
 
 	result := core.NewTx(t.Type, crypto.ID(from), crypto.ID(to), t.Amount, []byte(t.Payload), prevId, t.Uncompleted, []byte(t.Description))
+	if t.Fee != 0 {
+		result.SetFee(t.Fee)
+	}
 	result.Sig = sig
 
 	return result
@@ -122,6 +128,7 @@ func (t *TxJSON) FromTxInfo(info *TxInfo) {
 	t.From = info.From.ToHex()
 	t.To = info.To.ToHex()
 	t.Amount = info.Amount
+	t.Fee = info.Fee
 	t.Sig = encoding.ToHex(info.Sig)
 
 	// TODO
@@ -134,6 +141,64 @@ func (t *TxJSON) FromTxInfo(info *TxInfo) {
 
 }
 
+////////////////////////////// WorkflowJSON //////////////////////////////////////
+
+type WorkflowJSON struct {
+	Origin    string `json:"origin"`    // hex
+	Requester string `json:"requester"` // Requester.ToHex()
+	Responder string `json:"responder"` // Responder.ToHex()
+	State     string `json:"state"`
+	Rounds    int    `json:"rounds"`
+	Txs       []*TxInBlockJSON `json:"txs"`
+}
+
+func (w *WorkflowJSON) FromWorkflowInfo(info *WorkflowInfo) {
+	w.Origin = encoding.ToHex(info.Origin)
+	w.Requester = info.Requester.ToHex()
+	w.Responder = info.Responder.ToHex()
+	w.State = info.State
+	w.Rounds = info.Rounds
+
+	for _, tx := range info.Txs {
+		w.Txs = append(w.Txs, &TxInBlockJSON{
+			Id:     encoding.ToHex(tx.Id),
+			Type:   tx.Type,
+			From:   tx.From.ToHex(),
+			To:     tx.To.ToHex(),
+			Amount: tx.Amount,
+			Fee:    tx.Fee,
+		})
+	}
+}
+
+////////////////////////////// UploadJSON //////////////////////////////////////
+
+type UploadJSON struct {
+	Hash     string `json:"hash"`     // hex
+	Uploader string `json:"uploader"` // Uploader.ToHex()
+	To       string `json:"to"`       // To.ToHex()
+	Type     uint8  `json:"type"`
+	Ill      uint8  `json:"ill"`
+	Start    int64  `json:"start"`
+	End      int64  `json:"end"`
+	Num      int64  `json:"num"`
+	StoreAt  string `json:"store_at"`
+	Height   uint64 `json:"height"`
+}
+
+func (u *UploadJSON) FromUploadInfo(info *UploadInfo) {
+	u.Hash = encoding.ToHex(info.Hash)
+	u.Uploader = info.Uploader.ToHex()
+	u.To = info.To.ToHex()
+	u.Type = info.Type
+	u.Ill = info.Ill
+	u.Start = info.TimeStart
+	u.End = info.TimeEnd
+	u.Num = info.Num
+	u.StoreAt = info.StoreAt
+	u.Height = info.Height
+}
+
 ////////////////////////////// RawTxJSON //////////////////////////////////////
 
 type RawTxJSON struct {
@@ -142,6 +207,7 @@ type RawTxJSON struct {
 
 	To     string `json:"to"`   // To.ToHex()
 	Amount uint32 `json:"amount"`
+	Fee    uint32 `json:"fee"`
 
 	Payload  string `json:"payload"`    // string(Payload)
 	PrevTxId string `json:"prev_tx_id"` // hex
@@ -1,8 +1,10 @@
 package rpc
 
 import (
+	"encoding/json"
 	"github.com/azd1997/ecoin/common/crypto"
 	"github.com/azd1997/ecoin/common/encoding"
+	"io/ioutil"
 	"net/http"
 )
 
@@ -17,8 +19,16 @@ var (
 	// QueryAccountV1Path GET /v1/account
 	QueryAccountV1Path = AccountV1Path + "/query"
 
+	// RegisterV1Path POST /v1/account/register
+	RegisterV1Path = AccountV1Path + "/register"
+
+	// ReplyRegisterV1Path POST /v1/account/reply-register
+	ReplyRegisterV1Path = AccountV1Path + "/reply-register"
+
 	accountHandlers = HTTPHandlers{
 		{QueryAccountV1Path, getAccountInfo},
+		{RegisterV1Path, register},
+		{ReplyRegisterV1Path, replyRegister},
 	}
 )
 
@@ -28,8 +38,10 @@ GET /v1/account/query?id=...
 type GetAccountResponse struct {
 	TxsFrom []string `json:"txs_from"`
 	TxsTo []string `json:"txs_to"`
-	Balance    uint64   `json:"balance"`
-	Credit int64	`json:"credit"`		// TODO
+	Balance    uint64   `json:"balance"`	// 可用余额
+	Locked     uint64   `json:"locked"`	// 冻结在托管池中的款项
+	Registered bool	`json:"registered"`	// 是否已完成注册
+	Credit int64	`json:"credit"`		// 信誉分
 }
 
 func getAccountInfo(w http.ResponseWriter, r *http.Request) {
@@ -47,26 +59,114 @@ func getAccountInfo(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// 3. 查询账户相关交易Id
-	txFromHashes, txToHashes, balance, credit := globalSvr.en.QueryAccount(crypto.ID(id[0]))
-	if txFromHashes == nil && txToHashes == nil && balance == 0 {
+	info := globalSvr.en.QueryAccount(crypto.ID(id[0]))
+	if info.TxsHashFrom == nil && info.TxsHashTo == nil && info.Balance == 0 && info.Locked == 0 && !info.Registered {
 		failedResponse("Not found account", w)
 		return
 	}
 
 	// 十六进制编码
 	var hexFromHashes []string
-	for _, h := range txFromHashes {
+	for _, h := range info.TxsHashFrom {
 		hexFromHashes = append(hexFromHashes, encoding.ToHex(h))
 	}
 	var hexToHashes []string
-	for _, h := range txToHashes {
+	for _, h := range info.TxsHashTo {
 		hexToHashes = append(hexToHashes, encoding.ToHex(h))
 	}
 
 	successWithDataResponse(&GetAccountResponse{
 		TxsFrom:hexFromHashes,
 		TxsTo:hexToHashes,
-		Balance:    balance,
-		Credit:credit,
+		Balance:    info.Balance,
+		Locked:     info.Locked,
+		Registered: info.Registered,
+		Credit:     info.Credit,
 	}, w)
 }
+
+/*
+POST /v1/account/register
+{
+	"hospital":"xxxx",
+	"name":"yyy",
+	"info":"zzz"
+}
+*/
+type RegisterReq struct {
+	Hospital string `json:"hospital"`	// hex(id)，申请注册的医院
+	Name     string `json:"name"`		// 名称，病人不填
+	Info     string `json:"info"`		// 资质信息；病人则为个人信息，将使用医院公钥加密
+}
+
+type RegisterResp struct {
+	Hash string `json:"hash"`	// hex(hash)，注册申请或回复交易的哈希
+}
+
+// 以本机账户向医院申请注册
+func register(w http.ResponseWriter, r *http.Request) {
+	// 1. 读取r.Body
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		badRequestResponse(w)
+		return
+	}
+	// 2. 解码RegisterReq
+	query := &RegisterReq{}
+	if err := json.Unmarshal(body, query); err != nil {
+		badRequestResponse(w)
+		return
+	}
+	// 3. 检查医院ID
+	hospital, err := encoding.FromHex(query.Hospital)
+	if err != nil || len(hospital) != crypto.ID_LEN_WITH_ROLE {
+		badRequestResponse(w)
+		return
+	}
+	// 4. 构建注册申请
+	hash, err := globalSvr.en.Register(crypto.ID(hospital), query.Name, []byte(query.Info))
+	if err != nil {
+		failedResponse(err.Error(), w)
+		return
+	}
+
+	successWithDataResponse(&RegisterResp{Hash: encoding.ToHex(hash)}, w)
+}
+
+/*
+POST /v1/account/reply-register
+{
+	"hash":"xxxx",
+	"approved":true,
+	"reason":""
+}
+*/
+type ReplyRegisterReq struct {
+	Hash     string `json:"hash"`		// hex(hash)，注册申请交易的哈希
+	Approved bool   `json:"approved"`	// 是否通过
+	Reason   string `json:"reason"`	// 不通过的原因
+}
+
+// 以本机（医院）账户回复注册申请
+func replyRegister(w http.ResponseWriter, r *http.Request) {
+	// 1. 读取r.Body
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		badRequestResponse(w)
+		return
+	}
+	// 2. 解码ReplyRegisterReq
+	query := &ReplyRegisterReq{}
+	if err := json.Unmarshal(body, query); err != nil {
+		badRequestResponse(w)
+		return
+	}
+	// 3. 构建注册回复
+	hash, err := globalSvr.en.ReplyRegistration(query.Hash, query.Approved, query.Reason)
+	if err != nil {
+		failedResponse(err.Error(), w)
+		return
+	}
+
+	successWithDataResponse(&RegisterResp{Hash: encoding.ToHex(hash)}, w)
+}
@@ -8,6 +8,7 @@ import (
 	"github.com/azd1997/ecoin/protocol/core"
 	"github.com/azd1997/ecoin/protocol/raw"
 	"github.com/azd1997/ecoin/protocol/view"
+	"github.com/azd1997/ecoin/store/db"
 	"io/ioutil"
 	"net/http"
 )
@@ -31,10 +32,30 @@ var (
 	// QueryTxV1Path POST /v1/tx/query
 	QueryTxV1Path = TxV1Path + "/query"
 
+	// QueryWorkflowV1Path POST /v1/tx/workflow
+	QueryWorkflowV1Path = TxV1Path + "/workflow"
+
+	// SendKeysV1Path POST /v1/tx/send-keys
+	SendKeysV1Path = TxV1Path + "/send-keys"
+
+	// RequestDiagnosisV1Path POST /v1/tx/request-diagnosis
+	RequestDiagnosisV1Path = TxV1Path + "/request-diagnosis"
+
+	// OpenKeysV1Path POST /v1/tx/open-keys
+	OpenKeysV1Path = TxV1Path + "/open-keys"
+
+	// QueryUploadsV1Path POST /v1/tx/uploads
+	QueryUploadsV1Path = TxV1Path + "/uploads"
+
 	txHandlers = HTTPHandlers{
 		{UploadTxV1Path, uploadTxs},
 		{UploadTxRawV1Path, uploadRaw},
 		{QueryTxV1Path, queryTx},
+		{QueryWorkflowV1Path, queryWorkflow},
+		{SendKeysV1Path, sendKeys},
+		{RequestDiagnosisV1Path, requestDiagnosis},
+		{OpenKeysV1Path, openKeys},
+		{QueryUploadsV1Path, queryUploads},
 	}
 )
 
@@ -211,3 +232,292 @@ func queryTx(w http.ResponseWriter, r *http.Request) {
 	successWithDataResponse(resp, w)
 	return
 }
+
+/*
+
+POST /v1/tx/workflow
+{
+	"hash":"xxxx"
+}
+*/
+
+type QueryWorkflowReq struct {
+	Hash string `json:"hash"` // hex(hash)，流程中任意一笔交易的哈希
+}
+
+type QueryWorkflowResp struct {
+	Data *view.WorkflowJSON `json:"data"`
+}
+
+func queryWorkflow(w http.ResponseWriter, r *http.Request) {
+	// 1. 读取r.Body
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		badRequestResponse(w)
+		return
+	}
+
+	// 2. 解码QueryWorkflowReq
+	query := &QueryWorkflowReq{}
+	if err := json.Unmarshal(body, query); err != nil {
+		badRequestResponse(w)
+		return
+	}
+	// 3. 检查哈希长度合法性
+	h, err := encoding.FromHex(query.Hash)
+	if err != nil || len(h) != crypto.HASH_LENGTH {
+		badRequestResponse(w)
+		return
+	}
+	// 4. 查询WorkflowInfo
+	info, err := globalSvr.en.QueryWorkflow(query.Hash)
+	if err != nil {
+		failedResponse(err.Error(), w)
+		return
+	}
+	// 5. 转为WorkflowJSON
+	resp := &QueryWorkflowResp{Data: &view.WorkflowJSON{}}
+	resp.Data.FromWorkflowInfo(info)
+
+	successWithDataResponse(resp, w)
+}
+
+/*
+POST /v1/tx/send-keys
+{
+	"hash":"xxxx",
+	"keys":["xxxx", "xxxx"]
+}
+*/
+
+type SendKeysReq struct {
+	Hash string   `json:"hash"` // hex(hash)，研究机构的数据请求交易
+	Keys []string `json:"keys"` // hex(key)，各段目标数据的密钥，将包装给交易双方及仲裁候选者
+}
+
+type SendTxResp struct {
+	Hash string `json:"hash"` // hex(hash)，新构建的交易的哈希
+}
+
+// 以本机（病人）账户回复目标数据的密钥
+func sendKeys(w http.ResponseWriter, r *http.Request) {
+	// 1. 读取r.Body
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		badRequestResponse(w)
+		return
+	}
+	// 2. 解码SendKeysReq
+	query := &SendKeysReq{}
+	if err := json.Unmarshal(body, query); err != nil {
+		badRequestResponse(w)
+		return
+	}
+	keys, ok := decodeHexList(query.Keys)
+	if !ok || len(keys) == 0 {
+		badRequestResponse(w)
+		return
+	}
+	// 3. 构建密钥回复
+	hash, err := globalSvr.en.SendTargetKeys(query.Hash, keys)
+	if err != nil {
+		failedResponse(err.Error(), w)
+		return
+	}
+
+	successWithDataResponse(&SendTxResp{Hash: encoding.ToHex(hash)}, w)
+}
+
+/*
+POST /v1/tx/request-diagnosis
+{
+	"to":"xxxx",
+	"hashes":["xxxx", "xxxx"],
+	"keys":["xxxx"],
+	"amount":10
+}
+*/
+
+type RequestDiagnosisReq struct {
+	To     string   `json:"to"`     // hex(id)，医院或医生
+	Hashes []string `json:"hashes"` // hex(hash)，目标数据的上传交易
+	Keys   []string `json:"keys"`   // hex(key)，目标数据的密钥，将包装给交易双方及仲裁候选者
+	Amount uint32   `json:"amount"`
+}
+
+// 以本机（病人）账户请求诊断
+func requestDiagnosis(w http.ResponseWriter, r *http.Request) {
+	// 1. 读取r.Body
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		badRequestResponse(w)
+		return
+	}
+	// 2. 解码RequestDiagnosisReq
+	query := &RequestDiagnosisReq{}
+	if err := json.Unmarshal(body, query); err != nil {
+		badRequestResponse(w)
+		return
+	}
+	to, err := encoding.FromHex(query.To)
+	if err != nil || len(to) != crypto.ID_LEN_WITH_ROLE {
+		badRequestResponse(w)
+		return
+	}
+	rawHashes, ok := decodeHexList(query.Hashes)
+	if !ok || len(rawHashes) == 0 {
+		badRequestResponse(w)
+		return
+	}
+	var hashes []crypto.Hash
+	for _, h := range rawHashes {
+		if len(h) != crypto.HASH_LENGTH {
+			badRequestResponse(w)
+			return
+		}
+		hashes = append(hashes, h)
+	}
+	keys, ok := decodeHexList(query.Keys)
+	if !ok || len(keys) == 0 {
+		badRequestResponse(w)
+		return
+	}
+	// 3. 构建诊断请求
+	hash, err := globalSvr.en.RequestDiagnosis(crypto.ID(to), hashes, keys, query.Amount)
+	if err != nil {
+		failedResponse(err.Error(), w)
+		return
+	}
+
+	successWithDataResponse(&SendTxResp{Hash: encoding.ToHex(hash)}, w)
+}
+
+/*
+POST /v1/tx/open-keys
+{
+	"hash":"xxxx"
+}
+*/
+
+type OpenKeysReq struct {
+	Hash string `json:"hash"` // hex(hash)，携带密钥的交易
+}
+
+type OpenKeysResp struct {
+	Keys []string `json:"keys"` // hex(key)
+}
+
+// 使用本机账户打开交易中的目标数据密钥
+func openKeys(w http.ResponseWriter, r *http.Request) {
+	// 1. 读取r.Body
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		badRequestResponse(w)
+		return
+	}
+	// 2. 解码OpenKeysReq
+	query := &OpenKeysReq{}
+	if err := json.Unmarshal(body, query); err != nil {
+		badRequestResponse(w)
+		return
+	}
+	// 3. 打开密钥
+	keys, err := globalSvr.en.OpenKeys(query.Hash)
+	if err != nil {
+		failedResponse(err.Error(), w)
+		return
+	}
+	resp := &OpenKeysResp{}
+	for _, key := range keys {
+		resp.Keys = append(resp.Keys, encoding.ToHex(key))
+	}
+
+	successWithDataResponse(resp, w)
+}
+
+/*
+POST /v1/tx/uploads
+{
+	"uploader":"xxxx",
+	"type":1,
+	"ill":2,
+	"start":1585000000,
+	"end":1586000000,
+	"offset":0,
+	"limit":20
+}
+*/
+
+type QueryUploadsReq struct {
+	Uploader string `json:"uploader"` // Uploader.ToHex()，为空表示不限
+	Type     *uint8 `json:"type"`     // 数据类型，缺省表示不限
+	Ill      *uint8 `json:"ill"`      // 疾病类型，缺省表示不限
+	Start    int64  `json:"start"`    // 与采集时间区间[start, end]有重叠，为0表示不限
+	End      int64  `json:"end"`
+	Offset   int    `json:"offset"`
+	Limit    int    `json:"limit"` // 每页条数，为0或超过maxBatchQueryNum时取maxBatchQueryNum
+}
+
+type QueryUploadsResp struct {
+	Total   int                `json:"total"` // 满足条件的总数
+	Uploads []*view.UploadJSON `json:"uploads"`
+}
+
+// 按数据类型、疾病类型、采集时间区间及上传者检索已上链的数据
+func queryUploads(w http.ResponseWriter, r *http.Request) {
+	// 1. 读取r.Body
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		badRequestResponse(w)
+		return
+	}
+	// 2. 解码QueryUploadsReq
+	query := &QueryUploadsReq{}
+	if err := json.Unmarshal(body, query); err != nil {
+		badRequestResponse(w)
+		return
+	}
+	// 3. 检查检索条件
+	filter := &db.UploadFilter{Type: query.Type, Ill: query.Ill, TimeStart: query.Start, TimeEnd: query.End}
+	if query.Uploader != "" {
+		uploader, err := encoding.FromHex(query.Uploader)
+		if err != nil || len(uploader) != crypto.ID_LEN_WITH_ROLE {
+			badRequestResponse(w)
+			return
+		}
+		filter.Uploader = crypto.ID(uploader)
+	}
+	if query.Offset < 0 || query.Limit < 0 || (query.End != 0 && query.Start > query.End) {
+		badRequestResponse(w)
+		return
+	}
+	if query.Limit == 0 || query.Limit > maxBatchQueryNum {
+		query.Limit = maxBatchQueryNum
+	}
+	// 4. 检索
+	uploads, total, err := globalSvr.en.QueryUploads(filter, query.Offset, query.Limit)
+	if err != nil {
+		failedResponse(err.Error(), w)
+		return
+	}
+	resp := &QueryUploadsResp{Total: total, Uploads: []*view.UploadJSON{}}
+	for _, u := range uploads {
+		uploadJSON := &view.UploadJSON{}
+		uploadJSON.FromUploadInfo(u)
+		resp.Uploads = append(resp.Uploads, uploadJSON)
+	}
+
+	successWithDataResponse(resp, w)
+}
+
+func decodeHexList(hexes []string) ([][]byte, bool) {
+	var result [][]byte
+	for _, h := range hexes {
+		b, err := encoding.FromHex(h)
+		if err != nil || len(b) == 0 {
+			return nil, false
+		}
+		result = append(result, b)
+	}
+	return result, true
+}
@@ -1,14 +1,24 @@
 package storage
 
-import "github.com/azd1997/ecoin/common"
+import (
+	"fmt"
+	"net/url"
+	"sort"
+
+	"github.com/azd1997/ecoin/common"
+)
 
 // DataStorage 数据存储接口，标志数据库等
+// 数据仓库中的每条记录对应一个采集时刻（Unix时间戳），按时间区间与点数查询：
+// 取时间在[startTime, endTime]内的记录（endTime为0表示不限），按时间先后排列，
+// numsOfRecords不为0时Get最多返回这么多条，Query要求至少有这么多条
 type DataStorage interface {
 	Get(startTime common.TimeStamp, endTime common.TimeStamp, numsOfRecords uint) (records [][]byte, err error)
 	Query(startTime common.TimeStamp, endTime common.TimeStamp, numsOfRecords uint) (ok bool, err error)
 	IsOk() bool		// 判断可用与否
 }
 
+// MosquittoBroker Mosquitto数据仓库，尚未实现：查询总是成功且不返回数据，因此Open不支持mqtt://
 type MosquittoBroker struct {
 	Addr string
 }
@@ -26,3 +36,66 @@ func (broker *MosquittoBroker) Get(startTime common.TimeStamp, endTime common.Ti
 func (broker *MosquittoBroker) IsOk() bool {
 	return true
 }
+
+// Open 根据数据仓库地址（TargetInfo.StoreAt）的scheme获取数据仓库
+//	file:///path/to/dir      本地文件系统，见LocalStorage
+//	http(s)://host/prefix    HTTP对象存储，见HTTPStorage
+// mqtt://暂不支持，直到有真正的Mosquitto适配，否则任意声称的数据都能通过检查
+func Open(storeAt string) (DataStorage, error) {
+	if storeAt == "" {
+		return nil, fmt.Errorf("empty storage address")
+	}
+	u, err := url.Parse(storeAt)
+	if err != nil {
+		return nil, fmt.Errorf("invalid storage address %s: %v", storeAt, err)
+	}
+	switch u.Scheme {
+	case "file":
+		if u.Path == "" {
+			return nil, fmt.Errorf("invalid storage address %s: empty path", storeAt)
+		}
+		return NewLocalStorage(u.Path), nil
+	case "http", "https":
+		return NewHTTPStorage(storeAt), nil
+	default:
+		return nil, fmt.Errorf("unsupported storage scheme %q in %s", u.Scheme, storeAt)
+	}
+}
+
+// OpenRemote 获取他人（如其他节点的交易）所声称的数据仓库
+// 不允许访问本机文件系统，HTTP对象存储只连接公网地址且响应体最长maxBody字节，见NewRemoteHTTPStorage
+func OpenRemote(storeAt string, maxBody int64) (DataStorage, error) {
+	if IsLocal(storeAt) {
+		return nil, fmt.Errorf("remote storage address %s refers to local file system", storeAt)
+	}
+	ds, err := Open(storeAt)
+	if err != nil {
+		return nil, err
+	}
+	if _, ok := ds.(*HTTPStorage); ok {
+		return NewRemoteHTTPStorage(storeAt, maxBody), nil
+	}
+	return ds, nil
+}
+
+// IsLocal 数据仓库地址是否指向本机文件系统
+func IsLocal(storeAt string) bool {
+	u, err := url.Parse(storeAt)
+	return err == nil && u.Scheme == "file"
+}
+
+// 从按时间先后排列的时间戳中选出时间在[start, end]内的（end为0表示不限），num不为0时最多选num个
+func selectTimes(times []int64, start, end common.TimeStamp, num uint) []int64 {
+	sort.Slice(times, func(i, j int) bool { return times[i] < times[j] })
+	var result []int64
+	for _, t := range times {
+		if t < int64(start) || (end != 0 && t > int64(end)) {
+			continue
+		}
+		if num != 0 && uint(len(result)) >= num {
+			break
+		}
+		result = append(result, t)
+	}
+	return result
+}
@@ -0,0 +1,175 @@
+package storage
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"github.com/azd1997/ecoin/common"
+	"github.com/azd1997/ecoin/protocol/core"
+)
+
+func TestDataStorage(t *testing.T) {
+	dir, err := ioutil.TempDir("", "datastorage")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	local := NewLocalStorage(dir)
+	for ts := 10; ts <= 50; ts += 10 {
+		if err := local.Put(common.TimeStamp(ts), []byte{byte(ts)}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	server := httptest.NewServer(NewHTTPHandler(local))
+	defer server.Close()
+
+	stores := map[string]string{
+		"local": "file://" + dir,
+		"http":  server.URL,
+	}
+	for name, storeAt := range stores {
+		ds, err := Open(storeAt)
+		if err != nil {
+			t.Fatalf("%s: open %s failed: %v", name, storeAt, err)
+		}
+		if !ds.IsOk() {
+			t.Fatalf("%s: storage is unavailable", name)
+		}
+
+		// 按时间区间取，点数限制取最早的若干条
+		records, err := ds.Get(20, 40, 0)
+		if err != nil || !bytes.Equal(bytes.Join(records, nil), []byte{20, 30, 40}) {
+			t.Fatalf("%s: get [20, 40] = %v, %v", name, records, err)
+		}
+		records, err = ds.Get(20, 0, 2)
+		if err != nil || !bytes.Equal(bytes.Join(records, nil), []byte{20, 30}) {
+			t.Fatalf("%s: get [20, -] num 2 = %v, %v", name, records, err)
+		}
+
+		queries := []struct {
+			start, end common.TimeStamp
+			num        uint
+			ok         bool
+		}{
+			{10, 50, 5, true},
+			{10, 50, 6, false},
+			{15, 25, 0, true},
+			{51, 60, 0, false},
+		}
+		for _, q := range queries {
+			if ok, err := ds.Query(q.start, q.end, q.num); err != nil || ok != q.ok {
+				t.Fatalf("%s: query [%d, %d] num %d = %v, %v", name, q.start, q.end, q.num, ok, err)
+			}
+		}
+
+		// 抽样的记录及证明与全部记录的承诺一致
+		all, _ := ds.Get(10, 50, 0)
+		ti, _ := core.NewTargetInfo(storeAt, 0, 0, 10, 50, all)
+		for i := range all {
+			record, proof, err := Sample(ds, 10, 50, 0, uint(i))
+			if err != nil || !ti.CheckSegment(i, record, proof) {
+				t.Fatalf("%s: sample %d mismatches commitment: %v", name, i, err)
+			}
+		}
+		if _, _, err := Sample(ds, 10, 50, 0, uint(len(all))); err == nil {
+			t.Fatalf("%s: sample out of range should fail", name)
+		}
+
+		// 区间内的记录多于承诺的条数时，证明只基于承诺的最早Num条记录
+		first, _ := ds.Get(10, 50, 3)
+		ti, _ = core.NewTargetInfo(storeAt, 0, 0, 10, 50, first)
+		for i := range first {
+			record, proof, err := Sample(ds, 10, 50, uint(ti.Num), uint(i))
+			if err != nil || !ti.CheckSegment(i, record, proof) {
+				t.Fatalf("%s: sample %d of first %d mismatches commitment: %v", name, i, ti.Num, err)
+			}
+		}
+		if _, _, err := Sample(ds, 10, 50, uint(ti.Num), uint(ti.Num)); err == nil {
+			t.Fatalf("%s: sample beyond Num should fail", name)
+		}
+
+		td, err := NewTargetData(storeAt, 10, 50, 5)
+		if err != nil || td.IsOk() != nil {
+			t.Fatalf("%s: target data should be ok: %v", name, err)
+		}
+		td.NumsOfRecords = 6
+		if td.IsOk() == nil {
+			t.Fatalf("%s: target data should not be ok", name)
+		}
+	}
+
+	for _, storeAt := range []string{"", "ftp://store", "file://", "mqtt://broker:1883"} {
+		if _, err := Open(storeAt); err == nil {
+			t.Fatalf("open %q should fail", storeAt)
+		}
+	}
+	if NewLocalStorage(dir + "/missing").IsOk() {
+		t.Fatal("missing dir should be unavailable")
+	}
+}
+
+func TestRemoteStorage(t *testing.T) {
+	dir, err := ioutil.TempDir("", "remotestorage")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	local := NewLocalStorage(dir)
+	for ts := 10; ts <= 50; ts += 10 {
+		if err := local.Put(common.TimeStamp(ts), bytes.Repeat([]byte{byte(ts)}, 64)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	server := httptest.NewServer(NewHTTPHandler(local))
+	defer server.Close()
+
+	// 不允许访问本机文件系统及非公网地址
+	if _, err := OpenRemote("file://"+dir, 1<<20); err == nil {
+		t.Fatal("remote storage should not open local file system")
+	}
+	ds, err := OpenRemote(server.URL, 1<<20)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ds.Query(10, 50, 5); err == nil {
+		t.Fatal("remote storage should not connect to loopback address")
+	}
+	if ds.(*HTTPStorage).client.CheckRedirect(nil, nil) == nil {
+		t.Fatal("remote storage should not follow redirects")
+	}
+
+	for ip, public := range map[string]bool{
+		"8.8.8.8":         true,
+		"2001:4860::8888": true,
+		"127.0.0.1":       false,
+		"10.1.2.3":        false,
+		"172.16.0.1":      false,
+		"192.168.1.1":     false,
+		"169.254.169.254": false,
+		"0.0.0.0":         false,
+		"::1":             false,
+		"fe80::1":         false,
+		"fd00::1":         false,
+		"::ffff:10.0.0.1": false,
+	} {
+		if IsPublicIP(net.ParseIP(ip)) != public {
+			t.Fatalf("%s: public should be %v", ip, public)
+		}
+	}
+
+	// 超过长度限制的响应被拒绝
+	hs := NewHTTPStorage(server.URL)
+	if records, err := hs.Get(10, 50, 0); err != nil || len(records) != 5 {
+		t.Fatalf("get = %d records, %v", len(records), err)
+	}
+	hs.maxBody = 128
+	if _, err := hs.Get(10, 50, 0); err == nil {
+		t.Fatal("oversize response should be rejected")
+	}
+}
@@ -6,6 +6,7 @@ import (
 
 	"github.com/pkg/errors"
 	"path/filepath"
+	"sort"
 	"time"
 
 	"github.com/azd1997/ego/epattern"
@@ -98,6 +99,18 @@ func (b *badgerDB) PutGenesis(block *core.Block) error {
 			return err
 		}
 
+		// 创世区块的构建者及出块奖励的接收者为初始账户，视为已注册，由它们（医院）开始审核其他账户的注册
+		if err := tx.Set(getRegistryKey(block.CreateBy), block.Hash); err != nil {
+			return err
+		}
+		for _, cb := range block.Txs {
+			if cb.Type == core.TX_COINBASE {
+				if err := tx.Set(getRegistryKey(cb.To), cb.Id); err != nil {
+					return err
+				}
+			}
+		}
+
 		if err := b.updateLatestHeightTxn(1, tx); err != nil {
 			return err
 		}
@@ -310,6 +323,25 @@ func (b *badgerDB) GetTxToHashesViaID(id crypto.ID) ([]crypto.Hash, []uint64, er
 	return txHashes, heights, nil
 }
 
+// GetNextTxHash 获取以prev为来源交易的后续交易的哈希
+func (b *badgerDB) GetNextTxHash(prev crypto.Hash) (crypto.Hash, error) {
+	var result crypto.Hash
+	rf := func(txn *badger.Txn) error {
+		item, err := txn.Get(getTxNextKey(prev))
+		if err != nil {
+			return err
+		}
+
+		return item.Value(func(val []byte) error {
+			result = make([]byte, len(val))
+			copy(result, val)
+			return nil
+		})
+	}
+
+	return result, b.view(rf)
+}
+
 // HasTx 查看数据库中是否存在某个交易
 func (b *badgerDB) HasTx(h crypto.Hash) bool {
 	rf := func(tx *badger.Txn) error {
@@ -356,6 +388,137 @@ func (b *badgerDB) GetBalanceViaID(id crypto.ID) (uint64, error) {
 	return result, nil
 }
 
+// GetLockedViaID 通过ID来获取其冻结在托管池中的款项
+func (b *badgerDB) GetLockedViaID(id crypto.ID) (uint64, error) {
+	var result uint64
+
+	rf := func(txn *badger.Txn) error {
+		item, err := txn.Get(getLockedKey(id))
+		if err != nil {
+			return err
+		}
+
+		return item.Value(func(val []byte) error {
+			result = byteh(val)
+			return nil
+		})
+	}
+
+	err := b.View(rf)
+	if err == badger.ErrKeyNotFound {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, b.wrapError(err)
+	}
+	return result, nil
+}
+
+// GetCreditViaID 通过ID来获取其信誉分
+func (b *badgerDB) GetCreditViaID(id crypto.ID) (int64, error) {
+	var result int64
+	rf := func(txn *badger.Txn) error {
+		var err error
+		result, err = b.getCreditTxn(id, txn)
+		return err
+	}
+
+	return result, b.view(rf)
+}
+
+// GetEscrow 获取记在交易h名下的托管款项
+func (b *badgerDB) GetEscrow(h crypto.Hash) (*core.Escrow, error) {
+	var result *core.Escrow
+	rf := func(txn *badger.Txn) error {
+		var err error
+		result, err = b.getEscrowTxn(h, txn)
+		return err
+	}
+
+	return result, b.view(rf)
+}
+
+// GetRegistration 查询账户的注册记录
+func (b *badgerDB) GetRegistration(id crypto.ID) (crypto.Hash, error) {
+	var result crypto.Hash
+	rf := func(txn *badger.Txn) error {
+		item, err := txn.Get(getRegistryKey(id))
+		if err != nil {
+			return err
+		}
+
+		return item.Value(func(val []byte) error {
+			result = make([]byte, len(val))
+			copy(result, val)
+			return nil
+		})
+	}
+
+	return result, b.view(rf)
+}
+
+// GetUploads 按条件检索上传交易，返回排序后第offset条起最多limit条（limit为0表示不限），以及满足条件的总数
+// 指定了上传者，或同时指定了数据类型与疾病类型时，使用对应的索引；否则遍历全部上传交易
+func (b *badgerDB) GetUploads(filter *UploadFilter, offset, limit int) ([]*Upload, int, error) {
+	var matched []*Upload
+	rf := func(txn *badger.Txn) error {
+		prefix, indirect := uploadPrefix, false
+		switch {
+		case filter.Uploader != "":
+			prefix, indirect = getAccountUploadKeyPrefix(filter.Uploader), true
+		case filter.Type != nil && filter.Ill != nil:
+			prefix, indirect = getUploadTypeKeyPrefix(*filter.Type, *filter.Ill), true
+		}
+
+		opts := badger.DefaultIteratorOptions
+		opts.PrefetchValues = !indirect
+		it := txn.NewIterator(opts)
+		defer it.Close()
+
+		for it.Seek(prefix); it.ValidForPrefix(prefix); it.Next() {	// 按前缀迭代Key，同一前缀下按采集开始时间有序
+			item := it.Item()
+			tail := item.Key()[len(prefix):]	// timeStart + hash
+			timeStart := int64(byteh(tail[:8]))
+			if filter.TimeEnd != 0 && timeStart > filter.TimeEnd {
+				break
+			}
+
+			u := &Upload{}
+			var err error
+			if indirect {
+				hash := make([]byte, len(tail)-8)
+				copy(hash, tail[8:])
+				u, err = b.getUploadTxn(timeStart, hash, txn)
+			} else {
+				err = item.Value(func(val []byte) error {
+					return u.Decode(bytes.NewReader(val))
+				})
+			}
+			if err != nil {
+				return err
+			}
+			if filter.match(u) {
+				matched = append(matched, u)
+			}
+		}
+		return nil
+	}
+	if err := b.view(rf); err != nil {
+		return nil, 0, err
+	}
+
+	sort.Slice(matched, func(i, j int) bool { return uploadLess(matched[i], matched[j]) })
+	total := len(matched)
+	if offset >= total {
+		return nil, total, nil
+	}
+	matched = matched[offset:]
+	if limit > 0 && limit < len(matched) {
+		matched = matched[:limit]
+	}
+	return matched, total, nil
+}
+
 // GetLatestHeight 获取最新的区块高度
 func (b *badgerDB) GetLatestHeight() (uint64, error) {
 	var result uint64
@@ -533,7 +696,7 @@ func (b *badgerDB) putBlockTxn(block *core.Block, height uint64, txn *badger.Txn
 
 	// 存储区块内的交易列表
 	if !block.IsEmptyMerkleRoot() {
-		if err := b.putTxTxn(hash, block.Txs, height, txn); err != nil {
+		if err := b.putTxTxn(hash, block.CreateBy, block.Txs, height, txn); err != nil {
 			return err
 		}
 	} else {
@@ -563,8 +726,10 @@ func (b *badgerDB) putBlockTxn(block *core.Block, height uint64, txn *badger.Txn
 }
 
 // 用来批量插入新交易的事务
-func (b *badgerDB) putTxTxn(hash crypto.Hash, txs []*core.Tx, height uint64, txn *badger.Txn) error {
+// 交易费由区块构建者creator获得
+func (b *badgerDB) putTxTxn(hash crypto.Hash, creator crypto.ID, txs []*core.Tx, height uint64, txn *badger.Txn) error {
 	var txHashes [][]byte
+	var fees int64
 	for _, tx := range txs {
 		storageData := tx.Encode()
 
@@ -576,20 +741,52 @@ func (b *badgerDB) putTxTxn(hash crypto.Hash, txs []*core.Tx, height uint64, txn
 		if err := txn.Set(getTxHeightKey(tx.Id), hbyte(height)); err != nil {
 			return err
 		}
+		// 记录来源交易的后续交易，用于沿交易流程向后查找
+		if tx.HasPrevTx() {
+			if err := txn.Set(getTxNextKey(tx.PrevTxId), tx.Id); err != nil {
+				return err
+			}
+		}
 		// 更新账户与交易的关联，更新发起方/接收方的余额
+		// 请求类交易的转账数额冻结在托管池，接收方暂不入账
 		if tx.From != crypto.ZeroID {
 			if err := b.updateAccountTxFromTxn(tx, height, txn); err != nil {
 				return err
 			}
-			if err := b.updateBalanceTxn(tx.From, -int64(tx.Amount), txn); err != nil {
+			if err := b.updateBalanceTxn(tx.From, -int64(tx.Amount)-int64(tx.Fee), txn); err != nil {
 				return err
 			}
+			fees += int64(tx.Fee)
 		}
 		if tx.To != crypto.ZeroID {
 			if err := b.updateAccountTxToTxn(tx, height, txn); err != nil {
 				return err
 			}
-			if err := b.updateBalanceTxn(tx.To, int64(tx.Amount), txn); err != nil {
+			if !tx.IsRequest() {
+				if err := b.updateBalanceTxn(tx.To, int64(tx.Amount), txn); err != nil {
+					return err
+				}
+			}
+		}
+		// 托管池
+		if err := b.updateEscrowTxn(tx, txn); err != nil {
+			return err
+		}
+		// 未出块胜者扣除信誉分
+		if tx.Type == core.TX_COINBASE {
+			if err := b.updateCreditsTxn(core.CreditDeltas(tx, nil), txn); err != nil {
+				return err
+			}
+		}
+		// 注册
+		if id, ok := tx.Registration(); ok {
+			if err := txn.Set(getRegistryKey(id), tx.Id); err != nil {
+				return err
+			}
+		}
+		// 上传交易索引
+		if tx.Type == core.TX_UPLOAD {
+			if err := b.putUploadTxn(tx, height, txn); err != nil {
 				return err
 			}
 		}
@@ -598,6 +795,13 @@ func (b *badgerDB) putTxTxn(hash crypto.Hash, txs []*core.Tx, height uint64, txn
 		txHashes = append(txHashes, tx.Hash())
 	}
 
+	// 区块构建者获得交易费
+	if fees > 0 {
+		if err := b.updateBalanceTxn(creator, fees, txn); err != nil {
+			return err
+		}
+	}
+
 	// 存储“区块体”数据：这个区块体只包含交易列表的哈希
 	block := storage.NewBlock(txHashes)
 	storageData := block.Encode()
@@ -623,6 +827,161 @@ func (b *badgerDB) updateAccountTxToTxn(tx *core.Tx, height uint64, txn *badger.
 	return txn.Set(accountTxKey, heightValue)
 }
 
+// 用来处理交易对托管池的操作的事务，规则见core.Tx.EscrowOp
+func (b *badgerDB) updateEscrowTxn(tx *core.Tx, txn *badger.Txn) error {
+	switch tx.EscrowOp() {
+	case core.EscrowLock:
+		e := &core.Escrow{Requester: tx.From, Responder: tx.To, Amount: uint64(tx.Amount)}
+		if err := txn.Set(getEscrowKey(tx.Id), e.Encode()); err != nil {
+			return err
+		}
+		return b.updateLockedTxn(tx.From, int64(tx.Amount), txn)
+	case core.EscrowCarry:
+		e, err := b.getEscrowTxn(tx.PrevTxId, txn)
+		if err == badger.ErrKeyNotFound {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if err := txn.Delete(getEscrowKey(tx.PrevTxId)); err != nil {
+			return err
+		}
+		if tx.IsRequest() {
+			e.Amount += uint64(tx.Amount)
+			if err := b.updateLockedTxn(e.Requester, int64(tx.Amount), txn); err != nil {
+				return err
+			}
+		}
+		return txn.Set(getEscrowKey(tx.Id), e.Encode())
+	case core.EscrowRelease, core.EscrowSplit:
+		e, err := b.getEscrowTxn(tx.PrevTxId, txn)
+		if err == badger.ErrKeyNotFound {
+			e, err = &core.Escrow{Requester: tx.From, Responder: tx.To}, nil
+		} else if err == nil {
+			// 仲裁结果影响交易双方的信誉分
+			if err = txn.Delete(getEscrowKey(tx.PrevTxId)); err == nil {
+				err = b.updateCreditsTxn(core.CreditDeltas(tx, e), txn)
+			}
+		}
+		if err != nil {
+			return err
+		}
+		for id, amount := range e.Settle(tx) {
+			if err := b.updateBalanceTxn(id, int64(amount), txn); err != nil {
+				return err
+			}
+		}
+		return b.updateLockedTxn(e.Requester, -int64(e.Amount), txn)
+	}
+	return nil
+}
+
+// 读取记在交易hash名下的托管款项
+func (b *badgerDB) getEscrowTxn(hash crypto.Hash, txn *badger.Txn) (*core.Escrow, error) {
+	item, err := txn.Get(getEscrowKey(hash))
+	if err != nil {
+		return nil, err
+	}
+
+	result := &core.Escrow{}
+	err = item.Value(func(val []byte) error {
+		return result.Decode(bytes.NewReader(val))
+	})
+	return result, err
+}
+
+// 为上传交易建立索引的事务。无法解析数据摘要的上传交易不建立索引
+func (b *badgerDB) putUploadTxn(tx *core.Tx, height uint64, txn *badger.Txn) error {
+	ti := &core.TargetInfo{}
+	if err := ti.Decode(bytes.NewReader(tx.Payload)); err != nil {
+		return nil
+	}
+	tail := append(hbyte(uint64(ti.TimeStart)), tx.Id...)
+
+	if err := txn.Set(getUploadKey(ti.TimeStart, tx.Id), newUpload(tx, ti, height).Encode()); err != nil {
+		return err
+	}
+	if err := txn.Set(append(getUploadTypeKeyPrefix(ti.Type, ti.Ill), tail...), placeHolder); err != nil {
+		return err
+	}
+	return txn.Set(append(getAccountUploadKeyPrefix(tx.From), tail...), placeHolder)
+}
+
+func (b *badgerDB) getUploadTxn(timeStart int64, hash crypto.Hash, txn *badger.Txn) (*Upload, error) {
+	item, err := txn.Get(getUploadKey(timeStart, hash))
+	if err != nil {
+		return nil, err
+	}
+
+	result := &Upload{}
+	err = item.Value(func(val []byte) error {
+		return result.Decode(bytes.NewReader(val))
+	})
+	return result, err
+}
+
+// 更新账户冻结在托管池中的款项的事务
+func (b *badgerDB) updateLockedTxn(id crypto.ID, inc int64, txn *badger.Txn) error {
+	if inc == 0 {
+		return nil
+	}
+	lockedKey := getLockedKey(id)
+
+	item, err := txn.Get(lockedKey)
+	if err != nil && err != badger.ErrKeyNotFound {
+		return err
+	}
+
+	origin := int64(0)
+	if err != badger.ErrKeyNotFound {
+		item.Value(func(val []byte) error {
+			origin = int64(byteh(val))
+			return nil
+		})
+	}
+
+	if origin+inc < 0 {
+		return errors.New("not sufficient locked balance")
+	}
+	return txn.Set(lockedKey, hbyte(uint64(origin+inc)))
+}
+
+// 读取账户信誉分的事务。没有记录的账户为初始积分
+func (b *badgerDB) getCreditTxn(id crypto.ID, txn *badger.Txn) (int64, error) {
+	item, err := txn.Get(getCreditKey(id))
+	if err == badger.ErrKeyNotFound {
+		return core.CreditInit, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	var result int64
+	err = item.Value(func(val []byte) error {
+		result = int64(byteh(val))
+		return nil
+	})
+	return result, err
+}
+
+// 用来批量更新账户信誉分的事务。信誉分可以为负
+func (b *badgerDB) updateCreditsTxn(deltas map[crypto.ID]int64, txn *badger.Txn) error {
+	for id, inc := range deltas {
+		if inc == 0 {
+			continue
+		}
+		origin, err := b.getCreditTxn(id, txn)
+		if err != nil {
+			return err
+		}
+		if err := txn.Set(getCreditKey(id), hbyte(uint64(origin+inc))); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 // 用来更新最高高度的事务
 func (b *badgerDB) updateLatestHeightTxn(height uint64, txn *badger.Txn) error {
 	if err := txn.Set(mLatestHeight, hbyte(height)); err != nil {
@@ -23,11 +23,17 @@ type db interface {
 	GetTxViaHash(h crypto.Hash) (*core.Tx, uint64, error)
 	GetTxFromHashesViaID(id crypto.ID) ([]crypto.Hash, []uint64, error)
 	GetTxToHashesViaID(id crypto.ID) ([]crypto.Hash, []uint64, error)
+	GetNextTxHash(prev crypto.Hash) (crypto.Hash, error)
 
 
 	HasTx(h crypto.Hash) bool
 
 	GetBalanceViaID(id crypto.ID) (uint64, error)
+	GetLockedViaID(id crypto.ID) (uint64, error)
+	GetEscrow(h crypto.Hash) (*core.Escrow, error)
+	GetRegistration(id crypto.ID) (crypto.Hash, error)
+	GetCreditViaID(id crypto.ID) (int64, error)
+	GetUploads(filter *UploadFilter, offset, limit int) ([]*Upload, int, error)
 
 	GetLatestHeight() (uint64, error)
 	GetLatestHeader() (*core.BlockHeader, uint64, []byte, error)
@@ -100,6 +106,11 @@ func GetTxToHashesViaID(id crypto.ID) ([]crypto.Hash, []uint64, error) {
 	return instance.GetTxToHashesViaID(id)
 }
 
+// GetNextTxHash 根据来源交易哈希查询以其为来源交易的后续交易哈希
+func GetNextTxHash(prev crypto.Hash) (crypto.Hash, error) {
+	return instance.GetNextTxHash(prev)
+}
+
 // HasTx 根据交易哈希判断是否存在某个交易
 func HasTx(h crypto.Hash) bool {
 	return instance.HasTx(h)
@@ -110,11 +121,36 @@ func GetBalanceViaID(id crypto.ID) (uint64, error) {
 	return instance.GetBalanceViaID(id)
 }
 
-// TODO
-// GetCreditViaID 查询账户的信誉分
-//func GetCreditViaID(id crypto.ID) (uint64, error) {
-//	return instance.GetCreditViaID(id)
-//}
+// GetLockedViaID 查询账户冻结在托管池中的款项
+func GetLockedViaID(id crypto.ID) (uint64, error) {
+	return instance.GetLockedViaID(id)
+}
+
+// GetEscrow 根据交易流程最新一笔交易的哈希查询托管款项
+func GetEscrow(h crypto.Hash) (*core.Escrow, error) {
+	return instance.GetEscrow(h)
+}
+
+// GetRegistration 查询账户的注册记录，返回使账户完成注册的交易哈希
+func GetRegistration(id crypto.ID) (crypto.Hash, error) {
+	return instance.GetRegistration(id)
+}
+
+// IsRegistered 账户是否已完成注册
+func IsRegistered(id crypto.ID) bool {
+	_, err := instance.GetRegistration(id)
+	return err == nil
+}
+
+// GetCreditViaID 查询账户的信誉分。没有记录的账户为初始积分core.CreditInit
+func GetCreditViaID(id crypto.ID) (int64, error) {
+	return instance.GetCreditViaID(id)
+}
+
+// GetUploads 按条件检索已存储的上传交易，返回第offset条起最多limit条（limit为0表示不限），以及满足条件的总数
+func GetUploads(filter *UploadFilter, offset, limit int) ([]*Upload, int, error) {
+	return instance.GetUploads(filter, offset, limit)
+}
 
 // GetLatestHeight 获取最高高度
 func GetLatestHeight() (uint64, error) {
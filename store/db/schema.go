@@ -14,10 +14,17 @@ var (
 	blockPrefix          = []byte("B")     // blockPrefix + height + hash -> block
 	txPrefix       = []byte("T")     // txPrefix + height + hash -> tx
 	txHeightPrefix = []byte("N")     // txHeightPrefix + hash -> height
+	txNextPrefix   = []byte("X")     // txNextPrefix + prevTxHash -> next tx hash
+	escrowPrefix   = []byte("E")     // escrowPrefix + txHash -> escrow
+	registryPrefix = []byte("G")     // registryPrefix + id -> hash of the tx which completes registration
+	uploadPrefix   = []byte("U")     // uploadPrefix + timeStart + txHash -> upload index
+	uploadTypePrefix = []byte("V")   // uploadTypePrefix + type + ill + timeStart + txHash -> placeHolder
 	balanceSuffix          = []byte("b") // id + balanceSuffix -> balance
 	creditSuffix          = []byte("c") // id + creditSuffix -> credit
+	lockedSuffix          = []byte("l") // id + lockedSuffix -> locked balance
 	txFromSuffix       = []byte("f")     // id + txFromSuffix + txHash -> height
 	txToSuffix       = []byte("t")     // id + txToSuffix + txHash -> height
+	uploadSuffix       = []byte("u")     // id + uploadSuffix + timeStart + txHash -> placeHolder
 
 	// meta data key should begin with 'm'
 	mLatestHeight = []byte("mLatestHeight")
@@ -75,12 +82,36 @@ func getTxHeightKey(hash crypto.Hash) []byte {
 	return append(txHeightPrefix, hash...)
 }
 
+// X..
+// getTxNextKey用来根据来源交易哈希查询其后续交易的哈希
+func getTxNextKey(prevHash crypto.Hash) []byte {
+	return append(txNextPrefix, prevHash...)
+}
+
+// E..
+// getEscrowKey用来根据交易流程最新一笔交易的哈希查询托管款项
+func getEscrowKey(hash crypto.Hash) []byte {
+	return append(escrowPrefix, hash...)
+}
+
+// G..
+// getRegistryKey用来根据用户ID查询其注册记录
+func getRegistryKey(id crypto.ID) []byte {
+	return append(registryPrefix, []byte(id)...)
+}
+
 // ..b
 // getBalanceKey用来根据用户ID查询余额
 func getBalanceKey(id crypto.ID) []byte {
 	return append([]byte(id), balanceSuffix...)
 }
 
+// ..l
+// getLockedKey用来根据用户ID查询冻结在托管池中的款项
+func getLockedKey(id crypto.ID) []byte {
+	return append([]byte(id), lockedSuffix...)
+}
+
 // ..c
 // getCreditKey用来根据用户ID查询信用积分
 func getCreditKey(id crypto.ID) []byte {
@@ -98,3 +129,21 @@ func getAccountTxFromKeyPrefix(id crypto.ID) []byte {
 func getAccountTxToKeyPrefix(id crypto.ID) []byte {
 	return append([]byte(id), txToSuffix...)
 }
+
+// U..
+// getUploadKey用来根据采集开始时间和上传交易哈希查询上传交易索引，按采集开始时间有序
+func getUploadKey(timeStart int64, hash crypto.Hash) []byte {
+	return append(append(append([]byte{}, uploadPrefix...), hbyte(uint64(timeStart))...), hash...)
+}
+
+// V..
+// getUploadTypeKeyPrefix 按数据类型和疾病类型检索上传交易的前缀，其后为采集开始时间和上传交易哈希
+func getUploadTypeKeyPrefix(typ, ill uint8) []byte {
+	return append(append([]byte{}, uploadTypePrefix...), typ, ill)
+}
+
+// ..u
+// getAccountUploadKeyPrefix 按上传者检索上传交易的前缀，其后为采集开始时间和上传交易哈希
+func getAccountUploadKeyPrefix(id crypto.ID) []byte {
+	return append([]byte(id), uploadSuffix...)
+}
@@ -0,0 +1,96 @@
+package db
+
+import (
+	"bytes"
+	"encoding/gob"
+	"io"
+
+	"github.com/pkg/errors"
+
+	"github.com/azd1997/ecoin/common/crypto"
+	"github.com/azd1997/ecoin/common/encoding"
+	"github.com/azd1997/ecoin/protocol/core"
+)
+
+// 上传交易索引
+// 研究机构购买数据前需要知道上传交易的哈希（见core.TargetData），
+// 因此已存储区块中的上传交易按数据类型、疾病类型、采集时间区间以及上传者建立索引，供检索
+
+// Upload 上传交易的索引项
+type Upload struct {
+	Hash      crypto.Hash // 上传交易哈希
+	Uploader  crypto.ID   // 上传者（病人）
+	To        crypto.ID   // 上传到的医院
+	Type      uint8       // 数据类型
+	Ill       uint8       // 疾病类型
+	TimeStart int64       // 数据采集的开始时间
+	TimeEnd   int64       // 数据采集的结束时间
+	Num       int64       // 数据点数
+	StoreAt   string      // 数据仓库地址
+	Height    uint64      // 上传交易所在区块高度
+}
+
+func newUpload(tx *core.Tx, ti *core.TargetInfo, height uint64) *Upload {
+	return &Upload{
+		Hash:      tx.Id,
+		Uploader:  tx.From,
+		To:        tx.To,
+		Type:      ti.Type,
+		Ill:       ti.Ill,
+		TimeStart: ti.TimeStart,
+		TimeEnd:   ti.TimeEnd,
+		Num:       ti.Num,
+		StoreAt:   ti.StoreAt,
+		Height:    height,
+	}
+}
+
+// Encode 编码
+func (u *Upload) Encode() []byte {
+	res, _ := encoding.GobEncode(u)
+	return res
+}
+
+// Decode 解码
+func (u *Upload) Decode(data io.Reader) error {
+	if err := gob.NewDecoder(data).Decode(u); err != nil {
+		return errors.Wrap(err, "Upload_Decode")
+	}
+	return nil
+}
+
+// UploadFilter 上传交易的检索条件，零值（nil）表示不限
+type UploadFilter struct {
+	Uploader  crypto.ID
+	Type      *uint8
+	Ill       *uint8
+	TimeStart int64 // 检索采集时间与[TimeStart, TimeEnd]有重叠的数据，为0表示不限
+	TimeEnd   int64
+}
+
+func (f *UploadFilter) match(u *Upload) bool {
+	if f.Uploader != "" && u.Uploader != f.Uploader {
+		return false
+	}
+	if f.Type != nil && u.Type != *f.Type {
+		return false
+	}
+	if f.Ill != nil && u.Ill != *f.Ill {
+		return false
+	}
+	if f.TimeStart != 0 && u.TimeEnd < f.TimeStart {
+		return false
+	}
+	if f.TimeEnd != 0 && u.TimeStart > f.TimeEnd {
+		return false
+	}
+	return true
+}
+
+// 检索结果按采集开始时间排序，相同时按哈希排序
+func uploadLess(a, b *Upload) bool {
+	if a.TimeStart != b.TimeStart {
+		return a.TimeStart < b.TimeStart
+	}
+	return bytes.Compare(a.Hash, b.Hash) < 0
+}
@@ -0,0 +1,93 @@
+package db
+
+import (
+	"testing"
+
+	"github.com/dgraph-io/badger"
+
+	"github.com/azd1997/ecoin/account/role"
+	"github.com/azd1997/ecoin/common/crypto"
+	"github.com/azd1997/ecoin/protocol/core"
+)
+
+func TestGetUploads(t *testing.T) {
+	setup()
+	defer cleanup()
+
+	newID := func(no uint8) crypto.ID {
+		priv, _ := crypto.NewPrivateKeyS256()
+		return crypto.PrivateKey2ID(priv, no)
+	}
+	alice, bob, hospital := newID(role.PATIENT), newID(role.PATIENT), newID(role.HOSPITAL)
+
+	// 上传交易：上传者、数据类型、疾病类型、采集时间区间
+	uploads := []struct {
+		from       crypto.ID
+		typ, ill   uint8
+		start, end int64
+	}{
+		{alice, 1, 1, 100, 200},
+		{alice, 1, 2, 300, 400},
+		{bob, 1, 1, 150, 250},
+		{bob, 2, 1, 500, 600},
+		{alice, 1, 1, 700, 800},
+	}
+	var txs []*core.Tx
+	for i, u := range uploads {
+		ti, err := core.NewTargetInfo("file:///data", u.typ, u.ill, u.start, u.end, [][]byte{{byte(i)}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		tx := &core.Tx{Type: core.TX_UPLOAD, From: u.from, To: hospital, Payload: ti.Encode()}
+		tx.Id = crypto.HashD(append(tx.Payload, byte(i)))
+		txs = append(txs, tx)
+	}
+	b := instance.(*badgerDB)
+	err := b.update(func(txn *badger.Txn) error {
+		for i, tx := range txs {
+			if err := b.putUploadTxn(tx, uint64(i+1), txn); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	u8 := func(v uint8) *uint8 { return &v }
+	cases := []struct {
+		filter *UploadFilter
+		expect []int // 按采集开始时间排序的结果在uploads中的序号
+	}{
+		{&UploadFilter{}, []int{0, 2, 1, 3, 4}},
+		{&UploadFilter{Uploader: alice}, []int{0, 1, 4}},
+		{&UploadFilter{Type: u8(1), Ill: u8(1)}, []int{0, 2, 4}},
+		{&UploadFilter{Ill: u8(1)}, []int{0, 2, 3, 4}},
+		{&UploadFilter{Uploader: bob, Type: u8(2)}, []int{3}},
+		{&UploadFilter{TimeStart: 220, TimeEnd: 550}, []int{2, 1, 3}},
+		{&UploadFilter{Type: u8(1), Ill: u8(1), TimeStart: 210}, []int{2, 4}},
+		{&UploadFilter{Type: u8(3), Ill: u8(1)}, nil},
+	}
+	for i, c := range cases {
+		result, total, err := GetUploads(c.filter, 0, 0)
+		if err != nil || total != len(c.expect) || len(result) != len(c.expect) {
+			t.Fatalf("case %d: expect %d uploads, but %d(total %d), %v", i, len(c.expect), len(result), total, err)
+		}
+		for j, u := range result {
+			expect := txs[c.expect[j]]
+			if string(u.Hash) != string(expect.Id) || u.Uploader != expect.From || u.Height != uint64(c.expect[j]+1) {
+				t.Fatalf("case %d: result %d mismatches upload %d", i, j, c.expect[j])
+			}
+		}
+	}
+
+	// 分页
+	result, total, err := GetUploads(&UploadFilter{}, 1, 2)
+	if err != nil || total != 5 || len(result) != 2 || result[0].TimeStart != 150 || result[1].TimeStart != 300 {
+		t.Fatalf("page [1, 3) = %v, total %d, %v", result, total, err)
+	}
+	if result, total, err = GetUploads(&UploadFilter{}, 5, 2); err != nil || total != 5 || len(result) != 0 {
+		t.Fatalf("page beyond total = %v, total %d, %v", result, total, err)
+	}
+}
@@ -0,0 +1,300 @@
+package storage
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/azd1997/ecoin/common"
+)
+
+// HTTP对象存储的接口，BaseURL为数据仓库地址（TargetInfo.StoreAt）：
+//	GET {BaseURL}/records?start=&end=&num=    返回 {"records": [...]}
+//	GET {BaseURL}/records/count?start=&end=   返回 {"count": n}
+//	GET {BaseURL}/records/sample?start=&end=&num=&index=   返回 {"record": ..., "proof": [...]}，见Sampler
+// 服务端可使用NewHTTPHandler将任意DataStorage以该接口提供出去
+
+// 请求数据仓库的超时时间
+const httpStorageTimeout = 10 * time.Second
+
+type recordsResponse struct {
+	Records [][]byte `json:"records"`
+}
+
+type countResponse struct {
+	Count int `json:"count"`
+}
+
+type sampleResponse struct {
+	Record []byte   `json:"record"`
+	Proof  [][]byte `json:"proof"`
+}
+
+// HTTPStorage HTTP对象存储
+type HTTPStorage struct {
+	BaseURL string
+	client  *http.Client
+	maxBody int64 // 响应体的最大长度，0表示不限
+}
+
+// NewHTTPStorage 以baseURL作为数据仓库地址
+func NewHTTPStorage(baseURL string) *HTTPStorage {
+	return &HTTPStorage{
+		BaseURL: strings.TrimRight(baseURL, "/"),
+		client:  &http.Client{Timeout: httpStorageTimeout},
+	}
+}
+
+// NewRemoteHTTPStorage 以他人提供的baseURL作为数据仓库地址
+// 只连接公网地址（解析域名后逐个检查实际连接的IP），不跟随重定向，不使用代理，响应体最长maxBody字节
+func NewRemoteHTTPStorage(baseURL string, maxBody int64) *HTTPStorage {
+	dialer := &net.Dialer{
+		Timeout: httpStorageTimeout,
+		Control: func(network, address string, _ syscall.RawConn) error {
+			host, _, err := net.SplitHostPort(address)
+			if err != nil {
+				return err
+			}
+			if ip := net.ParseIP(host); ip == nil || !IsPublicIP(ip) {
+				return ErrNonPublicAddr{addr: address}
+			}
+			return nil
+		},
+	}
+	transport := &http.Transport{
+		DialContext: func(ctx context.Context, network, addr string) (net.Conn, error) {
+			return dialer.DialContext(ctx, network, addr)
+		},
+		TLSHandshakeTimeout: httpStorageTimeout,
+	}
+	return &HTTPStorage{
+		BaseURL: strings.TrimRight(baseURL, "/"),
+		client: &http.Client{
+			Timeout:   httpStorageTimeout,
+			Transport: transport,
+			CheckRedirect: func(req *http.Request, via []*http.Request) error {
+				return errRedirect
+			},
+		},
+		maxBody: maxBody,
+	}
+}
+
+var errRedirect = errors.New("redirect is not allowed for remote storage")
+
+// ErrNonPublicAddr 远程数据仓库指向非公网地址
+type ErrNonPublicAddr struct {
+	addr string
+}
+
+func (e ErrNonPublicAddr) Error() string {
+	return fmt.Sprintf("remote storage address %s is not public", e.addr)
+}
+
+// 非公网地址段：本机、私有网络（RFC1918等）、链路本地及保留地址
+var nonPublicNets = func() []*net.IPNet {
+	cidrs := []string{
+		"0.0.0.0/8",
+		"10.0.0.0/8",
+		"100.64.0.0/10",
+		"127.0.0.0/8",
+		"169.254.0.0/16",
+		"172.16.0.0/12",
+		"192.0.0.0/24",
+		"192.168.0.0/16",
+		"198.18.0.0/15",
+		"224.0.0.0/4",
+		"240.0.0.0/4",
+		"::/128",
+		"::1/128",
+		"fc00::/7",
+		"fe80::/10",
+		"ff00::/8",
+	}
+	nets := make([]*net.IPNet, len(cidrs))
+	for i, cidr := range cidrs {
+		_, nets[i], _ = net.ParseCIDR(cidr)
+	}
+	return nets
+}()
+
+// IsPublicIP ip是否为公网地址
+func IsPublicIP(ip net.IP) bool {
+	for _, n := range nonPublicNets {
+		if n.Contains(ip) {
+			return false
+		}
+	}
+	return true
+}
+
+// Get 获取数据记录
+func (hs *HTTPStorage) Get(startTime common.TimeStamp, endTime common.TimeStamp, numsOfRecords uint) (records [][]byte, err error) {
+	resp := &recordsResponse{}
+	if err := hs.get("/records", rangeQuery(startTime, endTime, numsOfRecords), resp); err != nil {
+		return nil, err
+	}
+	return resp.Records, nil
+}
+
+// Query 查询数据记录是否存在
+func (hs *HTTPStorage) Query(startTime common.TimeStamp, endTime common.TimeStamp, numsOfRecords uint) (ok bool, err error) {
+	count, err := hs.Count(startTime, endTime)
+	if err != nil {
+		return false, err
+	}
+	return enough(count, numsOfRecords), nil
+}
+
+// Count 时间在[startTime, endTime]内的记录数
+func (hs *HTTPStorage) Count(startTime common.TimeStamp, endTime common.TimeStamp) (int, error) {
+	resp := &countResponse{}
+	if err := hs.get("/records/count", rangeQuery(startTime, endTime, 0), resp); err != nil {
+		return 0, err
+	}
+	return resp.Count, nil
+}
+
+// Sample 抽取时间区间内最早numsOfRecords条记录中的第index条记录及其默克尔证明
+func (hs *HTTPStorage) Sample(startTime common.TimeStamp, endTime common.TimeStamp, numsOfRecords uint, index uint) (record []byte, proof [][]byte, err error) {
+	query := rangeQuery(startTime, endTime, numsOfRecords)
+	query.Set("index", strconv.FormatUint(uint64(index), 10))
+	resp := &sampleResponse{}
+	if err := hs.get("/records/sample", query, resp); err != nil {
+		return nil, nil, err
+	}
+	return resp.Record, resp.Proof, nil
+}
+
+func (hs *HTTPStorage) IsOk() bool {
+	_, err := hs.Count(0, 0)
+	return err == nil
+}
+
+func (hs *HTTPStorage) get(path string, query url.Values, v interface{}) error {
+	resp, err := hs.client.Get(hs.BaseURL + path + "?" + query.Encode())
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("storage %s%s: %s", hs.BaseURL, path, resp.Status)
+	}
+	var body io.Reader = resp.Body
+	if hs.maxBody > 0 {
+		// 超长的响应被截断，解码失败
+		body = io.LimitReader(resp.Body, hs.maxBody)
+	}
+	return json.NewDecoder(body).Decode(v)
+}
+
+func rangeQuery(startTime, endTime common.TimeStamp, num uint) url.Values {
+	query := url.Values{}
+	query.Set("start", strconv.FormatInt(int64(startTime), 10))
+	query.Set("end", strconv.FormatInt(int64(endTime), 10))
+	if num != 0 {
+		query.Set("num", strconv.FormatUint(uint64(num), 10))
+	}
+	return query
+}
+
+// NewHTTPHandler 将数据仓库ds以HTTP对象存储的接口提供出去
+func NewHTTPHandler(ds DataStorage) http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/records", func(w http.ResponseWriter, r *http.Request) {
+		start, end, num, err := parseRangeQuery(r.URL.Query())
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		records, err := ds.Get(start, end, num)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		writeJSON(w, &recordsResponse{Records: records})
+	})
+	mux.HandleFunc("/records/count", func(w http.ResponseWriter, r *http.Request) {
+		start, end, _, err := parseRangeQuery(r.URL.Query())
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		count, err := countRecords(ds, start, end)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		writeJSON(w, &countResponse{Count: count})
+	})
+	mux.HandleFunc("/records/sample", func(w http.ResponseWriter, r *http.Request) {
+		start, end, num, err := parseRangeQuery(r.URL.Query())
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		index, err := strconv.ParseUint(r.URL.Query().Get("index"), 10, 32)
+		if err != nil {
+			http.Error(w, "invalid index", http.StatusBadRequest)
+			return
+		}
+		record, proof, err := Sample(ds, start, end, num, uint(index))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		writeJSON(w, &sampleResponse{Record: record, Proof: proof})
+	})
+	return mux
+}
+
+// 统计记录数。数据仓库不支持直接统计时，取回全部记录计数
+func countRecords(ds DataStorage, start, end common.TimeStamp) (int, error) {
+	if c, ok := ds.(interface {
+		Count(common.TimeStamp, common.TimeStamp) (int, error)
+	}); ok {
+		return c.Count(start, end)
+	}
+	records, err := ds.Get(start, end, 0)
+	return len(records), err
+}
+
+func parseRangeQuery(query url.Values) (start, end common.TimeStamp, num uint, err error) {
+	parse := func(key string) (int64, error) {
+		v := query.Get(key)
+		if v == "" {
+			return 0, nil
+		}
+		n, err := strconv.ParseInt(v, 10, 64)
+		if err != nil || n < 0 {
+			return 0, fmt.Errorf("invalid %s: %s", key, v)
+		}
+		return n, nil
+	}
+	var s, e, n int64
+	if s, err = parse("start"); err != nil {
+		return
+	}
+	if e, err = parse("end"); err != nil {
+		return
+	}
+	if n, err = parse("num"); err != nil {
+		return
+	}
+	return common.TimeStamp(s), common.TimeStamp(e), uint(n), nil
+}
+
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(v)
+}
@@ -0,0 +1,98 @@
+package storage
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+
+	"github.com/azd1997/ecoin/common"
+)
+
+// LocalStorage 本地文件系统上的数据仓库
+// 每条记录保存为目录Dir下的一个文件，文件名为记录的采集时刻（十进制Unix时间戳）
+type LocalStorage struct {
+	Dir string
+}
+
+// NewLocalStorage 以目录dir作为数据仓库
+func NewLocalStorage(dir string) *LocalStorage {
+	return &LocalStorage{Dir: dir}
+}
+
+// Put 写入采集时刻为t的记录，已存在则覆盖
+func (ls *LocalStorage) Put(t common.TimeStamp, record []byte) error {
+	if err := os.MkdirAll(ls.Dir, 0700); err != nil {
+		return err
+	}
+	return ioutil.WriteFile(ls.path(int64(t)), record, 0600)
+}
+
+// Get 获取数据记录
+func (ls *LocalStorage) Get(startTime common.TimeStamp, endTime common.TimeStamp, numsOfRecords uint) (records [][]byte, err error) {
+	times, err := ls.times()
+	if err != nil {
+		return nil, err
+	}
+	for _, t := range selectTimes(times, startTime, endTime, numsOfRecords) {
+		record, err := ioutil.ReadFile(ls.path(t))
+		if err != nil {
+			return nil, err
+		}
+		records = append(records, record)
+	}
+	return records, nil
+}
+
+// Query 查询数据记录是否存在
+func (ls *LocalStorage) Query(startTime common.TimeStamp, endTime common.TimeStamp, numsOfRecords uint) (ok bool, err error) {
+	count, err := ls.Count(startTime, endTime)
+	if err != nil {
+		return false, err
+	}
+	return enough(count, numsOfRecords), nil
+}
+
+// Count 时间在[startTime, endTime]内的记录数
+func (ls *LocalStorage) Count(startTime common.TimeStamp, endTime common.TimeStamp) (int, error) {
+	times, err := ls.times()
+	if err != nil {
+		return 0, err
+	}
+	return len(selectTimes(times, startTime, endTime, 0)), nil
+}
+
+func (ls *LocalStorage) IsOk() bool {
+	info, err := os.Stat(ls.Dir)
+	return err == nil && info.IsDir()
+}
+
+func (ls *LocalStorage) path(t int64) string {
+	return filepath.Join(ls.Dir, strconv.FormatInt(t, 10))
+}
+
+// 目录下所有记录的采集时刻。文件名不是时间戳的文件忽略
+func (ls *LocalStorage) times() ([]int64, error) {
+	infos, err := ioutil.ReadDir(ls.Dir)
+	if err != nil {
+		return nil, err
+	}
+	var times []int64
+	for _, info := range infos {
+		if info.IsDir() {
+			continue
+		}
+		if t, err := strconv.ParseInt(info.Name(), 10, 64); err == nil {
+			times = append(times, t)
+		}
+	}
+	return times, nil
+}
+
+// 查到count条记录是否满足要求的点数num。num为0时只要求存在记录
+func enough(count int, num uint) bool {
+	if num == 0 {
+		return count > 0
+	}
+	return uint(count) >= num
+}
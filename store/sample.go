@@ -0,0 +1,36 @@
+package storage
+
+import (
+	"fmt"
+
+	"github.com/azd1997/ecoin/common"
+	"github.com/azd1997/ecoin/protocol/core"
+)
+
+// Sampler 支持抽样挑战的数据仓库
+// 返回时间区间[startTime, endTime]内（按时间先后）第index条记录，以及该记录相对于区间内最早numsOfRecords条记录的默克尔证明（见core.SegmentProof）
+// numsOfRecords与Get中的含义相同，为0表示区间内全部记录。上传交易的承诺（core.TargetInfo.Merkle）只包含最早的Num条记录，
+// 证明须基于同样的记录计算，否则区间内有更多记录时证明与承诺不一致
+type Sampler interface {
+	Sample(startTime common.TimeStamp, endTime common.TimeStamp, numsOfRecords uint, index uint) (record []byte, proof [][]byte, err error)
+}
+
+// Sample 从数据仓库ds中抽取时间区间内最早numsOfRecords条记录中的第index条记录及其默克尔证明
+// ds不支持抽样时，取回这些记录再计算证明
+func Sample(ds DataStorage, startTime common.TimeStamp, endTime common.TimeStamp, numsOfRecords uint, index uint) (record []byte, proof [][]byte, err error) {
+	if s, ok := ds.(Sampler); ok {
+		return s.Sample(startTime, endTime, numsOfRecords, index)
+	}
+	records, err := ds.Get(startTime, endTime, numsOfRecords)
+	if err != nil {
+		return nil, nil, err
+	}
+	if index >= uint(len(records)) {
+		return nil, nil, fmt.Errorf("sample index %d out of %d records", index, len(records))
+	}
+	p, err := core.SegmentProof(records, int(index))
+	if err != nil {
+		return nil, nil, err
+	}
+	return records[index], p, nil
+}
@@ -1,6 +1,8 @@
 package storage
 
 import (
+	"fmt"
+
 	"github.com/azd1997/ecoin/common"
 )
 
@@ -13,17 +15,37 @@ type TargetData struct {
 	Storage DataStorage
 }
 
+// NewTargetData 根据上传交易中的数据仓库地址与数据区间构造目标数据
+func NewTargetData(storeAt string, startTime, endTime common.TimeStamp, numsOfRecords uint) (*TargetData, error) {
+	ds, err := Open(storeAt)
+	if err != nil {
+		return nil, err
+	}
+	return &TargetData{
+		StartTime:     startTime,
+		EndTime:       endTime,
+		NumsOfRecords: numsOfRecords,
+		Storage:       ds,
+	}, nil
+}
+
 // IsValid 检查目标数据是否存在可取用
 func (t *TargetData) IsOk() (err error) {
-	// 1. 从TargetData解析索引
-
-	// 2. 检查Storage是否可用
-
-	// 3. 去查询数据是否在指定broker（Storage）中
-	// TODO: 实现DataStorage接口，传入结构体指针，用以查询
-	_, err = t.Storage.Query(t.StartTime, t.EndTime, t.NumsOfRecords)
+	// 1. 检查Storage是否可用
+	if t.Storage == nil || !t.Storage.IsOk() {
+		return fmt.Errorf("storage of target data is unavailable")
+	}
 
-	return err
+	// 2. 去查询数据是否在指定broker（Storage）中
+	ok, err := t.Storage.Query(t.StartTime, t.EndTime, t.NumsOfRecords)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return fmt.Errorf("target data [%d, %d] with %d records not found",
+			t.StartTime, t.EndTime, t.NumsOfRecords)
+	}
+	return nil
 }
 
 // newTargetData 构造targetData